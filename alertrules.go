@@ -0,0 +1,177 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"log"
+	"net/url"
+	"os"
+	"path/filepath"
+)
+
+// ruleGroup is a group of Grafana-managed alert rules, in the format of the
+// rule group provisioning API, stored in
+// alert-rules/<folder UID>/<group title>.json. Interval is the evaluation
+// interval of the group in seconds. Rules are kept as generic JSON, each
+// with folderUID and ruleGroup fields matching the group.
+type ruleGroup struct {
+	Title     string                   `json:"title"`
+	FolderUID string                   `json:"folderUid"`
+	Interval  int64                    `json:"interval"`
+	Rules     []map[string]interface{} `json:"rules"`
+}
+
+// ruleGroupPath returns the file of a rule group in a pulled directory.
+func ruleGroupPath(dir, folderUID, title string) string {
+	return filepath.Join(dir, "alert-rules", folderUID, url.PathEscape(title)+".json")
+}
+
+// ruleGroupFiles returns the rule group files of a pulled directory.
+func ruleGroupFiles(dir string) ([]string, error) {
+	var files []string
+	err := filepath.WalkDir(filepath.Join(dir, "alert-rules"), func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() && filepath.Ext(path) == ".json" {
+			files = append(files, path)
+		}
+		return nil
+	})
+	return files, err
+}
+
+func readRuleGroup(path string) (ruleGroup, error) {
+	var g ruleGroup
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return g, err
+	}
+	err = json.Unmarshal(data, &g)
+	return g, err
+}
+
+func writeRuleGroup(dir string, g ruleGroup) error {
+	data, err := json.MarshalIndent(g, "", "  ")
+	if err != nil {
+		return err
+	}
+	path := ruleGroupPath(dir, g.FolderUID, g.Title)
+	if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+// ruleGroupEndpoint is the path of the provisioning API endpoint of a rule
+// group.
+func ruleGroupEndpoint(folderUID, title string) string {
+	return fmt.Sprintf("/api/v1/provisioning/folder/%s/rule-groups/%s", url.PathEscape(folderUID), url.PathEscape(title))
+}
+
+// pullAlertRules saves the Grafana-managed alert rules of the instance by
+// rule group, in their folder. The alert-rules directory is replaced, so that
+// groups deleted on the instance don't come back on the next push, unless a
+// group could not be fetched: the local files are then only updated.
+func pullAlertRules(ctx context.Context) {
+	fmt.Println("Pulling alert rules...")
+	var rules []struct {
+		FolderUID string `json:"folderUID"`
+		RuleGroup string `json:"ruleGroup"`
+	}
+	if err := getJSON(ctx, "/api/v1/provisioning/alert-rules", &rules); err != nil {
+		pullFailed(ctx, "alert-rules", "fetching alert rules", err)
+		return
+	}
+	seen := make(map[groupKey]bool)
+	var keys []groupKey
+	for _, r := range rules {
+		key := groupKey{r.FolderUID, r.RuleGroup}
+		if !seen[key] {
+			seen[key] = true
+			keys = append(keys, key)
+		}
+	}
+
+	var groups []ruleGroup
+	complete := true
+	for _, key := range keys {
+		if stopped(ctx) {
+			return
+		}
+		var g ruleGroup
+		if err := getJSON(ctx, ruleGroupEndpoint(key.folderUID, key.title), &g); err != nil {
+			log.Printf("Error fetching rule group %s: %s", key, describeError(err))
+			summary.add("alert rules", outcomeFailed, key.String())
+			complete = false
+			continue
+		}
+		for _, rule := range g.Rules {
+			for _, field := range volatileAlertRuleFields {
+				delete(rule, field)
+			}
+		}
+		groups = append(groups, g)
+	}
+
+	if complete {
+		if err := os.RemoveAll(filepath.Join(directory, "alert-rules")); err != nil {
+			log.Printf("Error cleaning alert rules directory: %v", err)
+			summary.add("alert rules", outcomeFailed, "alert-rules")
+			return
+		}
+	}
+	for _, g := range groups {
+		key := groupKey{g.FolderUID, g.Title}
+		if err := writeRuleGroup(directory, g); err != nil {
+			log.Printf("Error saving rule group %s: %v", key, err)
+			summary.add("alert rules", outcomeFailed, key.String())
+			continue
+		}
+		fmt.Printf("Saved rule group: %s (%d rules)\n", key, len(g.Rules))
+	}
+}
+
+// pushAlertRules creates or replaces every local rule group in its folder,
+// which must exist on the instance. Rules keep their UID, rules of the group
+// missing locally are deleted from it.
+func pushAlertRules(ctx context.Context) {
+	fmt.Println("Pushing alert rules...")
+	files, err := ruleGroupFiles(directory)
+	if err != nil {
+		fmt.Println("Error reading alert rules directory:", err)
+		return
+	}
+
+	for _, path := range files {
+		if stopped(ctx) {
+			break
+		}
+		g, err := readRuleGroup(path)
+		if err != nil {
+			log.Printf("Error reading %s: %v", path, err)
+			summary.add("alert rules", outcomeFailed, path)
+			continue
+		}
+		key := groupKey{g.FolderUID, g.Title}
+		for _, rule := range g.Rules {
+			rule["folderUID"] = g.FolderUID
+			rule["ruleGroup"] = g.Title
+		}
+
+		body, err := json.Marshal(g)
+		if err != nil {
+			log.Printf("Error marshalling rule group %s: %v", key, err)
+			continue
+		}
+		if _, err := apiRequest(ctx, "PUT", ruleGroupEndpoint(g.FolderUID, g.Title), body); err != nil {
+			log.Printf("Error pushing rule group %s: %s", key, describeError(err))
+			summary.add("alert rules", outcomeFailed, key.String())
+			continue
+		}
+		printChange("Uploaded rule group: %s (%d rules)\n", key, len(g.Rules))
+		summary.add("alert rules", outcomePushed, key.String())
+	}
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"gopkg.in/yaml.v3"
+)
+
+// uidAliasesFile maps logical dashboard and folder UIDs to their UID in
+// each environment.
+var uidAliasesFile string
+
+// uidAliases holds the UID of every logical name, by environment:
+//
+//	infra-overview:
+//	  dev: abc
+//	  prod: xyz
+//
+// Local files use the logical name as UID. It is replaced by the UID of
+// -environment on push and check, and pulled UIDs are replaced by their
+// logical name, so environments whose UIDs diverged are managed from the
+// same files. Names without a UID for the environment are used as is.
+var uidAliases map[string]map[string]string
+
+// loadUIDAliases reads -uid-aliases and rejects UIDs aliased twice in the
+// same environment, which couldn't be pulled back.
+func loadUIDAliases() error {
+	if environment == "" {
+		return fmt.Errorf("-uid-aliases needs -environment")
+	}
+	data, err := os.ReadFile(uidAliasesFile)
+	if err != nil {
+		return err
+	}
+	if err := yaml.Unmarshal(data, &uidAliases); err != nil {
+		return err
+	}
+	names := make(map[string]string)
+	for name, uids := range uidAliases {
+		uid, ok := uids[environment]
+		if !ok {
+			continue
+		}
+		if other, ok := names[uid]; ok {
+			return fmt.Errorf("UID %s of environment %s is aliased by both %s and %s", uid, environment, other, name)
+		}
+		names[uid] = name
+	}
+	return nil
+}
+
+// environmentUID returns the UID of a logical name in -environment.
+func environmentUID(name string) string {
+	if uid, ok := uidAliases[name][environment]; ok {
+		return uid
+	}
+	return name
+}
+
+// logicalUID returns the logical name of a UID of -environment.
+func logicalUID(uid string) string {
+	for name, uids := range uidAliases {
+		if uids[environment] == uid {
+			return name
+		}
+	}
+	return uid
+}
+
+// aliasDashboardUID replaces the logical UID of a dashboard given as JSON,
+// and those of the dashboards it links to, by their UID in -environment.
+func aliasDashboardUID(data []byte) ([]byte, error) {
+	if len(uidAliases) == 0 {
+		return data, nil
+	}
+	var dashboard map[string]interface{}
+	if err := json.Unmarshal(data, &dashboard); err != nil {
+		return nil, err
+	}
+	if name, ok := dashboard["uid"].(string); ok {
+		dashboard["uid"] = environmentUID(name)
+	}
+	aliasDashboardLinks(dashboard, environmentUID)
+	return json.Marshal(dashboard)
+}
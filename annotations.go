@@ -0,0 +1,291 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	// annotationsFrom and annotationsTo bound the time of the annotations
+	// pulled and pushed, unbounded when empty.
+	annotationsFrom string
+	annotationsTo   string
+)
+
+// annotationPageSize is the number of annotations listed per request.
+const annotationPageSize = 1000
+
+// annotation is an annotation as stored in annotations/annotations.json.
+// Annotations of a dashboard keep its UID, since IDs differ between
+// instances; annotations without one belong to the organization. Times are
+// in milliseconds since the epoch.
+type annotation struct {
+	DashboardUID string   `json:"dashboardUID,omitempty"`
+	PanelID      int      `json:"panelId,omitempty"`
+	Time         int64    `json:"time"`
+	TimeEnd      int64    `json:"timeEnd,omitempty"`
+	Tags         []string `json:"tags,omitempty"`
+	Text         string   `json:"text"`
+}
+
+func (a annotation) validate() error {
+	switch {
+	case a.Time == 0:
+		return errors.New("has no time")
+	case a.TimeEnd != 0 && a.TimeEnd < a.Time:
+		return errors.New("ends before it starts")
+	case a.Text == "":
+		return errors.New("has no text")
+	}
+	return nil
+}
+
+// key identifies an annotation, to skip the ones the instance already has.
+func (a annotation) key() string {
+	return fmt.Sprintf("%s/%d/%d/%d/%s", a.DashboardUID, a.PanelID, a.Time, a.TimeEnd, a.Text)
+}
+
+// parseAnnotationTime parses -from and -to: an RFC 3339 time, a date, or
+// now-<duration> where the duration may be in days, such as now-30d. It
+// returns milliseconds since the epoch, 0 when empty.
+func parseAnnotationTime(value string) (int64, error) {
+	switch {
+	case value == "":
+		return 0, nil
+	case value == "now":
+		return time.Now().UnixMilli(), nil
+	case strings.HasPrefix(value, "now-"):
+		text := strings.TrimPrefix(value, "now-")
+		var d time.Duration
+		var err error
+		if days, ok := strings.CutSuffix(text, "d"); ok {
+			var n int
+			n, err = strconv.Atoi(days)
+			d = time.Duration(n) * 24 * time.Hour
+		} else {
+			d, err = time.ParseDuration(text)
+		}
+		if err != nil {
+			return 0, fmt.Errorf("invalid duration in %q", value)
+		}
+		return time.Now().Add(-d).UnixMilli(), nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t.UnixMilli(), nil
+	}
+	t, err := time.ParseInLocation("2006-01-02", value, time.Local)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time %q, expected RFC 3339, a date or now-<duration>", value)
+	}
+	return t.UnixMilli(), nil
+}
+
+// annotationRange returns -from and -to in milliseconds.
+func annotationRange() (from, to int64, err error) {
+	if from, err = parseAnnotationTime(annotationsFrom); err != nil {
+		return 0, 0, err
+	}
+	if to, err = parseAnnotationTime(annotationsTo); err != nil {
+		return 0, 0, err
+	}
+	if from != 0 && to != 0 && to < from {
+		return 0, 0, errors.New("-to is before -from")
+	}
+	return from, to, nil
+}
+
+// inRange reports whether an annotation starts between from and to.
+func (a annotation) inRange(from, to int64) bool {
+	return (from == 0 || a.Time >= from) && (to == 0 || a.Time <= to)
+}
+
+// listAnnotations returns the annotations of the instance between from and
+// to, leaving out alert annotations. The API returns the most recent
+// annotations first without offset, so pages are requested with an end
+// moved back to the oldest annotation seen.
+func listAnnotations(ctx context.Context, from, to int64) ([]annotation, error) {
+	var annotations []annotation
+	seen := make(map[int]bool)
+	uids := make(map[int]string)
+	for {
+		query := url.Values{"type": {"annotation"}, "limit": {strconv.Itoa(annotationPageSize)}}
+		if from != 0 {
+			query.Set("from", strconv.FormatInt(from, 10))
+		}
+		if to != 0 {
+			query.Set("to", strconv.FormatInt(to, 10))
+		}
+		var page []struct {
+			annotation
+			ID          int `json:"id"`
+			DashboardID int `json:"dashboardId"`
+		}
+		if err := getJSON(ctx, "/api/annotations?"+query.Encode(), &page); err != nil {
+			return nil, err
+		}
+
+		oldest, added := int64(0), 0
+		for _, a := range page {
+			if oldest == 0 || a.Time < oldest {
+				oldest = a.Time
+			}
+			if seen[a.ID] {
+				continue
+			}
+			seen[a.ID] = true
+			added++
+			// Instances older than Grafana 8 only return the dashboard ID
+			if a.DashboardUID == "" && a.DashboardID != 0 {
+				uid, ok := uids[a.DashboardID]
+				if !ok {
+					var found []struct {
+						UID string `json:"uid"`
+					}
+					if err := getJSON(ctx, fmt.Sprintf("/api/search?dashboardIds=%d", a.DashboardID), &found); err != nil {
+						return nil, err
+					}
+					if len(found) > 0 {
+						uid = found[0].UID
+					}
+					uids[a.DashboardID] = uid
+				}
+				a.DashboardUID = uid
+			}
+			annotations = append(annotations, a.annotation)
+		}
+		if len(page) < annotationPageSize || added == 0 {
+			return annotations, nil
+		}
+		to = oldest
+	}
+}
+
+// pullAnnotations saves the annotations between -from and -to.
+func pullAnnotations(ctx context.Context) {
+	fmt.Println("Pulling annotations...")
+	from, to, err := annotationRange()
+	if err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+	annotations, err := listAnnotations(ctx, from, to)
+	if err != nil {
+		log.Fatalf("Error listing annotations: %s", describeError(err))
+	}
+	if annotations == nil {
+		annotations = []annotation{}
+	}
+	if err := writePulledResources(directory, "annotations", annotations); err != nil {
+		fmt.Println("Error saving annotations:", err)
+		return
+	}
+	fmt.Printf("Saved %d annotation(s)\n", len(annotations))
+}
+
+// pushAnnotations recreates the annotations of the file between -from and
+// -to that the instance doesn't have yet, on the dashboard with the same UID.
+// Panel IDs are kept, as they are part of the pushed dashboard. Annotations
+// of a dashboard missing on the instance are reported and skipped.
+func pushAnnotations(ctx context.Context) {
+	fmt.Println("Pushing annotations...")
+	from, to, err := annotationRange()
+	if err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+	var annotations []annotation
+	if err := readResources(directory, "annotations", &annotations); err != nil {
+		fmt.Println("Error reading annotations file:", err)
+		return
+	}
+
+	// Only the time span of the file is compared against the instance
+	var first, last int64
+	for _, a := range annotations {
+		if !a.inRange(from, to) {
+			continue
+		}
+		if first == 0 || a.Time < first {
+			first = a.Time
+		}
+		if a.Time > last {
+			last = a.Time
+		}
+	}
+	if last == 0 {
+		fmt.Println("No annotations to push")
+		return
+	}
+	remote, err := listAnnotations(ctx, first, last)
+	if err != nil {
+		log.Fatalf("Error listing annotations: %s", describeError(err))
+	}
+	existing := make(map[string]bool, len(remote))
+	for _, a := range remote {
+		existing[a.key()] = true
+	}
+
+	dashboardIDs := make(map[string]int)
+	for _, local := range annotations {
+		if stopped(ctx) {
+			break
+		}
+		if !local.inRange(from, to) {
+			continue
+		}
+		var a annotation
+		body, err := pushPayload("annotations", local, &a)
+		name := fmt.Sprintf("%s at %s", strings.SplitN(local.Text, "\n", 2)[0], time.UnixMilli(local.Time).Format(time.RFC3339))
+		if err != nil {
+			fmt.Printf("Error preparing annotation %s: %v\n", name, err)
+			summary.add("annotations", outcomeFailed, name)
+			continue
+		}
+		if existing[a.key()] {
+			summary.add("annotations", outcomeUnchanged, name)
+			continue
+		}
+
+		payload := map[string]interface{}{}
+		json.Unmarshal(body, &payload)
+		if a.DashboardUID != "" {
+			id, ok := dashboardIDs[a.DashboardUID]
+			if !ok {
+				var d struct {
+					Dashboard struct {
+						ID int `json:"id"`
+					} `json:"dashboard"`
+				}
+				if err := getJSON(ctx, "/api/dashboards/uid/"+url.PathEscape(a.DashboardUID), &d); err != nil {
+					log.Printf("Error finding dashboard %s of annotation %s: %s", a.DashboardUID, name, describeError(err))
+				}
+				id = d.Dashboard.ID
+				dashboardIDs[a.DashboardUID] = id
+			}
+			if id == 0 {
+				summary.add("annotations", outcomeFailed, name)
+				continue
+			}
+			// Older instances only know the dashboard ID
+			payload["dashboardId"] = id
+		}
+		body, _ = json.Marshal(payload)
+		data, status, err := doRequest(ctx, "POST", baseURL+"/api/annotations", body)
+		if err == nil && status >= 400 {
+			err = newAPIError(status, data)
+		}
+		if err != nil {
+			log.Printf("Error pushing annotation %s: %s", name, describeError(err))
+			summary.add("annotations", outcomeFailed, name)
+			continue
+		}
+		existing[a.key()] = true
+		printChange("Uploaded annotation: %s\n", name)
+		summary.add("annotations", outcomePushed, name)
+	}
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+)
+
+var apiData string
+
+// apiPassthrough sends an arbitrary API call given as positional arguments,
+// e.g. "GET /api/health", with the tool's credentials and headers, and
+// prints the response body.
+func apiPassthrough(ctx context.Context, args []string) {
+	if len(args) != 2 {
+		fmt.Println("Error: api expects a method and a path, e.g. GET /api/health")
+		os.Exit(1)
+	}
+	method, path := strings.ToUpper(args[0]), args[1]
+	if !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+
+	var body []byte
+	if apiData != "" {
+		if strings.HasPrefix(apiData, "@") {
+			data, err := os.ReadFile(apiData[1:])
+			if err != nil {
+				fmt.Println("Error reading request body:", err)
+				os.Exit(1)
+			}
+			body = data
+		} else {
+			body = []byte(apiData)
+		}
+	}
+
+	data, status, err := doRequest(ctx, method, baseURL+path, body)
+	if err != nil {
+		fmt.Println("Error making request:", err)
+		os.Exit(1)
+	}
+
+	var out bytes.Buffer
+	if json.Indent(&out, data, "", "  ") == nil {
+		data = out.Bytes()
+	}
+	fmt.Println(string(data))
+
+	if status >= 400 {
+		fmt.Fprintf(os.Stderr, "Error: %s %s: %s\n", method, path, describeError(newAPIError(status, data)))
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// apiError is an error response returned by the Grafana API.
+type apiError struct {
+	StatusCode int    `json:"-"`
+	Message    string `json:"message"`
+	Status     string `json:"status"`
+	TraceID    string `json:"traceID"`
+}
+
+// newAPIError decodes a Grafana error body. Bodies that are not JSON are
+// kept as the message.
+func newAPIError(statusCode int, body []byte) *apiError {
+	e := &apiError{StatusCode: statusCode}
+	if err := json.Unmarshal(body, e); err != nil || e.Message == "" {
+		e.Message = strings.TrimSpace(string(body))
+	}
+	if e.Message == "" {
+		e.Message = http.StatusText(statusCode)
+	}
+	return e
+}
+
+func (e *apiError) Error() string {
+	msg := e.Message
+	if e.Status != "" {
+		msg = e.Status + ": " + msg
+	}
+	msg = fmt.Sprintf("%s (HTTP %d)", msg, e.StatusCode)
+	if e.TraceID != "" {
+		msg += ", trace ID " + e.TraceID
+	}
+	return msg
+}
+
+// hint returns a remediation for common errors, or an empty string.
+func (e *apiError) hint() string {
+	switch e.Status {
+	case "version-mismatch":
+		return "the dashboard was changed on the instance since it was pulled; pull it again and reapply the local changes, or check that its uid is not used by another dashboard"
+	case "name-exists":
+		return "a dashboard with the same title already exists in the target folder; rename it or reuse its UID"
+	case "plugin-dashboard":
+		return "the dashboard belongs to a plugin; update the plugin instead of pushing it"
+	}
+
+	switch e.StatusCode {
+	case http.StatusUnauthorized:
+		return "check that the API key is valid and has not expired"
+	case http.StatusForbidden:
+		return "the API key lacks permission for this call; use an Editor or Admin key"
+	case http.StatusNotFound:
+		return "check the Grafana URL and that the resource exists on this instance"
+	case http.StatusConflict:
+		return "the resource already exists; delete it or update it instead of creating it"
+	case http.StatusPreconditionFailed:
+		return "the resource changed on the server since it was exported; pull it again"
+	case http.StatusRequestEntityTooLarge:
+		return "the payload exceeds the server body size limit; set maxBodySize and minify in the configuration file"
+	}
+	return ""
+}
+
+// describeError formats an error for the user, decoding Grafana API errors
+// and appending a remediation hint when one is known.
+func describeError(err error) string {
+	apiErr, ok := asAPIError(err)
+	if !ok {
+		return err.Error()
+	}
+
+	if hint := apiErr.hint(); hint != "" {
+		return apiErr.Error() + " - hint: " + hint
+	}
+	return apiErr.Error()
+}
+
+// asAPIError extracts the API error from errors returned by API calls.
+func asAPIError(err error) (*apiError, bool) {
+	var apiErr *apiError
+	if errors.As(err, &apiErr) {
+		return apiErr, true
+	}
+	return nil, false
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// appPlugins are the IDs of the app plugins, such as grafana-k6-app, whose
+// dashboards are pulled into their own directory and left to the plugin on
+// push and prune.
+var appPlugins stringList
+
+// outcomePluginManaged is recorded for dashboards skipped because an app
+// plugin of -app-plugin ships them.
+const outcomePluginManaged = "plugin managed"
+
+// pluginDashboards returns the app plugin of -app-plugin shipping each
+// dashboard UID of the instance. Plugins that are not installed ship none.
+func pluginDashboards(ctx context.Context) (map[string]string, error) {
+	owners := make(map[string]string)
+	for _, id := range appPlugins {
+		var list []struct {
+			UID     string `json:"uid"`
+			Removed bool   `json:"removed"`
+		}
+		err := getJSON(ctx, "/api/plugins/"+url.PathEscape(id)+"/dashboards", &list)
+		if apiErr, ok := asAPIError(err); ok && apiErr.StatusCode == http.StatusNotFound {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("dashboards of plugin %s: %w", id, err)
+		}
+		for _, d := range list {
+			if d.UID != "" && !d.Removed {
+				owners[d.UID] = id
+			}
+		}
+	}
+	return owners, nil
+}
+
+// pluginDirectory returns the directory, relative to -directory, holding the
+// dashboards of an app plugin. It is laid out like a pulled directory.
+func pluginDirectory(id string) string {
+	return "plugins/" + strings.NewReplacer("/", "-", "\\", "-").Replace(id)
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+)
+
+var (
+	// requireApprovalLabel is the approval marker a push requires, none
+	// when empty.
+	requireApprovalLabel string
+	approvalCommand      string
+	approvalURL          string
+)
+
+// approvalActions push the local directory to -url and can be gated on an
+// approval.
+var approvalActions = map[string]bool{
+	"push":               true,
+	"push-dashboards":    true,
+	"push-datasources":   true,
+	"push-folders":       true,
+	"push-notifications": true,
+}
+
+// diffMarker prefixes the digest line of a diff summary, which the approval
+// check looks for in the posted summary.
+const diffMarker = "grafana-sync-diff:"
+
+// requireApproval refuses the push unless the approval check confirms that
+// the diff summary of this push was posted and approved with
+// -require-approval-label. The summary is printed when the push is refused,
+// so that CI can post it.
+func requireApproval(ctx context.Context) {
+	if !approvalActions[action] {
+		log.Fatalf("Error: require-approval-label is not supported by the %s action", action)
+	}
+	if approvalCommand == "" && approvalURL == "" {
+		log.Fatalf("Error: require-approval-label needs approval-command or approval-url")
+	}
+
+	drifts, err := checkDrift(ctx)
+	if err != nil {
+		log.Fatalf("Error computing the diff summary: %s", describeError(err))
+	}
+	summaryText, digest := diffSummary(drifts)
+
+	approved, err := checkApproval(ctx, summaryText, digest)
+	if err != nil {
+		log.Fatalf("Error checking approval: %v", err)
+	}
+	if !approved {
+		fmt.Printf("Push refused: no %q approval for this diff. Post the summary below and approve it:\n\n%s", requireApprovalLabel, summaryText)
+		os.Exit(1)
+	}
+	fmt.Printf("Found %q approval for diff %s\n", requireApprovalLabel, digest)
+}
+
+// diffSummary describes the dashboard changes of the push, ending with a
+// marker line holding the digest of the changes and the instance. The digest
+// changes with any change to the pushed dashboards, so an approval doesn't
+// carry over to later commits or other instances.
+func diffSummary(drifts []drift) (string, string) {
+	var lines []string
+	for _, d := range drifts {
+		lines = append(lines, fmt.Sprintf("- %s: %s (%s)", d.Reason, d.Title, d.UID))
+	}
+	sort.Strings(lines)
+
+	sum := sha256.Sum256([]byte(baseURL + "\n" + strings.Join(lines, "\n")))
+	digest := hex.EncodeToString(sum[:])[:16]
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "Dashboards to push to %s: %d change(s)\n", baseURL, len(lines))
+	for _, line := range lines {
+		b.WriteString(line + "\n")
+	}
+	fmt.Fprintf(&b, "%s %s\n", diffMarker, digest)
+	return b.String(), digest
+}
+
+// checkApproval asks -approval-command, run with sh -c, then -approval-url, whether the diff
+// with the given digest was approved. The command receives the summary on
+// stdin and the label and digest in GRAFANA_SYNC_* environment variables; it
+// approves by exiting with status 0. The URL is called with label and digest
+// query parameters; it approves by answering 200.
+func checkApproval(ctx context.Context, summaryText, digest string) (bool, error) {
+	if approvalCommand != "" {
+		cmd := shellCommand(ctx, approvalCommand)
+		cmd.Stdin = strings.NewReader(summaryText)
+		cmd.Stdout, cmd.Stderr = os.Stdout, os.Stderr
+		cmd.Env = append(os.Environ(),
+			"GRAFANA_SYNC_APPROVAL_LABEL="+requireApprovalLabel,
+			"GRAFANA_SYNC_DIFF_DIGEST="+digest,
+		)
+		err := cmd.Run()
+		if _, ok := err.(*exec.ExitError); ok {
+			return false, nil
+		}
+		if err != nil {
+			return false, err
+		}
+	}
+
+	if approvalURL != "" {
+		query := url.Values{"label": {requireApprovalLabel}, "digest": {digest}}
+		endpoint := approvalURL
+		if strings.Contains(endpoint, "?") {
+			endpoint += "&" + query.Encode()
+		} else {
+			endpoint += "?" + query.Encode()
+		}
+		req, err := http.NewRequestWithContext(ctx, "GET", endpoint, nil)
+		if err != nil {
+			return false, err
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return false, err
+		}
+		resp.Body.Close()
+		switch resp.StatusCode {
+		case http.StatusOK:
+		case http.StatusForbidden, http.StatusNotFound:
+			return false, nil
+		default:
+			return false, fmt.Errorf("approval URL returned %s", resp.Status)
+		}
+	}
+	return true, nil
+}
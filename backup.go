@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+var (
+	backupBeforePush bool
+	backupDir        string
+)
+
+// backupRunDir is the timestamped directory used by the current run. It has
+// the same layout as a pulled directory, so a backup can be restored with
+// push and -directory pointing at it.
+var (
+	backupRunDir   string
+	backupRunDirMu sync.Mutex
+)
+
+func backupPath(elem ...string) (string, error) {
+	backupRunDirMu.Lock()
+	if backupRunDir == "" {
+		backupRunDir = filepath.Join(backupDir, time.Now().Format("20060102-150405"))
+		fmt.Printf("Backing up remote resources to %s\n", backupRunDir)
+	}
+	backupRunDirMu.Unlock()
+	path := filepath.Join(append([]string{backupRunDir}, elem...)...)
+	return path, os.MkdirAll(filepath.Dir(path), os.ModePerm)
+}
+
+// backupDashboard saves the remote version of a dashboard before it is
+// overwritten. Dashboards that do not exist remotely are skipped.
+func backupDashboard(ctx context.Context, uid string) error {
+	if uid == "" {
+		return nil
+	}
+
+	raw, _, err := client.GetRawDashboardByUID(ctx, uid)
+	if err != nil {
+		if apiErr, ok := asAPIError(err); ok && apiErr.StatusCode == http.StatusNotFound {
+			return nil
+		}
+		return err
+	}
+
+	path, err := backupPath("dashboards", uid+".json")
+	if err != nil {
+		return err
+	}
+	return saveToFile(path, raw)
+}
+
+// backupList saves the remote list of a resource kind before it is pushed,
+// under the same file name used by pull.
+func backupList(ctx context.Context, kind, fileName, endpoint string) error {
+	data, status, err := doRequest(ctx, "GET", baseURL+endpoint, nil)
+	if err != nil {
+		return err
+	}
+	if status >= 400 {
+		return newAPIError(status, data)
+	}
+
+	path, err := backupPath(kind, fileName)
+	if err != nil {
+		return err
+	}
+	return saveToFile(path, data)
+}
@@ -0,0 +1,377 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+
+	"grafana-sync/internal/slugify"
+)
+
+var (
+	// bundleDir is where the bundle action writes bundles.
+	bundleDir string
+	// bundlePath is the bundle directory installed by install-bundle.
+	bundlePath string
+)
+
+// bundleManifestFile describes a bundle, at the root of its directory.
+const bundleManifestFile = "bundle.json"
+
+// bundleManifest lists the content of a bundle: the folder it installs into
+// and the files of its resources, relative to the bundle directory.
+type bundleManifest struct {
+	Folder        folderInfo `json:"folder"`
+	Dashboards    []string   `json:"dashboards"`
+	LibraryPanels []string   `json:"libraryPanels,omitempty"`
+	AlertRules    []string   `json:"alertRules,omitempty"`
+}
+
+// libraryElement is a library panel as stored in a bundle.
+type libraryElement struct {
+	UID         string          `json:"uid"`
+	Name        string          `json:"name"`
+	Kind        int             `json:"kind"`
+	FolderUID   string          `json:"folderUid,omitempty"`
+	FolderTitle string          `json:"folderTitle,omitempty"`
+	Model       json.RawMessage `json:"model"`
+}
+
+// volatileAlertRuleFields are left out of the alert rules of a bundle.
+var volatileAlertRuleFields = []string{"id", "orgID", "updated", "provenance"}
+
+// bundleFolder exports the dashboards of -folder along with the library
+// panels they use and the alert rules of the folder into a bundle directory
+// under -bundle-dir, which install-bundle installs on another instance.
+func bundleFolder(ctx context.Context) {
+	if folder == "" || folder == generalFolder {
+		log.Fatalf("Error: bundle requires -folder, other than %s", generalFolder)
+	}
+	f, err := findFolder(ctx, folder)
+	if err != nil {
+		log.Fatalf("Error: %s", describeError(err))
+	}
+	fmt.Printf("Bundling folder %s...\n", f.Title)
+
+	dir := filepath.Join(bundleDir, f.UID)
+	if err := os.RemoveAll(dir); err != nil {
+		log.Fatalf("Error cleaning bundle directory: %v", err)
+	}
+	m := bundleManifest{Folder: folderInfo{UID: f.UID, Title: f.Title}}
+
+	dashboards, err := client.Search(ctx, searchType(searchTypeDashboard), searchFolderID(f.ID))
+	if err != nil {
+		log.Fatalf("Error searching dashboards: %s", describeError(err))
+	}
+	libraryUIDs := map[string]bool{}
+	slugs := map[string]bool{}
+	for _, db := range dashboards {
+		if stopped(ctx) {
+			return
+		}
+		raw, meta, err := client.GetRawDashboardByUID(ctx, db.UID)
+		if err != nil {
+			log.Fatalf("Error fetching dashboard UID %s: %s", db.UID, describeError(err))
+		}
+		var board map[string]interface{}
+		if err := json.Unmarshal(raw, &board); err != nil {
+			log.Fatalf("Error unmarshalling dashboard UID %s: %v", db.UID, err)
+		}
+		board["id"] = 0
+		for _, panel := range dashboardPanels(board) {
+			if ref, ok := panel["libraryPanel"].(map[string]interface{}); ok {
+				if uid, _ := ref["uid"].(string); uid != "" {
+					libraryUIDs[uid] = true
+				}
+			}
+		}
+
+		slug := meta.Slug
+		if slug == "" {
+			slug = slugify.Slugify(db.Title)
+		}
+		name := filepath.Join("dashboards", slugify.Dedupe(slug, slugs)+".json")
+		if err := writeBundleFile(dir, name, board); err != nil {
+			log.Fatalf("Error saving dashboard UID %s: %v", db.UID, err)
+		}
+		m.Dashboards = append(m.Dashboards, name)
+		fmt.Printf("Bundled dashboard: %s\n", db.Title)
+	}
+
+	for uid := range libraryUIDs {
+		element, err := getLibraryElement(ctx, uid)
+		if err != nil {
+			log.Fatalf("Error fetching library panel %s: %s", uid, describeError(err))
+		}
+		name := filepath.Join("library-panels", uid+".json")
+		if err := writeBundleFile(dir, name, element); err != nil {
+			log.Fatalf("Error saving library panel %s: %v", uid, err)
+		}
+		m.LibraryPanels = append(m.LibraryPanels, name)
+		fmt.Printf("Bundled library panel: %s\n", element.Name)
+	}
+
+	data := sendRequest(ctx, "GET", baseURL+"/api/v1/provisioning/alert-rules", nil)
+	var rules []map[string]interface{}
+	if err := json.Unmarshal(data, &rules); err != nil {
+		log.Fatalf("Error unmarshalling alert rules: %v", err)
+	}
+	for _, rule := range rules {
+		if rule["folderUID"] != f.UID {
+			continue
+		}
+		for _, field := range volatileAlertRuleFields {
+			delete(rule, field)
+		}
+		uid, _ := rule["uid"].(string)
+		name := filepath.Join("alert-rules", uid+".json")
+		if err := writeBundleFile(dir, name, rule); err != nil {
+			log.Fatalf("Error saving alert rule %s: %v", uid, err)
+		}
+		m.AlertRules = append(m.AlertRules, name)
+		fmt.Printf("Bundled alert rule: %s\n", rule["title"])
+	}
+
+	if err := writeBundleFile(dir, bundleManifestFile, m); err != nil {
+		log.Fatalf("Error saving bundle manifest: %v", err)
+	}
+	fmt.Printf("Saved bundle %s: %d dashboard(s), %d library panel(s), %d alert rule(s)\n", dir, len(m.Dashboards), len(m.LibraryPanels), len(m.AlertRules))
+	fmt.Printf("Install it with: grafana-sync --action=install-bundle --bundle=%s --url=<url> --apikey=<apikey>\n", dir)
+}
+
+// installBundle installs the bundle at -bundle: its folder is created when
+// missing, then library panels, dashboards and alert rules are created or
+// updated in it.
+func installBundle(ctx context.Context) {
+	if bundlePath == "" {
+		log.Fatalf("Error: install-bundle requires -bundle")
+	}
+	var m bundleManifest
+	if err := readBundleFile(bundlePath, bundleManifestFile, &m); err != nil {
+		log.Fatalf("Error reading bundle manifest: %v", err)
+	}
+	fmt.Printf("Installing bundle %s into folder %s...\n", bundlePath, m.Folder.Title)
+
+	if err := ensureFolder(ctx, m.Folder); err != nil {
+		log.Fatalf("Error creating folder %s: %s", m.Folder.Title, describeError(err))
+	}
+
+	for _, name := range m.LibraryPanels {
+		if stopped(ctx) {
+			return
+		}
+		var element libraryElement
+		err := readBundleFile(bundlePath, name, &element)
+		if err == nil {
+			err = putLibraryElement(ctx, element, m.Folder.UID)
+		}
+		if err != nil {
+			log.Printf("Error installing library panel %s: %s", name, describeError(err))
+			summary.add("library panels", outcomeFailed, name)
+			continue
+		}
+		summary.add("library panels", outcomePushed, element.Name)
+	}
+
+	for _, name := range m.Dashboards {
+		if stopped(ctx) {
+			return
+		}
+		data, err := os.ReadFile(filepath.Join(bundlePath, name))
+		if err == nil {
+			_, err = saveDashboard(ctx, name, rawBoardRequest{
+				Dashboard:  data,
+				Parameters: setDashboardParams{FolderUID: m.Folder.UID, Overwrite: true},
+			})
+		}
+		if err != nil {
+			log.Printf("Error installing dashboard %s: %s", name, describeError(err))
+			summary.add("dashboards", outcomeFailed, name)
+			continue
+		}
+		summary.add("dashboards", outcomePushed, name)
+	}
+
+	for _, name := range m.AlertRules {
+		if stopped(ctx) {
+			return
+		}
+		var rule map[string]interface{}
+		err := readBundleFile(bundlePath, name, &rule)
+		if err == nil {
+			rule["folderUID"] = m.Folder.UID
+			err = putAlertRule(ctx, rule)
+		}
+		if err != nil {
+			log.Printf("Error installing alert rule %s: %s", name, describeError(err))
+			summary.add("alert rules", outcomeFailed, name)
+			continue
+		}
+		summary.add("alert rules", outcomePushed, fmt.Sprint(rule["title"]))
+	}
+}
+
+// findFolder returns the folder with the given title.
+func findFolder(ctx context.Context, title string) (folderInfo, error) {
+	folders, err := client.GetAllFolders(ctx)
+	if err != nil {
+		return folderInfo{}, err
+	}
+	for _, f := range folders {
+		if f.Title == title {
+			return f, nil
+		}
+	}
+	return folderInfo{}, fmt.Errorf("folder %q not found", title)
+}
+
+// ensureFolder creates a folder, under its parent when it has one, unless a
+// folder with its UID exists.
+func ensureFolder(ctx context.Context, f folderInfo) error {
+	data, status, err := doRequest(ctx, "GET", fmt.Sprintf("%s/api/folders/%s", baseURL, url.PathEscape(f.UID)), nil)
+	if err != nil {
+		return err
+	}
+	if status == http.StatusOK {
+		return nil
+	}
+	if status != http.StatusNotFound {
+		return newAPIError(status, data)
+	}
+
+	_, err = createFolder(ctx, f)
+	return err
+}
+
+// createFolder creates a folder, under its parent when it has one, and
+// returns it as created, with its ID and, when it had none, its UID.
+func createFolder(ctx context.Context, f folderInfo) (folderInfo, error) {
+	body, _ := json.Marshal(folderInfo{UID: f.UID, Title: f.Title, ParentUID: f.ParentUID})
+	data, status, err := doRequest(ctx, "POST", baseURL+"/api/folders", body)
+	if err != nil {
+		return folderInfo{}, err
+	}
+	if status >= 400 {
+		return folderInfo{}, newAPIError(status, data)
+	}
+	var created folderInfo
+	if err := json.Unmarshal(data, &created); err != nil {
+		return folderInfo{}, err
+	}
+	printChange("Created folder: %s\n", f.Title)
+	return created, nil
+}
+
+// getLibraryElement fetches a library panel by UID.
+func getLibraryElement(ctx context.Context, uid string) (libraryElement, error) {
+	var result struct {
+		Result libraryElement `json:"result"`
+	}
+	data, status, err := doRequest(ctx, "GET", fmt.Sprintf("%s/api/library-elements/%s", baseURL, url.PathEscape(uid)), nil)
+	if err != nil {
+		return result.Result, err
+	}
+	if status >= 400 {
+		return result.Result, newAPIError(status, data)
+	}
+	err = json.Unmarshal(data, &result)
+	return result.Result, err
+}
+
+// putLibraryElement creates a library panel in a folder, or updates the
+// library panel with the same UID.
+func putLibraryElement(ctx context.Context, element libraryElement, folderUID string) error {
+	endpoint := fmt.Sprintf("%s/api/library-elements/%s", baseURL, url.PathEscape(element.UID))
+	data, status, err := doRequest(ctx, "GET", endpoint, nil)
+	if err != nil {
+		return err
+	}
+	body := map[string]interface{}{
+		"uid":       element.UID,
+		"name":      element.Name,
+		"kind":      element.Kind,
+		"model":     element.Model,
+		"folderUid": folderUID,
+	}
+
+	method := "POST"
+	switch {
+	case status == http.StatusNotFound:
+		endpoint = baseURL + "/api/library-elements"
+	case status >= 400:
+		return newAPIError(status, data)
+	default:
+		// Updates must carry the current version
+		var existing struct {
+			Result struct {
+				Version int `json:"version"`
+			} `json:"result"`
+		}
+		if err := json.Unmarshal(data, &existing); err != nil {
+			return err
+		}
+		method = "PATCH"
+		body["version"] = existing.Result.Version
+	}
+
+	payload, _ := json.Marshal(body)
+	if data, status, err = doRequest(ctx, method, endpoint, payload); err != nil {
+		return err
+	}
+	if status >= 400 {
+		return newAPIError(status, data)
+	}
+	return nil
+}
+
+// putAlertRule creates an alert rule, or updates the alert rule with the
+// same UID.
+func putAlertRule(ctx context.Context, rule map[string]interface{}) error {
+	uid, _ := rule["uid"].(string)
+	endpoint := fmt.Sprintf("%s/api/v1/provisioning/alert-rules/%s", baseURL, url.PathEscape(uid))
+	data, status, err := doRequest(ctx, "GET", endpoint, nil)
+	if err != nil {
+		return err
+	}
+	method := "PUT"
+	switch {
+	case status == http.StatusNotFound:
+		method, endpoint = "POST", baseURL+"/api/v1/provisioning/alert-rules"
+	case status >= 400:
+		return newAPIError(status, data)
+	}
+
+	payload, _ := json.Marshal(rule)
+	if data, status, err = doRequest(ctx, method, endpoint, payload); err != nil {
+		return err
+	}
+	if status >= 400 {
+		return newAPIError(status, data)
+	}
+	return nil
+}
+
+func writeBundleFile(dir, name string, v interface{}) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(dir, name)
+	if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+func readBundleFile(dir, name string, v interface{}) error {
+	data, err := os.ReadFile(filepath.Join(dir, name))
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// changedOnly skips on push the resources whose normalized content is the
+// same as on the instance, so that re-runs don't add saves to the audit
+// trail and version history.
+var changedOnly bool
+
+// outcomeUnchanged records the resources skipped by -changed-only.
+const outcomeUnchanged = "unchanged"
+
+// remoteState holds the resources of a kind on the instance, by
+// resourceKey. A nil remoteState finds nothing unchanged.
+type remoteState map[string]resource
+
+// loadRemoteState fetches the resources of a kind when -changed-only is
+// set.
+func loadRemoteState(ctx context.Context, kind string) (remoteState, error) {
+	if !changedOnly {
+		return nil, nil
+	}
+	return fetchRemoteState(ctx, kind)
+}
+
+// fetchRemoteState fetches the resources of a kind on the instance.
+func fetchRemoteState(ctx context.Context, kind string) (remoteState, error) {
+	var items []resource
+	switch kind {
+	case "datasources":
+		var list []datasource
+		if err := getJSON(ctx, "/api/datasources", &list); err != nil {
+			return nil, err
+		}
+		for _, item := range list {
+			items = append(items, item)
+		}
+	case "folders":
+		list, err := client.GetAllFolders(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, item := range list {
+			item.ID = 0
+			items = append(items, item)
+		}
+	case "notifications":
+		var list []notificationChannel
+		if err := getJSON(ctx, "/api/alert-notifications", &list); err != nil {
+			return nil, err
+		}
+		for _, item := range list {
+			items = append(items, item)
+		}
+	default:
+		return nil, fmt.Errorf("%s can't be compared with the instance", kind)
+	}
+
+	state := make(remoteState, len(items))
+	for _, item := range items {
+		state[resourceKey(item)] = item
+	}
+	return state, nil
+}
+
+// unchanged reports whether a resource about to be pushed is the same as
+// on the instance. Resources carrying secrets are never unchanged, since
+// the instance doesn't return them. The UID Grafana gave a datasource is
+// ignored when the local datasource has none.
+func (s remoteState) unchanged(r resource) bool {
+	remote, ok := s[resourceKey(r)]
+	if !ok {
+		return false
+	}
+	switch r := r.(type) {
+	case datasource:
+		if len(r.SecureJSONData) > 0 {
+			return false
+		}
+		if ds, ok := remote.(datasource); ok && r.UID == "" {
+			ds.UID = ""
+			remote = ds
+		}
+	case notificationChannel:
+		if len(r.SecureSettings) > 0 {
+			return false
+		}
+	}
+	return resourceHash(remote) == resourceHash(r)
+}
+
+// datasource returns the datasource of the instance a local datasource
+// saves to: the one with its name, or else the one with its UID.
+func (s remoteState) datasource(ds datasource) (datasource, bool) {
+	if remote, ok := s[ds.Name].(datasource); ok {
+		return remote, true
+	}
+	if ds.UID == "" {
+		return datasource{}, false
+	}
+	for _, r := range s {
+		if remote, ok := r.(datasource); ok && remote.UID == ds.UID {
+			return remote, true
+		}
+	}
+	return datasource{}, false
+}
+
+// resourceKey identifies a resource across instances: datasources by name,
+// folders and notification channels by UID, or by title and name when they
+// have none.
+func resourceKey(r resource) string {
+	switch r := r.(type) {
+	case datasource:
+		return r.Name
+	case folderInfo:
+		if r.UID != "" {
+			return r.UID
+		}
+		return "title:" + r.Title
+	case notificationChannel:
+		if r.UID != "" {
+			return r.UID
+		}
+		return "name:" + r.Name
+	}
+	return ""
+}
+
+// resourceHash returns the hash of the JSON of a resource, whose fields
+// are written in a fixed order.
+func resourceHash(r resource) string {
+	data, _ := json.Marshal(r)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// getJSON decodes the response of a GET on an API path into out.
+func getJSON(ctx context.Context, path string, out interface{}) error {
+	data, status, err := doRequest(ctx, "GET", baseURL+path, nil)
+	if err != nil {
+		return err
+	}
+	if status >= 400 {
+		return newAPIError(status, data)
+	}
+	return json.Unmarshal(data, out)
+}
+
+// dashboardUnchanged reports whether a dashboard about to be saved with the
+// given parameters is already in their folder with the same normalized
+// content.
+func dashboardUnchanged(ctx context.Context, uid string, data []byte, params setDashboardParams) (bool, error) {
+	if !changedOnly || uid == "" {
+		return false, nil
+	}
+	remote, meta, err := client.GetRawDashboardByUID(ctx, uid)
+	if apiErr, ok := asAPIError(err); ok && apiErr.StatusCode == http.StatusNotFound {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if params.FolderUID != "" && meta.FolderUID != params.FolderUID || params.FolderUID == "" && meta.FolderID != params.FolderID {
+		return false, nil
+	}
+	local, err := dashboardHash(data)
+	if err != nil {
+		return false, err
+	}
+	current, err := dashboardHash(remote)
+	return err == nil && local == current, err
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+)
+
+// Reasons a local dashboard drifted from the instance.
+const (
+	driftMissing = "missing"
+	driftChanged = "changed"
+)
+
+// drift describes a local dashboard whose remote state differs.
+type drift struct {
+	UID    string `json:"uid"`
+	Title  string `json:"title"`
+	File   string `json:"file"`
+	Reason string `json:"reason"`
+}
+
+// checkDrift compares every local dashboard with its remote version. Unlike
+// most actions it returns errors instead of exiting, so it can be run
+// repeatedly by the daemon.
+func checkDrift(ctx context.Context) ([]drift, error) {
+	files, err := dashboardSources()
+	if err != nil {
+		return nil, err
+	}
+
+	var drifts []drift
+	for _, filePath := range files {
+		data, err := loadDashboard(filePath)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", filePath, err)
+		}
+		var dashboard struct {
+			UID   string `json:"uid"`
+			Title string `json:"title"`
+		}
+		if err := json.Unmarshal(data, &dashboard); err != nil {
+			return nil, fmt.Errorf("%s: %w", filePath, err)
+		}
+		local, err := normalizeDashboard(data)
+		if err != nil {
+			return nil, err
+		}
+		d := drift{UID: dashboard.UID, Title: dashboard.Title, File: filepath.Base(filePath)}
+
+		raw, _, err := client.GetRawDashboardByUID(ctx, dashboard.UID)
+		if err != nil {
+			if apiErr, ok := asAPIError(err); ok && apiErr.StatusCode == http.StatusNotFound {
+				d.Reason = driftMissing
+				drifts = append(drifts, d)
+				continue
+			}
+			return nil, err
+		}
+		// Fields left out on pull are not managed, so they don't count as
+		// drift. Local files are already filtered.
+		raw, err = filterDashboardFields(raw)
+		if err != nil {
+			return nil, err
+		}
+		remote, err := normalizeDashboard(raw)
+		if err != nil {
+			return nil, err
+		}
+		if !bytes.Equal(local, remote) {
+			d.Reason = driftChanged
+			drifts = append(drifts, d)
+		}
+	}
+	return drifts, nil
+}
+
+// checkDashboards reports drift between local dashboards and the instance and
+// exits with a non-zero status when there is any.
+func checkDashboards(ctx context.Context) {
+	fmt.Println("Checking dashboards...")
+	drifts, err := checkDrift(ctx)
+	if err != nil {
+		log.Fatalf("Error checking dashboards: %s", describeError(err))
+	}
+
+	for _, d := range drifts {
+		fmt.Printf("  %s: %s - %s (%s)\n", d.Reason, d.Title, d.UID, d.File)
+	}
+	if len(drifts) > 0 {
+		fmt.Printf("Found %d drifted dashboard(s)\n", len(drifts))
+		os.Exit(1)
+	}
+	fmt.Println("No drift found")
+}
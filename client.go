@@ -0,0 +1,333 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"grafana-sync/internal/slugify"
+)
+
+// grafanaClient is a thin client of the Grafana HTTP API. It implements the
+// typed calls the tool makes often and leaves everything else, including
+// endpoints of recent Grafana versions, to Do.
+type grafanaClient struct {
+	baseURL string
+	apiKey  string
+	// credentials renews the token of clients without a fixed API key.
+	credentials credentialProvider
+}
+
+// newGrafanaClient returns a client of an instance. Without an API key, the
+// client takes its tokens from -apikey-command or -apikey-file.
+func newGrafanaClient(baseURL, apiKey string) *grafanaClient {
+	c := &grafanaClient{baseURL: strings.TrimSuffix(baseURL, "/"), apiKey: apiKey}
+	if apiKey == "" {
+		c.credentials = apiKeyProvider
+	}
+	return c
+}
+
+// pageSize is the number of results requested per page from paginated
+// endpoints.
+const pageSize = 1000
+
+// searchTypeDashboard restricts a search to dashboards.
+const searchTypeDashboard = "dash-db"
+
+// searchParam sets a query parameter of /api/search.
+type searchParam func(url.Values)
+
+func searchType(t string) searchParam {
+	return func(v url.Values) { v.Set("type", t) }
+}
+
+func searchFolderID(id int) searchParam {
+	return func(v url.Values) { v.Add("folderIds", strconv.Itoa(id)) }
+}
+
+func searchFolderUID(uid string) searchParam {
+	return func(v url.Values) { v.Add("folderUIDs", uid) }
+}
+
+func searchDashboardUID(uid string) searchParam {
+	return func(v url.Values) { v.Add("dashboardUIDs", uid) }
+}
+
+func searchTag(tag string) searchParam {
+	return func(v url.Values) { v.Add("tag", tag) }
+}
+
+func searchSort(option string) searchParam {
+	return func(v url.Values) { v.Set("sort", option) }
+}
+
+// foundBoard is a search result.
+type foundBoard struct {
+	ID          int      `json:"id"`
+	UID         string   `json:"uid"`
+	Title       string   `json:"title"`
+	URL         string   `json:"url"`
+	Type        string   `json:"type"`
+	Tags        []string `json:"tags"`
+	FolderID    int      `json:"folderId"`
+	FolderUID   string   `json:"folderUid"`
+	FolderTitle string   `json:"folderTitle"`
+	// SortMeta is the value results are sorted by, for sort options
+	// that have one.
+	SortMeta json.RawMessage `json:"sortMeta,omitempty"`
+}
+
+// link returns the path of the dashboard on the instance, /d/<uid>/<slug>,
+// building it when Grafana left the slug out of the URL.
+func (b foundBoard) link() string {
+	if b.URL != "" && !strings.HasSuffix(b.URL, "/") {
+		return b.URL
+	}
+	return "/d/" + b.UID + "/" + slugify.Slugify(b.Title)
+}
+
+// boardProperties is the metadata returned along with a dashboard.
+type boardProperties struct {
+	Slug        string    `json:"slug"`
+	URL         string    `json:"url"`
+	Version     int       `json:"version"`
+	UpdatedBy   string    `json:"updatedBy"`
+	Provisioned bool      `json:"provisioned"`
+	FolderID    int       `json:"folderId"`
+	FolderUID   string    `json:"folderUid"`
+	FolderTitle string    `json:"folderTitle"`
+	Updated     time.Time `json:"updated"`
+}
+
+// rawBoardRequest saves a dashboard given as JSON.
+type rawBoardRequest struct {
+	Dashboard  []byte
+	Parameters setDashboardParams
+}
+
+type setDashboardParams struct {
+	FolderID  int
+	FolderUID string
+	Overwrite bool
+	Message   string
+}
+
+// statusMessage is the response to a dashboard save.
+type statusMessage struct {
+	ID      int    `json:"id"`
+	UID     string `json:"uid"`
+	URL     string `json:"url"`
+	Status  string `json:"status"`
+	Version int    `json:"version"`
+	Slug    string `json:"slug"`
+}
+
+// folderInfo is a folder as listed by /api/folders.
+type folderInfo struct {
+	ID        int    `json:"id,omitempty"`
+	UID       string `json:"uid"`
+	Title     string `json:"title"`
+	ParentUID string `json:"parentUid,omitempty"`
+}
+
+func (c *grafanaClient) Do(ctx context.Context, method, url string, body []byte) ([]byte, int, error) {
+	if requestTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, requestTimeout)
+		defer cancel()
+	}
+	for attempt := 0; ; attempt++ {
+		key := c.apiKey
+		if c.credentials != nil {
+			var err error
+			if key, err = c.credentials.token(); err != nil {
+				return nil, 0, err
+			}
+		}
+		req, err := http.NewRequestWithContext(ctx, method, url, bytes.NewBuffer(body))
+		if err != nil {
+			return nil, 0, err
+		}
+		req.Header.Set("Authorization", "Bearer "+key)
+		if len(body) > 0 {
+			req.Header.Set("Content-Type", "application/json")
+		}
+
+		resp, err := httpClient.Do(req)
+		if err != nil {
+			return nil, 0, err
+		}
+		data, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+
+		// A token that expired during the run is renewed, and the call
+		// retried once
+		if resp.StatusCode == http.StatusUnauthorized && c.credentials != nil && attempt == 0 {
+			if err := c.credentials.refresh(key); err != nil {
+				return nil, 0, err
+			}
+			continue
+		}
+		return data, resp.StatusCode, err
+	}
+}
+
+// call performs a request on an API path and decodes the JSON response into
+// out, when not nil. Error statuses are returned as *apiError.
+func (c *grafanaClient) call(ctx context.Context, method, path string, query url.Values, in, out interface{}) error {
+	endpoint := c.baseURL + path
+	if len(query) > 0 {
+		endpoint += "?" + query.Encode()
+	}
+	var body []byte
+	if in != nil {
+		var err error
+		if body, err = json.Marshal(in); err != nil {
+			return err
+		}
+	}
+
+	data, status, err := c.Do(ctx, method, endpoint, body)
+	if err != nil {
+		return err
+	}
+	if status >= 400 {
+		return newAPIError(status, data)
+	}
+	if out == nil {
+		return nil
+	}
+	if err := json.Unmarshal(data, out); err != nil {
+		return fmt.Errorf("%s %s: %w", method, path, err)
+	}
+	return nil
+}
+
+func (c *grafanaClient) Search(ctx context.Context, params ...searchParam) ([]foundBoard, error) {
+	query := url.Values{}
+	for _, p := range params {
+		p(query)
+	}
+	query.Set("limit", strconv.Itoa(pageSize))
+
+	// Pages are fetched in batches of the search concurrency, until a page
+	// comes back short
+	var results []foundBoard
+	for first := 1; ; first += concurrency("search") {
+		pages := make([][]foundBoard, concurrency("search"))
+		errs := make([]error, len(pages))
+		var wg sync.WaitGroup
+		for i := range pages {
+			pageQuery := url.Values{}
+			for k, v := range query {
+				pageQuery[k] = v
+			}
+			pageQuery.Set("page", strconv.Itoa(first+i))
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				errs[i] = c.call(ctx, "GET", "/api/search", pageQuery, nil, &pages[i])
+			}(i)
+		}
+		wg.Wait()
+		for i, found := range pages {
+			if errs[i] != nil {
+				return nil, errs[i]
+			}
+			results = append(results, found...)
+			if len(found) < pageSize {
+				return results, nil
+			}
+		}
+	}
+}
+
+func (c *grafanaClient) GetRawDashboardByUID(ctx context.Context, uid string) ([]byte, boardProperties, error) {
+	var result struct {
+		Dashboard json.RawMessage `json:"dashboard"`
+		Meta      boardProperties `json:"meta"`
+	}
+	err := c.call(ctx, "GET", "/api/dashboards/uid/"+url.PathEscape(uid), nil, nil, &result)
+	return result.Dashboard, result.Meta, err
+}
+
+func (c *grafanaClient) SetRawDashboardWithParam(ctx context.Context, request rawBoardRequest) (statusMessage, error) {
+	var status statusMessage
+	err := c.call(ctx, "POST", "/api/dashboards/db", nil, dashboardSaveBody(request), &status)
+	return status, err
+}
+
+// dashboardSaveBody returns the body of the request saving a dashboard.
+func dashboardSaveBody(request rawBoardRequest) map[string]interface{} {
+	body := map[string]interface{}{
+		"dashboard": json.RawMessage(request.Dashboard),
+		"folderId":  request.Parameters.FolderID,
+		"overwrite": request.Parameters.Overwrite,
+	}
+	if request.Parameters.FolderUID != "" {
+		body["folderUid"] = request.Parameters.FolderUID
+	}
+	if request.Parameters.Message != "" {
+		body["message"] = request.Parameters.Message
+	}
+	return body
+}
+
+// GetAllFolders returns every folder, including the subfolders of the nested
+// folders of Grafana 10+, which are listed after their parent with their
+// ParentUID set.
+func (c *grafanaClient) GetAllFolders(ctx context.Context) ([]folderInfo, error) {
+	folders, err := c.listFolders(ctx, "")
+	if err != nil {
+		return nil, err
+	}
+	for i := 0; i < len(folders); i++ {
+		parent := folders[i].UID
+		children, err := c.listFolders(ctx, parent)
+		if err != nil {
+			return nil, err
+		}
+		// Instances without nested folders ignore parentUid and list the
+		// top level folders again, the parent among them
+		for _, child := range children {
+			if child.UID == parent {
+				return folders, nil
+			}
+		}
+		for _, child := range children {
+			child.ParentUID = parent
+			folders = append(folders, child)
+		}
+	}
+	return folders, nil
+}
+
+// listFolders returns the subfolders of a folder, the top level folders when
+// parentUID is empty.
+func (c *grafanaClient) listFolders(ctx context.Context, parentUID string) ([]folderInfo, error) {
+	query := url.Values{"limit": {strconv.Itoa(pageSize)}}
+	if parentUID != "" {
+		query.Set("parentUid", parentUID)
+	}
+	var folders []folderInfo
+	for page := 1; ; page++ {
+		query.Set("page", strconv.Itoa(page))
+		var found []folderInfo
+		if err := c.call(ctx, "GET", "/api/folders", query, nil, &found); err != nil {
+			return nil, err
+		}
+		folders = append(folders, found...)
+		if len(found) < pageSize {
+			return folders, nil
+		}
+	}
+}
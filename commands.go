@@ -0,0 +1,201 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// command is a subcommand of the command line, such as
+// "grafana-sync pull dashboards", running an action with its own flags.
+type command struct {
+	name    string
+	action  string
+	summary string
+	flags   []string
+}
+
+// globalFlags are accepted by every command.
+var globalFlags = []string{
+	"apikey", "apikey-command", "apikey-file", "apikey-refresh", "url", "directory", "config", "profile",
+	"org-id", "debug-http", "user-agent", "log-requests", "rate-limit", "concurrency", "deadline", "request-timeout",
+	"require-role", "acting-user", "acting-user-header",
+}
+
+var (
+	pullFlags = []string{"folder", "tag", "uid", "uid-file", "match", "exclude", "group-by-team", "uses-datasource-type", "uid-aliases", "environment", "enterprise", "app-plugin", "required"}
+	pushFlags = []string{
+		"folder", "tag", "uid", "uid-file", "match", "exclude", "backup-before-push", "backup-dir", "transform", "changed-only",
+		"guardrails", "max-panels", "max-json-size", "max-queries-per-panel",
+		"convert-datasource-refs", "default-datasource", "read-only", "panel",
+		"prune", "prune-scope", "prune-kinds", "datasource-overrides", "environment", "uid-aliases", "translations", "language",
+		"require-approval-label", "approval-command", "approval-url", "uses-datasource-type", "enterprise", "app-plugin", "dry-run",
+		"max-body-size", "strict-folders",
+	}
+	guardrailFlags = []string{"guardrails", "max-panels", "max-json-size", "max-queries-per-panel"}
+)
+
+// commands lists the subcommands in the order of the help.
+var commands = []command{
+	{"pull", "pull", "Pull dashboards, library panels, datasources, folders and notification channels", pullFlags},
+	{"pull dashboards", "pull-dashboards", "Pull dashboards", pullFlags},
+	{"pull datasources", "pull-datasources", "Pull datasources", []string{"match", "exclude", "enterprise"}},
+	{"pull folders", "pull-folders", "Pull folders", []string{"uid-aliases", "environment"}},
+	{"pull notifications", "pull-notifications", "Pull legacy notification channels", nil},
+	{"pull library-panels", "pull-library-panels", "Pull library panels", nil},
+	{"pull playlists", "pull-playlists", "Pull playlists", nil},
+	{"pull teams", "pull-teams", "Pull teams with their members and preferences", nil},
+	{"pull org-users", "pull-org-users", "Pull the users of the organization with their roles", nil},
+	{"pull snapshots", "pull-snapshots", "Pull dashboard snapshots with their content", nil},
+	{"pull annotations", "pull-annotations", "Pull annotations between -from and -to", []string{"from", "to"}},
+	{"pull service-accounts", "pull-service-accounts", "Pull service accounts with their role and token metadata", nil},
+	{"pull alert-rules", "pull-alert-rules", "Pull Grafana-managed alert rules by rule group", nil},
+	{"pull contact-points", "pull-contact-points", "Pull unified alerting contact points", nil},
+	{"pull mute-timings", "pull-mute-timings", "Pull unified alerting mute timings", nil},
+	{"pull all-orgs", "pull-all-orgs", "Pull every organization into its own org-<id> directory", pullFlags},
+	{"pull sources", "pull-sources", "Pull every source instance of the merge section of the config file", pullFlags},
+	{"push", "push", "Push library panels, dashboards, datasources, folders and notification channels", pushFlags},
+	{"push dashboards", "push-dashboards", "Push dashboards", pushFlags},
+	{"push datasources", "push-datasources", "Push datasources", pushFlags},
+	{"push folders", "push-folders", "Push folders", pushFlags},
+	{"push notifications", "push-notifications", "Push legacy notification channels", pushFlags},
+	{"push library-panels", "push-library-panels", "Push library panels", pushFlags},
+	{"push playlists", "push-playlists", "Push playlists, remapping their dashboards", pushFlags},
+	{"push teams", "push-teams", "Push teams with their members and preferences", pushFlags},
+	{"push org-users", "push-org-users", "Push the roles of the users of the organization", pushFlags},
+	{"push snapshots", "push-snapshots", "Push the snapshots missing on the instance, keeping their key", pushFlags},
+	{"push annotations", "push-annotations", "Push the annotations missing on the instance", append([]string{"from", "to"}, pushFlags...)},
+	{"push service-accounts", "push-service-accounts", "Push service accounts, creating their missing tokens", append([]string{"token-file"}, pushFlags...)},
+	{"push alert-rules", "push-alert-rules", "Push Grafana-managed alert rules by rule group", pushFlags},
+	{"push contact-points", "push-contact-points", "Push unified alerting contact points", pushFlags},
+	{"push mute-timings", "push-mute-timings", "Push unified alerting mute timings", pushFlags},
+	{"push routes", "push-routes", "Push every directory of the routes of the config file to its profile", pushFlags},
+	{"push merged", "push-merged", "Push the sources pulled by pull sources, merged", pushFlags},
+	{"validate", "validate", "Validate the local files", guardrailFlags},
+	{"extract-strings", "extract-strings", "Extract the translatable strings of the dashboards", []string{"translations"}},
+	{"build", "build", "Build composed dashboards", []string{"output"}},
+	{"extract-library-panels", "extract-library-panels", "Extract panels into library panels", []string{"folder", "panel-title"}},
+	{"check", "check", "Report drift between local and remote dashboards", []string{"transform", "uid-aliases", "environment"}},
+	{"diff", "diff", "Print a unified diff between the instance and the local dashboards, datasources and folders", []string{"transform", "uid-aliases", "environment", "datasource-overrides", "translations", "language"}},
+	{"diff-dirs", "diff-dirs", "Print a unified diff between two pulled directories, without an instance", []string{"compare-directory"}},
+	{"verify", "verify", "Verify local and remote dashboards against the pull manifest", nil},
+	{"daemon", "daemon", "Check drift periodically and serve metrics", []string{"interval", "listen", "drift-webhook", "webhook-log", "webhook-token", "reconcile-command", "transform", "grpc-listen", "control-token", "leader-election", "leader-election-namespace", "uid-aliases", "environment", "watch-config"}},
+	{"nightly", "nightly", "Export the instance into a dated archive", append([]string{"archive-dir", "keep", "digest-webhook", "smtp-server", "mail-from", "mail-to"}, pullFlags...)},
+	{"split", "split", "Split a pull between the targets of the config file", []string{"split-dir"}},
+	{"bundle", "bundle", "Bundle the dashboards of a folder", []string{"folder", "bundle-dir"}},
+	{"install-bundle", "install-bundle", "Install a bundle", []string{"bundle", "max-body-size"}},
+	{"copy", "copy", "Copy the dashboards of a folder into another folder of the instance, or copy an instance to another", []string{"from-folder", "to-folder", "suffix", "source-url", "source-apikey", "dest-url", "dest-apikey", "datasource-overrides", "environment", "dry-run", "max-body-size"}},
+	{"promote", "promote", "Promote the dashboards of a folder from one profile to another after confirming the changes", []string{"from", "to", "folder", "yes", "transform", "translations", "language", "convert-datasource-refs", "default-datasource", "read-only", "dry-run"}},
+	{"freeze", "freeze", "Make the dashboards of a folder view-only until unfreeze", []string{"folder", "duration"}},
+	{"unfreeze", "unfreeze", "Restore the permissions of a frozen folder, or of the folders whose freeze expired", []string{"folder"}},
+	{"rebalance-rule-groups", "rebalance-rule-groups", "Reorganize the local alert rule groups", nil},
+	{"report", "report", "Print a report", []string{"report", "compare-directory", "format", "alert-labels", "stale-days", "tag-stale"}},
+	{"stats", "stats", "Print statistics of the local dashboards, alert rules and datasources", []string{"folder", "pushgateway", "pushgateway-job"}},
+	{"api", "api", "Call the Grafana API with a METHOD and a PATH given after the command", []string{"data"}},
+	{"bootstrap-service-account", "bootstrap-service-account", "Create a service account and a token for sync runs, with admin credentials", []string{"service-account-name", "service-account-role", "service-account-team", "token-ttl", "token-file"}},
+	{"mock-server", "mock-server", "Serve a fake Grafana API seeded from the directory", []string{"listen"}},
+}
+
+var (
+	// commandLine holds the flags of the run, the ones of the command
+	// when a command is given instead of -action.
+	commandLine = flag.CommandLine
+	// commandArgs are the positional arguments of the command.
+	commandArgs []string
+)
+
+// parseCommandLine parses the arguments, either as a command followed by
+// its flags, such as "pull dashboards -folder=Infra", or as flags alone,
+// the action being given with -action. Global flags may also come before
+// the command.
+func parseCommandLine() {
+	args := os.Args[1:]
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+		flag.Usage = printUsage
+		flag.Parse()
+		commandArgs = flag.Args()
+		if len(commandArgs) == 0 || flagsSet()["action"] {
+			return
+		}
+		if cmd, _ := findCommand(commandArgs[:1]); cmd == nil {
+			return
+		}
+		args = commandArgs
+	}
+	parseCommand(args)
+}
+
+// parseCommand parses a command followed by its flags.
+func parseCommand(args []string) {
+	if args[0] == "help" {
+		printUsage()
+		os.Exit(0)
+	}
+
+	var words []string
+	for _, arg := range args {
+		if strings.HasPrefix(arg, "-") {
+			break
+		}
+		words = append(words, arg)
+	}
+	cmd, n := findCommand(words)
+	if cmd == nil {
+		fmt.Fprintf(os.Stderr, "Error: unknown command %q, run 'grafana-sync help' for the list of commands\n", strings.Join(words, " "))
+		os.Exit(2)
+	}
+
+	fs := flag.NewFlagSet("grafana-sync "+cmd.name, flag.ExitOnError)
+	for _, name := range append(append([]string{}, globalFlags...), cmd.flags...) {
+		f := flag.Lookup(name)
+		fs.Var(f.Value, f.Name, f.Usage)
+	}
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: grafana-sync %s [flags]\n\n%s.\n\nFlags:\n", cmd.name, cmd.summary)
+		fs.PrintDefaults()
+	}
+	fs.Parse(args[len(words):])
+
+	action = cmd.action
+	commandLine = fs
+	commandArgs = append(words[n:], fs.Args()...)
+	if len(commandArgs) > 0 && action != "api" {
+		fmt.Fprintf(os.Stderr, "Error: unexpected arguments %q for %s\n", commandArgs, cmd.name)
+		os.Exit(2)
+	}
+}
+
+// flagsSet returns the names of the flags given on the command line.
+func flagsSet() map[string]bool {
+	set := make(map[string]bool)
+	flag.Visit(func(f *flag.Flag) { set[f.Name] = true })
+	commandLine.Visit(func(f *flag.Flag) { set[f.Name] = true })
+	return set
+}
+
+// findCommand returns the command named by the longest prefix of words,
+// and the length of that prefix. Words may also be joined with dashes, as
+// in the action names: "push dashboards" and "push-dashboards" are the same
+// command.
+func findCommand(words []string) (*command, int) {
+	for n := len(words); n > 0; n-- {
+		name := strings.Join(words[:n], "-")
+		for i := range commands {
+			if commands[i].action == name {
+				return &commands[i], n
+			}
+		}
+	}
+	return nil, 0
+}
+
+func printUsage() {
+	out := flag.CommandLine.Output()
+	fmt.Fprintf(out, "Usage: grafana-sync <command> [flags]\n\nCommands:\n")
+	for _, cmd := range commands {
+		fmt.Fprintf(out, "  %-24s %s\n", cmd.name, cmd.summary)
+	}
+	fmt.Fprintf(out, "\nRun 'grafana-sync <command> -h' for the flags of a command. The flags below, with -action, are still accepted without a command.\n\nFlags:\n")
+	flag.PrintDefaults()
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"flag"
+	"strings"
+	"testing"
+)
+
+func TestFindCommand(t *testing.T) {
+	tests := []struct {
+		words  string
+		action string
+		n      int
+	}{
+		{"pull", "pull", 1},
+		{"pull dashboards", "pull-dashboards", 2},
+		{"pull alert-rules", "pull-alert-rules", 2},
+		{"push merged", "push-merged", 2},
+		// The longest known command wins, the rest are arguments
+		{"pull nope", "pull", 1},
+		{"api GET /api/health", "api", 1},
+		{"nope", "", 0},
+		{"", "", 0},
+	}
+	for _, tt := range tests {
+		cmd, n := findCommand(strings.Fields(tt.words))
+		action := ""
+		if cmd != nil {
+			action = cmd.action
+		}
+		if action != tt.action || n != tt.n {
+			t.Errorf("findCommand(%q) = %q, %d, want %q, %d", tt.words, action, n, tt.action, tt.n)
+		}
+	}
+}
+
+func TestParseCommand(t *testing.T) {
+	defer func(a, f, d string) { action, folder, apiData = a, f, d }(action, folder, apiData)
+
+	tests := []struct {
+		args   string
+		action string
+		folder string
+		rest   string
+	}{
+		{"pull", "pull", "", ""},
+		{"push dashboards -folder Infra", "push-dashboards", "Infra", ""},
+		{"push dashboards --folder=Ops", "push-dashboards", "Ops", ""},
+		{"pull folders", "pull-folders", "", ""},
+		{"api GET /api/health", "api", "", "GET /api/health"},
+		{"api POST /api/dashboards/db -data {}", "api", "", "POST /api/dashboards/db"},
+	}
+	for _, tt := range tests {
+		folder = ""
+		parseCommand(strings.Fields(tt.args))
+		if action != tt.action || folder != tt.folder || strings.Join(commandArgs, " ") != tt.rest {
+			t.Errorf("parseCommand(%q) = %q, folder %q, args %q, want %q, folder %q, args %q", tt.args, action, folder, commandArgs, tt.action, tt.folder, tt.rest)
+		}
+	}
+}
+
+func TestCommandFlagsExist(t *testing.T) {
+	for _, cmd := range commands {
+		for _, name := range append(append([]string{}, globalFlags...), cmd.flags...) {
+			if flag.Lookup(name) == nil {
+				t.Errorf("command %s lists the unknown flag %s", cmd.name, name)
+			}
+		}
+	}
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// composeSuffix marks a manifest that assembles a dashboard from fragment
+// files, e.g. "payments.compose.json" next to the regular dashboard files.
+const composeSuffix = ".compose.json"
+
+var buildDir string
+
+// composeManifest lists the files a dashboard is assembled from. Base is a
+// dashboard without panels, and each panels entry is a file holding a panel
+// or an array of panels, such as a row followed by its panels. Paths are
+// relative to the manifest.
+type composeManifest struct {
+	Base   string   `json:"base"`
+	Panels []string `json:"panels"`
+}
+
+// composeDashboard assembles the dashboard described by a manifest. Panel IDs
+// that are missing or used twice are renumbered.
+func composeDashboard(manifestPath string) (map[string]interface{}, error) {
+	data, err := os.ReadFile(manifestPath)
+	if err != nil {
+		return nil, err
+	}
+	var manifest composeManifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, err
+	}
+	if manifest.Base == "" {
+		return nil, fmt.Errorf("%s: manifest has no base", manifestPath)
+	}
+
+	dir := filepath.Dir(manifestPath)
+	dashboard, err := readDashboard(filepath.Join(dir, manifest.Base))
+	if err != nil {
+		return nil, fmt.Errorf("base %s: %w", manifest.Base, err)
+	}
+
+	panels, _ := dashboard["panels"].([]interface{})
+	for _, fragment := range manifest.Panels {
+		data, err := os.ReadFile(filepath.Join(dir, fragment))
+		if err != nil {
+			return nil, fmt.Errorf("fragment %s: %w", fragment, err)
+		}
+		var content interface{}
+		if err := json.Unmarshal(data, &content); err != nil {
+			return nil, fmt.Errorf("fragment %s: %w", fragment, err)
+		}
+		switch content := content.(type) {
+		case map[string]interface{}:
+			panels = append(panels, content)
+		case []interface{}:
+			panels = append(panels, content...)
+		default:
+			return nil, fmt.Errorf("fragment %s: expected a panel or an array of panels", fragment)
+		}
+	}
+	dashboard["panels"] = panels
+
+	renumberPanels(dashboard)
+	return dashboard, nil
+}
+
+// composeFragments returns the base and fragment files of the compose
+// manifests among files, which are parts of dashboards rather than
+// dashboards of their own. Manifests that can't be read are left to the
+// actions reading them to report.
+func composeFragments(files []string) map[string]bool {
+	fragments := make(map[string]bool)
+	for _, path := range files {
+		if !isComposeManifest(path) {
+			continue
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			continue
+		}
+		var manifest composeManifest
+		if json.Unmarshal(data, &manifest) != nil {
+			continue
+		}
+		dir := filepath.Dir(path)
+		for _, part := range append([]string{manifest.Base}, manifest.Panels...) {
+			if part != "" {
+				fragments[filepath.Join(dir, part)] = true
+			}
+		}
+	}
+	return fragments
+}
+
+// renumberPanels gives a fresh ID to every panel whose ID is missing or
+// already taken by an earlier panel.
+func renumberPanels(dashboard map[string]interface{}) {
+	panels := dashboardPanels(dashboard)
+
+	maxID := 0.0
+	for _, panel := range panels {
+		if id, ok := panel["id"].(float64); ok && id > maxID {
+			maxID = id
+		}
+	}
+
+	seen := map[float64]bool{}
+	for _, panel := range panels {
+		id, ok := panel["id"].(float64)
+		if !ok || seen[id] {
+			maxID++
+			id = maxID
+			panel["id"] = id
+		}
+		seen[id] = true
+	}
+}
+
+// isComposeManifest reports whether a dashboards directory entry is a
+// compose manifest rather than a dashboard.
+func isComposeManifest(name string) bool {
+	return strings.HasSuffix(name, composeSuffix)
+}
+
+// buildDashboards writes the dashboards assembled from every compose
+// manifest to the build directory, without talking to Grafana.
+func buildDashboards() {
+	fmt.Println("Building composed dashboards...")
+	dashboardDir := filepath.Join(directory, "dashboards")
+	files, err := os.ReadDir(dashboardDir)
+	if err != nil {
+		log.Fatalf("Error reading dashboard directory: %v", err)
+	}
+
+	if err := os.MkdirAll(buildDir, os.ModePerm); err != nil {
+		log.Fatalf("Error creating directory: %v", err)
+	}
+
+	failed := false
+	for _, file := range files {
+		if !isComposeManifest(file.Name()) {
+			continue
+		}
+		dashboard, err := composeDashboard(filepath.Join(dashboardDir, file.Name()))
+		if err != nil {
+			log.Printf("Error composing %s: %v", file.Name(), err)
+			failed = true
+			continue
+		}
+
+		filePath := filepath.Join(buildDir, strings.TrimSuffix(file.Name(), composeSuffix)+".json")
+		if err := writeDashboard(filePath, dashboard); err != nil {
+			log.Printf("Error saving %s: %v", filePath, err)
+			failed = true
+			continue
+		}
+		fmt.Printf("Built dashboard: %s\n", filePath)
+	}
+
+	if failed {
+		os.Exit(1)
+	}
+}
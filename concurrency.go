@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// concurrencyLimits are the number of API calls made at once by each stage
+// of a run, set with -concurrency: search pages, dashboard fetches on pull,
+// and pushes per resource kind. Folders are pushed one at a time by
+// default, since parent folders must exist before their children.
+var concurrencyLimits = map[string]int{
+	"search":        1,
+	"fetch":         4,
+	"dashboards":    4,
+	"datasources":   1,
+	"folders":       1,
+	"notifications": 1,
+}
+
+// concurrencyFlag sets concurrencyLimits from stage=n values.
+type concurrencyFlag struct{}
+
+func (concurrencyFlag) String() string {
+	stages := make([]string, 0, len(concurrencyLimits))
+	for stage, n := range concurrencyLimits {
+		stages = append(stages, stage+"="+strconv.Itoa(n))
+	}
+	sort.Strings(stages)
+	return strings.Join(stages, ",")
+}
+
+func (concurrencyFlag) Set(value string) error {
+	stage, n, ok := strings.Cut(value, "=")
+	if !ok {
+		return fmt.Errorf("expected stage=n, got %q", value)
+	}
+	if _, known := concurrencyLimits[stage]; !known {
+		return fmt.Errorf("unknown stage %q, must be one of search, fetch, dashboards, datasources, folders, notifications", stage)
+	}
+	limit, err := strconv.Atoi(n)
+	if err != nil || limit < 1 {
+		return fmt.Errorf("invalid concurrency %q for %s, must be at least 1", n, stage)
+	}
+	concurrencyLimits[stage] = limit
+	return nil
+}
+
+// concurrency returns the number of API calls a stage makes at once.
+func concurrency(stage string) int {
+	if n := concurrencyLimits[stage]; n > 1 {
+		return n
+	}
+	return 1
+}
+
+// forEach calls fn with every index below n, from as many goroutines as the
+// concurrency of stage allows. Indexes are handed out in order, and no new
+// ones once the run is stopped.
+func forEach(ctx context.Context, stage string, n int, fn func(i int)) {
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < concurrency(stage) && w < n; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				fn(i)
+			}
+		}()
+	}
+	for i := 0; i < n && !stopped(ctx); i++ {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+
+	"gopkg.in/yaml.v3"
+)
+
+const defaultConfigFile = "grafana-sync.yaml"
+
+var (
+	configFile string
+	// profileName selects the profile of the configuration file used for
+	// -url and -apikey.
+	profileName string
+)
+
+// config is the content of the configuration file.
+type config struct {
+	// URL, APIKey, Directory and Folder are used when the matching flag
+	// isn't given. URL and APIKey may contain ${VAR} placeholders.
+	URL       string `yaml:"url"`
+	APIKey    string `yaml:"apikey"`
+	Directory string `yaml:"directory"`
+	Folder    string `yaml:"folder"`
+	// Resources filters the resources synced, by kind.
+	Resources map[string]resourceFilter `yaml:"resources"`
+	// Profiles are named Grafana instances or credentials.
+	Profiles map[string]profile `yaml:"profiles"`
+	// Routes send local directories to the profile they belong to.
+	Routes []route `yaml:"routes"`
+	// Fields selects the fields saved on pull, by kind.
+	Fields map[string]fieldFilter `yaml:"fields"`
+	// Normalize selects what is ignored when comparing dashboards.
+	Normalize normalizeConfig `yaml:"normalize"`
+	// Split assigns dashboards to the targets of the split action.
+	Split []splitRule `yaml:"split"`
+	// Merge lists the instances consolidated by push-merged.
+	Merge []mergeSource `yaml:"merge"`
+	// URLRewrites are applied to the links of dashboards before push.
+	URLRewrites []urlRewrite `yaml:"urlRewrites"`
+	// PermissionPolicy is checked by the permissions report.
+	PermissionPolicy permissionPolicy `yaml:"permissionPolicy"`
+	// PermissionTemplates are named lists of permissions, applied on push to
+	// the folders matching the FolderPermissions rules.
+	PermissionTemplates map[string][]permissionItem `yaml:"permissionTemplates"`
+	FolderPermissions   []folderPermissionRule      `yaml:"folderPermissions"`
+	// RuleGroups reorganizes the local alert rules with the
+	// rebalance-rule-groups action.
+	RuleGroups []ruleGroupRule `yaml:"ruleGroups"`
+	// Layout is the template of the path of pulled dashboards, relative to
+	// the dashboards directory.
+	Layout string `yaml:"layout"`
+	// Jobs are run on their schedule by the daemon.
+	Jobs []job `yaml:"jobs"`
+	// MaxBodySize is the largest request body the instance accepts, unless
+	// the profile sets its own.
+	MaxBodySize int `yaml:"maxBodySize"`
+	// Minify lists the minifications applied to dashboards too large to be
+	// pushed.
+	Minify []string `yaml:"minify"`
+}
+
+// profile holds the connection settings of a Grafana instance. Values may
+// contain ${VAR} placeholders resolved from the environment, so that API
+// keys don't have to be stored in the file.
+type profile struct {
+	URL    string `yaml:"url"`
+	APIKey string `yaml:"apikey"`
+	// Watermark marks the dashboards pushed to a non-production instance.
+	Watermark *watermark `yaml:"watermark"`
+	// MaxBodySize is the largest request body the instance accepts.
+	MaxBodySize int `yaml:"maxBodySize"`
+}
+
+// route maps a local directory, relative to -directory and laid out like a
+// pulled directory, to the profile it is pushed to and optionally to a
+// target folder for its dashboards and to the environment of its datasource
+// overrides.
+type route struct {
+	Directory   string `yaml:"directory"`
+	Profile     string `yaml:"profile"`
+	Folder      string `yaml:"folder"`
+	Environment string `yaml:"environment"`
+}
+
+var cfg config
+
+// loadConfig reads the configuration file. The default file is optional, a
+// file given explicitly with -config must exist.
+func loadConfig() {
+	if err := readConfig(); err != nil {
+		log.Fatalf("Error %v", err)
+	}
+}
+
+// readConfig replaces cfg with the content of the configuration file and
+// checks it, leaving cfg empty when the default file doesn't exist.
+func readConfig() error {
+	cfg = config{}
+	data, err := os.ReadFile(configFile)
+	if os.IsNotExist(err) && configFile == defaultConfigFile {
+		return parseLayout()
+	}
+	if err != nil {
+		return fmt.Errorf("reading config file: %v", err)
+	}
+	if err := yaml.Unmarshal(data, &cfg); err != nil {
+		return fmt.Errorf("parsing config file %s: %v", configFile, err)
+	}
+	if err := parseLayout(); err != nil {
+		return fmt.Errorf("parsing layout in %s: %v", configFile, err)
+	}
+	if err := checkResourceFilters(cfg.Resources); err != nil {
+		return fmt.Errorf("in resources of %s: %v", configFile, err)
+	}
+	if err := checkFieldFilters(cfg.Fields); err != nil {
+		return fmt.Errorf("in fields of %s: %v", configFile, err)
+	}
+	if err := checkPermissionTemplates(); err != nil {
+		return fmt.Errorf("in folderPermissions of %s: %v", configFile, err)
+	}
+	if err := checkJobs(); err != nil {
+		return fmt.Errorf("in jobs of %s: %v", configFile, err)
+	}
+	if err := checkMinify(); err != nil {
+		return fmt.Errorf("in minify of %s: %v", configFile, err)
+	}
+	return nil
+}
+
+// applyConfigSettings fills the connection and sync settings that weren't
+// given as flags from -profile, then from the configuration file.
+func applyConfigSettings() error {
+	set := flagsSet()
+
+	url, key, bodySize := cfg.URL, cfg.APIKey, cfg.MaxBodySize
+	if profileName != "" {
+		p, ok := cfg.Profiles[profileName]
+		if !ok {
+			return fmt.Errorf("in %s: unknown profile %q", configFile, profileName)
+		}
+		url, key = p.URL, p.APIKey
+		if err := useWatermark(p); err != nil {
+			return fmt.Errorf("in profile %s of %s: %v", profileName, configFile, err)
+		}
+		if p.MaxBodySize > 0 {
+			bodySize = p.MaxBodySize
+		}
+	}
+	if !set["max-body-size"] && bodySize > 0 {
+		maxBodySize = bodySize
+	}
+
+	for _, setting := range []struct {
+		name  string
+		value string
+		flag  *string
+	}{
+		{"url", url, &baseURL},
+		{"apikey", key, &apiKey},
+		{"directory", cfg.Directory, &directory},
+		{"folder", cfg.Folder, &folder},
+	} {
+		if set[setting.name] || setting.value == "" {
+			continue
+		}
+		value, err := expandPlaceholders(setting.value)
+		if err != nil {
+			return fmt.Errorf("in %s of %s: %v", setting.name, configFile, err)
+		}
+		*setting.flag = value
+	}
+	return nil
+}
+
+// resolveProfile returns the connection settings of a named profile with its
+// placeholders resolved.
+func resolveProfile(name string) (profile, error) {
+	p, ok := cfg.Profiles[name]
+	if !ok {
+		return profile{}, fmt.Errorf("unknown profile %q", name)
+	}
+
+	var err error
+	if p.URL, err = expandPlaceholders(p.URL); err != nil {
+		return profile{}, err
+	}
+	if p.APIKey, err = expandPlaceholders(p.APIKey); err != nil {
+		return profile{}, err
+	}
+	return p, nil
+}
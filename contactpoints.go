@@ -0,0 +1,201 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// contactPointsDir holds the contact points of a directory, one file per
+// contact point name listing its integrations.
+var contactPointsDir = filepath.Join("alerting", "contact-points")
+
+// redactedValue replaces secure settings in contact points returned by the
+// provisioning API.
+const redactedValue = "[REDACTED]"
+
+// contactPoint is an integration of a unified alerting contact point, as
+// returned by /api/v1/provisioning/contact-points. Integrations sharing a
+// name form one contact point.
+type contactPoint struct {
+	UID                   string                 `json:"uid,omitempty"`
+	Name                  string                 `json:"name"`
+	Type                  string                 `json:"type"`
+	Settings              map[string]interface{} `json:"settings"`
+	DisableResolveMessage bool                   `json:"disableResolveMessage,omitempty"`
+}
+
+func (c contactPoint) validate() error {
+	switch {
+	case c.Name == "":
+		return errors.New("has no name")
+	case c.Type == "":
+		return errors.New("has no type")
+	}
+	return nil
+}
+
+// contactPointPath returns the file of a contact point in a directory.
+func contactPointPath(dir, name string) string {
+	return filepath.Join(dir, contactPointsDir, url.PathEscape(name)+".json")
+}
+
+// pullContactPoints saves the contact points of the instance. Secure
+// settings, which Grafana redacts, are saved as placeholders and listed in
+// the required-secrets.txt checklist. The contact points directory is
+// replaced, so that deleted contact points don't come back on push.
+func pullContactPoints(ctx context.Context) {
+	fmt.Println("Pulling contact points...")
+	var points []contactPoint
+	if err := getJSON(ctx, "/api/v1/provisioning/contact-points", &points); err != nil {
+		pullFailed(ctx, "contact-points", "fetching contact points", err)
+		return
+	}
+
+	byName := make(map[string][]contactPoint)
+	var secrets []requiredSecret
+	for _, cp := range points {
+		redacted := make(map[string]bool)
+		for field, value := range cp.Settings {
+			if value == redactedValue {
+				redacted[field] = true
+			}
+		}
+		for field, placeholder := range secretPlaceholders("contact-points", cp.Name+"_"+cp.Type, redacted, &secrets) {
+			cp.Settings[field] = placeholder
+		}
+		byName[cp.Name] = append(byName[cp.Name], cp)
+	}
+
+	dir := filepath.Join(directory, contactPointsDir)
+	err := os.RemoveAll(dir)
+	if err == nil {
+		err = os.MkdirAll(dir, os.ModePerm)
+	}
+	if err != nil {
+		log.Printf("Error replacing contact points directory: %v", err)
+		summary.add("contact points", outcomeFailed, dir)
+		return
+	}
+	names := make([]string, 0, len(byName))
+	for name := range byName {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		data, err := json.MarshalIndent(byName[name], "", "  ")
+		if err == nil {
+			err = os.WriteFile(contactPointPath(directory, name), data, 0644)
+		}
+		if err != nil {
+			log.Printf("Error saving contact point %s: %v", name, err)
+			continue
+		}
+		fmt.Printf("Saved contact point: %s\n", name)
+	}
+
+	if err := writeRequiredSecrets(filepath.Join(directory, "alerting"), "contact-points", secrets); err != nil {
+		fmt.Println("Error saving required secrets:", err)
+		return
+	}
+	if len(secrets) > 0 {
+		fmt.Printf("Contact points need %d secret(s) on push, listed in %s\n", len(secrets), filepath.Join(directory, contactPointsDir, requiredSecretsFile))
+	}
+}
+
+// readContactPoints reads the integrations of a contact point file, which
+// must all be valid.
+func readContactPoints(path string) ([]contactPoint, error) {
+	var list []contactPoint
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &list); err != nil {
+		return nil, err
+	}
+	for _, cp := range list {
+		if err := cp.validate(); err != nil {
+			return nil, fmt.Errorf("contact point %v", err)
+		}
+	}
+	return list, nil
+}
+
+// pushContactPoints creates or updates the local contact points. Integrations
+// are matched by UID. Placeholders of secure settings are resolved first, and
+// nothing is pushed when a secret is missing.
+func pushContactPoints(ctx context.Context) {
+	fmt.Println("Pushing contact points...")
+	files, err := filepath.Glob(filepath.Join(directory, contactPointsDir, "*.json"))
+	if err != nil || len(files) == 0 {
+		fmt.Println("Error reading contact points directory: no contact point files")
+		return
+	}
+
+	var points []contactPoint
+	var missing []string
+	for _, path := range files {
+		list, err := readContactPoints(path)
+		if err != nil {
+			log.Printf("Error reading %s: %v", path, err)
+			summary.add("contact points", outcomeFailed, path)
+			continue
+		}
+		for _, cp := range list {
+			for field, value := range cp.Settings {
+				if s, ok := value.(string); ok {
+					cp.Settings[field] = resolveSecret(cp.Name, field, s, &missing)
+				}
+			}
+			points = append(points, cp)
+		}
+	}
+	if len(missing) > 0 {
+		sort.Strings(missing)
+		log.Fatalf("Error: missing secrets of contact points, set these environment variables before pushing:\n  %s", strings.Join(missing, "\n  "))
+	}
+
+	var existing []contactPoint
+	if err := getJSON(ctx, "/api/v1/provisioning/contact-points", &existing); err != nil {
+		log.Printf("Error fetching contact points: %s", describeError(err))
+		for _, cp := range points {
+			summary.add("contact points", outcomeFailed, fmt.Sprintf("%s (%s)", cp.Name, cp.Type))
+		}
+		return
+	}
+	exists := make(map[string]bool, len(existing))
+	for _, cp := range existing {
+		exists[cp.UID] = true
+	}
+
+	for _, cp := range points {
+		if stopped(ctx) {
+			break
+		}
+		name := fmt.Sprintf("%s (%s)", cp.Name, cp.Type)
+		body, err := json.Marshal(cp)
+		if err != nil {
+			log.Printf("Error marshalling contact point %s: %v", name, err)
+			continue
+		}
+		method, endpoint := "POST", "/api/v1/provisioning/contact-points"
+		if cp.UID != "" && exists[cp.UID] {
+			method, endpoint = "PUT", endpoint+"/"+url.PathEscape(cp.UID)
+		}
+		if _, err := apiRequest(ctx, method, endpoint, body); err != nil {
+			log.Printf("Error pushing contact point %s: %s", name, describeError(err))
+			summary.add("contact points", outcomeFailed, name)
+			continue
+		}
+		printChange("Uploaded contact point: %s\n", name)
+		summary.add("contact points", outcomePushed, name)
+	}
+}
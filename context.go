@@ -0,0 +1,52 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+var (
+	// deadline bounds the duration of the whole run, 0 means no deadline.
+	deadline time.Duration
+	// requestTimeout bounds each API call, 0 means no timeout.
+	requestTimeout time.Duration
+)
+
+// runContext returns the context of the run, cancelled on Ctrl+C or SIGTERM
+// and once -deadline has passed. The calls in flight are aborted and the
+// loops over resources stop before starting on the next one. A second
+// Ctrl+C kills the process right away.
+func runContext() (context.Context, context.CancelFunc) {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-ctx.Done()
+		stop()
+	}()
+	if deadline <= 0 {
+		return ctx, stop
+	}
+	ctx, cancel := context.WithTimeout(ctx, deadline)
+	return ctx, func() {
+		cancel()
+		stop()
+	}
+}
+
+// stopped reports whether the run was cancelled, in which case no work must
+// be started on further resources.
+func stopped(ctx context.Context) bool {
+	return ctx.Err() != nil
+}
+
+// describeStop explains why the run was cancelled.
+func describeStop(err error) string {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return fmt.Sprintf("deadline of %s exceeded", deadline)
+	}
+	return "interrupted"
+}
@@ -0,0 +1,417 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"grafana-sync/internal/controlpb"
+)
+
+var (
+	// grpcListen is the address of the gRPC control API of the daemon,
+	// disabled when empty.
+	grpcListen string
+	// controlToken is the bearer token required by the control APIs.
+	controlToken string
+)
+
+// syncActions are the actions the control APIs can trigger.
+var syncActions = map[string]func(context.Context){
+	"pull":            pullData,
+	"push":            pushData,
+	"pull-dashboards": pullDashboards,
+	"push-dashboards": pushDashboards,
+}
+
+var (
+	errSyncRunning   = errors.New("a sync is already running")
+	errUnknownAction = errors.New("action must be one of 'pull', 'push', 'pull-dashboards', 'push-dashboards'")
+	errInvalidTeam   = errors.New("team must name a team directory")
+)
+
+// syncMu serializes the syncs triggered through the control APIs and the
+// drift checks of the daemon, which share the directory and the
+// connection.
+var syncMu sync.Mutex
+
+// syncRun is a sync triggered through the control APIs.
+type syncRun struct {
+	ID       int64          `json:"id"`
+	Action   string         `json:"action"`
+	Team     string         `json:"team,omitempty"`
+	Status   string         `json:"status"`
+	Error    string         `json:"error,omitempty"`
+	Started  time.Time      `json:"started"`
+	Finished *time.Time     `json:"finished,omitempty"`
+	Counts   map[string]int `json:"counts,omitempty"`
+}
+
+// Statuses of a syncRun.
+const (
+	runRunning   = "running"
+	runSucceeded = "succeeded"
+	runFailed    = "failed"
+)
+
+// syncEvent reports the progress of a sync: its start, the outcome of
+// every resource it records in the summary, and its end.
+type syncEvent struct {
+	RunID   int64    `json:"runId"`
+	Type    string   `json:"type"`
+	Kind    string   `json:"kind,omitempty"`
+	Outcome string   `json:"outcome,omitempty"`
+	Name    string   `json:"name,omitempty"`
+	Run     *syncRun `json:"run,omitempty"`
+}
+
+// controller runs the syncs triggered through the control APIs, one at a
+// time, and hands their events to the watchers.
+type controller struct {
+	mu       sync.Mutex
+	last     *syncRun
+	watchers map[chan syncEvent]bool
+}
+
+var control = &controller{watchers: make(map[chan syncEvent]bool)}
+
+// trigger starts a sync of action, limited to the directory of team when
+// set, and returns it without waiting for it to finish.
+func (c *controller) trigger(ctx context.Context, action, team string) (syncRun, error) {
+	fn, ok := syncActions[action]
+	if !ok {
+		return syncRun{}, errUnknownAction
+	}
+	if team != "" && !validTeamName(team) {
+		return syncRun{}, errInvalidTeam
+	}
+	if !election.isLeader() {
+		return syncRun{}, errNotLeader
+	}
+	c.mu.Lock()
+	if c.last != nil && c.last.Status == runRunning {
+		c.mu.Unlock()
+		return syncRun{}, errSyncRunning
+	}
+	var id int64 = 1
+	if c.last != nil {
+		id = c.last.ID + 1
+	}
+	r := &syncRun{ID: id, Action: action, Team: team, Status: runRunning, Started: time.Now()}
+	c.last = r
+	started := *r
+	c.mu.Unlock()
+
+	c.publish(syncEvent{RunID: r.ID, Type: "started", Run: &started})
+	go c.run(ctx, r, fn)
+	return started, nil
+}
+
+func (c *controller) run(ctx context.Context, r *syncRun, fn func(context.Context)) {
+	syncMu.Lock()
+	defer syncMu.Unlock()
+	log.Printf("Sync %d: %s %s", r.ID, r.Action, r.Team)
+
+	baseDir := directory
+	if r.Team != "" {
+		directory = filepath.Join(baseDir, teamDirectory(r.Team))
+	}
+	summary = newRunSummary()
+	summary.observe = func(kind, outcome, name string) {
+		c.publish(syncEvent{RunID: r.ID, Type: "resource", Kind: kind, Outcome: outcome, Name: name})
+	}
+	var err error
+	if r.Team != "" && !knownTeam(baseDir, r.Team) {
+		err = fmt.Errorf("no directory for team %s", r.Team)
+	} else {
+		fn(ctx)
+	}
+	directory = baseDir
+	counts := summary.counts()
+
+	c.mu.Lock()
+	now := time.Now()
+	r.Finished = &now
+	r.Counts = counts
+	for key, n := range counts {
+		if err == nil && strings.HasSuffix(key, " "+outcomeFailed) {
+			err = fmt.Errorf("%d resource(s) failed", n)
+		}
+	}
+	if err == nil && stopped(ctx) {
+		err = errors.New("stopped")
+	}
+	r.Status = runSucceeded
+	if err != nil {
+		r.Status, r.Error = runFailed, err.Error()
+	}
+	finished := *r
+	c.mu.Unlock()
+
+	log.Printf("Sync %d %s", r.ID, r.Status)
+	c.publish(syncEvent{RunID: r.ID, Type: "finished", Run: &finished})
+}
+
+// validTeamName reports whether team can name a team directory: its
+// directory name is neither empty nor "." or "..".
+func validTeamName(team string) bool {
+	name := strings.TrimPrefix(teamDirectory(team), "teams/")
+	return strings.TrimSpace(name) != "" && name != "." && name != ".."
+}
+
+// knownTeam reports whether team names one of the team directories of
+// base, as laid out by -group-by-team.
+func knownTeam(base, team string) bool {
+	if !validTeamName(team) {
+		return false
+	}
+	name := strings.TrimPrefix(teamDirectory(team), "teams/")
+	entries, err := os.ReadDir(filepath.Join(base, "teams"))
+	if err != nil {
+		return false
+	}
+	for _, e := range entries {
+		if e.IsDir() && e.Name() == name {
+			return true
+		}
+	}
+	return false
+}
+
+// lastRun returns the running sync, or the last one.
+func (c *controller) lastRun() (syncRun, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.last == nil {
+		return syncRun{}, false
+	}
+	return *c.last, true
+}
+
+// watch returns a channel receiving the events of the syncs, until stop is
+// called. Events are dropped for watchers that don't keep up.
+func (c *controller) watch() (events chan syncEvent, stop func()) {
+	events = make(chan syncEvent, 100)
+	c.mu.Lock()
+	c.watchers[events] = true
+	c.mu.Unlock()
+	return events, func() {
+		c.mu.Lock()
+		delete(c.watchers, events)
+		c.mu.Unlock()
+	}
+}
+
+func (c *controller) publish(e syncEvent) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for w := range c.watchers {
+		select {
+		case w <- e:
+		default:
+		}
+	}
+}
+
+// controlAuthorized checks the bearer token of a control API call. Calls
+// are refused when no token is set.
+func controlAuthorized(authorization string) bool {
+	return controlToken != "" && subtle.ConstantTimeCompare([]byte(authorization), []byte("Bearer "+controlToken)) == 1
+}
+
+// serveSync is the REST control API: POST /sync with a JSON action and team
+// triggers a sync, GET /sync returns the last run and GET /sync/events
+// streams the events as JSON lines.
+func serveSync(ctx context.Context) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !controlAuthorized(r.Header.Get("Authorization")) {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		switch {
+		case r.URL.Path == "/sync" && r.Method == http.MethodPost:
+			var req struct {
+				Action string `json:"action"`
+				Team   string `json:"team"`
+			}
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				http.Error(w, "invalid request: "+err.Error(), http.StatusBadRequest)
+				return
+			}
+			run, err := control.trigger(ctx, req.Action, req.Team)
+			switch {
+			case errors.Is(err, errSyncRunning):
+				http.Error(w, err.Error(), http.StatusConflict)
+			case errors.Is(err, errNotLeader):
+				http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			case err != nil:
+				http.Error(w, err.Error(), http.StatusBadRequest)
+			default:
+				writeJSON(w, http.StatusAccepted, run)
+			}
+		case r.URL.Path == "/sync" && r.Method == http.MethodGet:
+			run, ok := control.lastRun()
+			if !ok {
+				http.Error(w, "no sync has run", http.StatusNotFound)
+				return
+			}
+			writeJSON(w, http.StatusOK, run)
+		case r.URL.Path == "/sync/events" && r.Method == http.MethodGet:
+			events, stop := control.watch()
+			defer stop()
+			w.Header().Set("Content-Type", "application/x-ndjson")
+			w.WriteHeader(http.StatusOK)
+			flusher, _ := w.(http.Flusher)
+			if flusher != nil {
+				flusher.Flush()
+			}
+			enc := json.NewEncoder(w)
+			for {
+				select {
+				case e := <-events:
+					if err := enc.Encode(e); err != nil {
+						return
+					}
+					if flusher != nil {
+						flusher.Flush()
+					}
+				case <-r.Context().Done():
+					return
+				}
+			}
+		default:
+			http.Error(w, "not found", http.StatusNotFound)
+		}
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// controlServer is the gRPC control API, backed by the same controller as
+// the REST one.
+type controlServer struct {
+	controlpb.UnimplementedSyncControlServer
+	ctx context.Context
+}
+
+func (s controlServer) Trigger(_ context.Context, req *controlpb.TriggerRequest) (*controlpb.Run, error) {
+	run, err := control.trigger(s.ctx, req.Action, req.Team)
+	switch {
+	case errors.Is(err, errSyncRunning):
+		return nil, status.Error(codes.FailedPrecondition, err.Error())
+	case errors.Is(err, errNotLeader):
+		return nil, status.Error(codes.Unavailable, err.Error())
+	case err != nil:
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	return run.proto(), nil
+}
+
+func (s controlServer) Watch(_ *controlpb.WatchRequest, stream grpc.ServerStreamingServer[controlpb.Event]) error {
+	events, stop := control.watch()
+	defer stop()
+	for {
+		select {
+		case e := <-events:
+			pe := &controlpb.Event{RunId: e.RunID, Type: e.Type, Kind: e.Kind, Outcome: e.Outcome, Name: e.Name}
+			if e.Run != nil {
+				pe.Run = e.Run.proto()
+			}
+			if err := stream.Send(pe); err != nil {
+				return err
+			}
+		case <-stream.Context().Done():
+			return nil
+		}
+	}
+}
+
+func (s controlServer) LastRun(context.Context, *controlpb.LastRunRequest) (*controlpb.Run, error) {
+	run, ok := control.lastRun()
+	if !ok {
+		return nil, status.Error(codes.NotFound, "no sync has run")
+	}
+	return run.proto(), nil
+}
+
+func (r syncRun) proto() *controlpb.Run {
+	run := &controlpb.Run{
+		Id:      r.ID,
+		Action:  r.Action,
+		Team:    r.Team,
+		Status:  r.Status,
+		Error:   r.Error,
+		Started: r.Started.Format(time.RFC3339),
+		Counts:  make(map[string]int64, len(r.Counts)),
+	}
+	if r.Finished != nil {
+		run.Finished = r.Finished.Format(time.RFC3339)
+	}
+	for key, n := range r.Counts {
+		run.Counts[key] = int64(n)
+	}
+	return run
+}
+
+// authorizeControl checks the bearer token in the metadata of gRPC calls.
+func authorizeControl(ctx context.Context) error {
+	md, _ := metadata.FromIncomingContext(ctx)
+	var authorization string
+	if values := md.Get("authorization"); len(values) > 0 {
+		authorization = values[0]
+	}
+	if !controlAuthorized(authorization) {
+		return status.Error(codes.Unauthenticated, "invalid token")
+	}
+	return nil
+}
+
+// serveControlGRPC serves the gRPC control API on -grpc-listen.
+func serveControlGRPC(ctx context.Context) {
+	lis, err := net.Listen("tcp", grpcListen)
+	if err != nil {
+		log.Fatalf("Error listening on %s: %v", grpcListen, err)
+	}
+	server := grpc.NewServer(
+		grpc.UnaryInterceptor(func(ctx context.Context, req interface{}, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+			if err := authorizeControl(ctx); err != nil {
+				return nil, err
+			}
+			return handler(ctx, req)
+		}),
+		grpc.StreamInterceptor(func(srv interface{}, ss grpc.ServerStream, _ *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+			if err := authorizeControl(ss.Context()); err != nil {
+				return err
+			}
+			return handler(srv, ss)
+		}),
+	)
+	controlpb.RegisterSyncControlServer(server, controlServer{ctx: ctx})
+	go func() {
+		<-ctx.Done()
+		server.Stop()
+	}()
+	fmt.Printf("Serving the gRPC control API on %s\n", grpcListen)
+	if err := server.Serve(lis); err != nil {
+		log.Fatalf("Error serving the gRPC control API: %v", err)
+	}
+}
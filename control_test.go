@@ -0,0 +1,84 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestControlAuthorized(t *testing.T) {
+	defer func(token string) { controlToken = token }(controlToken)
+
+	tests := []struct {
+		token, authorization string
+		want                 bool
+	}{
+		{"s3cr3t", "Bearer s3cr3t", true},
+		{"s3cr3t", "Bearer wrong", false},
+		{"s3cr3t", "s3cr3t", false},
+		{"s3cr3t", "bearer s3cr3t", false},
+		{"s3cr3t", "", false},
+		// Without a token, every call is refused
+		{"", "", false},
+		{"", "Bearer ", false},
+	}
+	for _, tt := range tests {
+		controlToken = tt.token
+		if got := controlAuthorized(tt.authorization); got != tt.want {
+			t.Errorf("controlAuthorized(%q) with token %q = %v, want %v", tt.authorization, tt.token, got, tt.want)
+		}
+	}
+}
+
+func TestValidTeamName(t *testing.T) {
+	tests := []struct {
+		team string
+		want bool
+	}{
+		{"ops", true},
+		{"Team A", true},
+		// Slashes are replaced, as in the team directories
+		{"a/b", true},
+		{"", false},
+		{"  ", false},
+		{".", false},
+		{"..", false},
+	}
+	for _, tt := range tests {
+		if got := validTeamName(tt.team); got != tt.want {
+			t.Errorf("validTeamName(%q) = %v, want %v", tt.team, got, tt.want)
+		}
+	}
+}
+
+func TestKnownTeam(t *testing.T) {
+	base := t.TempDir()
+	for _, dir := range []string{"ops", "a-b"} {
+		if err := os.MkdirAll(filepath.Join(base, "teams", dir), os.ModePerm); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(base, "teams", "notes"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		team string
+		want bool
+	}{
+		{"ops", true},
+		{"a/b", true},
+		{"web", false},
+		{"notes", false},
+		{"..", false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		if got := knownTeam(base, tt.team); got != tt.want {
+			t.Errorf("knownTeam(%q) = %v, want %v", tt.team, got, tt.want)
+		}
+	}
+	if knownTeam(t.TempDir(), "ops") {
+		t.Errorf("knownTeam found ops in a directory without teams")
+	}
+}
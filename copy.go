@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"regexp"
+)
+
+var (
+	fromFolder string
+	toFolder   string
+	// copySuffix is appended to the titles of copied dashboards.
+	copySuffix string
+)
+
+// dashboardURL matches the dashboard UID of links to /d/<uid>.
+var dashboardURL = regexp.MustCompile(`/d/([A-Za-z0-9_-]+)`)
+
+// copyFolder copies the dashboards of -from-folder into -to-folder on the
+// same instance, without going through local files. Copies get new UIDs
+// derived from the original UID and the target folder, so that copying
+// again updates the previous copies, and links between the copied
+// dashboards point to the copies. The target folder is created when
+// missing.
+func copyFolder(ctx context.Context) {
+	if fromFolder == "" || toFolder == "" {
+		log.Fatalf("Error: copy requires -from-folder and -to-folder")
+	}
+	if fromFolder == toFolder {
+		log.Fatalf("Error: -from-folder and -to-folder are the same folder")
+	}
+	sourceID := getFolderID(ctx, fromFolder)
+	target, err := copyTarget(ctx)
+	if err != nil {
+		log.Fatalf("Error: %s", describeError(err))
+	}
+	fmt.Printf("Copying folder %s to %s...\n", fromFolder, toFolder)
+
+	dashboards, err := client.Search(ctx, searchType(searchTypeDashboard), searchFolderID(sourceID))
+	if err != nil {
+		log.Fatalf("Error searching dashboards: %s", describeError(err))
+	}
+	copies := make(map[string]string, len(dashboards))
+	for _, db := range dashboards {
+		copies[db.UID] = copyUID(db.UID, target.UID)
+	}
+	relink := func(s string) string {
+		return dashboardURL.ReplaceAllStringFunc(s, func(m string) string {
+			if uid, ok := copies[m[len("/d/"):]]; ok {
+				return "/d/" + uid
+			}
+			return m
+		})
+	}
+
+	for _, db := range dashboards {
+		if stopped(ctx) {
+			break
+		}
+		title := db.Title + copySuffix
+		raw, _, err := client.GetRawDashboardByUID(ctx, db.UID)
+		if err != nil {
+			log.Printf("Error fetching dashboard UID %s: %s", db.UID, describeError(err))
+			summary.add("dashboards", outcomeFailed, title)
+			continue
+		}
+		var board map[string]interface{}
+		if err := json.Unmarshal(raw, &board); err != nil {
+			log.Printf("Error unmarshalling dashboard UID %s: %v", db.UID, err)
+			summary.add("dashboards", outcomeFailed, title)
+			continue
+		}
+		board["id"] = nil
+		board["uid"] = copies[db.UID]
+		board["title"] = title
+		delete(board, "version")
+		rewriteDashboardLinks(board, relink)
+
+		data, err := json.Marshal(board)
+		if err != nil {
+			log.Printf("Error marshalling dashboard %s: %v", title, err)
+			continue
+		}
+		_, err = saveDashboard(ctx, title, rawBoardRequest{
+			Dashboard:  data,
+			Parameters: setDashboardParams{FolderUID: target.UID, Overwrite: true, Message: "Copied from " + fromFolder + " by grafana-sync"},
+		})
+		if err != nil {
+			log.Printf("Error copying dashboard %s: %s", db.Title, describeError(err))
+			summary.add("dashboards", outcomeFailed, title)
+			continue
+		}
+		fmt.Printf("Copied dashboard: %s\n", title)
+		summary.add("dashboards", outcomePushed, title)
+	}
+}
+
+// copyTarget returns the folder of -to-folder, creating it when missing.
+func copyTarget(ctx context.Context) (folderInfo, error) {
+	if toFolder == generalFolder {
+		return folderInfo{}, nil
+	}
+	if f, err := findFolder(ctx, toFolder); err == nil {
+		return f, nil
+	}
+	return createFolder(ctx, folderInfo{Title: toFolder})
+}
+
+// copyUID returns the UID of the copy of a dashboard in a folder.
+func copyUID(uid, folderUID string) string {
+	sum := sha1.Sum([]byte(folderUID + "/" + uid))
+	return hex.EncodeToString(sum[:])[:14]
+}
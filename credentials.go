@@ -0,0 +1,150 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	// apiKeyCommand prints the token of -url on stdout, for short-lived
+	// tokens that must be renewed during long runs.
+	apiKeyCommand string
+	// apiKeyFile holds the token of -url, rewritten by an external agent
+	// when the token is renewed.
+	apiKeyFile string
+	// apiKeyRefresh is how long a token of -apikey-command is used before
+	// the command is run again, 0 to only renew rejected tokens.
+	apiKeyRefresh time.Duration
+)
+
+// credentialProvider supplies the bearer token of API calls and renews it.
+// It is safe for concurrent use.
+type credentialProvider interface {
+	// token returns the current token.
+	token() (string, error)
+	// refresh renews the token after the instance rejected the given one.
+	refresh(rejected string) error
+}
+
+// apiKeyProvider is the credential provider of -url set up from
+// -apikey-command or -apikey-file, nil when the token is a fixed -apikey.
+var apiKeyProvider credentialProvider
+
+// setupCredentials sets up the credential provider of -apikey-command or
+// -apikey-file and reads a first token, so that a broken provider fails the
+// run before anything is done. The provider replaces the API key of -url and
+// of the configuration file.
+func setupCredentials() error {
+	switch {
+	case apiKeyCommand != "" && apiKeyFile != "":
+		return fmt.Errorf("apikey-command and apikey-file can't be combined")
+	case apiKeyCommand != "":
+		apiKeyProvider = &commandCredentials{command: apiKeyCommand}
+	case apiKeyFile != "":
+		apiKeyProvider = &fileCredentials{path: apiKeyFile}
+	default:
+		return nil
+	}
+	apiKey = ""
+	_, err := apiKeyProvider.token()
+	return err
+}
+
+// commandCredentials runs a command printing the token on stdout, again when
+// the token is rejected or older than -apikey-refresh.
+type commandCredentials struct {
+	command string
+	mu      sync.Mutex
+	current string
+	fetched time.Time
+}
+
+func (c *commandCredentials) token() (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.current == "" || (apiKeyRefresh > 0 && time.Since(c.fetched) >= apiKeyRefresh) {
+		if err := c.run(); err != nil {
+			return "", err
+		}
+	}
+	return c.current, nil
+}
+
+func (c *commandCredentials) refresh(rejected string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	// Concurrent calls rejected with the same token renew it once
+	if c.current != rejected {
+		return nil
+	}
+	return c.run()
+}
+
+func (c *commandCredentials) run() error {
+	cmd := shellCommand(context.Background(), c.command)
+	cmd.Stderr = os.Stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return fmt.Errorf("apikey-command: %v", err)
+	}
+	token := strings.TrimSpace(string(out))
+	if token == "" {
+		return errors.New("apikey-command printed no token")
+	}
+	c.current, c.fetched = token, time.Now()
+	return nil
+}
+
+// fileCredentials reads the token from a file, again whenever the file
+// changes.
+type fileCredentials struct {
+	path    string
+	mu      sync.Mutex
+	current string
+	modTime time.Time
+}
+
+func (f *fileCredentials) token() (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	info, err := os.Stat(f.path)
+	if err != nil {
+		return "", fmt.Errorf("apikey-file: %v", err)
+	}
+	if f.current == "" || !info.ModTime().Equal(f.modTime) {
+		if err := f.read(); err != nil {
+			return "", err
+		}
+		f.modTime = info.ModTime()
+	}
+	return f.current, nil
+}
+
+func (f *fileCredentials) refresh(rejected string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.current != rejected {
+		return nil
+	}
+	// The file may have been rewritten within the resolution of its
+	// modification time
+	return f.read()
+}
+
+func (f *fileCredentials) read() error {
+	data, err := os.ReadFile(f.path)
+	if err != nil {
+		return fmt.Errorf("apikey-file: %v", err)
+	}
+	token := strings.TrimSpace(string(data))
+	if token == "" {
+		return fmt.Errorf("apikey-file %s holds no token", f.path)
+	}
+	f.current = token
+	return nil
+}
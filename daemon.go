@@ -0,0 +1,171 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	daemonInterval time.Duration
+	listenAddr     string
+	driftWebhook   string
+)
+
+// daemonState holds the result of the latest check, exposed as metrics.
+type daemonState struct {
+	mu            sync.Mutex
+	drifts        []drift
+	lastCheck     time.Time
+	checkFailures int
+}
+
+var state = &daemonState{}
+
+// runDaemon checks for drift every -interval until the run is cancelled,
+// serving the results as Prometheus metrics on -listen. The configuration
+// file is reloaded on SIGHUP.
+func runDaemon(ctx context.Context) {
+	fmt.Printf("Starting daemon, checking every %s\n", daemonInterval)
+
+	if leaseName != "" {
+		// Stand by until the Lease is acquired, and wait for its release
+		// before exiting
+		election = &leaderElector{}
+		released := make(chan struct{})
+		go func() {
+			runLeaderElection(ctx)
+			close(released)
+		}()
+		defer func() { <-released }()
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", state.serveMetrics)
+	// The webhook runs -reconcile-command, so it is only served with a token
+	if webhookToken != "" {
+		mux.HandleFunc("/webhook/grafana", serveWebhook)
+	} else {
+		fmt.Println("Webhook disabled: set -webhook-token to serve /webhook/grafana")
+	}
+	// The control APIs trigger pushes, so they are only served with a token
+	if controlToken != "" {
+		mux.HandleFunc("/sync", serveSync(ctx))
+		mux.HandleFunc("/sync/events", serveSync(ctx))
+		if grpcListen != "" {
+			go serveControlGRPC(ctx)
+		}
+	} else {
+		fmt.Println("Control API disabled: set -control-token to serve /sync and -grpc-listen")
+	}
+	if len(cfg.Jobs) > 0 {
+		fmt.Printf("Scheduling %d job(s)\n", len(cfg.Jobs))
+	}
+	// Jobs may be added by reloading the configuration
+	go runJobs(ctx)
+	go watchConfigFile(ctx)
+	go func() {
+		fmt.Printf("Serving metrics on %s/metrics\n", listenAddr)
+		log.Fatal(http.ListenAndServe(listenAddr, mux))
+	}()
+
+	ticker := time.NewTicker(daemonInterval)
+	defer ticker.Stop()
+	for {
+		runScheduledCheck(ctx)
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// runScheduledCheck runs one drift check, records it and sends the webhook
+// alert when the set of drifted dashboards changed. Standby replicas leave
+// the checks to the leader.
+func runScheduledCheck(ctx context.Context) {
+	if !election.isLeader() {
+		return
+	}
+	syncMu.Lock()
+	drifts, err := checkDrift(ctx)
+	syncMu.Unlock()
+
+	state.mu.Lock()
+	defer state.mu.Unlock()
+	if err != nil {
+		state.checkFailures++
+		log.Printf("Error checking dashboards: %s", describeError(err))
+		return
+	}
+
+	changed := driftKey(drifts) != driftKey(state.drifts)
+	state.drifts = drifts
+	state.lastCheck = time.Now()
+	log.Printf("Check finished: %d drifted dashboard(s)", len(drifts))
+
+	if changed && len(drifts) > 0 && driftWebhook != "" {
+		if err := sendDriftAlert(drifts); err != nil {
+			log.Printf("Error sending drift alert: %v", err)
+		}
+	}
+}
+
+func driftKey(drifts []drift) string {
+	var keys []string
+	for _, d := range drifts {
+		keys = append(keys, d.UID+"/"+d.Reason)
+	}
+	return strings.Join(keys, ",")
+}
+
+func sendDriftAlert(drifts []drift) error {
+	body, _ := json.Marshal(map[string]interface{}{
+		"text":   fmt.Sprintf("grafana-sync: %d dashboard(s) drifted from %s on %s", len(drifts), directory, baseURL),
+		"drifts": drifts,
+	})
+	resp, err := http.Post(driftWebhook, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 400 {
+		return fmt.Errorf("webhook returned %d", resp.StatusCode)
+	}
+	return nil
+}
+
+func (s *daemonState) serveMetrics(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	fmt.Fprintln(w, "# HELP grafana_sync_drifted_dashboards Number of local dashboards missing or changed on the instance.")
+	fmt.Fprintln(w, "# TYPE grafana_sync_drifted_dashboards gauge")
+	fmt.Fprintf(w, "grafana_sync_drifted_dashboards %d\n", len(s.drifts))
+	fmt.Fprintln(w, "# HELP grafana_sync_dashboard_drift Set to 1 for every drifted dashboard.")
+	fmt.Fprintln(w, "# TYPE grafana_sync_dashboard_drift gauge")
+	for _, d := range s.drifts {
+		fmt.Fprintf(w, "grafana_sync_dashboard_drift{uid=%q,title=%q,reason=%q} 1\n", d.UID, d.Title, d.Reason)
+	}
+	fmt.Fprintln(w, "# HELP grafana_sync_last_check_timestamp_seconds Time of the last successful check.")
+	fmt.Fprintln(w, "# TYPE grafana_sync_last_check_timestamp_seconds gauge")
+	fmt.Fprintf(w, "grafana_sync_last_check_timestamp_seconds %d\n", s.lastCheck.Unix())
+	fmt.Fprintln(w, "# HELP grafana_sync_check_failures_total Number of checks that failed.")
+	fmt.Fprintln(w, "# TYPE grafana_sync_check_failures_total counter")
+	fmt.Fprintf(w, "grafana_sync_check_failures_total %d\n", s.checkFailures)
+	fmt.Fprintln(w, "# HELP grafana_sync_leader Set to 1 when this replica runs the scheduled syncs.")
+	fmt.Fprintln(w, "# TYPE grafana_sync_leader gauge")
+	leader := 0
+	if election.isLeader() {
+		leader = 1
+	}
+	fmt.Fprintf(w, "grafana_sync_leader %d\n", leader)
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"encoding/json"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// dashboardFiles returns the dashboard files of the local dashboards
+// directory, leaving out sidecar files and compose manifests.
+func dashboardFiles() ([]string, error) {
+	paths, err := dashboardPaths(directory)
+	if err != nil {
+		return nil, err
+	}
+	var files []string
+	for _, path := range paths {
+		if !isComposeManifest(path) {
+			files = append(files, path)
+		}
+	}
+	return files, nil
+}
+
+// dashboardSources returns the files dashboards are pushed from: regular
+// dashboard files and compose manifests.
+func dashboardSources() ([]string, error) {
+	return dashboardPaths(directory)
+}
+
+// dashboardPaths returns the JSON files of the dashboards directory of dir,
+// leaving out sidecar files.
+func dashboardPaths(dir string) ([]string, error) {
+	files, err := dashboardDirFiles(dir)
+	if err != nil {
+		return nil, err
+	}
+	var paths []string
+	for _, path := range files {
+		if !strings.HasSuffix(path, permissionsSuffix) {
+			paths = append(paths, path)
+		}
+	}
+	return paths, nil
+}
+
+// dashboardDirFiles returns every JSON file of the dashboards directory of
+// dir and its subdirectories, but the fragments of compose manifests.
+func dashboardDirFiles(dir string) ([]string, error) {
+	dashboardDir := filepath.Join(dir, "dashboards")
+	if _, err := os.Stat(dashboardDir); err != nil {
+		return nil, err
+	}
+
+	var files []string
+	err := filepath.WalkDir(dashboardDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() && filepath.Ext(path) == ".json" {
+			files = append(files, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	fragments := composeFragments(files)
+	dashboards := files[:0]
+	for _, path := range files {
+		if !fragments[path] {
+			dashboards = append(dashboards, path)
+		}
+	}
+	return dashboards, nil
+}
+
+// loadDashboard returns the JSON pushed for a dashboard source: compose
+// manifests are assembled, URLs are rewritten, strings are translated, the
+// watermark of the profile is added and the configured transforms are
+// applied.
+func loadDashboard(path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if isComposeManifest(path) {
+		composed, err := composeDashboard(path)
+		if err != nil {
+			return nil, err
+		}
+		if data, err = json.Marshal(composed); err != nil {
+			return nil, err
+		}
+	}
+	if data, err = aliasDashboardUID(data); err != nil {
+		return nil, err
+	}
+	if data, err = rewriteURLs(data); err != nil {
+		return nil, err
+	}
+	if data, err = translateDashboard(data); err != nil {
+		return nil, err
+	}
+	if data, err = watermarkDashboard(data); err != nil {
+		return nil, err
+	}
+	return applyTransforms("dashboards", data)
+}
+
+// readDashboard loads a dashboard file as generic JSON so that all its
+// fields are kept intact.
+func readDashboard(path string) (map[string]interface{}, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var dashboard map[string]interface{}
+	if err := json.Unmarshal(data, &dashboard); err != nil {
+		return nil, err
+	}
+	return dashboard, nil
+}
+
+// writeDashboard saves a dashboard in the same format used by pull.
+func writeDashboard(path string, dashboard map[string]interface{}) error {
+	data, err := json.MarshalIndent(dashboard, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+// dashboardPanels returns every panel of a dashboard, including the panels
+// nested in collapsed rows. The returned maps are the ones held by the
+// dashboard, so changes to them are reflected in it.
+func dashboardPanels(dashboard map[string]interface{}) []map[string]interface{} {
+	var panels []map[string]interface{}
+	list, _ := dashboard["panels"].([]interface{})
+	for _, p := range list {
+		panel, ok := p.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		panels = append(panels, panel)
+		panels = append(panels, dashboardPanels(panel)...)
+	}
+	return panels
+}
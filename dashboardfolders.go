@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"sync"
+)
+
+// strictFolders makes push fail when -folder, or the folder a dashboard was
+// pulled from, is missing on the instance, instead of creating it.
+var strictFolders bool
+
+// pushFolderID returns the ID of the folder -folder names for push, created
+// unless -strict-folders when the instance has none with that title.
+func pushFolderID(ctx context.Context, title string) int {
+	id, err := lookups.folderID(ctx, title)
+	if errors.Is(err, errFolderNotFound) && !strictFolders {
+		var f folderInfo
+		if f, err = createFolder(ctx, folderInfo{Title: title}); err == nil {
+			lookups.addFolder(title, f.ID)
+			id = f.ID
+		}
+	}
+	if err != nil {
+		log.Fatalf("Error: %s", describeError(err))
+	}
+	return id
+}
+
+// ensurePushFolder creates a folder pushed resources go to unless it
+// exists, or with -strict-folders fails when it is missing.
+func ensurePushFolder(ctx context.Context, f folderInfo) error {
+	if !strictFolders {
+		return ensureFolder(ctx, f)
+	}
+	var current folderInfo
+	err := getJSON(ctx, "/api/folders/"+url.PathEscape(f.UID), &current)
+	if apiErr, ok := asAPIError(err); ok && apiErr.StatusCode == http.StatusNotFound {
+		return fmt.Errorf("folder %s is missing on the instance and -strict-folders is set", f.Title)
+	}
+	return err
+}
+
+// dashboardFolders tells push-dashboards which folder each dashboard goes
+// back to when -folder isn't given: the folder recorded for its file in the
+// manifest of the pulled directory, created on the instance when missing
+// along with the parents of nested folders listed in the folders file
+// unless -strict-folders.
+// Dashboards the manifest doesn't know go to the General folder. It is safe
+// for concurrent use.
+type dashboardFolders struct {
+	entries map[string]manifestEntry
+	folders map[string]folderInfo
+	mu      sync.Mutex
+	ensured map[string]error
+}
+
+// newDashboardFolders reads the manifest and the folders of -directory.
+// Without a manifest, every dashboard goes to the General folder.
+func newDashboardFolders() *dashboardFolders {
+	f := &dashboardFolders{entries: make(map[string]manifestEntry), folders: make(map[string]folderInfo), ensured: make(map[string]error)}
+	var folders []folderInfo
+	if err := readResources(directory, "folders", &folders); err == nil {
+		for _, folder := range folders {
+			f.folders[folder.UID] = folder
+		}
+	}
+	m, err := readManifest(directory)
+	if err != nil {
+		return f
+	}
+	for _, e := range m.Dashboards {
+		f.entries[filepath.Clean(e.Path)] = e
+	}
+	return f
+}
+
+// target returns the folder of the dashboard file at path, with the UID of
+// the instance under -uid-aliases and an empty UID for the General folder.
+func (f *dashboardFolders) target(ctx context.Context, path string) (folderInfo, error) {
+	rel, err := filepath.Rel(directory, path)
+	if err != nil {
+		return folderInfo{Title: generalFolder}, nil
+	}
+	e, ok := f.entries[rel]
+	if !ok || e.FolderUID == "" {
+		return folderInfo{Title: generalFolder}, nil
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	target := folderInfo{UID: environmentUID(e.FolderUID), Title: e.FolderTitle}
+	return target, f.ensure(ctx, e.FolderUID, e.FolderTitle)
+}
+
+// ensure creates the folder with the given logical UID unless it exists,
+// after its parents. Each folder is looked up, and created, once per run.
+func (f *dashboardFolders) ensure(ctx context.Context, uid, title string) error {
+	if err, ok := f.ensured[uid]; ok {
+		return err
+	}
+	f.ensured[uid] = fmt.Errorf("folder %s is its own ancestor", title)
+	folder := folderInfo{UID: environmentUID(uid), Title: title}
+	if parentUID := f.folders[uid].ParentUID; parentUID != "" {
+		parentTitle := f.folders[parentUID].Title
+		if parentTitle == "" {
+			parentTitle = parentUID
+		}
+		if err := f.ensure(ctx, parentUID, parentTitle); err != nil {
+			f.ensured[uid] = err
+			return err
+		}
+		folder.ParentUID = environmentUID(parentUID)
+	}
+	err := ensurePushFolder(ctx, folder)
+	f.ensured[uid] = err
+	return err
+}
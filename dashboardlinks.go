@@ -0,0 +1,192 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// dashboardLink is a link of the links bar of a dashboard: a link to a URL,
+// such as a runbook, or with type dashboards a list of the dashboards with
+// all of its tags.
+type dashboardLink struct {
+	Title       string   `json:"title"`
+	Type        string   `json:"type"`
+	URL         string   `json:"url,omitempty"`
+	Tags        []string `json:"tags,omitempty"`
+	Tooltip     string   `json:"tooltip,omitempty"`
+	Icon        string   `json:"icon,omitempty"`
+	AsDropdown  bool     `json:"asDropdown,omitempty"`
+	TargetBlank bool     `json:"targetBlank,omitempty"`
+	IncludeVars bool     `json:"includeVars,omitempty"`
+	KeepTime    bool     `json:"keepTime,omitempty"`
+}
+
+// name identifies a link across versions of a dashboard: its title, or its
+// URL or tags when it has none.
+func (l dashboardLink) name() string {
+	switch {
+	case l.Title != "":
+		return l.Title
+	case l.Type == "dashboards":
+		return "tags " + strings.Join(l.Tags, ",")
+	default:
+		return l.URL
+	}
+}
+
+// linksOf returns the dashboard links of a dashboard, in the order of the
+// links bar.
+func linksOf(dashboard map[string]interface{}) []dashboardLink {
+	var links []dashboardLink
+	data, _ := json.Marshal(dashboard["links"])
+	json.Unmarshal(data, &links)
+	return links
+}
+
+// aliasDashboardLinks replaces the UID of links to /d/<uid> in a dashboard
+// with uid, so that links between dashboards follow -uid-aliases.
+func aliasDashboardLinks(dashboard map[string]interface{}, uid func(string) string) {
+	rewriteDashboardLinks(dashboard, func(s string) string {
+		return dashboardURL.ReplaceAllStringFunc(s, func(m string) string {
+			return "/d/" + uid(m[len("/d/"):])
+		})
+	})
+}
+
+// linkChanges describes how the dashboard links of a local dashboard differ
+// from those of its remote version, both given as JSON: the links added,
+// removed or changed, and the new order of the links bar when only the
+// order changed.
+func linkChanges(remote, local []byte) []string {
+	var before, after map[string]interface{}
+	if json.Unmarshal(remote, &before) != nil || json.Unmarshal(local, &after) != nil {
+		return nil
+	}
+	from, to := linksOf(before), linksOf(after)
+	old := make(map[string]dashboardLink, len(from))
+	for _, l := range from {
+		old[l.name()] = l
+	}
+	var changes, kept, order []string
+	current := make(map[string]bool, len(to))
+	for _, l := range to {
+		current[l.name()] = true
+		o, ok := old[l.name()]
+		switch {
+		case !ok:
+			changes = append(changes, "added "+describeLink(l))
+			continue
+		case !reflect.DeepEqual(o, l):
+			changes = append(changes, "changed "+describeLink(l))
+		}
+		kept = append(kept, l.name())
+	}
+	for _, l := range from {
+		if !current[l.name()] {
+			changes = append(changes, "removed "+describeLink(l))
+		} else {
+			order = append(order, l.name())
+		}
+	}
+	if !reflect.DeepEqual(order, kept) {
+		changes = append(changes, "reordered "+strings.Join(kept, ", "))
+	}
+	return changes
+}
+
+// describeLink names a link along with its target.
+func describeLink(l dashboardLink) string {
+	if l.Type == "dashboards" {
+		return fmt.Sprintf("%q (dashboards tagged %s)", l.name(), strings.Join(l.Tags, ","))
+	}
+	return fmt.Sprintf("%q (%s)", l.name(), l.URL)
+}
+
+// Statuses of the links report.
+const (
+	linkOK = "ok"
+	// linkStale links point to a URL the urlRewrites replace on push.
+	linkStale = "stale"
+	// linkDangling links point to a dashboard UID missing from the directory.
+	linkDangling = "dangling"
+	// linkUnmatched dashboard lists have tags no local dashboard has.
+	linkUnmatched = "unmatched"
+)
+
+// reportLinks lists the dashboard links of every local dashboard in the
+// order of their links bar, flagging the links left behind by a migration.
+func reportLinks() {
+	files, err := dashboardSources()
+	if err != nil {
+		log.Fatalf("Error reading dashboards: %v", err)
+	}
+	type localDashboard struct {
+		path      string
+		dashboard map[string]interface{}
+	}
+	var dashboards []localDashboard
+	uids := make(map[string]bool)
+	var tagSets []map[string]bool
+	for _, path := range files {
+		var dashboard map[string]interface{}
+		if isComposeManifest(path) {
+			dashboard, err = composeDashboard(path)
+		} else {
+			dashboard, err = readDashboard(path)
+		}
+		if err != nil {
+			log.Fatalf("Error reading %s: %v", path, err)
+		}
+		dashboards = append(dashboards, localDashboard{path, dashboard})
+		if uid, _ := dashboard["uid"].(string); uid != "" {
+			uids[uid] = true
+		}
+		tags := make(map[string]bool)
+		list, _ := dashboard["tags"].([]interface{})
+		for _, t := range list {
+			if tag, ok := t.(string); ok {
+				tags[tag] = true
+			}
+		}
+		tagSets = append(tagSets, tags)
+	}
+	sort.Slice(dashboards, func(i, j int) bool { return dashboards[i].path < dashboards[j].path })
+
+	status := func(l dashboardLink) string {
+		if l.Type == "dashboards" {
+			for _, tags := range tagSets {
+				matched := true
+				for _, tag := range l.Tags {
+					matched = matched && tags[tag]
+				}
+				if matched {
+					return linkOK
+				}
+			}
+			return linkUnmatched
+		}
+		if rewriteURL(l.URL) != l.URL {
+			return linkStale
+		}
+		if m := dashboardURL.FindStringSubmatch(l.URL); m != nil && !uids[m[1]] {
+			return linkDangling
+		}
+		return linkOK
+	}
+
+	header := []string{"dashboard", "uid", "path", "position", "type", "title", "url", "tags", "status"}
+	var rows [][]string
+	for _, d := range dashboards {
+		title, _ := d.dashboard["title"].(string)
+		uid, _ := d.dashboard["uid"].(string)
+		for i, l := range linksOf(d.dashboard) {
+			rows = append(rows, []string{title, uid, d.path, strconv.Itoa(i + 1), l.Type, l.Title, l.URL, strings.Join(l.Tags, ","), status(l)})
+		}
+	}
+	writeReport(header, rows)
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"sort"
+
+	"gopkg.in/yaml.v3"
+)
+
+var (
+	// datasourceOverridesFile patches datasources per environment on push.
+	datasourceOverridesFile string
+	environment             string
+)
+
+// datasourceOverride replaces fields of a named datasource in one
+// environment. Only the jsonData and secureJsonData keys it lists are
+// replaced, the others are kept. String values may contain ${VAR}
+// placeholders resolved from the environment.
+type datasourceOverride struct {
+	URL            string                 `yaml:"url"`
+	User           string                 `yaml:"user"`
+	Database       string                 `yaml:"database"`
+	JSONData       map[string]interface{} `yaml:"jsonData"`
+	SecureJSONData map[string]string      `yaml:"secureJsonData"`
+}
+
+// datasourceOverrides holds the overrides of every datasource by name, by
+// environment.
+var datasourceOverrides map[string]map[string]datasourceOverride
+
+// loadDatasourceOverrides reads -datasource-overrides.
+func loadDatasourceOverrides() error {
+	data, err := os.ReadFile(datasourceOverridesFile)
+	if err != nil {
+		return err
+	}
+	return yaml.Unmarshal(data, &datasourceOverrides)
+}
+
+// environmentOverrides returns the datasource overrides of -environment,
+// none without an overrides file.
+func environmentOverrides() (map[string]datasourceOverride, error) {
+	if datasourceOverridesFile == "" {
+		return nil, nil
+	}
+	overrides, ok := datasourceOverrides[environment]
+	if !ok {
+		return nil, fmt.Errorf("environment %q not found in %s", environment, datasourceOverridesFile)
+	}
+	return overrides, nil
+}
+
+// overrideDatasource applies an override to a datasource.
+func overrideDatasource(ds datasource, o datasourceOverride) (datasource, error) {
+	var err error
+	for _, field := range []struct {
+		value    string
+		override *string
+	}{
+		{o.URL, &ds.URL},
+		{o.User, &ds.User},
+		{o.Database, &ds.Database},
+	} {
+		if field.value == "" {
+			continue
+		}
+		if *field.override, err = expandPlaceholders(field.value); err != nil {
+			return ds, err
+		}
+	}
+
+	if len(o.JSONData) > 0 {
+		jsonData := make(map[string]interface{}, len(ds.JSONData)+len(o.JSONData))
+		for key, value := range ds.JSONData {
+			jsonData[key] = value
+		}
+		for key, value := range o.JSONData {
+			if s, ok := value.(string); ok {
+				if value, err = expandPlaceholders(s); err != nil {
+					return ds, err
+				}
+			}
+			jsonData[key] = value
+		}
+		ds.JSONData = jsonData
+	}
+
+	if len(o.SecureJSONData) > 0 {
+		secure := make(map[string]string, len(ds.SecureJSONData)+len(o.SecureJSONData))
+		for key, value := range ds.SecureJSONData {
+			secure[key] = value
+		}
+		for key, value := range o.SecureJSONData {
+			if secure[key], err = expandPlaceholders(value); err != nil {
+				return ds, err
+			}
+		}
+		ds.SecureJSONData = secure
+	}
+	return ds, nil
+}
+
+// warnUnusedOverrides reports the overrides naming no local datasource,
+// usually a renamed datasource or a typo.
+func warnUnusedOverrides(overrides map[string]datasourceOverride, datasources []datasource) {
+	names := make(map[string]bool, len(datasources))
+	for _, ds := range datasources {
+		names[ds.Name] = true
+	}
+	var unused []string
+	for name := range overrides {
+		if !names[name] {
+			unused = append(unused, name)
+		}
+	}
+	sort.Strings(unused)
+	for _, name := range unused {
+		log.Printf("Warning: datasource override %s of environment %s matches no datasource", name, environment)
+	}
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+)
+
+// convertDatasourceRefs makes push replace legacy datasource references by
+// UID references.
+var convertDatasourceRefs bool
+
+// datasourceRef is a modern datasource reference.
+type datasourceRef struct {
+	Type string `json:"type"`
+	UID  string `json:"uid"`
+}
+
+// builtinDatasources are the special datasources referenced by name in old
+// dashboards.
+var builtinDatasources = map[string]datasourceRef{
+	"-- Grafana --":   {Type: "datasource", UID: "grafana"},
+	"-- Mixed --":     {Type: "datasource", UID: "-- Mixed --"},
+	"-- Dashboard --": {Type: "datasource", UID: "-- Dashboard --"},
+}
+
+// defaultDatasource is the UID of the datasource set on panels using the
+// default datasource.
+var defaultDatasource string
+
+// convertDashboardDatasources replaces the name and numeric ID datasource
+// references of dashboards exported from Grafana 7 and earlier with UID
+// references, resolved against the datasources of the target instance.
+// References to template variables and to the default datasource are left
+// alone, as are names the instance doesn't know, which are reported.
+func convertDashboardDatasources(ctx context.Context, name string, data []byte) ([]byte, error) {
+	var dashboard map[string]interface{}
+	if err := json.Unmarshal(data, &dashboard); err != nil {
+		return nil, err
+	}
+
+	var lookupErr error
+	convert := func(holder map[string]interface{}) {
+		var key string
+		switch ds := holder["datasource"].(type) {
+		case string:
+			key = ds
+		case float64:
+			key = fmt.Sprint(ds)
+		default:
+			return
+		}
+		if key == "" || key[0] == '$' {
+			return
+		}
+		if ref, ok := builtinDatasources[key]; ok {
+			holder["datasource"] = ref
+			return
+		}
+		ref, ok, err := lookups.datasource(ctx, key)
+		switch {
+		case err != nil:
+			lookupErr = err
+		case ok:
+			holder["datasource"] = ref
+		default:
+			log.Printf("Warning: %s references unknown datasource %q", name, key)
+		}
+	}
+
+	for _, panel := range dashboardPanels(dashboard) {
+		convert(panel)
+		targets, _ := panel["targets"].([]interface{})
+		for _, t := range targets {
+			if target, ok := t.(map[string]interface{}); ok {
+				convert(target)
+			}
+		}
+	}
+	for _, section := range []string{"templating", "annotations"} {
+		s, _ := dashboard[section].(map[string]interface{})
+		list, _ := s["list"].([]interface{})
+		for _, item := range list {
+			if holder, ok := item.(map[string]interface{}); ok {
+				convert(holder)
+			}
+		}
+	}
+	if lookupErr != nil {
+		return nil, lookupErr
+	}
+	return json.Marshal(dashboard)
+}
+
+// injectDefaultDatasource binds the panels using the default datasource,
+// either with a null datasource or with "default", and their queries to
+// -default-datasource, so they don't silently use another backend when the
+// target instance has a different default.
+func injectDefaultDatasource(ctx context.Context, data []byte) ([]byte, error) {
+	ref, ok, err := lookups.datasourceByUID(ctx, defaultDatasource)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, fmt.Errorf("default datasource %q not found on the instance", defaultDatasource)
+	}
+
+	var dashboard map[string]interface{}
+	if err := json.Unmarshal(data, &dashboard); err != nil {
+		return nil, err
+	}
+
+	usesDefault := func(holder map[string]interface{}) bool {
+		ds, ok := holder["datasource"]
+		return ok && (ds == nil || ds == "default")
+	}
+	for _, panel := range dashboardPanels(dashboard) {
+		if !usesDefault(panel) {
+			continue
+		}
+		panel["datasource"] = ref
+		targets, _ := panel["targets"].([]interface{})
+		for _, t := range targets {
+			if target, ok := t.(map[string]interface{}); ok && usesDefault(target) {
+				target["datasource"] = ref
+			}
+		}
+	}
+	return json.Marshal(dashboard)
+}
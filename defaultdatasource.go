@@ -0,0 +1,52 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// localDefaultDatasource returns the name of the datasource marked default
+// among the datasources synced, if any. Grafana has one default datasource
+// per organization, so several are refused.
+func localDefaultDatasource(datasources []datasource) (string, error) {
+	var defaults []string
+	for _, ds := range datasources {
+		if ds.IsDefault && included("datasources", ds.Name) {
+			defaults = append(defaults, ds.Name)
+		}
+	}
+	if len(defaults) > 1 {
+		return "", fmt.Errorf("several datasources are marked default: %s", strings.Join(defaults, ", "))
+	}
+	if len(defaults) == 0 {
+		return "", nil
+	}
+	return defaults[0], nil
+}
+
+// applyDefaultDatasource makes the named datasource the default one of the
+// organization once the datasources are pushed, so that a restored instance
+// doesn't keep the default it came up with, such as a provisioned one.
+func applyDefaultDatasource(ctx context.Context, name string) error {
+	var ds map[string]interface{}
+	if err := getJSON(ctx, "/api/datasources/name/"+url.PathEscape(name), &ds); err != nil {
+		return err
+	}
+	if isDefault, _ := ds["isDefault"].(bool); isDefault {
+		return nil
+	}
+	uid, _ := ds["uid"].(string)
+	ds["isDefault"] = true
+	body, err := json.Marshal(ds)
+	if err != nil {
+		return err
+	}
+	if _, err := apiRequest(ctx, "PUT", "/api/datasources/uid/"+url.PathEscape(uid), body); err != nil {
+		return err
+	}
+	printChange("Set default datasource: %s\n", name)
+	return nil
+}
@@ -0,0 +1,279 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// diffContext is the number of unchanged lines shown around changes.
+const diffContext = 3
+
+// diffLocal prints a unified diff from the instance to the local dashboards,
+// datasources and folders, normalized as they are compared by -changed-only,
+// and exits with a non-zero status when they differ. Resources that are
+// only on the instance are not reported, since push leaves them alone.
+func diffLocal(ctx context.Context) {
+	differences := 0
+	report := func(from, to string, remote, local []byte) {
+		if d := unifiedDiff(from, to, remote, local); d != "" {
+			fmt.Print(d)
+			differences++
+		}
+	}
+
+	if files, err := dashboardSources(); err == nil {
+		for _, path := range files {
+			if stopped(ctx) {
+				return
+			}
+			local, remote, uid, err := dashboardDiffSides(ctx, path)
+			if err != nil {
+				log.Fatalf("Error comparing %s: %s", path, describeError(err))
+			}
+			report("remote/dashboards/"+uid, path, remote, local)
+			if remote != nil {
+				for _, change := range linkChanges(remote, local) {
+					fmt.Printf("Dashboard links of %s: %s\n", path, change)
+				}
+			}
+		}
+	}
+
+	if _, err := os.Stat(resourceFile(directory, "datasources")); err == nil && roleAllows(ctx, "datasources", "Admin") {
+		var datasources []datasource
+		if err := readResources(directory, "datasources", &datasources); err != nil {
+			log.Fatalf("Error reading datasources file: %v", err)
+		}
+		overrides, err := environmentOverrides()
+		if err != nil {
+			log.Fatalf("Error: %v", err)
+		}
+		remote, err := fetchRemoteState(ctx, "datasources")
+		if err != nil {
+			log.Fatalf("Error fetching datasources: %s", describeError(err))
+		}
+		for _, ds := range datasources {
+			if !included("datasources", ds.Name) {
+				continue
+			}
+			if o, ok := overrides[ds.Name]; ok {
+				if ds, err = overrideDatasource(ds, o); err != nil {
+					log.Fatalf("Error overriding datasource %s: %v", ds.Name, err)
+				}
+			}
+			var local datasource
+			if _, err := pushPayload("datasources", ds, &local); err != nil {
+				log.Fatalf("Error preparing datasource %s: %v", ds.Name, err)
+			}
+			// The instance doesn't return secrets
+			local.SecureJSONData = nil
+			var remoteJSON []byte
+			if r, ok := remote[resourceKey(local)].(datasource); ok {
+				if local.UID == "" {
+					r.UID = ""
+				}
+				remoteJSON, _ = json.MarshalIndent(r, "", "  ")
+			}
+			localJSON, _ := json.MarshalIndent(local, "", "  ")
+			report("remote/datasources/"+local.Name, "datasources/"+local.Name, remoteJSON, localJSON)
+		}
+	}
+
+	if _, err := os.Stat(resourceFile(directory, "folders")); err == nil {
+		var folders []folderInfo
+		if err := readResources(directory, "folders", &folders); err != nil {
+			log.Fatalf("Error reading folders file: %v", err)
+		}
+		remote, err := fetchRemoteState(ctx, "folders")
+		if err != nil {
+			log.Fatalf("Error fetching folders: %s", describeError(err))
+		}
+		for _, f := range folders {
+			if !included("folders", f.Title) {
+				continue
+			}
+			f.UID, f.ParentUID = environmentUID(f.UID), environmentUID(f.ParentUID)
+			var local folderInfo
+			if _, err := pushPayload("folders", f, &local); err != nil {
+				log.Fatalf("Error preparing folder %s: %v", f.Title, err)
+			}
+			var remoteJSON []byte
+			if r, ok := remote[resourceKey(local)]; ok {
+				remoteJSON, _ = json.MarshalIndent(r, "", "  ")
+			}
+			localJSON, _ := json.MarshalIndent(local, "", "  ")
+			report("remote/folders/"+local.Title, "folders/"+local.Title, remoteJSON, localJSON)
+		}
+	}
+
+	if differences > 0 {
+		fmt.Printf("Found %d difference(s)\n", differences)
+		os.Exit(1)
+	}
+	fmt.Println("No differences found")
+}
+
+// dashboardDiffSides returns the normalized JSON of a local dashboard and of
+// the dashboard with its UID on the instance, empty when there is none.
+func dashboardDiffSides(ctx context.Context, path string) (local, remote []byte, uid string, err error) {
+	data, err := loadDashboard(path)
+	if err != nil {
+		return nil, nil, "", err
+	}
+	var dashboard struct {
+		UID string `json:"uid"`
+	}
+	if err := json.Unmarshal(data, &dashboard); err != nil {
+		return nil, nil, "", err
+	}
+	if local, err = normalizeDashboard(data); err != nil {
+		return nil, nil, "", err
+	}
+	if dashboard.UID == "" {
+		return local, nil, filepath.Base(path), nil
+	}
+	raw, _, err := client.GetRawDashboardByUID(ctx, dashboard.UID)
+	if apiErr, ok := asAPIError(err); ok && apiErr.StatusCode == http.StatusNotFound {
+		return local, nil, dashboard.UID, nil
+	}
+	if err == nil {
+		raw, err = filterDashboardFields(raw)
+	}
+	if err == nil {
+		remote, err = normalizeDashboard(raw)
+	}
+	return local, remote, dashboard.UID, err
+}
+
+// unifiedDiff returns the unified diff between two texts, empty when they
+// are the same. A nil text stands for a missing file.
+func unifiedDiff(fromName, toName string, a, b []byte) string {
+	if string(a) == string(b) {
+		return ""
+	}
+	ops := diffLines(splitLines(a), splitLines(b))
+
+	// Lines of each side before every operation
+	aPos, bPos := make([]int, len(ops)+1), make([]int, len(ops)+1)
+	var changes []int
+	for i, op := range ops {
+		aPos[i+1], bPos[i+1] = aPos[i], bPos[i]
+		if op.kind != '+' {
+			aPos[i+1]++
+		}
+		if op.kind != '-' {
+			bPos[i+1]++
+		}
+		if op.kind != ' ' {
+			changes = append(changes, i)
+		}
+	}
+
+	var out strings.Builder
+	if a == nil {
+		fromName = "/dev/null"
+	}
+	if b == nil {
+		toName = "/dev/null"
+	}
+	fmt.Fprintf(&out, "--- %s\n+++ %s\n", fromName, toName)
+	for i := 0; i < len(changes); {
+		j := i
+		for j+1 < len(changes) && changes[j+1]-changes[j]-1 <= 2*diffContext {
+			j++
+		}
+		start, end := max(changes[i]-diffContext, 0), min(changes[j]+diffContext+1, len(ops))
+		fmt.Fprintf(&out, "@@ -%s +%s @@\n", hunkRange(aPos[start], aPos[end]), hunkRange(bPos[start], bPos[end]))
+		for _, op := range ops[start:end] {
+			fmt.Fprintf(&out, "%c%s\n", op.kind, op.line)
+		}
+		i = j + 1
+	}
+	return out.String()
+}
+
+// hunkRange formats the lines from, exclusive, to to, inclusive, of a side
+// of a hunk.
+func hunkRange(from, to int) string {
+	if to == from {
+		return fmt.Sprintf("%d,0", from)
+	}
+	if to-from == 1 {
+		return fmt.Sprintf("%d", from+1)
+	}
+	return fmt.Sprintf("%d,%d", from+1, to-from)
+}
+
+func splitLines(data []byte) []string {
+	if len(data) == 0 {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+}
+
+// diffOp is a line of a diff: kept (' '), removed ('-') or added ('+').
+type diffOp struct {
+	kind byte
+	line string
+}
+
+// diffLines returns the operations turning a into b, from the longest
+// common subsequence of their lines. The common prefix and suffix are
+// skipped first, which leaves little to compare for typical changes.
+func diffLines(a, b []string) []diffOp {
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+	ma, mb := a[prefix:len(a)-suffix], b[prefix:len(b)-suffix]
+
+	// lcs[i][j] is the length of the longest common subsequence of ma[i:]
+	// and mb[j:]
+	lcs := make([][]int32, len(ma)+1)
+	for i := range lcs {
+		lcs[i] = make([]int32, len(mb)+1)
+	}
+	for i := len(ma) - 1; i >= 0; i-- {
+		for j := len(mb) - 1; j >= 0; j-- {
+			if ma[i] == mb[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	ops := make([]diffOp, 0, len(a)+len(b))
+	for _, line := range a[:prefix] {
+		ops = append(ops, diffOp{' ', line})
+	}
+	i, j := 0, 0
+	for i < len(ma) || j < len(mb) {
+		switch {
+		case i < len(ma) && j < len(mb) && ma[i] == mb[j]:
+			ops = append(ops, diffOp{' ', ma[i]})
+			i++
+			j++
+		case j == len(mb) || (i < len(ma) && lcs[i+1][j] >= lcs[i][j+1]):
+			ops = append(ops, diffOp{'-', ma[i]})
+			i++
+		default:
+			ops = append(ops, diffOp{'+', mb[j]})
+			j++
+		}
+	}
+	for _, line := range a[len(a)-suffix:] {
+		ops = append(ops, diffOp{' ', line})
+	}
+	return ops
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// diffDirectories prints a unified diff from -compare-directory to
+// -directory, two pulled directories, and exits with a non-zero status when
+// they differ. Dashboards are matched by UID and normalized as by diff;
+// datasources, folders and notification channels are matched as by
+// -changed-only. It works offline, for CI jobs without credentials.
+func diffDirectories() {
+	if compareDir == "" {
+		log.Fatalf("Error: diff-dirs requires -compare-directory")
+	}
+	differences := 0
+	report := func(from, to string, a, b []byte) {
+		if d := unifiedDiff(from, to, a, b); d != "" {
+			fmt.Print(d)
+			differences++
+		}
+	}
+
+	before, err := directoryDashboards(compareDir)
+	if err != nil {
+		log.Fatalf("Error reading %s: %v", compareDir, err)
+	}
+	after, err := directoryDashboards(directory)
+	if err != nil {
+		log.Fatalf("Error reading %s: %v", directory, err)
+	}
+	for _, key := range unionKeys(before, after) {
+		a, b := before[key], after[key]
+		report(a.path, b.path, a.data, b.data)
+	}
+
+	for _, kind := range []string{"datasources", "folders", "notifications"} {
+		before, err := directoryResources(compareDir, kind)
+		if err != nil {
+			log.Fatalf("Error reading %s: %v", resourceFile(compareDir, kind), err)
+		}
+		after, err := directoryResources(directory, kind)
+		if err != nil {
+			log.Fatalf("Error reading %s: %v", resourceFile(directory, kind), err)
+		}
+		for _, key := range unionKeys(before, after) {
+			a, b := before[key], after[key]
+			report(a.path, b.path, a.data, b.data)
+		}
+	}
+
+	if differences > 0 {
+		fmt.Printf("Found %d difference(s)\n", differences)
+		os.Exit(1)
+	}
+	fmt.Println("No differences found")
+}
+
+// dirEntry is a resource of a pulled directory as compared by diff-dirs:
+// the name it is shown under and its normalized JSON.
+type dirEntry struct {
+	path string
+	data []byte
+}
+
+// directoryDashboards returns the normalized dashboards of a pulled
+// directory by UID, or by path for dashboards without one. Compose
+// manifests are assembled.
+func directoryDashboards(dir string) (map[string]dirEntry, error) {
+	files, err := dashboardPaths(dir)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	dashboards := make(map[string]dirEntry, len(files))
+	for _, path := range files {
+		var dashboard map[string]interface{}
+		if isComposeManifest(path) {
+			dashboard, err = composeDashboard(path)
+		} else {
+			dashboard, err = readDashboard(path)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		data, _ := json.Marshal(dashboard)
+		if data, err = normalizeDashboard(data); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		key, _ := dashboard["uid"].(string)
+		if key == "" {
+			rel, _ := filepath.Rel(dir, path)
+			key = "path:" + rel
+		}
+		dashboards[key] = dirEntry{path: path, data: data}
+	}
+	return dashboards, nil
+}
+
+// directoryResources returns the items of the list file of a resource kind
+// by resourceKey, none when the file doesn't exist.
+func directoryResources(dir, kind string) (map[string]dirEntry, error) {
+	items, err := readResourceList(dir, kind)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	resources := make(map[string]dirEntry, len(items))
+	for _, item := range items {
+		key := resourceKey(item)
+		data, _ := json.MarshalIndent(item, "", "  ")
+		resources[key] = dirEntry{path: filepath.Join(dir, kind, key), data: data}
+	}
+	return resources, nil
+}
+
+// unionKeys returns the keys of both maps, sorted.
+func unionKeys(a, b map[string]dirEntry) []string {
+	var keys []string
+	for key := range a {
+		keys = append(keys, key)
+	}
+	for key := range b {
+		if _, ok := a[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// dryRun runs pushes without changing the instance: every request but GET,
+// HEAD and OPTIONS is reported instead of sent, and answered with an empty
+// JSON object as if it had succeeded.
+var dryRun bool
+
+// outcomeDryRun replaces outcomePushed in the summary of a dry run.
+const outcomeDryRun = "would be pushed"
+
+// printChange prints the line reporting a change made to the instance,
+// except in a dry run, which reports the change it would make instead.
+func printChange(format string, a ...interface{}) {
+	if !dryRun {
+		fmt.Printf(format, a...)
+	}
+}
+
+// mutating reports whether a request may change the instance.
+func mutating(req *http.Request) bool {
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return false
+	}
+	return true
+}
+
+// dryRunResponse reports what a mutating request would do and answers it
+// without sending it. Requests that create a resource are checked against
+// the instance first: they are reported as updates when they would save
+// over an existing resource, and answered with the error of the instance
+// when another resource already has the name.
+func (t *transport) dryRunResponse(req *http.Request) (*http.Response, error) {
+	var body []byte
+	if req.Body != nil {
+		body, _ = io.ReadAll(req.Body)
+		req.Body.Close()
+	}
+	var fields struct {
+		Dashboard struct {
+			UID   string `json:"uid"`
+			Title string `json:"title"`
+		} `json:"dashboard"`
+		FolderID  int64  `json:"folderId"`
+		FolderUID string `json:"folderUid"`
+		ParentUID string `json:"parentUid"`
+		Title     string `json:"title"`
+		Name      string `json:"name"`
+	}
+	json.Unmarshal(body, &fields)
+	base := req.URL.Path
+	if i := strings.Index(base, "/api/"); i >= 0 {
+		base = base[:i]
+	}
+
+	var conflict string
+	verb := map[string]string{http.MethodPost: "create", http.MethodPut: "update", http.MethodPatch: "update", http.MethodDelete: "delete"}[req.Method]
+	switch {
+	case verb == "":
+		verb = req.Method
+	case req.Method == http.MethodPost && strings.HasSuffix(req.URL.Path, "/permissions"):
+		verb = "replace"
+	case req.Method == http.MethodPost && req.URL.Path == base+"/api/dashboards/db":
+		// Dashboards are saved with overwrite, so an existing dashboard is
+		// updated, and so is the dashboard with the same title in the folder
+		if fields.Dashboard.UID != "" && t.exists(req, base+"/api/dashboards/uid/"+url.PathEscape(fields.Dashboard.UID)) ||
+			t.dashboardTitleTaken(req, base, fields.Dashboard.Title, fields.FolderUID, fields.FolderID) {
+			verb = "update"
+		}
+	case req.Method == http.MethodPost && req.URL.Path == base+"/api/datasources":
+		if fields.Name != "" && t.exists(req, base+"/api/datasources/name/"+url.PathEscape(fields.Name)) {
+			conflict = "data source with the same name already exists"
+		}
+	case req.Method == http.MethodPost && req.URL.Path == base+"/api/folders":
+		var folders []folderInfo
+		query := url.Values{}
+		if fields.ParentUID != "" {
+			query.Set("parentUid", fields.ParentUID)
+		}
+		if t.get(req, base+"/api/folders", query, &folders) {
+			for _, f := range folders {
+				if f.Title == fields.Title {
+					conflict = "a folder with the same name already exists"
+				}
+			}
+		}
+	case req.Method == http.MethodPost && req.URL.Path == base+"/api/alert-notifications":
+		var channels []notificationChannel
+		if t.get(req, base+"/api/alert-notifications", nil, &channels) {
+			for _, c := range channels {
+				if c.Name == fields.Name {
+					conflict = "alert notification with the same name already exists"
+				}
+			}
+		}
+	}
+	var name string
+	for _, n := range []string{fields.Dashboard.Title, fields.Title, fields.Name} {
+		if n != "" {
+			name = fmt.Sprintf(" (%q)", n)
+			break
+		}
+	}
+
+	status, answer := http.StatusOK, []byte("{}")
+	if conflict != "" {
+		fmt.Printf("Dry run: would fail to %s %s%s: %s\n", verb, req.URL.Path, name, conflict)
+		status = http.StatusConflict
+		answer, _ = json.Marshal(map[string]string{"message": conflict})
+	} else {
+		fmt.Printf("Dry run: would %s %s%s\n", verb, req.URL.Path, name)
+	}
+
+	return &http.Response{
+		Status:     fmt.Sprintf("%d %s", status, http.StatusText(status)),
+		StatusCode: status,
+		Proto:      "HTTP/1.1",
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		Header:     http.Header{"Content-Type": {"application/json"}},
+		Body:       io.NopCloser(bytes.NewReader(answer)),
+		Request:    req,
+	}, nil
+}
+
+// dashboardTitleTaken reports whether a dashboard with the given title is
+// in the folder, given by UID or else by ID, on the instance of req.
+func (t *transport) dashboardTitleTaken(req *http.Request, base, title, folderUID string, folderID int64) bool {
+	var hits []struct {
+		Title     string `json:"title"`
+		FolderUID string `json:"folderUid"`
+		FolderID  int64  `json:"folderId"`
+	}
+	if title == "" || !t.get(req, base+"/api/search", url.Values{"type": {"dash-db"}, "query": {title}}, &hits) {
+		return false
+	}
+	for _, hit := range hits {
+		sameFolder := hit.FolderID == folderID
+		if folderUID != "" {
+			sameFolder = hit.FolderUID == folderUID
+		}
+		if hit.Title == title && sameFolder {
+			return true
+		}
+	}
+	return false
+}
+
+// exists reports whether a GET on a path of the instance of req succeeds.
+func (t *transport) exists(req *http.Request, path string) bool {
+	return t.get(req, path, nil, nil)
+}
+
+// get sends a GET on a path of the instance of req and decodes the JSON it
+// answers into out, unless out is nil. It reports whether the GET succeeded.
+func (t *transport) get(req *http.Request, path string, query url.Values, out interface{}) bool {
+	target := *req.URL
+	target.Path, target.RawPath, target.RawQuery = path, "", query.Encode()
+	get, err := http.NewRequestWithContext(req.Context(), http.MethodGet, target.String(), nil)
+	if err != nil {
+		return false
+	}
+	get.Header = req.Header.Clone()
+	resp, err := t.next.RoundTrip(get)
+	if err != nil {
+		return false
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 400 {
+		return false
+	}
+	return out == nil || json.NewDecoder(resp.Body).Decode(out) == nil
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+)
+
+// enterprise enables the features of Grafana Enterprise, such as datasource
+// permissions.
+var enterprise bool
+
+// datasourcePermissions is the response of the datasource permissions
+// endpoint of Grafana Enterprise.
+type datasourcePermissions struct {
+	Enabled     bool                   `json:"enabled"`
+	Permissions []datasourcePermission `json:"permissions"`
+}
+
+type datasourcePermission struct {
+	ID          int    `json:"id"`
+	UserLogin   string `json:"userLogin"`
+	Team        string `json:"team"`
+	BuiltInRole string `json:"builtInRole"`
+	Permission  int    `json:"permission"`
+}
+
+// item returns the permission as a permissions file entry.
+func (e datasourcePermission) item() permissionItem {
+	return permissionItem{Role: e.BuiltInRole, Team: e.Team, User: e.UserLogin, Permission: e.Permission}
+}
+
+// datasourcePermissionsFile returns the file holding the permissions of
+// the datasources of dir, next to datasources.json and keyed by datasource
+// name.
+func datasourcePermissionsFile(dir string) string {
+	return permissionsFile(resourceFile(dir, "datasources"))
+}
+
+// datasourceID returns the ID of a datasource of the instance by name.
+func datasourceID(ctx context.Context, name string) (int, error) {
+	var ds struct {
+		ID int `json:"id"`
+	}
+	err := getJSON(ctx, "/api/datasources/name/"+url.PathEscape(name), &ds)
+	return ds.ID, err
+}
+
+func getDatasourcePermissions(ctx context.Context, id int) (datasourcePermissions, error) {
+	var p datasourcePermissions
+	err := getJSON(ctx, fmt.Sprintf("/api/datasources/%d/permissions", id), &p)
+	return p, err
+}
+
+// pullDatasourcePermissions saves the permissions of the pulled datasources
+// that have permissions enabled, with teams by name and users by login. A
+// restricted datasource without entries is only queried by admins.
+func pullDatasourcePermissions(ctx context.Context, datasources []datasource) {
+	permissions := make(map[string][]permissionItem)
+	for _, ds := range datasources {
+		if stopped(ctx) {
+			return
+		}
+		id, err := datasourceID(ctx, ds.Name)
+		var p datasourcePermissions
+		if err == nil {
+			p, err = getDatasourcePermissions(ctx, id)
+		}
+		if err != nil {
+			log.Printf("Error reading permissions of datasource %s: %s", ds.Name, describeError(err))
+			continue
+		}
+		if !p.Enabled {
+			continue
+		}
+		items := []permissionItem{}
+		for _, e := range p.Permissions {
+			items = append(items, e.item())
+		}
+		permissions[ds.Name] = items
+	}
+
+	data, err := json.MarshalIndent(permissions, "", "  ")
+	if err != nil {
+		fmt.Println("Error marshaling datasource permissions:", err)
+		return
+	}
+	if err := os.WriteFile(datasourcePermissionsFile(directory), data, 0644); err != nil {
+		fmt.Println("Error saving datasource permissions:", err)
+		return
+	}
+	fmt.Println("Saved datasource permissions")
+}
+
+// pushDatasourcePermissions enables permissions on the datasources listed
+// in the datasource permissions file and makes their entries match it,
+// removing the entries that are not in the file and adding the missing
+// ones. Datasources that are not in the file are left alone.
+func pushDatasourcePermissions(ctx context.Context, datasources []datasource) {
+	path := datasourcePermissionsFile(directory)
+	if _, err := os.Stat(path); err != nil {
+		return
+	}
+	permissions, err := loadPermissionsByKey(path)
+	if err != nil {
+		log.Printf("Error loading datasource permissions %s: %v", path, err)
+		return
+	}
+	for _, ds := range datasources {
+		if stopped(ctx) {
+			return
+		}
+		items, ok := permissions[ds.Name]
+		if !ok || !included("datasources", ds.Name) {
+			continue
+		}
+		if err := pushDatasourcePermission(ctx, ds.Name, items); err != nil {
+			log.Printf("Error pushing permissions for datasource %s: %s", ds.Name, describeError(err))
+			continue
+		}
+		fmt.Printf("Applied permissions: datasource %s\n", ds.Name)
+	}
+}
+
+func pushDatasourcePermission(ctx context.Context, name string, items []permissionItem) error {
+	id, err := datasourceID(ctx, name)
+	if err != nil {
+		return err
+	}
+	current, err := getDatasourcePermissions(ctx, id)
+	if err != nil {
+		return err
+	}
+	if !current.Enabled {
+		data, status, err := doRequest(ctx, "POST", fmt.Sprintf("%s/api/datasources/%d/enable-permissions", baseURL, id), nil)
+		if err == nil && status >= 400 {
+			err = newAPIError(status, data)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	wanted := make(map[permissionItem]bool, len(items))
+	for _, item := range items {
+		wanted[item] = true
+	}
+	for _, e := range current.Permissions {
+		if wanted[e.item()] {
+			delete(wanted, e.item())
+			continue
+		}
+		data, status, err := doRequest(ctx, "DELETE", fmt.Sprintf("%s/api/datasources/%d/permissions/%d", baseURL, id, e.ID), nil)
+		if err == nil && status >= 400 {
+			err = newAPIError(status, data)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	for _, item := range items {
+		if !wanted[item] {
+			continue
+		}
+		entry, err := resolvePermission(ctx, item, "builtinRole")
+		if err != nil {
+			return err
+		}
+		body, _ := json.Marshal(entry)
+		data, status, err := doRequest(ctx, "POST", fmt.Sprintf("%s/api/datasources/%d/permissions", baseURL, id), body)
+		if err == nil && status >= 400 {
+			err = newAPIError(status, data)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validateDatasourcePermissions checks that the datasource permissions file
+// can be parsed. A missing file is not a problem.
+func validateDatasourcePermissions() []string {
+	path := datasourcePermissionsFile(directory)
+	if _, err := loadPermissionsByKey(path); err != nil && !os.IsNotExist(err) {
+		return []string{fmt.Sprintf("%s: %v", path, err)}
+	}
+	return nil
+}
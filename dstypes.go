@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+)
+
+// usesDatasourceTypes limits pulls and pushes to the dashboards querying a
+// datasource of one of these types, such as loki.
+var usesDatasourceTypes stringList
+
+// dashboardDatasourceTypes returns the types of the datasources a dashboard
+// queries in its panels, queries, template variables and annotations.
+// References by name or UID are resolved against the connected instance,
+// ${DS_...} inputs of exported dashboards by their plugin, and template
+// variables by the type of datasource they select. The default datasource
+// and unknown datasources add no type.
+func dashboardDatasourceTypes(ctx context.Context, dashboard map[string]interface{}) (map[string]bool, error) {
+	types := make(map[string]bool)
+
+	// Types of the ${DS_...} inputs and of the datasource variables
+	placeholders := make(map[string]string)
+	inputs, _ := dashboard["__inputs"].([]interface{})
+	for _, i := range inputs {
+		input, _ := i.(map[string]interface{})
+		if input["type"] == "datasource" {
+			name, _ := input["name"].(string)
+			pluginID, _ := input["pluginId"].(string)
+			placeholders[name] = pluginID
+		}
+	}
+	templating, _ := dashboard["templating"].(map[string]interface{})
+	variables, _ := templating["list"].([]interface{})
+	for _, v := range variables {
+		variable, _ := v.(map[string]interface{})
+		if variable["type"] == "datasource" {
+			name, _ := variable["name"].(string)
+			query, _ := variable["query"].(string)
+			placeholders[name] = query
+			types[query] = true
+		}
+	}
+
+	var lookupErr error
+	add := func(holder map[string]interface{}) {
+		var name, uid string
+		switch ds := holder["datasource"].(type) {
+		case string:
+			name = ds
+		case map[string]interface{}:
+			if t, _ := ds["type"].(string); t != "" && !strings.HasPrefix(t, "$") {
+				types[t] = true
+				return
+			}
+			uid, _ = ds["uid"].(string)
+		default:
+			return
+		}
+		if key := name + uid; strings.HasPrefix(key, "$") {
+			key = strings.TrimSuffix(strings.TrimPrefix(key[1:], "{"), "}")
+			if t := placeholders[key]; t != "" {
+				types[t] = true
+			}
+			return
+		}
+		if _, ok := builtinDatasources[name]; ok || name == "default" {
+			return
+		}
+		var ref datasourceRef
+		var ok bool
+		var err error
+		if uid != "" {
+			ref, ok, err = lookups.datasourceByUID(ctx, uid)
+		} else {
+			ref, ok, err = lookups.datasource(ctx, name)
+		}
+		if err != nil {
+			lookupErr = err
+		} else if ok {
+			types[ref.Type] = true
+		}
+	}
+
+	for _, panel := range dashboardPanels(dashboard) {
+		add(panel)
+		targets, _ := panel["targets"].([]interface{})
+		for _, t := range targets {
+			if target, ok := t.(map[string]interface{}); ok {
+				add(target)
+			}
+		}
+	}
+	for _, section := range []string{"templating", "annotations"} {
+		s, _ := dashboard[section].(map[string]interface{})
+		list, _ := s["list"].([]interface{})
+		for _, item := range list {
+			if holder, ok := item.(map[string]interface{}); ok {
+				add(holder)
+			}
+		}
+	}
+	return types, lookupErr
+}
+
+// usesDatasourceType reports whether a dashboard given as JSON passes
+// -uses-datasource-type.
+func usesDatasourceType(ctx context.Context, data []byte) (bool, error) {
+	if len(usesDatasourceTypes) == 0 {
+		return true, nil
+	}
+	var dashboard map[string]interface{}
+	if err := json.Unmarshal(data, &dashboard); err != nil {
+		return false, err
+	}
+	types, err := dashboardDatasourceTypes(ctx, dashboard)
+	if err != nil {
+		return false, err
+	}
+	for _, t := range usesDatasourceTypes {
+		if types[t] {
+			return true, nil
+		}
+	}
+	return false, nil
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// identityDashboardFields differ between copies of a dashboard and are
+// ignored, along with the normalized fields, when looking for duplicates.
+var identityDashboardFields = []string{"uid", "title"}
+
+// duplicateDashboard is a dashboard of a pulled directory along with the
+// hash of its content.
+type duplicateDashboard struct {
+	dir   string
+	entry manifestEntry
+	hash  string
+}
+
+// reportDuplicates lists the dashboards of -directory, and of
+// -compare-directory when set, whose normalized content is identical apart
+// from their UID and title, grouped by content. The first dashboard of each
+// group is suggested as the one to keep.
+func reportDuplicates() {
+	dirs := []string{directory}
+	if compareDir != "" {
+		dirs = append(dirs, compareDir)
+	}
+
+	groups := make(map[string][]duplicateDashboard)
+	for _, dir := range dirs {
+		entries, err := pulledDashboards(dir)
+		if err != nil {
+			log.Fatalf("Error reading %s: %v", dir, err)
+		}
+		for _, e := range entries {
+			data, err := os.ReadFile(filepath.Join(dir, e.Path))
+			if err != nil {
+				log.Fatalf("Error reading %s: %v", e.Path, err)
+			}
+			hash, err := contentHash(data)
+			if err != nil {
+				log.Fatalf("Error hashing %s: %v", e.Path, err)
+			}
+			groups[hash] = append(groups[hash], duplicateDashboard{dir: dir, entry: e, hash: hash})
+		}
+	}
+
+	var duplicates [][]duplicateDashboard
+	for _, group := range groups {
+		if len(group) < 2 {
+			continue
+		}
+		sort.Slice(group, func(i, j int) bool {
+			a, b := group[i], group[j]
+			if a.dir != b.dir {
+				return a.dir < b.dir
+			}
+			if a.entry.FolderTitle != b.entry.FolderTitle {
+				return a.entry.FolderTitle < b.entry.FolderTitle
+			}
+			return a.entry.Title < b.entry.Title
+		})
+		duplicates = append(duplicates, group)
+	}
+	sort.Slice(duplicates, func(i, j int) bool {
+		if len(duplicates[i]) != len(duplicates[j]) {
+			return len(duplicates[i]) > len(duplicates[j])
+		}
+		return duplicates[i][0].hash < duplicates[j][0].hash
+	})
+
+	header := []string{"content", "directory", "folder", "dashboard", "uid", "path", "keep_uid"}
+	var rows [][]string
+	for _, group := range duplicates {
+		keep := group[0].entry.UID
+		for _, d := range group {
+			rows = append(rows, []string{d.hash[:12], d.dir, d.entry.FolderTitle, d.entry.Title, d.entry.UID, d.entry.Path, keep})
+		}
+	}
+	writeReport(header, rows)
+}
+
+// contentHash hashes the normalized content of a dashboard without its
+// identity fields.
+func contentHash(data []byte) (string, error) {
+	var dashboard map[string]interface{}
+	if err := json.Unmarshal(data, &dashboard); err != nil {
+		return "", err
+	}
+	for _, field := range identityDashboardFields {
+		delete(dashboard, field)
+	}
+	content, err := json.Marshal(dashboard)
+	if err != nil {
+		return "", err
+	}
+	return dashboardHash(content)
+}
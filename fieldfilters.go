@@ -0,0 +1,231 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// fieldFilter selects the fields of the resources of a kind saved on pull,
+// with JSON paths relative to a dashboard or to an item of a list file, such
+// as panels[*].links. Keep, when set, removes every field that isn't on one
+// of its paths, then the fields matching Drop are removed.
+type fieldFilter struct {
+	Keep []string `yaml:"keep"`
+	Drop []string `yaml:"drop"`
+}
+
+// pathStep is a step of a field path: an object key, an array index, or a
+// wildcard matching every key or element.
+type pathStep struct {
+	key      string
+	index    int
+	isIndex  bool
+	wildcard bool
+}
+
+// parseFieldPath parses a field path: keys separated by dots, with [N] or
+// [*] after a key for array elements. A leading $. is allowed and * matches
+// every key.
+func parseFieldPath(path string) ([]pathStep, error) {
+	text := strings.TrimPrefix(strings.TrimPrefix(path, "$"), ".")
+	if text == "" {
+		return nil, fmt.Errorf("empty path %q", path)
+	}
+	var steps []pathStep
+	for _, part := range strings.Split(text, ".") {
+		key, rest, _ := strings.Cut(part, "[")
+		if key == "" && rest == "" {
+			return nil, fmt.Errorf("empty key in path %q", path)
+		}
+		if key != "" {
+			steps = append(steps, pathStep{key: key, wildcard: key == "*"})
+		}
+		for rest != "" {
+			index, after, ok := strings.Cut(rest, "]")
+			if !ok {
+				return nil, fmt.Errorf("unclosed [ in path %q", path)
+			}
+			if index == "*" {
+				steps = append(steps, pathStep{isIndex: true, wildcard: true})
+			} else {
+				n, err := strconv.Atoi(index)
+				if err != nil || n < 0 {
+					return nil, fmt.Errorf("invalid index %q in path %q", index, path)
+				}
+				steps = append(steps, pathStep{isIndex: true, index: n})
+			}
+			if after == "" {
+				break
+			}
+			if !strings.HasPrefix(after, "[") {
+				return nil, fmt.Errorf("unexpected %q in path %q", after, path)
+			}
+			rest = after[1:]
+		}
+	}
+	return steps, nil
+}
+
+// matchesKey reports whether a step selects the field key of an object.
+func (s pathStep) matchesKey(key string) bool {
+	return !s.isIndex && (s.wildcard || s.key == key)
+}
+
+// matchesIndex reports whether a step selects the element i of an array.
+func (s pathStep) matchesIndex(i int) bool {
+	return s.isIndex && (s.wildcard || s.index == i)
+}
+
+// checkFieldFilters rejects unknown resource kinds and invalid paths.
+func checkFieldFilters(filters map[string]fieldFilter) error {
+	for kind, f := range filters {
+		if !stringList(resourceKinds).contains(kind) {
+			return fmt.Errorf("unknown resource kind %q", kind)
+		}
+		for _, path := range append(append([]string{}, f.Keep...), f.Drop...) {
+			if _, err := parseFieldPath(path); err != nil {
+				return fmt.Errorf("%s: %v", kind, err)
+			}
+		}
+	}
+	return nil
+}
+
+// filterFields applies the field filter of a kind to a decoded resource.
+func filterFields(kind string, value interface{}) interface{} {
+	f, ok := cfg.Fields[kind]
+	if !ok {
+		return value
+	}
+	if len(f.Keep) > 0 {
+		var paths [][]pathStep
+		for _, path := range f.Keep {
+			steps, _ := parseFieldPath(path)
+			paths = append(paths, steps)
+		}
+		value = keepFields(value, paths)
+	}
+	for _, path := range f.Drop {
+		steps, _ := parseFieldPath(path)
+		value = dropFields(value, steps)
+	}
+	return value
+}
+
+// keepFields returns value with only the fields on one of paths, and the
+// objects and arrays leading to them. A field ending a path is kept whole.
+func keepFields(value interface{}, paths [][]pathStep) interface{} {
+	// next returns the remaining paths of a child, and whether one of paths
+	// ends at it
+	next := func(match func(pathStep) bool) ([][]pathStep, bool) {
+		var rest [][]pathStep
+		for _, steps := range paths {
+			if !match(steps[0]) {
+				continue
+			}
+			if len(steps) == 1 {
+				return nil, true
+			}
+			rest = append(rest, steps[1:])
+		}
+		return rest, false
+	}
+	switch v := value.(type) {
+	case map[string]interface{}:
+		kept := make(map[string]interface{})
+		for key, child := range v {
+			rest, whole := next(func(s pathStep) bool { return s.matchesKey(key) })
+			if whole {
+				kept[key] = child
+			} else if rest != nil && isContainer(child) {
+				kept[key] = keepFields(child, rest)
+			}
+		}
+		return kept
+	case []interface{}:
+		kept := []interface{}{}
+		for i, child := range v {
+			rest, whole := next(func(s pathStep) bool { return s.matchesIndex(i) })
+			if whole {
+				kept = append(kept, child)
+			} else if rest != nil && isContainer(child) {
+				kept = append(kept, keepFields(child, rest))
+			}
+		}
+		return kept
+	}
+	return value
+}
+
+// dropFields removes the fields of value matching a path. Array elements
+// matched by the last step are removed too.
+func dropFields(value interface{}, steps []pathStep) interface{} {
+	step, last := steps[0], len(steps) == 1
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, child := range v {
+			if !step.matchesKey(key) {
+				continue
+			}
+			if last {
+				delete(v, key)
+			} else {
+				v[key] = dropFields(child, steps[1:])
+			}
+		}
+	case []interface{}:
+		kept := v[:0]
+		for i, child := range v {
+			if !step.matchesIndex(i) {
+				kept = append(kept, child)
+			} else if !last {
+				kept = append(kept, dropFields(child, steps[1:]))
+			}
+		}
+		return kept
+	}
+	return value
+}
+
+func isContainer(value interface{}) bool {
+	switch value.(type) {
+	case map[string]interface{}, []interface{}:
+		return true
+	}
+	return false
+}
+
+// filterDashboardFields applies the field filter of dashboards to a
+// dashboard given as JSON.
+func filterDashboardFields(data []byte) ([]byte, error) {
+	if _, ok := cfg.Fields["dashboards"]; !ok {
+		return data, nil
+	}
+	var dashboard map[string]interface{}
+	if err := json.Unmarshal(data, &dashboard); err != nil {
+		return nil, err
+	}
+	return json.Marshal(filterFields("dashboards", dashboard))
+}
+
+// writePulledResources writes the list file of a pulled resource kind, with
+// the field filter of the kind applied to each item.
+func writePulledResources(dir, kind string, list interface{}) error {
+	if _, ok := cfg.Fields[kind]; ok {
+		data, err := json.Marshal(list)
+		if err != nil {
+			return err
+		}
+		var items []interface{}
+		if err := json.Unmarshal(data, &items); err != nil {
+			return err
+		}
+		for i, item := range items {
+			items[i] = filterFields(kind, item)
+		}
+		list = items
+	}
+	return writeResources(dir, kind, list)
+}
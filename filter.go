@@ -0,0 +1,63 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+)
+
+// resourceFilter selects the resources of a kind by name, or title for
+// dashboards and folders, with glob patterns. A resource is synced when it
+// matches one of the include patterns, if any, and none of the exclude
+// patterns.
+type resourceFilter struct {
+	Include []string `yaml:"include"`
+	Exclude []string `yaml:"exclude"`
+}
+
+// checkResourceFilters rejects unknown resource kinds and invalid patterns.
+func checkResourceFilters(filters map[string]resourceFilter) error {
+	for kind, f := range filters {
+		if !stringList(resourceKinds).contains(kind) {
+			return fmt.Errorf("unknown resource kind %q", kind)
+		}
+		for _, pattern := range append(append([]string{}, f.Include...), f.Exclude...) {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return fmt.Errorf("%s: invalid pattern %q", kind, pattern)
+			}
+		}
+	}
+	return nil
+}
+
+// included reports whether the named resource of a kind passes the filter
+// of the configuration file, and -match and -exclude.
+func included(kind, name string) bool {
+	if !titleSelected(kind, name) {
+		return false
+	}
+	f := cfg.Resources[kind]
+	if len(f.Include) > 0 && !matchesAny(f.Include, name) {
+		return false
+	}
+	return !matchesAny(f.Exclude, name)
+}
+
+func matchesAny(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// dashboardTitle returns the title of a dashboard given as JSON, empty when
+// it can't be decoded.
+func dashboardTitle(data []byte) string {
+	var dashboard struct {
+		Title string `json:"title"`
+	}
+	json.Unmarshal(data, &dashboard)
+	return dashboard.Title
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+)
+
+// folderPermissionsFile returns the file holding the permissions of the
+// folders of dir, next to folders.json and keyed by folder UID.
+func folderPermissionsFile(dir string) string {
+	return permissionsFile(resourceFile(dir, "folders"))
+}
+
+// pullFolderPermissions saves the permissions set on the pulled folders,
+// with teams by name and users by login. Folders with inherited
+// permissions only are left out.
+func pullFolderPermissions(ctx context.Context, folders []folderInfo) {
+	if !roleAllows(ctx, "folder permissions", "Admin") {
+		return
+	}
+	permissions := make(map[string][]permissionItem)
+	for _, f := range folders {
+		if stopped(ctx) {
+			return
+		}
+		items, err := ownPermissions(ctx, fmt.Sprintf("/api/folders/%s/permissions", url.PathEscape(environmentUID(f.UID))))
+		if err != nil {
+			log.Printf("Error reading permissions of folder %s: %s", f.Title, describeError(err))
+			continue
+		}
+		if len(items) > 0 {
+			permissions[f.UID] = items
+		}
+	}
+
+	data, err := json.MarshalIndent(permissions, "", "  ")
+	if err != nil {
+		fmt.Println("Error marshaling folder permissions:", err)
+		return
+	}
+	if err := os.WriteFile(folderPermissionsFile(directory), data, 0644); err != nil {
+		fmt.Println("Error saving folder permissions:", err)
+		return
+	}
+	fmt.Println("Saved folder permissions")
+}
+
+// pushFolderPermissions replaces the permissions of the pushed folders that
+// have an entry in the folder permissions file, or else match a
+// folderPermissions rule of the configuration file, translating team and
+// user names to IDs of the target instance. Other folders keep their
+// permissions.
+func pushFolderPermissions(ctx context.Context, folders []folderInfo) {
+	path := folderPermissionsFile(directory)
+	var permissions map[string][]permissionItem
+	if _, err := os.Stat(path); err == nil {
+		if permissions, err = loadPermissionsByKey(path); err != nil {
+			log.Printf("Error loading folder permissions %s: %v", path, err)
+			return
+		}
+	}
+	for _, f := range folders {
+		if stopped(ctx) {
+			return
+		}
+		if !included("folders", f.Title) {
+			continue
+		}
+		items, ok := permissions[f.UID]
+		source := ""
+		if !ok {
+			var err error
+			if items, source, err = templatePermissions(f); err != nil {
+				log.Printf("Error applying permission template %s to folder %s: %v", source, f.Title, err)
+				continue
+			}
+			if source == "" {
+				continue
+			}
+			source = " (template " + source + ")"
+		}
+		if err := pushPermissions(ctx, fmt.Sprintf("/api/folders/%s/permissions", url.PathEscape(environmentUID(f.UID))), items); err != nil {
+			log.Printf("Error pushing permissions for folder %s: %s", f.Title, describeError(err))
+			summary.add("permissions", outcomeFailed, f.Title)
+			continue
+		}
+		fmt.Printf("Applied permissions: folder %s%s\n", f.Title, source)
+	}
+}
+
+// validateFolderPermissions checks that the folder permissions file can be
+// parsed. A missing file is not a problem.
+func validateFolderPermissions() []string {
+	path := folderPermissionsFile(directory)
+	if _, err := loadPermissionsByKey(path); err != nil && !os.IsNotExist(err) {
+		return []string{fmt.Sprintf("%s: %v", path, err)}
+	}
+	return nil
+}
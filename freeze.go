@@ -0,0 +1,197 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// freezeDir holds, under -directory, the state of every frozen folder.
+const freezeDir = "freezes"
+
+// freezeDuration is how long freeze keeps a folder frozen, 0 until unfreeze.
+var freezeDuration time.Duration
+
+// frozenFolder records what freeze changed on a folder, so that unfreeze can
+// put it back: the permissions of the folder and of its dashboards, and the
+// versions of the dashboards when they were frozen.
+type frozenFolder struct {
+	Title       string            `json:"title"`
+	UID         string            `json:"uid"`
+	FrozenAt    time.Time         `json:"frozenAt"`
+	Until       time.Time         `json:"until,omitempty"`
+	Permissions []permissionItem  `json:"permissions"`
+	Dashboards  []frozenDashboard `json:"dashboards"`
+}
+
+// frozenDashboard is a dashboard of a frozen folder. Permissions are its own
+// permissions, empty when it only inherits those of the folder.
+type frozenDashboard struct {
+	UID         string           `json:"uid"`
+	Title       string           `json:"title"`
+	Version     int              `json:"version"`
+	Permissions []permissionItem `json:"permissions,omitempty"`
+}
+
+func freezeFile(uid string) string {
+	return filepath.Join(directory, freezeDir, url.PathEscape(uid)+".json")
+}
+
+// viewOnly returns permission entries lowered to View, so that everyone who
+// could see a resource still can, but nobody but admins can change it.
+func viewOnly(items []permissionItem) []permissionItem {
+	frozen := make([]permissionItem, len(items))
+	for i, item := range items {
+		item.Permission = min(item.Permission, 1)
+		frozen[i] = item
+	}
+	return frozen
+}
+
+// freezeFolder makes -folder and its dashboards view-only for everyone but
+// admins, to guard against edits in the UI during a migration. The current
+// permissions and dashboard versions are saved first, so that unfreeze
+// restores them even when the freeze fails midway.
+func freezeFolder(ctx context.Context) {
+	if folder == "" {
+		log.Fatalf("Error: freeze requires -folder")
+	}
+	f, err := findFolder(ctx, folder)
+	if err != nil {
+		log.Fatalf("Error: %s", describeError(err))
+	}
+	path := freezeFile(f.UID)
+	if _, err := os.Stat(path); err == nil {
+		log.Fatalf("Error: folder %s is already frozen, see %s", folder, path)
+	}
+
+	state := frozenFolder{Title: f.Title, UID: f.UID, FrozenAt: time.Now().UTC().Truncate(time.Second)}
+	if freezeDuration > 0 {
+		state.Until = state.FrozenAt.Add(freezeDuration)
+	}
+	folderPath := fmt.Sprintf("/api/folders/%s/permissions", url.PathEscape(f.UID))
+	if state.Permissions, err = ownPermissions(ctx, folderPath); err != nil {
+		log.Fatalf("Error reading permissions of folder %s: %s", folder, describeError(err))
+	}
+	boards, err := client.Search(ctx, searchType(searchTypeDashboard), searchFolderUID(f.UID))
+	if err != nil {
+		log.Fatalf("Error searching dashboards: %s", describeError(err))
+	}
+	for _, board := range boards {
+		if stopped(ctx) {
+			return
+		}
+		d := frozenDashboard{UID: board.UID, Title: board.Title}
+		_, meta, err := client.GetRawDashboardByUID(ctx, board.UID)
+		if err == nil {
+			d.Permissions, err = dashboardPermissions(ctx, board.UID)
+		}
+		if err != nil {
+			log.Fatalf("Error reading dashboard %s: %s", board.Title, describeError(err))
+		}
+		d.Version = meta.Version
+		state.Dashboards = append(state.Dashboards, d)
+	}
+
+	data, _ := json.MarshalIndent(state, "", "  ")
+	if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+		log.Fatalf("Error creating directory: %v", err)
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		log.Fatalf("Error saving %s: %v", path, err)
+	}
+
+	if err := pushPermissions(ctx, folderPath, viewOnly(state.Permissions)); err != nil {
+		log.Fatalf("Error freezing folder %s: %s", folder, describeError(err))
+	}
+	for _, d := range state.Dashboards {
+		if stopped(ctx) {
+			return
+		}
+		if len(d.Permissions) == 0 {
+			continue
+		}
+		if err := pushDashboardPermissions(ctx, d.UID, viewOnly(d.Permissions)); err != nil {
+			log.Fatalf("Error freezing dashboard %s: %s", d.Title, describeError(err))
+		}
+	}
+	if state.Until.IsZero() {
+		fmt.Printf("Froze folder %s and its %d dashboard(s) until unfreeze\n", folder, len(state.Dashboards))
+	} else {
+		fmt.Printf("Froze folder %s and its %d dashboard(s) until %s\n", folder, len(state.Dashboards), state.Until.Format(time.RFC3339))
+	}
+}
+
+// unfreezeFolders restores the permissions of -folder, or without -folder
+// of every folder whose freeze expired, and reports the dashboards whose
+// version changed while frozen.
+func unfreezeFolders(ctx context.Context) {
+	files, err := filepath.Glob(filepath.Join(directory, freezeDir, "*.json"))
+	if err != nil {
+		log.Fatalf("Error reading %s: %v", freezeDir, err)
+	}
+	unfrozen := 0
+	for _, path := range files {
+		if stopped(ctx) {
+			return
+		}
+		var state frozenFolder
+		data, err := os.ReadFile(path)
+		if err == nil {
+			err = json.Unmarshal(data, &state)
+		}
+		if err != nil {
+			log.Fatalf("Error reading %s: %v", path, err)
+		}
+		if folder != "" && state.Title != folder {
+			continue
+		}
+		if folder == "" && (state.Until.IsZero() || time.Now().Before(state.Until)) {
+			continue
+		}
+		unfreezeFolder(ctx, state)
+		if err := os.Remove(path); err != nil {
+			log.Fatalf("Error removing %s: %v", path, err)
+		}
+		unfrozen++
+	}
+	if unfrozen == 0 {
+		if folder != "" {
+			log.Fatalf("Error: folder %s is not frozen", folder)
+		}
+		fmt.Println("No expired freeze to unfreeze")
+	}
+}
+
+func unfreezeFolder(ctx context.Context, state frozenFolder) {
+	folderPath := fmt.Sprintf("/api/folders/%s/permissions", url.PathEscape(state.UID))
+	if err := pushPermissions(ctx, folderPath, state.Permissions); err != nil {
+		log.Fatalf("Error restoring permissions of folder %s: %s", state.Title, describeError(err))
+	}
+	for _, d := range state.Dashboards {
+		_, meta, err := client.GetRawDashboardByUID(ctx, d.UID)
+		if apiErr, ok := asAPIError(err); ok && apiErr.StatusCode == http.StatusNotFound {
+			fmt.Printf("Dashboard %s was deleted while frozen\n", d.Title)
+			continue
+		}
+		if err != nil {
+			log.Fatalf("Error reading dashboard %s: %s", d.Title, describeError(err))
+		}
+		if meta.Version != d.Version {
+			fmt.Printf("Dashboard %s changed while frozen: version %d, now %d\n", d.Title, d.Version, meta.Version)
+		}
+		if len(d.Permissions) == 0 {
+			continue
+		}
+		if err := pushDashboardPermissions(ctx, d.UID, d.Permissions); err != nil {
+			log.Fatalf("Error restoring permissions of dashboard %s: %s", d.Title, describeError(err))
+		}
+	}
+	fmt.Printf("Unfroze folder %s\n", state.Title)
+}
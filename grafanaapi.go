@@ -0,0 +1,18 @@
+package main
+
+import "context"
+
+// GrafanaAPI is the part of the Grafana HTTP API used by the tool. Every
+// call goes through the client of the connected instance, so tests and
+// library users can substitute their own implementation, or point the
+// regular one at the fake server of internal/fakegrafana.
+type GrafanaAPI interface {
+	Search(ctx context.Context, params ...searchParam) ([]foundBoard, error)
+	GetRawDashboardByUID(ctx context.Context, uid string) ([]byte, boardProperties, error)
+	SetRawDashboardWithParam(ctx context.Context, request rawBoardRequest) (statusMessage, error)
+	GetAllFolders(ctx context.Context) ([]folderInfo, error)
+
+	// Do performs any other authenticated call and returns the response
+	// body and status code, leaving error statuses to the caller.
+	Do(ctx context.Context, method, url string, body []byte) ([]byte, int, error)
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// Guardrail thresholds for dashboards. Zero disables a check.
+var (
+	maxPanels          int
+	maxJSONSize        int
+	maxQueriesPerPanel int
+	guardrailMode      string
+)
+
+// Outcome recorded for dashboards stopped by a guardrail in block mode.
+const outcomeBlocked = "blocked"
+
+// checkGuardrails returns a description of every threshold the dashboard
+// exceeds.
+func checkGuardrails(data []byte) []string {
+	var violations []string
+	if maxJSONSize > 0 && len(data) > maxJSONSize {
+		violations = append(violations, fmt.Sprintf("JSON size %d bytes exceeds %d", len(data), maxJSONSize))
+	}
+
+	var dashboard map[string]interface{}
+	if err := json.Unmarshal(data, &dashboard); err != nil {
+		return violations
+	}
+
+	panels := dashboardPanels(dashboard)
+	if maxPanels > 0 && len(panels) > maxPanels {
+		violations = append(violations, fmt.Sprintf("%d panels exceed %d", len(panels), maxPanels))
+	}
+
+	if maxQueriesPerPanel > 0 {
+		for _, panel := range panels {
+			targets, _ := panel["targets"].([]interface{})
+			if len(targets) > maxQueriesPerPanel {
+				title, _ := panel["title"].(string)
+				violations = append(violations, fmt.Sprintf("panel %q has %d queries, more than %d", title, len(targets), maxQueriesPerPanel))
+			}
+		}
+	}
+	return violations
+}
+
+// guardrailsBlock reports whether violations stop a dashboard from being
+// pushed, as opposed to only being warned about.
+func guardrailsBlock() bool {
+	return guardrailMode == "block"
+}
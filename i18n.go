@@ -0,0 +1,165 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+
+	"gopkg.in/yaml.v3"
+)
+
+var (
+	// translationsFile holds the translatable strings of the dashboards.
+	translationsFile string
+	// language selects the translations applied on push.
+	language string
+)
+
+// sourceLanguage is the key of the extracted text of a string, next to its
+// translations by language. previousSource keeps the text the translations
+// were made for when it changes, until the translations are reviewed and
+// the key removed.
+const (
+	sourceLanguage = "source"
+	previousSource = "previous"
+)
+
+// dashboardTranslations holds, by dashboard UID and string key such as
+// panel.4.title, the extracted text of each string and its translations.
+type dashboardTranslations map[string]map[string]map[string]string
+
+var translations dashboardTranslations
+
+// loadTranslations reads -translations.
+func loadTranslations() error {
+	if language == sourceLanguage || language == previousSource {
+		return fmt.Errorf("%q is not a language", language)
+	}
+	data, err := os.ReadFile(translationsFile)
+	if err != nil {
+		return err
+	}
+	return yaml.Unmarshal(data, &translations)
+}
+
+// eachDashboardString calls fn with the key and text of every translatable
+// string of a dashboard: its title and description, and the titles,
+// descriptions and text panel contents of its panels. The text is replaced
+// with the result of fn.
+func eachDashboardString(dashboard map[string]interface{}, fn func(key, text string) string) {
+	replace := func(m map[string]interface{}, field, key string) {
+		if text, ok := m[field].(string); ok && text != "" {
+			m[field] = fn(key, text)
+		}
+	}
+	replace(dashboard, "title", "title")
+	replace(dashboard, "description", "description")
+	for _, panel := range dashboardPanels(dashboard) {
+		id, ok := panel["id"].(float64)
+		if !ok {
+			continue
+		}
+		prefix := "panel." + strconv.FormatFloat(id, 'f', -1, 64) + "."
+		replace(panel, "title", prefix+"title")
+		replace(panel, "description", prefix+"description")
+		replace(panel, "content", prefix+"content")
+		if options, ok := panel["options"].(map[string]interface{}); ok {
+			replace(options, "content", prefix+"content")
+		}
+	}
+}
+
+// extractStrings saves the translatable strings of the local dashboards to
+// -translations. Translations already in the file are kept; the ones whose
+// source text changed are reported as outdated, the text they were made for
+// being kept as previous, and strings that no longer exist are dropped.
+func extractStrings() {
+	extracted := make(dashboardTranslations)
+	if data, err := os.ReadFile(translationsFile); err == nil {
+		if err := yaml.Unmarshal(data, &extracted); err != nil {
+			log.Fatalf("Error parsing %s: %v", translationsFile, err)
+		}
+	} else if !os.IsNotExist(err) {
+		log.Fatalf("Error reading %s: %v", translationsFile, err)
+	}
+
+	files, err := dashboardFiles()
+	if err != nil {
+		log.Fatalf("Error reading dashboard directory: %v", err)
+	}
+	result := make(dashboardTranslations)
+	var extractedStrings, outdated int
+	for _, path := range files {
+		dashboard, err := readDashboard(path)
+		if err != nil {
+			log.Printf("Error reading file %s: %v", path, err)
+			continue
+		}
+		uid, _ := dashboard["uid"].(string)
+		if uid == "" {
+			log.Printf("Warning: dashboard %s has no UID, its strings are not extracted", path)
+			continue
+		}
+		entries := make(map[string]map[string]string)
+		eachDashboardString(dashboard, func(key, text string) string {
+			entry := extracted[uid][key]
+			if entry == nil {
+				entry = make(map[string]string)
+			}
+			if entry[sourceLanguage] != text && len(entry) > 1 && entry[previousSource] == "" {
+				entry[previousSource] = entry[sourceLanguage]
+			}
+			if entry[previousSource] != "" {
+				fmt.Printf("Outdated translations: %s %s\n", uid, key)
+				outdated++
+			}
+			entry[sourceLanguage] = text
+			entries[key] = entry
+			extractedStrings++
+			return text
+		})
+		result[uid] = entries
+	}
+
+	data, err := yaml.Marshal(result)
+	if err == nil {
+		err = os.WriteFile(translationsFile, data, 0644)
+	}
+	if err != nil {
+		log.Fatalf("Error saving %s: %v", translationsFile, err)
+	}
+	fmt.Printf("Extracted %d string(s) of %d dashboard(s) into %s, %d with outdated translations\n", extractedStrings, len(result), translationsFile, outdated)
+}
+
+// translateDashboard replaces the strings of a dashboard about to be pushed
+// with their -language translation. Strings without a translation, or whose
+// source text changed since the translation, are kept as they are.
+func translateDashboard(data []byte) ([]byte, error) {
+	if language == "" {
+		return data, nil
+	}
+	var dashboard map[string]interface{}
+	if err := json.Unmarshal(data, &dashboard); err != nil {
+		return nil, err
+	}
+	uid, _ := dashboard["uid"].(string)
+	var missing, outdated int
+	eachDashboardString(dashboard, func(key, text string) string {
+		entry := translations[uid][key]
+		switch {
+		case entry[language] == "":
+			missing++
+			return text
+		case entry[sourceLanguage] != text || entry[previousSource] != "":
+			outdated++
+			return text
+		}
+		return entry[language]
+	})
+	if missing > 0 || outdated > 0 {
+		fmt.Printf("Warning: dashboard %s has %d untranslated and %d outdated string(s) in %s\n", uid, missing, outdated, language)
+	}
+	return json.Marshal(dashboard)
+}
@@ -0,0 +1,210 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+)
+
+var (
+	// sourceURL and sourceAPIKey, destURL and destAPIKey are the instances
+	// copy copies between, instead of copying a folder of -url.
+	sourceURL    string
+	sourceAPIKey string
+	destURL      string
+	destAPIKey   string
+)
+
+// copyingInstances reports whether copy copies between two instances.
+func copyingInstances() bool {
+	return action == "copy" && (sourceURL != "" || destURL != "")
+}
+
+// copiedDashboard is a dashboard read from the source instance with the UID
+// of its folder, empty for General.
+type copiedDashboard struct {
+	title     string
+	folderUID string
+	board     map[string]interface{}
+}
+
+// copyInstance copies the folders, datasources and dashboards of
+// -source-url to -dest-url in memory, keeping their UIDs. Resources are
+// created or updated on the destination, which keeps the resources the
+// source doesn't have. The resources filters of the configuration file and
+// the datasource overrides of -environment apply.
+func copyInstance(ctx context.Context) {
+	if sourceURL == "" || sourceAPIKey == "" || destURL == "" || destAPIKey == "" {
+		log.Fatalf("Error: copy between instances requires -source-url, -source-apikey, -dest-url and -dest-apikey")
+	}
+	overrides, err := environmentOverrides()
+	if err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+
+	fmt.Printf("Reading %s...\n", sourceURL)
+	connect(sourceURL, sourceAPIKey)
+	folders, err := client.GetAllFolders(ctx)
+	if err != nil {
+		log.Fatalf("Error fetching folders: %s", describeError(err))
+	}
+	var datasources []datasource
+	if roleAllows(ctx, "datasources", "Admin") {
+		if err := getJSON(ctx, "/api/datasources", &datasources); err != nil {
+			log.Fatalf("Error fetching datasources: %s", describeError(err))
+		}
+	}
+	found, err := client.Search(ctx, searchType(searchTypeDashboard))
+	if err != nil {
+		log.Fatalf("Error searching dashboards: %s", describeError(err))
+	}
+	dashboards := make([]*copiedDashboard, len(found))
+	forEach(ctx, "fetch", len(found), func(i int) {
+		db := found[i]
+		if !included("dashboards", db.Title) {
+			return
+		}
+		raw, _, err := client.GetRawDashboardByUID(ctx, db.UID)
+		var board map[string]interface{}
+		if err == nil {
+			err = json.Unmarshal(raw, &board)
+		}
+		if err != nil {
+			log.Printf("Error fetching dashboard UID %s: %s", db.UID, describeError(err))
+			summary.add("dashboards", outcomeFailed, db.Title)
+			return
+		}
+		board["id"] = nil
+		delete(board, "version")
+		dashboards[i] = &copiedDashboard{title: db.Title, folderUID: db.FolderUID, board: board}
+	})
+	if stopped(ctx) {
+		return
+	}
+
+	fmt.Printf("Copying to %s...\n", destURL)
+	connect(destURL, destAPIKey)
+	for _, f := range folders {
+		if stopped(ctx) {
+			return
+		}
+		if !included("folders", f.Title) {
+			continue
+		}
+		changed, err := copyFolderInfo(ctx, f)
+		if err != nil {
+			log.Printf("Error copying folder %s: %s", f.Title, describeError(err))
+			summary.add("folders", outcomeFailed, f.Title)
+			continue
+		}
+		if !changed {
+			summary.add("folders", outcomeUnchanged, f.Title)
+			continue
+		}
+		summary.add("folders", outcomePushed, f.Title)
+	}
+
+	if len(datasources) > 0 && roleAllows(ctx, "datasources", "Admin") {
+		for _, ds := range datasources {
+			if stopped(ctx) {
+				return
+			}
+			if !included("datasources", ds.Name) {
+				continue
+			}
+			if o, ok := overrides[ds.Name]; ok {
+				if ds, err = overrideDatasource(ds, o); err != nil {
+					fmt.Printf("Error overriding datasource %s: %v\n", ds.Name, err)
+					summary.add("datasources", outcomeFailed, ds.Name)
+					continue
+				}
+			}
+			if err := copyDatasource(ctx, ds); err != nil {
+				log.Printf("Error copying datasource %s: %s", ds.Name, describeError(err))
+				summary.add("datasources", outcomeFailed, ds.Name)
+				continue
+			}
+			fmt.Printf("Copied datasource: %s\n", ds.Name)
+			summary.add("datasources", outcomePushed, ds.Name)
+		}
+	}
+
+	forEach(ctx, "dashboards", len(dashboards), func(i int) {
+		d := dashboards[i]
+		if d == nil {
+			return
+		}
+		data, err := json.Marshal(d.board)
+		if err == nil {
+			_, err = saveDashboard(ctx, d.title, rawBoardRequest{
+				Dashboard:  data,
+				Parameters: setDashboardParams{FolderUID: d.folderUID, Overwrite: true, Message: "Copied from " + sourceURL + " by grafana-sync"},
+			})
+		}
+		if err != nil {
+			log.Printf("Error copying dashboard %s: %s", d.title, describeError(err))
+			summary.add("dashboards", outcomeFailed, d.title)
+			return
+		}
+		fmt.Printf("Copied dashboard: %s\n", d.title)
+		summary.add("dashboards", outcomePushed, d.title)
+	})
+}
+
+// copyFolderInfo creates a folder of the source on the destination with the
+// same UID, or renames the folder with that UID. It reports whether the
+// destination changed.
+func copyFolderInfo(ctx context.Context, f folderInfo) (bool, error) {
+	var current folderInfo
+	err := getJSON(ctx, "/api/folders/"+url.PathEscape(f.UID), &current)
+	if apiErr, ok := asAPIError(err); ok && apiErr.StatusCode == http.StatusNotFound {
+		body, _ := json.Marshal(folderInfo{UID: f.UID, Title: f.Title, ParentUID: f.ParentUID})
+		data, status, err := doRequest(ctx, "POST", baseURL+"/api/folders", body)
+		if err == nil && status >= 400 {
+			err = newAPIError(status, data)
+		}
+		if err != nil {
+			return false, err
+		}
+		printChange("Created folder: %s\n", f.Title)
+		return true, nil
+	}
+	if err != nil || current.Title == f.Title {
+		return false, err
+	}
+	body, _ := json.Marshal(map[string]interface{}{"title": f.Title, "overwrite": true})
+	data, status, err := doRequest(ctx, "PUT", baseURL+"/api/folders/"+url.PathEscape(f.UID), body)
+	if err == nil && status >= 400 {
+		err = newAPIError(status, data)
+	}
+	if err != nil {
+		return false, err
+	}
+	printChange("Renamed folder: %s\n", f.Title)
+	return true, nil
+}
+
+// copyDatasource creates a datasource on the destination, or updates the
+// datasource with the same name.
+func copyDatasource(ctx context.Context, ds datasource) error {
+	body, err := json.Marshal(ds)
+	if err != nil {
+		return err
+	}
+	method, path := "POST", "/api/datasources"
+	id, err := datasourceID(ctx, ds.Name)
+	if apiErr, ok := asAPIError(err); !ok || apiErr.StatusCode != http.StatusNotFound {
+		if err != nil {
+			return err
+		}
+		method, path = "PUT", fmt.Sprintf("/api/datasources/%d", id)
+	}
+	data, status, err := doRequest(ctx, method, baseURL+path, body)
+	if err == nil && status >= 400 {
+		err = newAPIError(status, data)
+	}
+	return err
+}
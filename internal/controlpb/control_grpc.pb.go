@@ -0,0 +1,214 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.5.1
+// - protoc             (unknown)
+// source: control.proto
+
+// Control API of grafana-sync in daemon mode, to trigger syncs, follow
+// their progress and query the last run.
+
+package controlpb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	SyncControl_Trigger_FullMethodName = "/grafanasync.control.v1.SyncControl/Trigger"
+	SyncControl_Watch_FullMethodName   = "/grafanasync.control.v1.SyncControl/Watch"
+	SyncControl_LastRun_FullMethodName = "/grafanasync.control.v1.SyncControl/LastRun"
+)
+
+// SyncControlClient is the client API for SyncControl service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type SyncControlClient interface {
+	// Trigger starts a sync and returns right away. It fails with
+	// FAILED_PRECONDITION while another sync runs.
+	Trigger(ctx context.Context, in *TriggerRequest, opts ...grpc.CallOption) (*Run, error)
+	// Watch streams the progress events of the running sync, and of the
+	// following ones, until the client cancels.
+	Watch(ctx context.Context, in *WatchRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[Event], error)
+	// LastRun returns the running sync, or the last one.
+	LastRun(ctx context.Context, in *LastRunRequest, opts ...grpc.CallOption) (*Run, error)
+}
+
+type syncControlClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewSyncControlClient(cc grpc.ClientConnInterface) SyncControlClient {
+	return &syncControlClient{cc}
+}
+
+func (c *syncControlClient) Trigger(ctx context.Context, in *TriggerRequest, opts ...grpc.CallOption) (*Run, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Run)
+	err := c.cc.Invoke(ctx, SyncControl_Trigger_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *syncControlClient) Watch(ctx context.Context, in *WatchRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[Event], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &SyncControl_ServiceDesc.Streams[0], SyncControl_Watch_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[WatchRequest, Event]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type SyncControl_WatchClient = grpc.ServerStreamingClient[Event]
+
+func (c *syncControlClient) LastRun(ctx context.Context, in *LastRunRequest, opts ...grpc.CallOption) (*Run, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Run)
+	err := c.cc.Invoke(ctx, SyncControl_LastRun_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// SyncControlServer is the server API for SyncControl service.
+// All implementations must embed UnimplementedSyncControlServer
+// for forward compatibility.
+type SyncControlServer interface {
+	// Trigger starts a sync and returns right away. It fails with
+	// FAILED_PRECONDITION while another sync runs.
+	Trigger(context.Context, *TriggerRequest) (*Run, error)
+	// Watch streams the progress events of the running sync, and of the
+	// following ones, until the client cancels.
+	Watch(*WatchRequest, grpc.ServerStreamingServer[Event]) error
+	// LastRun returns the running sync, or the last one.
+	LastRun(context.Context, *LastRunRequest) (*Run, error)
+	mustEmbedUnimplementedSyncControlServer()
+}
+
+// UnimplementedSyncControlServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedSyncControlServer struct{}
+
+func (UnimplementedSyncControlServer) Trigger(context.Context, *TriggerRequest) (*Run, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Trigger not implemented")
+}
+func (UnimplementedSyncControlServer) Watch(*WatchRequest, grpc.ServerStreamingServer[Event]) error {
+	return status.Errorf(codes.Unimplemented, "method Watch not implemented")
+}
+func (UnimplementedSyncControlServer) LastRun(context.Context, *LastRunRequest) (*Run, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method LastRun not implemented")
+}
+func (UnimplementedSyncControlServer) mustEmbedUnimplementedSyncControlServer() {}
+func (UnimplementedSyncControlServer) testEmbeddedByValue()                     {}
+
+// UnsafeSyncControlServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to SyncControlServer will
+// result in compilation errors.
+type UnsafeSyncControlServer interface {
+	mustEmbedUnimplementedSyncControlServer()
+}
+
+func RegisterSyncControlServer(s grpc.ServiceRegistrar, srv SyncControlServer) {
+	// If the following call pancis, it indicates UnimplementedSyncControlServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&SyncControl_ServiceDesc, srv)
+}
+
+func _SyncControl_Trigger_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(TriggerRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(SyncControlServer).Trigger(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: SyncControl_Trigger_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(SyncControlServer).Trigger(ctx, req.(*TriggerRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _SyncControl_Watch_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(WatchRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(SyncControlServer).Watch(m, &grpc.GenericServerStream[WatchRequest, Event]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type SyncControl_WatchServer = grpc.ServerStreamingServer[Event]
+
+func _SyncControl_LastRun_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(LastRunRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(SyncControlServer).LastRun(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: SyncControl_LastRun_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(SyncControlServer).LastRun(ctx, req.(*LastRunRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// SyncControl_ServiceDesc is the grpc.ServiceDesc for SyncControl service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var SyncControl_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "grafanasync.control.v1.SyncControl",
+	HandlerType: (*SyncControlServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Trigger",
+			Handler:    _SyncControl_Trigger_Handler,
+		},
+		{
+			MethodName: "LastRun",
+			Handler:    _SyncControl_LastRun_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "Watch",
+			Handler:       _SyncControl_Watch_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "control.proto",
+}
@@ -0,0 +1,3 @@
+package controlpb
+
+//go:generate buf generate
@@ -0,0 +1,524 @@
+// Package fakegrafana is an in-memory Grafana HTTP API for tests, and for
+// demos through the mock-server action of grafana-sync. It covers
+// the endpoints used by grafana-sync: dashboards and search, folders,
+// datasources, library panels, legacy notification channels, permissions and
+// the user and organization lookups.
+package fakegrafana
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"grafana-sync/internal/slugify"
+)
+
+// Object is a Grafana resource as generic JSON.
+type Object = map[string]interface{}
+
+// Server is a fake Grafana instance. The zero value is not usable, create
+// one with New.
+type Server struct {
+	*httptest.Server
+
+	// Role is the organization role reported for the API key.
+	Role string
+	// Teams and Users are returned by the team and user lookups.
+	Teams []Object
+	Users []Object
+
+	mu           sync.Mutex
+	dashboards   map[string]*dashboard
+	folders      map[string]Object
+	datasources  []Object
+	library      map[string]Object
+	channels     []Object
+	permissions  map[string][]interface{}
+	requests     []string
+	nextFolderID int
+	nextID       int
+}
+
+type dashboard struct {
+	model     Object
+	folderUID string
+}
+
+// New starts a fake instance with an Admin API key on a local port. Close
+// it when done.
+func New() *Server {
+	s := NewHandler()
+	s.Server = httptest.NewServer(s)
+	return s
+}
+
+// NewHandler returns a fake instance with an Admin API key that is not
+// listening, to be served on an address of the caller's choosing. URL and
+// Close are not available.
+func NewHandler() *Server {
+	return &Server{
+		Role:         "Admin",
+		dashboards:   make(map[string]*dashboard),
+		folders:      make(map[string]Object),
+		library:      make(map[string]Object),
+		permissions:  make(map[string][]interface{}),
+		nextFolderID: 100,
+	}
+}
+
+// AddFolder creates a folder, nested under the folder with parentUID unless
+// it's empty, and returns its ID.
+func (s *Server) AddFolder(uid, title, parentUID string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.nextFolderID++
+	folder := Object{"id": s.nextFolderID, "uid": uid, "title": title}
+	if parentUID != "" {
+		folder["parentUid"] = parentUID
+	}
+	s.folders[uid] = folder
+	return s.nextFolderID
+}
+
+// AddDashboard saves a dashboard, in the General folder when folderUID is
+// empty. The dashboard needs a uid.
+func (s *Server) AddDashboard(folderUID string, model Object) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.saveDashboard(folderUID, model)
+}
+
+// AddDatasource creates a datasource.
+func (s *Server) AddDatasource(ds Object) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.nextID++
+	ds["id"] = s.nextID
+	s.datasources = append(s.datasources, ds)
+}
+
+// AddChannel creates a legacy notification channel.
+func (s *Server) AddChannel(channel Object) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.nextID++
+	channel["id"] = s.nextID
+	s.channels = append(s.channels, channel)
+}
+
+// Dashboard returns the saved model of a dashboard.
+func (s *Server) Dashboard(uid string) (Object, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	d, ok := s.dashboards[uid]
+	if !ok {
+		return nil, false
+	}
+	return d.model, true
+}
+
+// Requests returns the calls received so far, as "METHOD /path?query".
+func (s *Server) Requests() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.requests...)
+}
+
+func (s *Server) saveDashboard(folderUID string, model Object) Object {
+	uid, _ := model["uid"].(string)
+	version := 1
+	if existing, ok := s.dashboards[uid]; ok {
+		if v, ok := existing.model["version"].(int); ok {
+			version = v + 1
+		}
+	}
+	s.nextID++
+	model["id"] = s.nextID
+	model["version"] = version
+	s.dashboards[uid] = &dashboard{model: model, folderUID: folderUID}
+	return Object{"uid": uid, "status": "success", "version": version, "slug": slug(model)}
+}
+
+var (
+	dashboardPath      = regexp.MustCompile(`^/api/dashboards/uid/([^/]+)$`)
+	dashboardPermsPath = regexp.MustCompile(`^/api/dashboards/uid/([^/]+)/permissions$`)
+	folderPath         = regexp.MustCompile(`^/api/folders/([^/]+)$`)
+	folderPermsPath    = regexp.MustCompile(`^/api/folders/([^/]+)/permissions$`)
+	datasourcePath     = regexp.MustCompile(`^/api/datasources/(uid|name|)/?([^/]+)$`)
+	libraryPath        = regexp.MustCompile(`^/api/library-elements/([^/]+)$`)
+	channelPath        = regexp.MustCompile(`^/api/alert-notifications/uid/([^/]+)$`)
+)
+
+// ServeHTTP answers a Grafana API call.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.requests = append(s.requests, r.Method+" "+r.URL.RequestURI())
+
+	var body Object
+	if r.Method == http.MethodPost || r.Method == http.MethodPut || r.Method == http.MethodPatch {
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			reply(w, http.StatusBadRequest, Object{"message": "bad request data"})
+			return
+		}
+	}
+
+	path := r.URL.Path
+	switch {
+	case path == "/api/health":
+		reply(w, http.StatusOK, Object{"database": "ok", "version": "10.4.0"})
+	case path == "/api/search":
+		reply(w, http.StatusOK, s.search(r))
+	case path == "/api/dashboards/db" && r.Method == http.MethodPost:
+		model, _ := body["dashboard"].(Object)
+		if model == nil {
+			reply(w, http.StatusBadRequest, Object{"message": "dashboard is required"})
+			return
+		}
+		if uid, _ := model["uid"].(string); uid == "" {
+			model["uid"] = fmt.Sprintf("fake%d", len(s.dashboards)+1)
+		}
+		folderUID, _ := body["folderUid"].(string)
+		if id, ok := body["folderId"].(float64); ok && folderUID == "" {
+			folderUID = s.folderUIDByID(int(id))
+		}
+		reply(w, http.StatusOK, s.saveDashboard(folderUID, model))
+	case dashboardPermsPath.MatchString(path):
+		s.servePermissions(w, r, dashboardPermsPath.FindStringSubmatch(path)[1], body)
+	case dashboardPath.MatchString(path):
+		s.serveDashboard(w, r, dashboardPath.FindStringSubmatch(path)[1])
+	case path == "/api/folders":
+		s.serveFolders(w, r, body)
+	case folderPermsPath.MatchString(path):
+		s.servePermissions(w, r, "folder:"+folderPermsPath.FindStringSubmatch(path)[1], body)
+	case folderPath.MatchString(path):
+		s.serveFolder(w, r, folderPath.FindStringSubmatch(path)[1], body)
+	case path == "/api/datasources":
+		s.serveDatasources(w, r, body)
+	case datasourcePath.MatchString(path):
+		m := datasourcePath.FindStringSubmatch(path)
+		s.serveDatasource(w, r, m[1], m[2], body)
+	case path == "/api/library-elements":
+		s.serveLibrary(w, r, body)
+	case libraryPath.MatchString(path):
+		s.serveLibraryElement(w, r, libraryPath.FindStringSubmatch(path)[1], body)
+	case path == "/api/alert-notifications":
+		if r.Method == http.MethodPost {
+			s.nextID++
+			body["id"] = s.nextID
+			if uid, _ := body["uid"].(string); uid == "" {
+				body["uid"] = fmt.Sprintf("channel%d", s.nextID)
+			}
+			s.channels = append(s.channels, body)
+			reply(w, http.StatusOK, body)
+			return
+		}
+		reply(w, http.StatusOK, orEmpty(s.channels))
+	case channelPath.MatchString(path):
+		uid := channelPath.FindStringSubmatch(path)[1]
+		for _, c := range s.channels {
+			if c["uid"] == uid {
+				if r.Method == http.MethodPut {
+					merge(c, body)
+				}
+				reply(w, http.StatusOK, c)
+				return
+			}
+		}
+		reply(w, http.StatusNotFound, Object{"message": "Alert notification not found"})
+	case path == "/api/teams/search":
+		reply(w, http.StatusOK, Object{"teams": orEmpty(s.Teams), "totalCount": len(s.Teams)})
+	case path == "/api/org/users/lookup", path == "/api/org/users":
+		reply(w, http.StatusOK, orEmpty(s.Users))
+	case path == "/api/user":
+		reply(w, http.StatusOK, Object{"id": 1, "login": "admin", "orgId": 1})
+	case path == "/api/user/orgs":
+		reply(w, http.StatusOK, []Object{{"orgId": 1, "name": "Main Org.", "role": s.Role}})
+	case path == "/api/org":
+		reply(w, http.StatusOK, Object{"id": 1, "name": "Main Org."})
+	default:
+		reply(w, http.StatusNotFound, Object{"message": "Not found"})
+	}
+}
+
+func (s *Server) search(r *http.Request) []Object {
+	q := r.URL.Query()
+	folderIDs := make(map[int]bool)
+	for _, id := range q["folderIds"] {
+		n, _ := strconv.Atoi(id)
+		folderIDs[n] = true
+	}
+	query := strings.ToLower(q.Get("query"))
+
+	results := []Object{}
+	if q.Get("type") != "dash-folder" {
+		for uid, d := range s.dashboards {
+			title, _ := d.model["title"].(string)
+			tags := stringSlice(d.model["tags"])
+			folder := s.folders[d.folderUID]
+			folderID, _ := folder["id"].(int)
+			if len(folderIDs) > 0 && !folderIDs[folderID] {
+				continue
+			}
+			if query != "" && !strings.Contains(strings.ToLower(title), query) {
+				continue
+			}
+			if !containsAll(tags, q["tag"]) {
+				continue
+			}
+			results = append(results, Object{
+				"uid": uid, "title": title, "type": "dash-db", "tags": tags, "url": "/d/" + uid,
+				"folderUid": d.folderUID, "folderTitle": folder["title"], "folderId": folderID,
+			})
+		}
+	}
+	sort.Slice(results, func(i, j int) bool { return results[i]["title"].(string) < results[j]["title"].(string) })
+	return results
+}
+
+func (s *Server) serveDashboard(w http.ResponseWriter, r *http.Request, uid string) {
+	d, ok := s.dashboards[uid]
+	if !ok {
+		reply(w, http.StatusNotFound, Object{"message": "Dashboard not found"})
+		return
+	}
+	if r.Method == http.MethodDelete {
+		delete(s.dashboards, uid)
+		reply(w, http.StatusOK, Object{"message": "Dashboard deleted"})
+		return
+	}
+	folder := s.folders[d.folderUID]
+	folderTitle := "General"
+	if folder != nil {
+		folderTitle, _ = folder["title"].(string)
+	}
+	reply(w, http.StatusOK, Object{
+		"dashboard": d.model,
+		"meta": Object{
+			"slug": slug(d.model), "folderUid": d.folderUID, "folderTitle": folderTitle,
+			"folderId": folder["id"], "version": d.model["version"], "provisioned": false,
+		},
+	})
+}
+
+func (s *Server) servePermissions(w http.ResponseWriter, r *http.Request, key string, body Object) {
+	if r.Method == http.MethodPost {
+		items, _ := body["items"].([]interface{})
+		s.permissions[key] = items
+		reply(w, http.StatusOK, Object{"message": "Permissions updated"})
+		return
+	}
+	reply(w, http.StatusOK, orEmpty(s.permissions[key]))
+}
+
+func (s *Server) serveFolders(w http.ResponseWriter, r *http.Request, body Object) {
+	if r.Method == http.MethodPost {
+		uid, _ := body["uid"].(string)
+		if uid == "" {
+			uid = fmt.Sprintf("folder%d", s.nextFolderID+1)
+		}
+		if _, ok := s.folders[uid]; ok {
+			reply(w, http.StatusConflict, Object{"message": "a folder with the same uid already exists"})
+			return
+		}
+		s.nextFolderID++
+		folder := Object{"id": s.nextFolderID, "uid": uid, "title": body["title"]}
+		if parent, ok := body["parentUid"]; ok {
+			folder["parentUid"] = parent
+		}
+		s.folders[uid] = folder
+		reply(w, http.StatusOK, folder)
+		return
+	}
+
+	parent := r.URL.Query().Get("parentUid")
+	folders := []Object{}
+	for _, f := range s.folders {
+		if p, _ := f["parentUid"].(string); p == parent {
+			folders = append(folders, f)
+		}
+	}
+	sort.Slice(folders, func(i, j int) bool { return folders[i]["id"].(int) < folders[j]["id"].(int) })
+	reply(w, http.StatusOK, folders)
+}
+
+func (s *Server) serveFolder(w http.ResponseWriter, r *http.Request, uid string, body Object) {
+	folder, ok := s.folders[uid]
+	if !ok {
+		reply(w, http.StatusNotFound, Object{"message": "folder not found"})
+		return
+	}
+	switch r.Method {
+	case http.MethodDelete:
+		delete(s.folders, uid)
+		reply(w, http.StatusOK, Object{"message": "Folder deleted"})
+	case http.MethodPut:
+		merge(folder, body)
+		reply(w, http.StatusOK, folder)
+	default:
+		reply(w, http.StatusOK, folder)
+	}
+}
+
+func (s *Server) folderUIDByID(id int) string {
+	for uid, f := range s.folders {
+		if f["id"] == id {
+			return uid
+		}
+	}
+	return ""
+}
+
+func (s *Server) serveDatasources(w http.ResponseWriter, r *http.Request, body Object) {
+	if r.Method != http.MethodPost {
+		reply(w, http.StatusOK, orEmpty(s.datasources))
+		return
+	}
+	for _, ds := range s.datasources {
+		if ds["name"] == body["name"] {
+			reply(w, http.StatusConflict, Object{"message": "data source with the same name already exists"})
+			return
+		}
+	}
+	s.nextID++
+	body["id"] = s.nextID
+	if uid, _ := body["uid"].(string); uid == "" {
+		body["uid"] = fmt.Sprintf("ds%d", s.nextID)
+	}
+	s.datasources = append(s.datasources, body)
+	s.keepOneDefault(body)
+	reply(w, http.StatusOK, Object{"datasource": body, "id": body["id"], "message": "Datasource added"})
+}
+
+func (s *Server) serveDatasource(w http.ResponseWriter, r *http.Request, by, key string, body Object) {
+	for i, ds := range s.datasources {
+		var match bool
+		switch by {
+		case "uid":
+			match = ds["uid"] == key
+		case "name":
+			match = ds["name"] == key
+		default:
+			match = fmt.Sprint(ds["id"]) == key
+		}
+		if !match {
+			continue
+		}
+		switch r.Method {
+		case http.MethodDelete:
+			s.datasources = append(s.datasources[:i], s.datasources[i+1:]...)
+			reply(w, http.StatusOK, Object{"message": "Data source deleted"})
+		case http.MethodPut:
+			merge(ds, body)
+			s.keepOneDefault(ds)
+			reply(w, http.StatusOK, Object{"datasource": ds})
+		default:
+			reply(w, http.StatusOK, ds)
+		}
+		return
+	}
+	reply(w, http.StatusNotFound, Object{"message": "Data source not found"})
+}
+
+// keepOneDefault unsets isDefault on the other datasources when ds is the
+// default one, as Grafana does.
+func (s *Server) keepOneDefault(ds Object) {
+	if ds["isDefault"] != true {
+		return
+	}
+	for _, other := range s.datasources {
+		if other["uid"] != ds["uid"] {
+			other["isDefault"] = false
+		}
+	}
+}
+
+func (s *Server) serveLibrary(w http.ResponseWriter, r *http.Request, body Object) {
+	if r.Method == http.MethodPost {
+		uid, _ := body["uid"].(string)
+		if uid == "" {
+			uid = fmt.Sprintf("lib%d", len(s.library)+1)
+			body["uid"] = uid
+		}
+		body["version"] = 1
+		s.library[uid] = body
+		reply(w, http.StatusOK, Object{"result": body})
+		return
+	}
+	search := r.URL.Query().Get("searchString")
+	elements := []Object{}
+	for _, e := range s.library {
+		if name, _ := e["name"].(string); strings.Contains(name, search) {
+			elements = append(elements, e)
+		}
+	}
+	reply(w, http.StatusOK, Object{"result": Object{"elements": elements, "totalCount": len(elements)}})
+}
+
+func (s *Server) serveLibraryElement(w http.ResponseWriter, r *http.Request, uid string, body Object) {
+	element, ok := s.library[uid]
+	if !ok {
+		reply(w, http.StatusNotFound, Object{"message": "library element could not be found"})
+		return
+	}
+	if r.Method == http.MethodPatch {
+		merge(element, body)
+		version, _ := element["version"].(int)
+		element["version"] = version + 1
+	}
+	reply(w, http.StatusOK, Object{"result": element})
+}
+
+func reply(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func merge(dst, src Object) {
+	for k, v := range src {
+		dst[k] = v
+	}
+}
+
+func orEmpty[T any](list []T) []T {
+	if list == nil {
+		return []T{}
+	}
+	return list
+}
+
+func slug(model Object) string {
+	title, _ := model["title"].(string)
+	return slugify.Slugify(title)
+}
+
+func stringSlice(v interface{}) []string {
+	list, _ := v.([]interface{})
+	out := []string{}
+	for _, item := range list {
+		if s, ok := item.(string); ok {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+func containsAll(have, want []string) bool {
+	for _, w := range want {
+		found := false
+		for _, h := range have {
+			found = found || h == w
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,104 @@
+// Package slugify derives dashboard slugs from titles the way Grafana does,
+// for the Grafana versions that return an empty slug along with dashboards.
+package slugify
+
+import (
+	"crypto/sha1"
+	"fmt"
+	"strings"
+)
+
+// maxLength is the longest slug Grafana keeps, longer ones are replaced by a
+// hash of the title like those made only of unsupported characters.
+const maxLength = 50
+
+// namespaceOID is the UUID namespace Grafana hashes titles in.
+var namespaceOID = [16]byte{0x6b, 0xa7, 0xb8, 0x12, 0x9d, 0xad, 0x11, 0xd1, 0x80, 0xb4, 0x00, 0xc0, 0x4f, 0xd4, 0x30, 0xc8}
+
+// replacements spell out the characters Grafana transliterates instead of
+// treating as separators.
+var replacements = map[rune]string{
+	'&': "and", '@': "at", '©': "c", '®': "r", 'Æ': "ae", 'ß': "ss",
+	'à': "a", 'á': "a", 'â': "a", 'ä': "ae", 'å': "a", 'æ': "ae",
+	'ç': "c", 'è': "e", 'é': "e", 'ê': "e", 'ë': "e",
+	'ì': "i", 'í': "i", 'î': "i", 'ï': "i",
+	'ò': "o", 'ó': "o", 'ô': "o", 'õ': "o", 'ö': "oe", 'ø': "o",
+	'ù': "u", 'ú': "u", 'û': "u", 'ü': "ue", 'ý': "y", 'þ': "p", 'ÿ': "y",
+	'ā': "a", 'ă': "a", 'Ą': "a", 'ą': "a", 'ć': "c", 'ĉ': "c", 'ċ': "c", 'č': "c",
+	'ď': "d", 'đ': "d", 'ē': "e", 'ĕ': "e", 'ė': "e", 'ę': "e", 'ě': "e",
+	'ĝ': "g", 'ğ': "g", 'ġ': "g", 'ģ': "g", 'ĥ': "h", 'ħ': "h",
+	'ĩ': "i", 'ī': "i", 'ĭ': "i", 'į': "i", 'ı': "i", 'ĳ': "ij", 'ĵ': "j",
+	'ķ': "k", 'ĸ': "k", 'Ĺ': "l", 'ĺ': "l", 'ļ': "l", 'ľ': "l", 'ŀ': "l", 'ł': "l",
+	'ń': "n", 'ņ': "n", 'ň': "n", 'ŉ': "n", 'ŋ': "n",
+	'ō': "o", 'ŏ': "o", 'ő': "o", 'Œ': "oe", 'œ': "oe",
+	'ŕ': "r", 'ŗ': "r", 'ř': "r", 'ś': "s", 'ŝ': "s", 'ş': "s", 'š': "s",
+	'ţ': "t", 'ť': "t", 'ŧ': "t", 'ũ': "u", 'ū': "u", 'ŭ': "u", 'ů': "u", 'ű': "u", 'ų': "u",
+	'ŵ': "w", 'ŷ': "y", 'ź': "z", 'ż': "z", 'ž': "z", 'ſ': "z",
+	'Ə': "e", 'ƒ': "f", 'Ơ': "o", 'ơ': "o", 'Ư': "u", 'ư': "u",
+	'ǎ': "a", 'ǐ': "i", 'ǒ': "o", 'ǔ': "u", 'ǖ': "u", 'ǘ': "u", 'ǚ': "u", 'ǜ': "u",
+	'ǻ': "a", 'Ǽ': "ae", 'ǽ': "ae", 'Ǿ': "o", 'ǿ': "o", 'ə': "e",
+	'Є': "e", 'Б': "b", 'Г': "g", 'Д': "d", 'Ж': "zh", 'З': "z", 'У': "u", 'Ф': "f",
+	'Х': "h", 'Ц': "c", 'Ч': "ch", 'Ш': "sh", 'Щ': "sch", 'Ъ': "-", 'Ы': "y", 'Ь': "-",
+	'Э': "je", 'Ю': "ju", 'Я': "ja",
+	'а': "a", 'б': "b", 'в': "v", 'г': "g", 'д': "d", 'е': "e", 'ж': "zh", 'з': "z",
+	'и': "i", 'й': "j", 'к': "k", 'л': "l", 'м': "m", 'н': "n", 'о': "o", 'п': "p",
+	'р': "r", 'с': "s", 'т': "t", 'у': "u", 'ф': "f", 'х': "h", 'ц': "c", 'ч': "ch",
+	'ш': "sh", 'щ': "sch", 'ъ': "-", 'ы': "y", 'ь': "-", 'э': "je", 'ю': "ju", 'я': "ja",
+	'ё': "jo", 'є': "e", 'і': "i", 'ї': "i", 'Ґ': "g", 'ґ': "g",
+}
+
+// Slugify returns the slug Grafana derives from a dashboard title: the
+// lowercased title with accented letters transliterated and every run of
+// other characters collapsed into a single dash, trimmed of leading and
+// trailing dashes. Titles whose slug would be empty or too long get a
+// name-based UUID of the title instead, so that a slug is never blank.
+func Slugify(title string) string {
+	s := slug(strings.TrimSpace(title))
+	if s == "" || len(s) > maxLength {
+		s = hashed(title)
+	}
+	return s
+}
+
+func slug(value string) string {
+	var b strings.Builder
+	separated := false
+	for _, c := range strings.ToLower(value) {
+		if r, ok := replacements[c]; ok {
+			b.WriteString(r)
+			separated = false
+			continue
+		}
+		if c >= 'a' && c <= 'z' || c >= '0' && c <= '9' {
+			b.WriteRune(c)
+			separated = false
+		} else if !separated {
+			b.WriteByte('-')
+			separated = true
+		}
+	}
+	return strings.Trim(b.String(), "-")
+}
+
+// hashed returns the version 5 UUID of a title in the OID namespace.
+func hashed(title string) string {
+	h := sha1.New()
+	h.Write(namespaceOID[:])
+	h.Write([]byte(title))
+	var u [16]byte
+	copy(u[:], h.Sum(nil))
+	u[6] = u[6]&0x0f | 0x50
+	u[8] = u[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", u[0:4], u[4:6], u[6:8], u[8:10], u[10:])
+}
+
+// Dedupe returns name, or when it is in taken name followed by the first
+// free numeric suffix, and adds the result to taken.
+func Dedupe(name string, taken map[string]bool) string {
+	unique := name
+	for i := 1; taken[unique]; i++ {
+		unique = fmt.Sprintf("%s-%d", name, i)
+	}
+	taken[unique] = true
+	return unique
+}
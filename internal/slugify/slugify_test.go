@@ -0,0 +1,74 @@
+package slugify
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSlugify(t *testing.T) {
+	tests := []struct {
+		title, want string
+	}{
+		{"Cool Dashboard", "cool-dashboard"},
+		{"  CPU   usage  ", "cpu-usage"},
+		{"Node Exporter Full", "node-exporter-full"},
+		{"K8s / Cluster (prod)", "k8s-cluster-prod"},
+		{"API: latency, p99 [ms]", "api-latency-p99-ms"},
+		{"--leading and trailing--", "leading-and-trailing"},
+		{"Errors & Warnings", "errors-and-warnings"},
+		{"ops@example", "opsatexample"},
+		{"Ops Überblick & Co", "ops-ueberblick-and-co"},
+		{"Café Müller", "cafe-mueller"},
+		{"Ærøskøbing", "aeroskobing"},
+		{"Straße", "strasse"},
+		{"Łódź", "lodz"},
+		{"Мониторинг", "monitoring"},
+		{"Panel 2.0_beta", "panel-2-0-beta"},
+		// Titles without a single supported character, or with a slug
+		// longer than 50 characters, hash to the UUIDv5 of the title in the
+		// OID namespace
+		{"!!!", "4d00cdd5-4767-562e-ac67-2db97918243b"},
+		{"日本語ダッシュボード", "52ec0c88-1772-5e21-92ac-d4e202f8d259"},
+		{strings.Repeat("a", 51), "b2f23866-e4fa-5968-b294-c3cf64e32aa4"},
+		{strings.Repeat("a", 50), strings.Repeat("a", 50)},
+	}
+	for _, tt := range tests {
+		if got := Slugify(tt.title); got != tt.want {
+			t.Errorf("Slugify(%q) = %q, want %q", tt.title, got, tt.want)
+		}
+	}
+}
+
+func TestDedupe(t *testing.T) {
+	taken := map[string]bool{}
+	tests := []struct {
+		name, want string
+	}{
+		{"a", "a"},
+		{"a", "a-1"},
+		{"a", "a-2"},
+		{"a-1", "a-1-1"},
+		{"b", "b"},
+		{"a", "a-3"},
+	}
+	for _, tt := range tests {
+		if got := Dedupe(tt.name, taken); got != tt.want {
+			t.Errorf("Dedupe(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+	if len(taken) != len(tests) {
+		t.Errorf("taken has %d names, want %d", len(taken), len(tests))
+	}
+}
+
+func TestDedupeCollidingTitles(t *testing.T) {
+	taken := map[string]bool{}
+	var got []string
+	for _, title := range []string{"CPU Usage", "cpu-usage", "CPU / usage", "Memory"} {
+		got = append(got, Dedupe(Slugify(title), taken))
+	}
+	want := "cpu-usage cpu-usage-1 cpu-usage-2 memory"
+	if strings.Join(got, " ") != want {
+		t.Errorf("deduped slugs %v, want %s", got, want)
+	}
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// job is a sync the daemon runs on a schedule, defined in the jobs section
+// of the configuration file. Directory is relative to -directory; Profile,
+// Folder and Resources replace the ones of the command line and of the
+// file for the job.
+type job struct {
+	Name      string                    `yaml:"name"`
+	Schedule  string                    `yaml:"schedule"`
+	Action    string                    `yaml:"action"`
+	Profile   string                    `yaml:"profile"`
+	Directory string                    `yaml:"directory"`
+	Folder    string                    `yaml:"folder"`
+	Resources map[string]resourceFilter `yaml:"resources"`
+
+	schedule cronSchedule
+}
+
+// checkJobs parses the schedules of the jobs and rejects jobs that can't
+// run.
+func checkJobs() error {
+	names := make(map[string]bool)
+	for i := range cfg.Jobs {
+		j := &cfg.Jobs[i]
+		switch {
+		case j.Name == "":
+			return fmt.Errorf("job %d has no name", i+1)
+		case names[j.Name]:
+			return fmt.Errorf("duplicate job %s", j.Name)
+		}
+		names[j.Name] = true
+		var err error
+		if j.schedule, err = parseCron(j.Schedule); err != nil {
+			return fmt.Errorf("job %s: invalid schedule %q: %v", j.Name, j.Schedule, err)
+		}
+		if _, ok := syncActions[j.Action]; !ok {
+			return fmt.Errorf("job %s: %v", j.Name, errUnknownAction)
+		}
+		if _, ok := cfg.Profiles[j.Profile]; j.Profile != "" && !ok {
+			return fmt.Errorf("job %s: unknown profile %q", j.Name, j.Profile)
+		}
+		if err := checkResourceFilters(j.Resources); err != nil {
+			return fmt.Errorf("job %s: %v", j.Name, err)
+		}
+	}
+	return nil
+}
+
+// runJobs starts the jobs of the configuration file when their schedule
+// matches, at the start of every minute, until the run is cancelled. A job
+// whose previous run hasn't finished is skipped, and jobs run one at a time
+// since they share the connection and the directory. Standby replicas skip
+// every job. Jobs are read again every minute, so that a reloaded
+// configuration applies from the next one.
+func runJobs(ctx context.Context) {
+	var mu sync.Mutex
+	running := make(map[string]bool)
+	for {
+		now := time.Now()
+		next := now.Truncate(time.Minute).Add(time.Minute)
+		select {
+		case <-time.After(next.Sub(now)):
+		case <-ctx.Done():
+			return
+		}
+		if !election.isLeader() {
+			continue
+		}
+		for _, j := range scheduledJobs() {
+			if !j.schedule.matches(next) {
+				continue
+			}
+			mu.Lock()
+			if running[j.Name] {
+				mu.Unlock()
+				log.Printf("Job %s: skipped, the previous run is still going", j.Name)
+				continue
+			}
+			running[j.Name] = true
+			mu.Unlock()
+			go func(j job) {
+				runJob(ctx, j)
+				mu.Lock()
+				delete(running, j.Name)
+				mu.Unlock()
+			}(j)
+		}
+	}
+}
+
+// runJob runs a job with its profile, directory, folder and filters, and
+// restores the settings of the daemon afterwards.
+func runJob(ctx context.Context, j job) {
+	syncMu.Lock()
+	defer syncMu.Unlock()
+	if stopped(ctx) {
+		return
+	}
+
+	url, key := baseURL, apiKey
+	baseDir, baseFolder, baseResources, baseWatermark := directory, folder, cfg.Resources, activeWatermark
+	defer func() {
+		directory, folder, cfg.Resources, activeWatermark = baseDir, baseFolder, baseResources, baseWatermark
+		connect(url, key)
+	}()
+
+	if j.Profile != "" {
+		p, err := resolveProfile(j.Profile)
+		if err != nil {
+			log.Printf("Job %s: %v", j.Name, err)
+			return
+		}
+		if err := useWatermark(p); err != nil {
+			log.Printf("Job %s: profile %s: %v", j.Name, j.Profile, err)
+			return
+		}
+		connect(p.URL, p.APIKey)
+	}
+	if j.Directory != "" {
+		directory = filepath.Join(baseDir, j.Directory)
+	}
+	if j.Folder != "" {
+		folder = j.Folder
+	}
+	if j.Resources != nil {
+		cfg.Resources = j.Resources
+	}
+
+	log.Printf("Job %s: %s %s on %s", j.Name, j.Action, directory, baseURL)
+	start := time.Now()
+	summary = newRunSummary()
+	syncActions[j.Action](ctx)
+	summary.print()
+	summary = newRunSummary()
+	log.Printf("Job %s: finished in %s", j.Name, time.Since(start).Round(time.Second))
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"text/template"
+)
+
+// defaultLayout is the path of a pulled dashboard, relative to the
+// dashboards directory, when the configuration file sets no layout: one
+// directory per folder, so that the tree mirrors the instance.
+const defaultLayout = "{{.FolderPath}}/{{.Slug}}.json"
+
+// layoutFields are the values available to the layout template.
+type layoutFields struct {
+	UID         string
+	Title       string
+	Slug        string
+	FolderUID   string
+	FolderTitle string
+	// FolderPath is FolderTitle preceded by the titles of the parents of
+	// nested folders, as in Parent/Child.
+	FolderPath string
+	Team       string
+}
+
+var layoutTemplate *template.Template
+
+// parseLayout compiles the layout of the configuration file and renders it
+// once, so that unknown fields are reported before anything is pulled.
+func parseLayout() error {
+	layout := cfg.Layout
+	if layout == "" {
+		layout = defaultLayout
+	}
+	t, err := template.New("layout").Parse(layout)
+	if err != nil {
+		return err
+	}
+	layoutTemplate = t
+	_, err = layoutPath(layoutFields{UID: "uid", Title: "Title", Slug: "slug", FolderUID: "folder", FolderTitle: "Folder", FolderPath: "Parent/Folder", Team: "team"})
+	return err
+}
+
+// layoutPath renders the path of a dashboard, relative to the dashboards
+// directory. The path must stay inside that directory and name a JSON file.
+func layoutPath(fields layoutFields) (string, error) {
+	if layoutTemplate == nil {
+		if err := parseLayout(); err != nil {
+			return "", err
+		}
+	}
+	var b strings.Builder
+	if err := layoutTemplate.Execute(&b, fields); err != nil {
+		return "", err
+	}
+	path := filepath.Clean(b.String())
+	switch {
+	case filepath.IsAbs(path) || path == ".." || strings.HasPrefix(path, ".."+string(filepath.Separator)):
+		return "", fmt.Errorf("layout path %q is outside the dashboards directory", path)
+	case filepath.Ext(path) != ".json" || filepath.Base(path) == ".json":
+		return "", fmt.Errorf("layout path %q is not a JSON file name", path)
+	}
+	return path, nil
+}
+
+// layoutRelPath returns the path of a pulled dashboard, given relative to the
+// pulled directory, relative to its dashboards directory.
+func layoutRelPath(relPath string) string {
+	parts := strings.Split(filepath.ToSlash(relPath), "/")
+	for i, part := range parts[:len(parts)-1] {
+		if part == "dashboards" {
+			return filepath.Join(parts[i+1:]...)
+		}
+	}
+	return filepath.Base(relPath)
+}
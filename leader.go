@@ -0,0 +1,274 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	// leaseName is the Kubernetes Lease the daemon replicas compete for,
+	// leader election being disabled when empty.
+	leaseName string
+	// leaseNamespace is the namespace of the Lease, the one of the pod by
+	// default.
+	leaseNamespace string
+)
+
+const (
+	// leaseDuration is how long a leader keeps the Lease without renewing
+	// it, and leaseRenewInterval how often it renews it. Standby replicas
+	// retry at the same interval.
+	leaseDuration      = 15 * time.Second
+	leaseRenewInterval = 5 * time.Second
+)
+
+// serviceAccountDir holds the credentials Kubernetes mounts in pods.
+const serviceAccountDir = "/var/run/secrets/kubernetes.io/serviceaccount"
+
+// errNotLeader is returned by the control APIs of standby replicas.
+var errNotLeader = errors.New("this replica is not the leader")
+
+// leaderElector tracks whether this replica holds the Lease. Without
+// -leader-election, the replica is always the leader.
+type leaderElector struct {
+	mu      sync.Mutex
+	leading bool
+}
+
+var election = &leaderElector{leading: true}
+
+// isLeader reports whether this replica runs the scheduled syncs.
+func (e *leaderElector) isLeader() bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.leading
+}
+
+func (e *leaderElector) setLeader(leading bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if leading != e.leading {
+		if leading {
+			log.Printf("Acquired lease %s/%s, running scheduled syncs", leaseNamespace, leaseName)
+		} else {
+			log.Printf("Lost lease %s/%s, standing by", leaseNamespace, leaseName)
+		}
+	}
+	e.leading = leading
+}
+
+// lease is the part of a coordination.k8s.io/v1 Lease used for the
+// election.
+type lease struct {
+	APIVersion string `json:"apiVersion"`
+	Kind       string `json:"kind"`
+	Metadata   struct {
+		Name            string `json:"name"`
+		Namespace       string `json:"namespace"`
+		ResourceVersion string `json:"resourceVersion,omitempty"`
+	} `json:"metadata"`
+	Spec struct {
+		HolderIdentity       string `json:"holderIdentity"`
+		LeaseDurationSeconds int    `json:"leaseDurationSeconds"`
+		AcquireTime          string `json:"acquireTime,omitempty"`
+		RenewTime            string `json:"renewTime,omitempty"`
+		LeaseTransitions     int    `json:"leaseTransitions"`
+	} `json:"spec"`
+}
+
+// microTime is the format of the MicroTime fields of a Lease.
+const microTime = "2006-01-02T15:04:05.000000Z07:00"
+
+// expired reports whether the holder of the Lease stopped renewing it.
+func (l lease) expired(now time.Time) bool {
+	renewed, err := time.Parse(microTime, l.Spec.RenewTime)
+	if err != nil {
+		renewed, err = time.Parse(time.RFC3339, l.Spec.RenewTime)
+	}
+	if err != nil || l.Spec.HolderIdentity == "" {
+		return true
+	}
+	return now.After(renewed.Add(time.Duration(l.Spec.LeaseDurationSeconds) * time.Second))
+}
+
+// kubeClient calls the Kubernetes API from a pod, with the credentials of
+// its service account.
+type kubeClient struct {
+	host string
+	http *http.Client
+}
+
+func newKubeClient() (*kubeClient, error) {
+	host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+	if host == "" || port == "" {
+		return nil, errors.New("not running in a Kubernetes pod")
+	}
+	ca, err := os.ReadFile(serviceAccountDir + "/ca.crt")
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(ca) {
+		return nil, errors.New("invalid cluster CA certificate")
+	}
+	return &kubeClient{
+		host: "https://" + host + ":" + port,
+		http: &http.Client{
+			Timeout:   leaseRenewInterval,
+			Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool}},
+		},
+	}, nil
+}
+
+// do sends a request and decodes the response into out. It returns the
+// status code, and an error for other statuses than 2xx and 404.
+func (k *kubeClient) do(ctx context.Context, method, path string, in, out interface{}) (int, error) {
+	var body []byte
+	if in != nil {
+		body, _ = json.Marshal(in)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, k.host+path, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	// The token is read on every request, as projected tokens are rotated
+	token, err := os.ReadFile(serviceAccountDir + "/token")
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Authorization", "Bearer "+strings.TrimSpace(string(token)))
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := k.http.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return resp.StatusCode, nil
+	case resp.StatusCode >= 300:
+		return resp.StatusCode, fmt.Errorf("%s %s returned %s", method, path, resp.Status)
+	case out != nil:
+		return resp.StatusCode, json.NewDecoder(resp.Body).Decode(out)
+	}
+	return resp.StatusCode, nil
+}
+
+// runLeaderElection competes for the Lease until the run is cancelled,
+// releasing it on the way out when held so that a standby replica takes
+// over right away.
+func runLeaderElection(ctx context.Context) {
+	k, err := newKubeClient()
+	if err != nil {
+		log.Fatalf("Error setting up leader election: %v", err)
+	}
+	if leaseNamespace == "" {
+		ns, err := os.ReadFile(serviceAccountDir + "/namespace")
+		if err != nil {
+			log.Fatalf("Error reading the namespace of the pod, set -leader-election-namespace: %v", err)
+		}
+		leaseNamespace = strings.TrimSpace(string(ns))
+	}
+	identity, err := os.Hostname()
+	if err != nil {
+		log.Fatalf("Error reading the hostname: %v", err)
+	}
+	fmt.Printf("Competing for lease %s/%s as %s\n", leaseNamespace, leaseName, identity)
+
+	path := fmt.Sprintf("/apis/coordination.k8s.io/v1/namespaces/%s/leases", leaseNamespace)
+	var renewed time.Time
+	ticker := time.NewTicker(leaseRenewInterval)
+	defer ticker.Stop()
+	for {
+		leading, err := acquireLease(ctx, k, path, identity)
+		switch {
+		case err == nil:
+			if leading {
+				renewed = time.Now()
+			}
+			election.setLeader(leading)
+		case election.isLeader() && time.Since(renewed) > leaseDuration:
+			log.Printf("Error renewing lease: %v", err)
+			election.setLeader(false)
+		case stopped(ctx):
+		default:
+			log.Printf("Error updating lease: %v", err)
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			if election.isLeader() {
+				releaseLease(k, path, identity)
+			}
+			return
+		}
+	}
+}
+
+// acquireLease creates the Lease, takes it over once expired or renews it
+// when held, and reports whether this replica holds it. Updates carry the
+// resource version of the Lease read, so that concurrent replicas can't
+// both win.
+func acquireLease(ctx context.Context, k *kubeClient, path, identity string) (bool, error) {
+	var l lease
+	status, err := k.do(ctx, "GET", path+"/"+leaseName, nil, &l)
+	if err != nil {
+		return false, err
+	}
+	now := time.Now()
+	if status == http.StatusNotFound {
+		l.APIVersion, l.Kind = "coordination.k8s.io/v1", "Lease"
+		l.Metadata.Name, l.Metadata.Namespace = leaseName, leaseNamespace
+	} else if l.Spec.HolderIdentity != identity && !l.expired(now) {
+		return false, nil
+	}
+
+	if l.Spec.HolderIdentity != identity {
+		l.Spec.HolderIdentity = identity
+		l.Spec.AcquireTime = now.UTC().Format(microTime)
+		if status != http.StatusNotFound {
+			l.Spec.LeaseTransitions++
+		}
+	}
+	l.Spec.LeaseDurationSeconds = int(leaseDuration / time.Second)
+	l.Spec.RenewTime = now.UTC().Format(microTime)
+
+	if status == http.StatusNotFound {
+		status, err = k.do(ctx, "POST", path, l, nil)
+	} else {
+		status, err = k.do(ctx, "PUT", path+"/"+leaseName, l, nil)
+	}
+	if status == http.StatusConflict {
+		// Another replica updated the Lease first
+		return false, nil
+	}
+	return err == nil && status != http.StatusNotFound, err
+}
+
+// releaseLease gives up the Lease held by this replica.
+func releaseLease(k *kubeClient, path, identity string) {
+	ctx, cancel := context.WithTimeout(context.Background(), leaseRenewInterval)
+	defer cancel()
+	var l lease
+	if _, err := k.do(ctx, "GET", path+"/"+leaseName, nil, &l); err != nil || l.Spec.HolderIdentity != identity {
+		return
+	}
+	l.Spec.HolderIdentity = ""
+	if _, err := k.do(ctx, "PUT", path+"/"+leaseName, l, nil); err != nil {
+		log.Printf("Error releasing lease: %v", err)
+		return
+	}
+	log.Printf("Released lease %s/%s", leaseNamespace, leaseName)
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLeaseExpired(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		holder    string
+		renewTime string
+		duration  int
+		want      bool
+	}{
+		{"pod-a", "2024-05-01T11:59:50.000000Z", 15, false},
+		{"pod-a", "2024-05-01T11:59:30.000000Z", 15, true},
+		{"pod-a", "2024-05-01T11:59:45.000000Z", 15, false},
+		{"pod-a", "2024-05-01T11:59:44.999999Z", 15, true},
+		// RFC 3339 times without microseconds are accepted too
+		{"pod-a", "2024-05-01T11:59:50Z", 15, false},
+		{"pod-a", "2024-05-01T13:59:50+02:00", 15, false},
+		// Leases without a holder or a readable renew time are free
+		{"", "2024-05-01T11:59:50.000000Z", 15, true},
+		{"pod-a", "", 15, true},
+		{"pod-a", "yesterday", 15, true},
+	}
+	for _, tt := range tests {
+		var l lease
+		l.Spec.HolderIdentity = tt.holder
+		l.Spec.RenewTime = tt.renewTime
+		l.Spec.LeaseDurationSeconds = tt.duration
+		if got := l.expired(now); got != tt.want {
+			t.Errorf("lease held by %q renewed at %q for %ds: expired = %v, want %v", tt.holder, tt.renewTime, tt.duration, got, tt.want)
+		}
+	}
+}
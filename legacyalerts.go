@@ -0,0 +1,128 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"path/filepath"
+	"strings"
+)
+
+// reportLegacyAlerts lists the legacy alerts embedded in the panels of the
+// local dashboards, to plan the migration to unified alerting.
+func reportLegacyAlerts() {
+	files, err := dashboardFiles()
+	if err != nil {
+		log.Fatalf("Error reading dashboard directory: %v", err)
+	}
+
+	header := []string{"file", "dashboard_uid", "dashboard", "panel_id", "panel", "alert", "frequency", "for", "conditions", "no_data_state", "execution_error_state", "notifications"}
+	var rows [][]string
+	for _, filePath := range files {
+		dashboard, err := readDashboard(filePath)
+		if err != nil {
+			log.Printf("Error reading file %s: %v", filePath, err)
+			continue
+		}
+		uid, _ := dashboard["uid"].(string)
+		title, _ := dashboard["title"].(string)
+
+		for _, panel := range dashboardPanels(dashboard) {
+			alert, ok := panel["alert"].(map[string]interface{})
+			if !ok {
+				continue
+			}
+			rows = append(rows, []string{
+				filepath.Base(filePath),
+				uid,
+				title,
+				fmt.Sprint(panel["id"]),
+				str(panel["title"]),
+				str(alert["name"]),
+				str(alert["frequency"]),
+				str(alert["for"]),
+				alertConditions(alert),
+				str(alert["noDataState"]),
+				str(alert["executionErrorState"]),
+				alertNotifications(alert),
+			})
+		}
+	}
+	writeReport(header, rows)
+}
+
+// alertConditions renders legacy alert conditions the way the alert editor
+// shows them, e.g. "WHEN avg() OF query(A, 5m, now) IS ABOVE 80".
+func alertConditions(alert map[string]interface{}) string {
+	conditions, _ := alert["conditions"].([]interface{})
+	var parts []string
+	for i, c := range conditions {
+		condition, _ := c.(map[string]interface{})
+		reducer, _ := condition["reducer"].(map[string]interface{})
+		query, _ := condition["query"].(map[string]interface{})
+		evaluator, _ := condition["evaluator"].(map[string]interface{})
+		operator, _ := condition["operator"].(map[string]interface{})
+
+		part := fmt.Sprintf("%s() OF query(%s) IS %s %s",
+			str(reducer["type"]),
+			joinValues(query["params"]),
+			evaluatorName(str(evaluator["type"])),
+			joinValues(evaluator["params"]))
+		if i == 0 {
+			part = "WHEN " + part
+		} else {
+			part = strings.ToUpper(str(operator["type"])) + " " + part
+		}
+		parts = append(parts, part)
+	}
+	return strings.Join(parts, " ")
+}
+
+// evaluatorNames are the labels used by the legacy alert editor.
+var evaluatorNames = map[string]string{
+	"gt":            "ABOVE",
+	"lt":            "BELOW",
+	"outside_range": "OUTSIDE RANGE",
+	"within_range":  "WITHIN RANGE",
+	"no_value":      "HAS NO VALUE",
+}
+
+func evaluatorName(t string) string {
+	if name, ok := evaluatorNames[t]; ok {
+		return name
+	}
+	return strings.ToUpper(t)
+}
+
+func alertNotifications(alert map[string]interface{}) string {
+	notifications, _ := alert["notifications"].([]interface{})
+	var refs []string
+	for _, n := range notifications {
+		notification, _ := n.(map[string]interface{})
+		if uid := str(notification["uid"]); uid != "" {
+			refs = append(refs, uid)
+		} else if id, ok := notification["id"]; ok {
+			refs = append(refs, fmt.Sprint(id))
+		}
+	}
+	return strings.Join(refs, ";")
+}
+
+func joinValues(v interface{}) string {
+	values, _ := v.([]interface{})
+	parts := make([]string, 0, len(values))
+	for _, value := range values {
+		parts = append(parts, fmt.Sprint(value))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// str returns a JSON value as a string, or an empty string for null.
+func str(v interface{}) string {
+	if v == nil {
+		return ""
+	}
+	if s, ok := v.(string); ok {
+		return s
+	}
+	return fmt.Sprint(v)
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/url"
+	"path/filepath"
+)
+
+// panelTitles holds the titles given with -panel-title.
+var panelTitles stringList
+
+// stringList is a flag that can be repeated.
+type stringList []string
+
+func (s *stringList) String() string { return fmt.Sprint(*s) }
+
+func (s *stringList) Set(value string) error {
+	*s = append(*s, value)
+	return nil
+}
+
+func (s stringList) contains(value string) bool {
+	for _, v := range s {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// extractLibraryPanels replaces the inline panels selected with -panel-title
+// by references to library panels, creating each library panel once from the
+// first occurrence found. The local dashboard files are rewritten and can be
+// pushed afterwards.
+func extractLibraryPanels(ctx context.Context) {
+	fmt.Println("Extracting library panels...")
+	if len(panelTitles) == 0 {
+		log.Fatalf("Error: at least one -panel-title is required")
+	}
+
+	files, err := dashboardFiles()
+	if err != nil {
+		log.Fatalf("Error reading dashboard directory: %v", err)
+	}
+
+	var folderID int
+	if folder != "" {
+		folderID = getFolderID(ctx, folder)
+	}
+
+	libraryUIDs := map[string]string{}
+	for _, filePath := range files {
+		if stopped(ctx) {
+			break
+		}
+		dashboard, err := readDashboard(filePath)
+		if err != nil {
+			log.Printf("Error reading file %s: %v", filePath, err)
+			continue
+		}
+
+		changed := false
+		for _, panel := range dashboardPanels(dashboard) {
+			title, _ := panel["title"].(string)
+			if !panelTitles.contains(title) || panel["libraryPanel"] != nil || panel["type"] == "row" {
+				continue
+			}
+
+			uid, ok := libraryUIDs[title]
+			if !ok {
+				uid, err = ensureLibraryPanel(ctx, title, panel, folderID)
+				if err != nil {
+					log.Printf("Error creating library panel %s: %s", title, describeError(err))
+					summary.add("library panels", outcomeFailed, title)
+					continue
+				}
+				libraryUIDs[title] = uid
+			}
+
+			// Keep only the placement of the panel and point it at the library panel
+			id, gridPos := panel["id"], panel["gridPos"]
+			for k := range panel {
+				delete(panel, k)
+			}
+			panel["id"] = id
+			panel["gridPos"] = gridPos
+			panel["libraryPanel"] = map[string]interface{}{"uid": uid, "name": title}
+			changed = true
+		}
+
+		if !changed {
+			continue
+		}
+		if err := writeDashboard(filePath, dashboard); err != nil {
+			log.Printf("Error saving file %s: %v", filePath, err)
+			continue
+		}
+		fmt.Printf("Updated dashboard: %s\n", filepath.Base(filePath))
+	}
+}
+
+// ensureLibraryPanel returns the UID of the library panel with the given
+// name, creating it from the panel model when it does not exist yet.
+func ensureLibraryPanel(ctx context.Context, name string, model map[string]interface{}, folderID int) (string, error) {
+	var search struct {
+		Result struct {
+			Elements []struct {
+				UID  string `json:"uid"`
+				Name string `json:"name"`
+			} `json:"elements"`
+		} `json:"result"`
+	}
+	if err := getJSON(ctx, "/api/library-elements?kind=1&searchString="+url.QueryEscape(name), &search); err != nil {
+		return "", err
+	}
+	for _, e := range search.Result.Elements {
+		if e.Name == name {
+			fmt.Printf("Using existing library panel: %s\n", name)
+			return e.UID, nil
+		}
+	}
+
+	libraryModel := map[string]interface{}{}
+	for k, v := range model {
+		if k != "id" && k != "gridPos" {
+			libraryModel[k] = v
+		}
+	}
+	body, _ := json.Marshal(map[string]interface{}{
+		"folderId": folderID,
+		"name":     name,
+		"model":    libraryModel,
+		"kind":     1,
+	})
+
+	data, status, err := doRequest(ctx, "POST", fmt.Sprintf("%s/api/library-elements", baseURL), body)
+	if err != nil {
+		return "", err
+	}
+	if status >= 400 {
+		return "", newAPIError(status, data)
+	}
+
+	var created struct {
+		Result struct {
+			UID string `json:"uid"`
+		} `json:"result"`
+	}
+	if err := json.Unmarshal(data, &created); err != nil {
+		return "", err
+	}
+	printChange("Created library panel: %s\n", name)
+	return created.Result.UID, nil
+}
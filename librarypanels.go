@@ -0,0 +1,172 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"path/filepath"
+)
+
+// libraryPanelsDir holds the library panels of a directory, one file per
+// library panel named after its UID.
+const libraryPanelsDir = "library-panels"
+
+// libraryPanelPageSize is the number of library panels listed per request.
+const libraryPanelPageSize = 100
+
+// listLibraryPanels returns every library panel of the instance, with the
+// title of its folder.
+func listLibraryPanels(ctx context.Context) ([]libraryElement, error) {
+	var panels []libraryElement
+	for page := 1; ; page++ {
+		var result struct {
+			Result struct {
+				Elements []struct {
+					libraryElement
+					Meta struct {
+						FolderName string `json:"folderName"`
+					} `json:"meta"`
+				} `json:"elements"`
+			} `json:"result"`
+		}
+		data, status, err := doRequest(ctx, "GET", fmt.Sprintf("%s/api/library-elements?kind=1&perPage=%d&page=%d", baseURL, libraryPanelPageSize, page), nil)
+		if err != nil {
+			return nil, err
+		}
+		if status >= 400 {
+			return nil, newAPIError(status, data)
+		}
+		if err := json.Unmarshal(data, &result); err != nil {
+			return nil, err
+		}
+		for _, e := range result.Result.Elements {
+			e.libraryElement.FolderTitle = e.Meta.FolderName
+			panels = append(panels, e.libraryElement)
+		}
+		if len(result.Result.Elements) < libraryPanelPageSize {
+			return panels, nil
+		}
+	}
+}
+
+// pullLibraryPanels saves the library panels of the instance, which
+// dashboards reference by UID. The library panels directory is replaced.
+func pullLibraryPanels(ctx context.Context) {
+	fmt.Println("Pulling library panels...")
+	panels, err := listLibraryPanels(ctx)
+	if err != nil {
+		pullFailed(ctx, "library-panels", "fetching library panels", err)
+		return
+	}
+
+	dir := filepath.Join(directory, libraryPanelsDir)
+	if err := os.RemoveAll(dir); err != nil {
+		log.Fatalf("Error cleaning library panels directory: %v", err)
+	}
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		log.Fatalf("Error creating directory: %v", err)
+	}
+	for _, p := range panels {
+		data, err := json.MarshalIndent(p, "", "  ")
+		if err == nil {
+			err = os.WriteFile(filepath.Join(dir, url.PathEscape(p.UID)+".json"), data, 0644)
+		}
+		if err != nil {
+			log.Printf("Error saving library panel %s: %v", p.Name, err)
+			continue
+		}
+		fmt.Printf("Saved library panel: %s\n", p.Name)
+	}
+}
+
+// pushLibraryPanels creates or updates the local library panels, keeping
+// their UID so that dashboard references stay valid. Their folder is
+// created when missing, unless -strict-folders.
+func pushLibraryPanels(ctx context.Context) {
+	fmt.Println("Pushing library panels...")
+	// A directory without library panels has nothing to push
+	files, err := filepath.Glob(filepath.Join(directory, libraryPanelsDir, "*.json"))
+	if err != nil {
+		fmt.Println("Error reading library panels directory:", err)
+		return
+	}
+	if len(files) == 0 {
+		fmt.Println("No library panels to push")
+		return
+	}
+
+	for _, path := range files {
+		if stopped(ctx) {
+			break
+		}
+		var p libraryElement
+		data, err := os.ReadFile(path)
+		if err == nil {
+			err = json.Unmarshal(data, &p)
+		}
+		if err == nil && (p.UID == "" || p.Name == "") {
+			err = fmt.Errorf("library panel has no uid or name")
+		}
+		if err != nil {
+			log.Printf("Error reading library panel %s: %v", path, err)
+			summary.add("library panels", outcomeFailed, filepath.Base(path))
+			continue
+		}
+		if p.FolderUID != "" {
+			title := p.FolderTitle
+			if title == "" {
+				title = p.FolderUID
+			}
+			err = ensurePushFolder(ctx, folderInfo{UID: p.FolderUID, Title: title})
+		}
+		if err == nil {
+			err = putLibraryElement(ctx, p, p.FolderUID)
+		}
+		if err != nil {
+			log.Printf("Error pushing library panel %s: %s", p.Name, describeError(err))
+			summary.add("library panels", outcomeFailed, p.Name)
+			continue
+		}
+		printChange("Uploaded library panel: %s\n", p.Name)
+		summary.add("library panels", outcomePushed, p.Name)
+	}
+	lookups.reset()
+}
+
+// resolveLibraryPanelRefs checks the library panel references of a
+// dashboard against the instance. A reference whose UID is unknown is
+// pointed at the library panel with the same name, when there is one, so
+// that library panels recreated with another UID don't leave broken panels.
+func resolveLibraryPanelRefs(ctx context.Context, data []byte) ([]byte, error) {
+	var dashboard map[string]interface{}
+	if err := json.Unmarshal(data, &dashboard); err != nil {
+		return nil, err
+	}
+	changed := false
+	for _, panel := range dashboardPanels(dashboard) {
+		ref, ok := panel["libraryPanel"].(map[string]interface{})
+		if !ok {
+			continue
+		}
+		uid, _ := ref["uid"].(string)
+		name, _ := ref["name"].(string)
+		resolved, found, err := lookups.libraryPanelUID(ctx, uid, name)
+		if err != nil {
+			return nil, err
+		}
+		if !found {
+			return nil, fmt.Errorf("library panel %q (%s) not found on the instance, push library panels first", name, uid)
+		}
+		if resolved != uid {
+			ref["uid"] = resolved
+			changed = true
+		}
+	}
+	if !changed {
+		return data, nil
+	}
+	return json.Marshal(dashboard)
+}
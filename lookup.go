@@ -0,0 +1,211 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// lookupCache holds the folders and datasources of the connected instance,
+// fetched once per run instead of once per file. It is safe for concurrent
+// use. A name that isn't found triggers one reload, so resources created
+// earlier in the run are found as well; names still missing after it are
+// remembered and don't cause further reloads.
+type lookupCache struct {
+	mu sync.Mutex
+	// folders maps folder paths, the titles of the ancestors of a folder
+	// and its own joined with /, to folder IDs, and folderTitles maps
+	// titles to the paths of the folders having them.
+	folders      map[string]int
+	folderTitles map[string][]string
+	datasources  map[string]datasourceRef
+	byUID        map[string]datasourceRef
+	// libraryPanels maps "uid:<uid>" and "name:<name>" to library panel
+	// UIDs.
+	libraryPanels map[string]string
+	missing       map[string]bool
+}
+
+var lookups = &lookupCache{}
+
+// reset drops the cached lookups, when connecting to another instance.
+func (c *lookupCache) reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.folders, c.folderTitles, c.datasources, c.byUID, c.libraryPanels, c.missing = nil, nil, nil, nil, nil, nil
+}
+
+// folderID returns the ID of the folder with the given path, or with the
+// given title when a single folder has it, 0 for the General folder. The
+// folders are fetched without holding the lock.
+func (c *lookupCache) folderID(ctx context.Context, name string) (int, error) {
+	if name == generalFolder {
+		return 0, nil
+	}
+	c.mu.Lock()
+	id, found, err := c.findFolder(name)
+	missing := c.missing["folder:"+name]
+	c.mu.Unlock()
+	if found || err != nil {
+		return id, err
+	}
+
+	if !missing {
+		folders, err := client.GetAllFolders(ctx)
+		if err != nil {
+			return 0, err
+		}
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		c.setFolders(folders)
+		if id, found, err := c.findFolder(name); found || err != nil {
+			return id, err
+		}
+		c.remember("folder:" + name)
+	}
+	return 0, fmt.Errorf("%w: %s", errFolderNotFound, name)
+}
+
+// errFolderNotFound is returned by folderID for names no folder has.
+var errFolderNotFound = errors.New("folder not found")
+
+// findFolder looks a folder up by path, then by title. Titles shared by
+// several nested folders are ambiguous.
+func (c *lookupCache) findFolder(name string) (int, bool, error) {
+	if id, ok := c.folders[name]; ok {
+		return id, true, nil
+	}
+	switch paths := c.folderTitles[name]; len(paths) {
+	case 0:
+		return 0, false, nil
+	case 1:
+		return c.folders[paths[0]], true, nil
+	default:
+		return 0, false, fmt.Errorf("several folders are titled %s, give the path of one of them: %s", name, strings.Join(paths, ", "))
+	}
+}
+
+// addFolder records a top level folder created during the run.
+func (c *lookupCache) addFolder(title string, id int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.folders == nil {
+		c.folders = make(map[string]int)
+		c.folderTitles = make(map[string][]string)
+	}
+	path := strings.ReplaceAll(title, "/", "-")
+	c.folders[path] = id
+	c.folderTitles[title] = append(c.folderTitles[title], path)
+	delete(c.missing, "folder:"+title)
+}
+
+func (c *lookupCache) remember(key string) {
+	if c.missing == nil {
+		c.missing = make(map[string]bool)
+	}
+	c.missing[key] = true
+}
+
+func (c *lookupCache) setFolders(folders []folderInfo) {
+	paths := folderPaths(folders)
+	c.folders = make(map[string]int, len(folders))
+	c.folderTitles = make(map[string][]string, len(folders))
+	for _, f := range folders {
+		path := filepath.ToSlash(paths[f.UID])
+		c.folders[path] = f.ID
+		c.folderTitles[f.Title] = append(c.folderTitles[f.Title], path)
+	}
+}
+
+// datasource returns the reference of a datasource by name or numeric ID.
+func (c *lookupCache) datasource(ctx context.Context, key string) (datasourceRef, bool, error) {
+	return c.lookupDatasource(ctx, func() map[string]datasourceRef { return c.datasources }, "datasource:"+key, key)
+}
+
+// datasourceByUID returns the reference of a datasource by UID.
+func (c *lookupCache) datasourceByUID(ctx context.Context, uid string) (datasourceRef, bool, error) {
+	return c.lookupDatasource(ctx, func() map[string]datasourceRef { return c.byUID }, "uid:"+uid, uid)
+}
+
+func (c *lookupCache) lookupDatasource(ctx context.Context, index func() map[string]datasourceRef, missingKey, key string) (datasourceRef, bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if ref, ok := index()[key]; ok || c.missing[missingKey] {
+		return ref, ok, nil
+	}
+	if err := c.loadDatasources(ctx); err != nil {
+		return datasourceRef{}, false, err
+	}
+	ref, ok := index()[key]
+	if !ok {
+		c.remember(missingKey)
+	}
+	return ref, ok, nil
+}
+
+func (c *lookupCache) loadDatasources(ctx context.Context) error {
+	data, status, err := doRequest(ctx, "GET", fmt.Sprintf("%s/api/datasources", baseURL), nil)
+	if err != nil {
+		return err
+	}
+	if status >= 400 {
+		return newAPIError(status, data)
+	}
+
+	var datasources []struct {
+		ID   int    `json:"id"`
+		UID  string `json:"uid"`
+		Name string `json:"name"`
+		Type string `json:"type"`
+	}
+	if err := json.Unmarshal(data, &datasources); err != nil {
+		return err
+	}
+	c.datasources = make(map[string]datasourceRef)
+	c.byUID = make(map[string]datasourceRef)
+	for _, ds := range datasources {
+		ref := datasourceRef{Type: ds.Type, UID: ds.UID}
+		c.datasources[ds.Name] = ref
+		c.datasources[strconv.Itoa(ds.ID)] = ref
+		c.byUID[ds.UID] = ref
+	}
+	return nil
+}
+
+// libraryPanelUID returns the UID of the library panel with the given UID,
+// or else of the one with the given name.
+func (c *lookupCache) libraryPanelUID(ctx context.Context, uid, name string) (string, bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	find := func() (string, bool) {
+		if resolved, ok := c.libraryPanels["uid:"+uid]; ok {
+			return resolved, true
+		}
+		resolved, ok := c.libraryPanels["name:"+name]
+		return resolved, ok
+	}
+	if resolved, ok := find(); ok || c.missing["library:"+uid] {
+		return resolved, ok, nil
+	}
+	panels, err := listLibraryPanels(ctx)
+	if err != nil {
+		return "", false, err
+	}
+	c.libraryPanels = make(map[string]string)
+	for _, p := range panels {
+		c.libraryPanels["uid:"+p.UID] = p.UID
+		c.libraryPanels["name:"+p.Name] = p.UID
+	}
+	resolved, ok := find()
+	if !ok {
+		c.remember("library:" + uid)
+	}
+	return resolved, ok, nil
+}
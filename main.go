@@ -1,27 +1,39 @@
 package main
 
 import (
-	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"io/ioutil"
+	"log"
 	"net/http"
 	"os"
 	"path/filepath"
-	"context"
-	"log"
+	"strings"
+	"time"
 
-	"github.com/grafana-tools/sdk"
+	"grafana-sync/internal/slugify"
 )
 
+// version is set at build time.
+var version = "dev"
+
 var (
 	apiKey    string
 	baseURL   string
 	directory string
 	action    string
 	folder    string
-	client    *sdk.Client
+	client    GrafanaAPI
+
+	debugHTTPDir string
+	userAgent    string
+	logRequests  bool
+
+	actingUser       string
+	actingUserHeader string
 )
 
 func init() {
@@ -30,354 +42,1224 @@ func init() {
 	flag.StringVar(&directory, "directory", "grafana_data", "Directory to store/load Grafana data")
 	flag.StringVar(&action, "action", "pull", "Action to perform: pull or push")
 	flag.StringVar(&folder, "folder", "", "Specify a folder for pulling dashboards (optional)")
+	flag.StringVar(&configFile, "config", defaultConfigFile, "Configuration file")
+	flag.StringVar(&profileName, "profile", "", "Profile of the configuration file used for -url and -apikey (optional)")
+	flag.StringVar(&debugHTTPDir, "debug-http", "", "Directory to record sanitized request/response pairs of failed API calls (optional)")
+	flag.StringVar(&userAgent, "user-agent", "grafana-sync/"+version, "User-Agent sent with every API call")
+	flag.BoolVar(&logRequests, "log-requests", false, "Log every API call with its X-Request-Id")
+	flag.StringVar(&buildDir, "output", "build", "Directory where build writes composed dashboards")
+	flag.IntVar(&maxPanels, "max-panels", 0, "Maximum number of panels per dashboard, 0 to disable")
+	flag.IntVar(&maxJSONSize, "max-json-size", 0, "Maximum dashboard JSON size in bytes, 0 to disable")
+	flag.IntVar(&maxQueriesPerPanel, "max-queries-per-panel", 0, "Maximum number of queries per panel, 0 to disable")
+	flag.StringVar(&guardrailMode, "guardrails", "warn", "What to do with dashboards exceeding a threshold: warn or block")
+	flag.BoolVar(&backupBeforePush, "backup-before-push", false, "Save the remote resources about to be overwritten before pushing")
+	flag.StringVar(&backupDir, "backup-dir", "backups", "Directory where -backup-before-push stores timestamped backups")
+	flag.DurationVar(&daemonInterval, "interval", 5*time.Minute, "Time between checks in daemon mode")
+	flag.StringVar(&listenAddr, "listen", ":9090", "Address the daemon serves metrics on, and mock-server the Grafana API")
+	flag.StringVar(&driftWebhook, "drift-webhook", "", "URL notified with a JSON payload when the daemon detects new drift (optional)")
+	flag.StringVar(&webhookLog, "webhook-log", "", "File where the daemon appends dashboard change events received on /webhook/grafana (optional)")
+	flag.StringVar(&webhookToken, "webhook-token", "", "Token required by /webhook/grafana as bearer token or token query parameter; the webhook is not served without it")
+	flag.StringVar(&grpcListen, "grpc-listen", "", "Address the daemon serves the gRPC control API on (optional)")
+	flag.StringVar(&controlToken, "control-token", "", "Bearer token required by the control APIs of the daemon, which are only served when it is set")
+	flag.StringVar(&leaseName, "leader-election", "", "Kubernetes Lease the daemon replicas compete for, so that only the leader runs scheduled syncs (optional)")
+	flag.StringVar(&leaseNamespace, "leader-election-namespace", "", "Namespace of the leader election Lease. Default is the namespace of the pod")
+	flag.StringVar(&reconcileCommand, "reconcile-command", "", "Shell command run for every dashboard change received by the daemon (optional)")
+	flag.StringVar(&requireRole, "require-role", "", "Fail unless the API key has at least this role: Viewer, Editor or Admin (optional)")
+	flag.StringVar(&apiData, "data", "", "Request body for the api action, or @file to read it from a file")
+	flag.StringVar(&reportName, "report", "", "Report to generate with the report action")
+	flag.StringVar(&compareDir, "compare-directory", "", "Second pulled directory compared by the uid-stability and duplicates reports and by diff-dirs")
+	flag.StringVar(&reportFormat, "format", "csv", "Report output format: csv or json")
+	flag.StringVar(&splitDir, "split-dir", "split", "Directory where split writes the directory of every target")
+	flag.BoolVar(&groupByTeam, "group-by-team", false, "Pull dashboards into teams/<team>/dashboards by the team owning their folder")
+	flag.BoolVar(&convertDatasourceRefs, "convert-datasource-refs", false, "Replace datasource references by name or numeric ID with UID references on push")
+	flag.StringVar(&defaultDatasource, "default-datasource", "", "UID of the datasource set on panels using the default datasource on push (optional)")
+	flag.BoolVar(&readOnly, "read-only", false, "Push dashboards locked: not editable and view-only for viewers and editors")
+	flag.StringVar(&archiveDir, "archive-dir", "archive", "Directory where nightly keeps its dated exports")
+	flag.IntVar(&keepArchives, "keep", 7, "Number of nightly exports to keep, 0 to keep all")
+	flag.StringVar(&digestWebhook, "digest-webhook", "", "URL the nightly change summary is posted to (optional)")
+	flag.StringVar(&smtpServer, "smtp-server", "", "SMTP server, as host:port, the nightly change summary is mailed through (optional)")
+	flag.StringVar(&mailFrom, "mail-from", "grafana-sync@localhost", "Sender of the nightly change summary")
+	flag.Var(&mailTo, "mail-to", "Recipient of the nightly change summary (repeatable)")
+	flag.Float64Var(&rateLimit, "rate-limit", 0, "Maximum number of API calls per second, 0 for no limit")
+	flag.DurationVar(&deadline, "deadline", 0, "Maximum duration of the whole run, such as 10m, 0 for no deadline")
+	flag.DurationVar(&requestTimeout, "request-timeout", 0, "Maximum duration of each API call, 0 for no timeout")
+	flag.StringVar(&bundleDir, "bundle-dir", "bundles", "Directory where bundle writes the bundle of -folder")
+	flag.StringVar(&bundlePath, "bundle", "", "Bundle directory installed by install-bundle")
+	flag.StringVar(&requireApprovalLabel, "require-approval-label", "", "Refuse to push unless the diff summary was approved with this label (optional)")
+	flag.StringVar(&approvalCommand, "approval-command", "", "Command checking the approval of the diff summary, approving by exiting with status 0")
+	flag.StringVar(&approvalURL, "approval-url", "", "URL checking the approval of the diff summary, approving by answering 200")
+	flag.BoolVar(&prune, "prune", false, "Delete the remote resources of -prune-kinds that have no local file after a push")
+	flag.StringVar(&pruneKinds, "prune-kinds", "dashboards", "Comma-separated kinds -prune deletes: dashboards, datasources or folders")
+	flag.StringVar(&pruneScope, "prune-scope", "", "Remote dashboards -prune may delete, as key=value terms joined with AND (optional)")
+	flag.StringVar(&datasourceOverridesFile, "datasource-overrides", "", "YAML file of datasource fields overridden on push, by environment (optional)")
+	flag.StringVar(&environment, "environment", "", "Environment of -datasource-overrides and -uid-aliases")
+	flag.StringVar(&uidAliasesFile, "uid-aliases", "", "YAML file of the dashboard and folder UIDs of logical names, by environment (optional)")
+	flag.Var(&alertLabels, "alert-labels", "Labels of a sample alert routed by the routing report, as key=value pairs separated by commas (repeatable)")
+	flag.IntVar(&staleDays, "stale-days", 90, "Number of days without views after which the stale report lists a dashboard")
+	flag.BoolVar(&tagStale, "tag-stale", false, "Tag the dashboards listed by the stale report as stale")
+	flag.StringVar(&serviceAccountName, "service-account-name", "grafana-sync", "Name of the service account created by bootstrap-service-account")
+	flag.StringVar(&serviceAccountRole, "service-account-role", "Editor", "Role of the service account created by bootstrap-service-account: Viewer, Editor or Admin")
+	flag.StringVar(&serviceAccountTeam, "service-account-team", "", "Team the service account created by bootstrap-service-account joins (optional)")
+	flag.DurationVar(&tokenTTL, "token-ttl", 0, "Lifetime of the token created by bootstrap-service-account, 0 for no expiry")
+	flag.StringVar(&tokenFile, "token-file", "", "File the tokens created by bootstrap-service-account and push-service-accounts are written to instead of the output (optional)")
+	flag.StringVar(&fromFolder, "from-folder", "", "Folder whose dashboards copy copies")
+	flag.StringVar(&toFolder, "to-folder", "", "Folder copy copies dashboards into, created when missing")
+	flag.StringVar(&copySuffix, "suffix", " (copy)", "Suffix appended by copy to the titles of copied dashboards")
+	flag.StringVar(&sourceURL, "source-url", "", "Grafana instance copy copies from, instead of copying a folder of -url")
+	flag.StringVar(&sourceAPIKey, "source-apikey", "", "API key of -source-url")
+	flag.StringVar(&destURL, "dest-url", "", "Grafana instance copy copies -source-url to")
+	flag.StringVar(&destAPIKey, "dest-apikey", "", "API key of -dest-url")
+	flag.StringVar(&translationsFile, "translations", "translations.yaml", "File of the dashboard strings extracted by extract-strings and of their translations")
+	flag.StringVar(&language, "language", "", "Language of -translations applied to dashboards on push (optional)")
+	flag.IntVar(&orgID, "org-id", 0, "ID of the organization to act on, 0 for the default organization of the API key")
+	flag.BoolVar(&changedOnly, "changed-only", false, "Skip on push the dashboards, datasources, folders and notification channels that are the same on the instance")
+	flag.Var(concurrencyFlag{}, "concurrency", "Number of API calls a stage makes at once, as stage=n: search, fetch, dashboards, datasources, folders or notifications (repeatable)")
+	flag.StringVar(&annotationsFrom, "from", "", "Start of the annotations pulled and pushed: RFC 3339 time, date or now-<duration> such as now-30d (optional). Profile promote promotes from")
+	flag.StringVar(&annotationsTo, "to", "", "End of the annotations pulled and pushed: RFC 3339 time, date or now-<duration> (optional). Profile promote promotes to")
+	flag.BoolVar(&assumeYes, "yes", false, "Promote without asking for confirmation")
+	flag.BoolVar(&enterprise, "enterprise", false, "Also pull and push the datasource permissions of Grafana Enterprise")
+	flag.Var(&usesDatasourceTypes, "uses-datasource-type", "Pull and push only the dashboards querying a datasource of this type, such as loki (repeatable)")
+	flag.Var(&appPlugins, "app-plugin", "ID of an app plugin, such as grafana-k6-app, whose dashboards are pulled into plugins/<id> and skipped on push and prune (repeatable)")
+	flag.BoolVar(&dryRun, "dry-run", false, "Report what push would create, update or delete on the instance without changing it")
+	flag.StringVar(&pushgatewayURL, "pushgateway", "", "Prometheus Pushgateway the stats action pushes to instead of printing JSON (optional)")
+	flag.StringVar(&pushgatewayJob, "pushgateway-job", "grafana_sync", "Job the statistics are pushed under on -pushgateway")
+	flag.StringVar(&requiredKinds, "required", "dashboards,datasources,folders,notifications", "Comma-separated kinds pull fails on when their API fails: dashboards, library-panels, datasources, folders or notifications. Other kinds are skipped with a warning")
+	flag.StringVar(&apiKeyCommand, "apikey-command", "", "Command printing the token of -url on stdout, run again when the token is rejected, instead of -apikey (optional)")
+	flag.StringVar(&apiKeyFile, "apikey-file", "", "File holding the token of -url, read again when it changes or the token is rejected, instead of -apikey (optional)")
+	flag.DurationVar(&apiKeyRefresh, "apikey-refresh", 0, "How long a token of -apikey-command is used before the command is run again, 0 to only renew rejected tokens")
+	flag.Var(&dashboardTags, "tag", "Pull and push only the dashboards with this tag (repeatable, dashboards must have every tag)")
+	flag.DurationVar(&freezeDuration, "duration", 0, "How long freeze keeps the folder frozen, after which unfreeze restores it, 0 until unfreeze")
+	flag.Var(&dashboardUIDs, "uid", "Pull and push only the dashboard with this UID (repeatable)")
+	flag.StringVar(&uidFile, "uid-file", "", "File listing the UIDs of the dashboards to pull and push, one per line, like -uid (optional)")
+	flag.Var(&matchPatterns, "match", "Pull and push only the dashboards and datasources whose title or name matches this glob, or /regexp/ (repeatable)")
+	flag.Var(&excludePatterns, "exclude", "Skip the dashboards and datasources whose title or name matches this glob, or /regexp/ (repeatable)")
+	flag.IntVar(&maxBodySize, "max-body-size", 0, "Largest request body the instance accepts, in bytes, for larger dashboards to be minified or reported before they are sent (0 to rely on HTTP 413)")
+	flag.BoolVar(&strictFolders, "strict-folders", false, "Fail push when the folder of dashboards or library panels is missing instead of creating it")
+	flag.BoolVar(&watchConfig, "watch-config", false, "Reload the configuration file in daemon mode when it changes")
+	flag.Var(&panelTitles, "panel-title", "Title of the panels to extract into library panels (repeatable)")
+	flag.Var(&selectedPanels, "panel", "Experimental: push only the panel with this ID or title, merged into the remote dashboard (repeatable)")
+	flag.StringVar(&actingUser, "acting-user", "", "User sent in the acting user header so Grafana records who triggered the sync (optional)")
+	flag.StringVar(&actingUserHeader, "acting-user-header", "X-Grafana-User", "Header carrying the acting user, matching the auth proxy header_name of the instance")
+	flag.Var(&transforms, "transform", "Transform command applied to each resource before push, as kind=command (repeatable)")
+}
+
+// offlineActions only work on local files and run without Grafana credentials.
+var offlineActions = map[string]bool{
+	"validate":              true,
+	"diff-dirs":             true,
+	"build":                 true,
+	"report":                true,
+	"split":                 true,
+	"mock-server":           true,
+	"rebalance-rule-groups": true,
+	"extract-strings":       true,
+	"stats":                 true,
+}
+
+// profileActions connect to the instances of the config file profiles
+// instead of -url and -apikey.
+var profileActions = map[string]bool{
+	"push-routes":  true,
+	"pull-sources": true,
+	"promote":      true,
 }
 
 func main() {
-	flag.Parse()
+	parseCommandLine()
 
-	if apiKey == "" || baseURL == "" {
-		fmt.Println("Error: apikey and url are required")
+	if guardrailMode != "warn" && guardrailMode != "block" {
+		fmt.Println("Error: guardrails must be 'warn' or 'block'")
 		os.Exit(1)
 	}
 
-	client, _ = sdk.NewClient(baseURL, apiKey, sdk.DefaultHTTPClient)
-	if client == nil {
-		log.Fatalf("Error: failed to initialize Grafana client")
+	loadConfig()
+	if err := applyConfigSettings(); err != nil {
+		log.Fatalf("Error %v", err)
+	}
+
+	if datasourceOverridesFile != "" {
+		if err := loadDatasourceOverrides(); err != nil {
+			log.Fatalf("Error reading datasource overrides: %v", err)
+		}
+	}
+
+	if uidAliasesFile != "" {
+		if err := loadUIDAliases(); err != nil {
+			log.Fatalf("Error reading UID aliases: %v", err)
+		}
+	}
+
+	if uidFile != "" {
+		if err := loadUIDFile(); err != nil {
+			log.Fatalf("Error reading UID file: %v", err)
+		}
+	}
+
+	if err := parseTitleFilters(); err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+
+	if language != "" {
+		if err := loadTranslations(); err != nil {
+			log.Fatalf("Error reading translations: %v", err)
+		}
+	}
+
+	if prune {
+		if err := parsePruneScope(); err != nil {
+			fmt.Println("Error:", err)
+			os.Exit(1)
+		}
+	}
+
+	ctx, cancel := runContext()
+	defer cancel()
+
+	offline := offlineActions[action] && !(action == "report" && onlineReports[reportName])
+	if !offline && !profileActions[action] && !copyingInstances() {
+		if err := setupCredentials(); err != nil {
+			log.Fatalf("Error: %v", err)
+		}
+		if (apiKey == "" && apiKeyProvider == nil) || baseURL == "" {
+			fmt.Println("Error: apikey and url are required")
+			os.Exit(1)
+		}
+
+		connect(baseURL, apiKey)
+		checkRequiredRole(ctx)
+	}
+
+	if requireApprovalLabel != "" {
+		requireApproval(ctx)
 	}
 
 	switch action {
 	case "pull-dashboards":
-		pullDashboards()
+		pullDashboards(ctx)
 	case "pull-datasources":
-		pullDatasources()
+		pullDatasources(ctx)
 	case "pull-folders":
-		pullFolders()
+		pullFolders(ctx)
 	case "pull-notifications":
-		pullNotificationChannels()
+		pullNotificationChannels(ctx)
 	case "push-dashboards":
-		pushDashboards()
+		pushDashboards(ctx)
 	case "push-datasources":
-		pushDatasources()
+		pushDatasources(ctx)
 	case "push-folders":
-		pushFolders()
+		pushFolders(ctx)
 	case "push-notifications":
-		pushNotificationChannels()
+		pushNotificationChannels(ctx)
 	case "pull":
-		pullData()
+		pullData(ctx)
 	case "push":
-		pushData()
+		pushData(ctx)
+	case "validate":
+		validateData()
+	case "extract-library-panels":
+		extractLibraryPanels(ctx)
+	case "build":
+		buildDashboards()
+	case "check":
+		checkDashboards(ctx)
+	case "diff":
+		diffLocal(ctx)
+	case "diff-dirs":
+		diffDirectories()
+	case "daemon":
+		runDaemon(ctx)
+	case "push-routes":
+		pushRoutes(ctx)
+	case "api":
+		apiPassthrough(ctx, commandArgs)
+	case "report":
+		runReport(ctx)
+	case "stats":
+		printStats()
+	case "verify":
+		verifyDashboards(ctx)
+	case "split":
+		splitData()
+	case "nightly":
+		runNightly(ctx)
+	case "pull-sources":
+		pullSources(ctx)
+	case "push-merged":
+		pushMerged(ctx)
+	case "bundle":
+		bundleFolder(ctx)
+	case "install-bundle":
+		installBundle(ctx)
+	case "mock-server":
+		runMockServer(ctx)
+	case "pull-alert-rules":
+		pullAlertRules(ctx)
+	case "push-alert-rules":
+		pushAlertRules(ctx)
+	case "pull-contact-points":
+		pullContactPoints(ctx)
+	case "push-contact-points":
+		pushContactPoints(ctx)
+	case "pull-library-panels":
+		pullLibraryPanels(ctx)
+	case "push-library-panels":
+		pushLibraryPanels(ctx)
+	case "pull-playlists":
+		pullPlaylists(ctx)
+	case "push-playlists":
+		pushPlaylists(ctx)
+	case "pull-teams":
+		pullTeams(ctx)
+	case "push-teams":
+		pushTeams(ctx)
+	case "pull-all-orgs":
+		pullAllOrgs(ctx)
+	case "pull-org-users":
+		pullOrgUsers(ctx)
+	case "push-org-users":
+		pushOrgUsers(ctx)
+	case "pull-snapshots":
+		pullSnapshots(ctx)
+	case "push-snapshots":
+		pushSnapshots(ctx)
+	case "pull-annotations":
+		pullAnnotations(ctx)
+	case "push-annotations":
+		pushAnnotations(ctx)
+	case "pull-service-accounts":
+		pullServiceAccounts(ctx)
+	case "push-service-accounts":
+		pushServiceAccounts(ctx)
+	case "pull-mute-timings":
+		pullMuteTimings(ctx)
+	case "push-mute-timings":
+		pushMuteTimings(ctx)
+	case "rebalance-rule-groups":
+		rebalanceRuleGroups()
+	case "extract-strings":
+		extractStrings()
+	case "promote":
+		promote(ctx)
+	case "freeze":
+		freezeFolder(ctx)
+	case "unfreeze":
+		unfreezeFolders(ctx)
+	case "copy":
+		if copyingInstances() {
+			copyInstance(ctx)
+		} else {
+			copyFolder(ctx)
+		}
+	case "bootstrap-service-account":
+		bootstrapServiceAccount(ctx)
 	default:
-		fmt.Println("Error: action must be one of 'pull', 'push', 'pull-dashboards', 'pull-datasources', 'pull-folders', 'pull-notifications', 'push-dashboards', 'push-datasources', 'push-folders', 'push-notifications'")
+		fmt.Println("Error: action must be one of 'pull', 'push', 'pull-dashboards', 'pull-datasources', 'pull-folders', 'pull-notifications', 'pull-library-panels', 'push-dashboards', 'push-datasources', 'push-folders', 'push-notifications', 'push-library-panels', 'validate', 'extract-library-panels', 'build', 'check', 'diff', 'diff-dirs', 'daemon', 'push-routes', 'api', 'report', 'stats', 'verify', 'split', 'nightly', 'pull-sources', 'push-merged', 'bundle', 'install-bundle', 'mock-server', 'rebalance-rule-groups', 'pull-alert-rules', 'push-alert-rules', 'pull-contact-points', 'push-contact-points', 'pull-mute-timings', 'push-mute-timings', 'pull-playlists', 'push-playlists', 'pull-teams', 'push-teams', 'pull-org-users', 'push-org-users', 'pull-service-accounts', 'push-service-accounts', 'pull-annotations', 'push-annotations', 'pull-snapshots', 'push-snapshots', 'pull-all-orgs', 'extract-strings', 'copy', 'promote', 'freeze', 'unfreeze', 'bootstrap-service-account'")
+		os.Exit(1)
+	}
+
+	summary.print()
+
+	if err := ctx.Err(); err != nil {
+		fmt.Printf("Stopped: %s\n", describeStop(err))
+		cancel()
+		os.Exit(1)
+	}
+	if summary.failed() {
+		cancel()
 		os.Exit(1)
 	}
 }
 
+// connect points the client at a Grafana instance.
+func connect(url, key string) {
+	baseURL, apiKey = url, key
+	client = newGrafanaClient(baseURL, apiKey)
+	resetRole()
+	lookups.reset()
+}
+
+// generalFolder is the title of the root folder. It is not returned by the
+// folders API and has ID 0 and no UID.
+const generalFolder = "General"
+
 // Helper to get folder ID by name
-func getFolderID(folderName string) int {
-	ctx := context.Background()
-	folders, err := client.GetAllFolders(ctx)
+func getFolderID(ctx context.Context, folderName string) int {
+	id, err := lookups.folderID(ctx, folderName)
 	if err != nil {
-		log.Fatalf("Error fetching folders: %v", err)
-	}
-
-	for _, f := range folders {
-		if f.Title == folderName {
-			return f.ID
-		}
+		log.Fatalf("Error: %s", describeError(err))
 	}
-
-	log.Fatalf("Folder not found: %s", folderName)
-	return 0
+	return id
 }
 
 // Pull all data from Grafana
-func pullData() {
-	pullDashboards()
-	pullDatasources()
-	pullFolders()
-	pullNotificationChannels()
+func pullData(ctx context.Context) {
+	if err := checkRequiredKinds(); err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+	for _, pull := range []func(context.Context){pullDashboards, pullLibraryPanels, pullDatasources, pullFolders, pullNotificationChannels} {
+		if stopped(ctx) {
+			return
+		}
+		pull(ctx)
+	}
 }
 
 // Push all data to Grafana
-func pushData() {
-	pushDashboards()
-	pushDatasources()
-	pushFolders()
-	pushNotificationChannels()
+func pushData(ctx context.Context) {
+	requireSecrets()
+	for _, push := range []func(context.Context){pushLibraryPanels, pushDashboards, pushDatasources, pushFolders, pushNotificationChannels} {
+		if stopped(ctx) {
+			return
+		}
+		push(ctx)
+	}
 }
 
 // Pull Functions
 
-func pullDashboards() {
+// pulledDashboard is a dashboard fetched by pull, before it is saved.
+type pulledDashboard struct {
+	manifestEntry
+	instanceUID string
+	data        []byte
+}
+
+func pullDashboards(ctx context.Context) {
 	fmt.Println("Pulling dashboards...")
-	ctx := context.Background()
 
-	searchParams := []sdk.SearchParam{sdk.SearchType(sdk.SearchTypeDashboard)}
+	searchParams := []searchParam{searchType(searchTypeDashboard)}
 	if folder != "" {
-		folderID := getFolderID(folder)
-		searchParams = append(searchParams, sdk.SearchFolderID(int(folderID)))
+		folderID := getFolderID(ctx, folder)
+		searchParams = append(searchParams, searchFolderID(folderID))
+	}
+	for _, tag := range dashboardTags {
+		searchParams = append(searchParams, searchTag(tag))
+	}
+	for _, uid := range dashboardUIDs {
+		searchParams = append(searchParams, searchDashboardUID(environmentUID(uid)))
 	}
 
 	// Search for dashboards using the client
 	dashboards, err := client.Search(ctx, searchParams...)
 	if err != nil {
-		log.Fatalf("Error searching dashboards: %v", err)
+		pullFailed(ctx, "dashboards", "searching dashboards", err)
+		return
 	}
 
 	// Create local directory for dashboards
-	dashboardDir := filepath.Join(directory, "dashboards")
-	if err := os.MkdirAll(dashboardDir, os.ModePerm); err != nil {
-		log.Fatalf("Error creating directory: %v", err)
+	if !groupByTeam {
+		if err := os.MkdirAll(filepath.Join(directory, "dashboards"), os.ModePerm); err != nil {
+			log.Fatalf("Error creating directory: %v", err)
+		}
+	}
+
+	// Reading the permissions of every dashboard needs an admin
+	withPermissions := roleAllows(ctx, "dashboard permissions", "Admin")
+
+	pluginOwners, err := pluginDashboards(ctx)
+	if err != nil {
+		pullFailed(ctx, "dashboards", "listing app plugin dashboards", err)
+		return
+	}
+
+	// Dashboards of nested folders are laid out under their parents
+	var paths map[string]string
+	if folders, err := client.GetAllFolders(ctx); err != nil {
+		log.Printf("Warning: error fetching folders: %s. Nested folders are laid out at the top level", describeError(err))
+	} else {
+		paths = folderPaths(folders)
 	}
 
-	// Iterate through dashboards and save them locally
-	for _, db := range dashboards {
+	// Fetch dashboards concurrently, keeping them in search order
+	pulled := make([]*pulledDashboard, len(dashboards))
+	forEach(ctx, "fetch", len(dashboards), func(i int) {
+		db := dashboards[i]
 		if db.Type != "dash-db" {
-			continue // Skip non-dashboard entries
+			return // Skip non-dashboard entries
+		}
+		if !included("dashboards", db.Title) || !uidSelected(db.UID) {
+			return
 		}
 
-		// Fetch the full dashboard using UID
-		board, meta, err := client.GetDashboardByUID(ctx, db.UID)
+		// Fetch the full dashboard using UID as raw JSON, keeping every field
+		raw, meta, err := client.GetRawDashboardByUID(ctx, db.UID)
 		if err != nil {
-			log.Printf("Error fetching dashboard UID %s: %v", db.UID, err)
-			continue
+			log.Printf("Error fetching dashboard UID %s: %s", db.UID, describeError(err))
+			return
+		}
+
+		var board map[string]interface{}
+		if err := json.Unmarshal(raw, &board); err != nil {
+			log.Printf("Error unmarshalling dashboard UID %s: %v", db.UID, err)
+			return
+		}
+
+		// Pulled files must not carry the watermark of the profile
+		removeWatermark(board)
+		db.Title, _ = board["title"].(string)
+
+		// Files use the logical UIDs of -uid-aliases
+		localUID, folderUID := logicalUID(db.UID), logicalUID(db.FolderUID)
+		board["uid"] = localUID
+		if len(uidAliases) > 0 {
+			aliasDashboardLinks(board, logicalUID)
 		}
 
 		// Ensure the dashboard has a title
-		if board.Title == "" {
+		if title, _ := board["title"].(string); title == "" {
 			log.Printf("Error: dashboard UID %s has no title", db.UID)
-			continue
+			return
+		}
+
+		// Some Grafana versions return no slug, derive it from the title as
+		// Grafana does
+		slug := unwatermarkedSlug(meta.Slug)
+		if meta.Slug == "" {
+			slug = slugify.Slugify(db.Title)
+		}
+
+		if uses, err := usesDatasourceType(ctx, raw); err != nil {
+			log.Printf("Error resolving the datasources of dashboard UID %s: %s", db.UID, describeError(err))
+			return
+		} else if !uses {
+			return
 		}
 
 		// removing uniq identifier
-		board.ID = 0
-		fmt.Println(board.ID)
+		board["id"] = 0
+		board = filterFields("dashboards", board).(map[string]interface{})
 
-		// Save the dashboard as a JSON file
-		filePath := filepath.Join(dashboardDir, meta.Slug+".json")
+		// Save the dashboard as a JSON file at its layout path, under its
+		// team with -group-by-team
+		var team string
+		if groupByTeam {
+			team, err = folderOwner(ctx, db.FolderUID)
+			if err != nil {
+				log.Printf("Error reading permissions of folder %s: %s", db.FolderTitle, describeError(err))
+				return
+			}
+		}
+		folderTitle := db.FolderTitle
+		if db.FolderUID == "" {
+			folderTitle = generalFolder
+		}
+		folderPath, ok := paths[db.FolderUID]
+		if !ok {
+			folderPath = strings.ReplaceAll(folderTitle, "/", "-")
+		}
+		layoutFile, err := layoutPath(layoutFields{
+			UID:         localUID,
+			Title:       db.Title,
+			Slug:        slug,
+			FolderUID:   folderUID,
+			FolderTitle: folderTitle,
+			FolderPath:  folderPath,
+			Team:        team,
+		})
+		if err != nil {
+			log.Printf("Error laying out dashboard UID %s: %v", db.UID, err)
+			return
+		}
+		relPath := filepath.Join("dashboards", layoutFile)
+		if plugin, ok := pluginOwners[db.UID]; ok {
+			relPath = filepath.Join(pluginDirectory(plugin), relPath)
+		} else if groupByTeam {
+			relPath = filepath.Join(teamDirectory(team), relPath)
+		}
 		data, err := json.MarshalIndent(board, "", "  ")
 		if err != nil {
 			log.Printf("Error marshaling dashboard UID %s: %v", db.UID, err)
-			continue
+			return
+		}
+		pulled[i] = &pulledDashboard{
+			manifestEntry: manifestEntry{
+				Path:        relPath,
+				UID:         localUID,
+				Title:       db.Title,
+				FolderUID:   folderUID,
+				FolderTitle: folderTitle,
+				Team:        team,
+			},
+			instanceUID: db.UID,
+			data:        data,
 		}
+	})
 
-		if err := os.WriteFile(filePath, data, 0644); err != nil {
-			log.Printf("Error saving dashboard UID %s: %v", db.UID, err)
-			continue
+	// Dashboards whose titles give the same slug, say in different folders,
+	// would overwrite each other: number all but the first in search order
+	taken := make(map[string]bool)
+	for _, d := range pulled {
+		if d != nil {
+			d.Path = slugify.Dedupe(strings.TrimSuffix(d.Path, ".json"), taken) + ".json"
+		}
+	}
+
+	// Save the dashboards locally, keeping the manifest in search order
+	entries := make([]*manifestEntry, len(dashboards))
+	forEach(ctx, "fetch", len(pulled), func(i int) {
+		d := pulled[i]
+		if d == nil {
+			return
+		}
+		filePath := filepath.Join(directory, d.Path)
+		if err := os.MkdirAll(filepath.Dir(filePath), os.ModePerm); err != nil {
+			log.Fatalf("Error creating directory: %v", err)
+		}
+		if err := os.WriteFile(filePath, d.data, 0644); err != nil {
+			log.Printf("Error saving dashboard UID %s: %v", d.instanceUID, err)
+			return
 		}
 
 		fmt.Printf("Saved dashboard: %s\n", filePath)
+
+		if withPermissions {
+			if err := pullDashboardPermissions(ctx, d.instanceUID, filePath); err != nil {
+				log.Printf("Error saving permissions of dashboard UID %s: %s", d.instanceUID, describeError(err))
+			}
+		}
+
+		hash, err := dashboardHash(d.data)
+		if err != nil {
+			log.Printf("Error hashing dashboard UID %s: %v", d.instanceUID, err)
+			return
+		}
+		entry := d.manifestEntry
+		entry.Hash = hash
+		entries[i] = &entry
+	})
+
+	var m manifest
+	for _, entry := range entries {
+		if entry != nil {
+			m.Dashboards = append(m.Dashboards, *entry)
+		}
+	}
+
+	if err := writeManifest(directory, m); err != nil {
+		log.Printf("Error saving manifest: %v", err)
 	}
 }
 
-func pullDatasources() {
+func pullDatasources(ctx context.Context) {
 	fmt.Println("Pulling datasources...")
-	url := fmt.Sprintf("%s/api/datasources", baseURL)
-	data := sendRequest("GET", url, nil)
-
-	datasourceDir := filepath.Join(directory, "datasources")
-	os.MkdirAll(datasourceDir, os.ModePerm)
-	err := saveToFile(filepath.Join(datasourceDir, "datasources.json"), data)
-	if err != nil {
+	if !roleAllows(ctx, "datasources", "Admin") {
+		return
+	}
+	var datasources []datasource
+	if err := getJSON(ctx, "/api/datasources", &datasources); err != nil {
+		pullFailed(ctx, "datasources", "fetching datasources", err)
+		return
+	}
+	pulledDatasources := []datasource{}
+	for _, ds := range datasources {
+		if included("datasources", ds.Name) {
+			pulledDatasources = append(pulledDatasources, ds)
+		}
+	}
+	if err := writePulledResources(directory, "datasources", pulledDatasources); err != nil {
 		fmt.Println("Error saving datasources:", err)
 		return
 	}
 	fmt.Println("Saved datasources")
+	if enterprise {
+		pullDatasourcePermissions(ctx, pulledDatasources)
+	}
 }
 
-func pullFolders() {
+func pullFolders(ctx context.Context) {
 	fmt.Println("Pulling folders...")
-	url := fmt.Sprintf("%s/api/folders", baseURL)
-	data := sendRequest("GET", url, nil)
-
-	folderDir := filepath.Join(directory, "folders")
-	os.MkdirAll(folderDir, os.ModePerm)
-	err := saveToFile(filepath.Join(folderDir, "folders.json"), data)
+	folders, err := client.GetAllFolders(ctx)
 	if err != nil {
+		pullFailed(ctx, "folders", "fetching folders", err)
+		return
+	}
+
+	// removing uniq identifiers, folders are matched by UID
+	pulled := []folderInfo{}
+	for _, f := range folders {
+		if !included("folders", f.Title) {
+			continue
+		}
+		f.ID = 0
+		f.UID, f.ParentUID = logicalUID(f.UID), logicalUID(f.ParentUID)
+		pulled = append(pulled, f)
+	}
+	if err := writePulledResources(directory, "folders", pulled); err != nil {
 		fmt.Println("Error saving folders:", err)
 		return
 	}
 	fmt.Println("Saved folders")
+	pullFolderPermissions(ctx, pulled)
 }
 
-func pullNotificationChannels() {
+func pullNotificationChannels(ctx context.Context) {
 	fmt.Println("Pulling notification channels...")
-	url := fmt.Sprintf("%s/api/alert-notifications", baseURL)
-	data := sendRequest("GET", url, nil)
-
-	notificationDir := filepath.Join(directory, "notifications")
-	os.MkdirAll(notificationDir, os.ModePerm)
-	err := saveToFile(filepath.Join(notificationDir, "notifications.json"), data)
-	if err != nil {
+	// Secure settings aren't returned, only which ones are set
+	var notifications []struct {
+		notificationChannel
+		SecureFields map[string]bool `json:"secureFields"`
+	}
+	if err := getJSON(ctx, "/api/alert-notifications", &notifications); err != nil {
+		pullFailed(ctx, "notifications", "fetching notification channels", err)
+		return
+	}
+	pulledChannels := []notificationChannel{}
+	var secrets []requiredSecret
+	for _, nc := range notifications {
+		if included("notifications", nc.Name) {
+			nc.SecureSettings = secretPlaceholders("notifications", nc.Name, nc.SecureFields, &secrets)
+			pulledChannels = append(pulledChannels, nc.notificationChannel)
+		}
+	}
+	if err := writePulledResources(directory, "notifications", pulledChannels); err != nil {
 		fmt.Println("Error saving notification channels:", err)
 		return
 	}
+	if err := writeRequiredSecrets(directory, "notifications", secrets); err != nil {
+		fmt.Println("Error saving required secrets:", err)
+		return
+	}
+	if len(secrets) > 0 {
+		fmt.Printf("Notification channels need %d secret(s) on push, listed in %s\n", len(secrets), filepath.Join(directory, "notifications", requiredSecretsFile))
+	}
 	fmt.Println("Saved notification channels")
 }
 
 // Push Functions
 
-func pushDashboards() {
+func pushDashboards(ctx context.Context) {
 	fmt.Println("Pushing dashboards...")
-	ctx := context.Background()
 
 	// Read the local dashboards directory
-	dashboardDir := filepath.Join(directory, "dashboards")
-	files, err := os.ReadDir(dashboardDir)
+	files, err := dashboardSources()
 	if err != nil {
 		log.Fatalf("Error reading dashboard directory: %v", err)
 	}
 
-	// Get folder ID if a folder is specified
+	// Get folder ID if a folder is specified, dashboards go back to the
+	// folder they were pulled from otherwise
 	var folderID int
+	var folders *dashboardFolders
 	if folder != "" {
-		folderID = getFolderID(folder)
+		folderID = pushFolderID(ctx, folder)
 		fmt.Printf("Using folder ID: %d for dashboards\n", folderID)
+	} else {
+		folders = newDashboardFolders()
 	}
 
-	// Iterate through dashboard files
-	for _, file := range files {
-		if filepath.Ext(file.Name()) == ".json" {
-			filePath := filepath.Join(dashboardDir, file.Name())
-			data, err := os.ReadFile(filePath)
+	pluginOwners, err := pluginDashboards(ctx)
+	if err != nil {
+		log.Fatalf("Error listing app plugin dashboards: %s", describeError(err))
+	}
+
+	// Push dashboard files concurrently
+	forEach(ctx, "dashboards", len(files), func(i int) {
+		filePath := files[i]
+		name := filepath.Base(filePath)
+		data, err := loadDashboard(filePath)
+		if err != nil {
+			log.Printf("Error loading file %s: %v", name, err)
+			return
+		}
+		if !included("dashboards", dashboardTitle(data)) || !uidSelected(dashboardUID(data)) {
+			return
+		}
+		if tagged, err := hasDashboardTags(data); err != nil {
+			log.Printf("Error reading the tags of dashboard %s: %v", name, err)
+			summary.add("dashboards", outcomeFailed, name)
+			return
+		} else if !tagged {
+			return
+		}
+		if uses, err := usesDatasourceType(ctx, data); err != nil {
+			log.Printf("Error resolving the datasources of dashboard %s: %s", name, describeError(err))
+			summary.add("dashboards", outcomeFailed, name)
+			return
+		} else if !uses {
+			return
+		}
+
+		if violations := checkGuardrails(data); len(violations) > 0 {
+			for _, v := range violations {
+				fmt.Printf("Guardrail: %s: %s\n", name, v)
+			}
+			if guardrailsBlock() {
+				summary.add("dashboards", outcomeBlocked, name)
+				return
+			}
+		}
+
+		data, from, err := migrateDashboardSchema(data)
+		if err != nil {
+			log.Printf("Error migrating dashboard %s: %v", name, err)
+			summary.add("dashboards", outcomeFailed, name)
+			return
+		}
+		switch {
+		case from == 0:
+		case from < oldestMigratedSchema:
+			fmt.Printf("Warning: dashboard %s has schema version %d, too old to be migrated; open and save it in Grafana first\n", name, from)
+		case from < latestMigratedSchema():
+			fmt.Printf("Migrated dashboard %s from schema version %d to %d\n", name, from, latestMigratedSchema())
+		}
+
+		if convertDatasourceRefs {
+			data, err = convertDashboardDatasources(ctx, name, data)
 			if err != nil {
-				log.Printf("Error reading file %s: %v", file.Name(), err)
-				continue
+				log.Printf("Error converting datasource references of %s: %s", name, describeError(err))
+				summary.add("dashboards", outcomeFailed, name)
+				return
 			}
+		}
 
-			// Unmarshal the JSON into a Board struct
-			var dashboard sdk.Board
-			if err := json.Unmarshal(data, &dashboard); err != nil {
-				log.Printf("Error unmarshalling file %s: %v", file.Name(), err)
-				continue
+		if data, err = resolveLibraryPanelRefs(ctx, data); err != nil {
+			log.Printf("Error resolving library panels of %s: %s", name, describeError(err))
+			summary.add("dashboards", outcomeFailed, name)
+			return
+		}
+
+		if defaultDatasource != "" {
+			data, err = injectDefaultDatasource(ctx, data)
+			if err != nil {
+				log.Printf("Error setting the default datasource of %s: %s", name, describeError(err))
+				summary.add("dashboards", outcomeFailed, name)
+				return
 			}
+		}
 
-			params := sdk.SetDashboardParams{
-				FolderID:  folderID,
-				Overwrite: true,      // Enable overwriting existing dashboards
+		if readOnly {
+			if data, err = lockDashboard(data); err != nil {
+				log.Printf("Error locking dashboard %s: %v", name, err)
+				summary.add("dashboards", outcomeFailed, name)
+				return
 			}
+		}
 
-			// Push the dashboard to Grafana
-			fmt.Printf("Pushing dashboard %s - %s in %d\n", dashboard.Title, dashboard.UID, folderID)
-			_, err = client.SetDashboard(ctx, dashboard, params)
+		if len(selectedPanels) > 0 {
+			data, err = mergeSelectedPanels(ctx, data)
 			if err != nil {
-				log.Printf("Error pushing dashboard %s: %v", file.Name(), err)
-				continue
+				log.Printf("Error merging panels of %s: %s", name, describeError(err))
+				summary.add("dashboards", outcomeFailed, name)
+				return
 			}
+		}
+
+		// The dashboard is pushed as raw JSON so that every field, such
+		// as library panel references, is kept
+		var dashboard struct {
+			UID   string `json:"uid"`
+			Title string `json:"title"`
+		}
+		if err := json.Unmarshal(data, &dashboard); err != nil {
+			log.Printf("Error unmarshalling file %s: %v", name, err)
+			return
+		}
 
-			fmt.Printf("Uploaded dashboard: %s\n", file.Name())
+		params := setDashboardParams{
+			FolderID:  folderID,
+			Overwrite: true, // Enable overwriting existing dashboards
+			Message:   pushMessage,
+		}
+		folderTitle := folder
+		if folders != nil {
+			target, err := folders.target(ctx, filePath)
+			if err != nil {
+				log.Printf("Error with folder %s of dashboard %s: %s", target.Title, name, describeError(err))
+				summary.add("dashboards", outcomeFailed, name)
+				return
+			}
+			params.FolderUID, folderTitle = target.UID, target.Title
+		}
+
+		// Dashboards shipped by an app plugin are updated by the plugin
+		if plugin, ok := pluginOwners[dashboard.UID]; ok {
+			fmt.Printf("Skipping dashboard %s - %s: it is managed by app plugin %s\n", dashboard.Title, dashboard.UID, plugin)
+			summary.add("dashboards", outcomePluginManaged, fmt.Sprintf("%s (%s)", dashboard.Title, dashboard.UID))
+			return
+		}
+
+		// Provisioned dashboards cannot be saved through the API
+		provisioned, err := isProvisioned(ctx, dashboard.UID)
+		if err != nil {
+			log.Printf("Error checking dashboard %s: %s", name, describeError(err))
+			summary.add("dashboards", outcomeFailed, name)
+			return
 		}
+		if provisioned {
+			fmt.Printf("Skipping provisioned dashboard %s - %s: it is managed by Grafana provisioning and cannot be saved through the API\n", dashboard.Title, dashboard.UID)
+			summary.add("dashboards", outcomeProvisioned, fmt.Sprintf("%s (%s)", dashboard.Title, dashboard.UID))
+			return
+		}
+
+		unchanged, err := dashboardUnchanged(ctx, dashboard.UID, data, params)
+		if err != nil {
+			log.Printf("Error comparing dashboard %s: %s", name, describeError(err))
+			summary.add("dashboards", outcomeFailed, name)
+			return
+		}
+		if unchanged {
+			fmt.Printf("Unchanged dashboard: %s\n", name)
+			summary.add("dashboards", outcomeUnchanged, name)
+			return
+		}
+
+		if backupBeforePush {
+			if err := backupDashboard(ctx, dashboard.UID); err != nil {
+				log.Printf("Error backing up dashboard %s: %s", name, describeError(err))
+				summary.add("dashboards", outcomeFailed, name)
+				return
+			}
+		}
+
+		// Push the dashboard to Grafana
+		fmt.Printf("Pushing dashboard %s - %s in %s\n", dashboard.Title, dashboard.UID, folderTitle)
+		status, err := saveDashboard(ctx, name, rawBoardRequest{Dashboard: data, Parameters: params})
+		if tooLarge := (*tooLargeError)(nil); errors.As(err, &tooLarge) {
+			log.Printf("Error pushing dashboard %s: %v", name, err)
+			summary.add("dashboards", outcomeTooLarge, name)
+			return
+		}
+		if err != nil {
+			log.Printf("Error pushing dashboard %s: %s", name, describeError(err))
+			summary.add("dashboards", outcomeFailed, name)
+			return
+		}
+
+		printChange("Uploaded dashboard: %s\n", name)
+		summary.add("dashboards", outcomePushed, name)
+
+		uid := dashboard.UID
+		if status.UID != "" {
+			uid = status.UID
+		}
+
+		// Lock down mirrored dashboards, ignoring their sidecars
+		if readOnly {
+			if err := pushDashboardPermissions(ctx, uid, readOnlyPermissions); err != nil {
+				log.Printf("Error locking down permissions of dashboard %s: %s", name, describeError(err))
+				summary.add("permissions", outcomeFailed, name)
+			}
+			return
+		}
+
+		// Apply the permissions sidecar, if any
+		permissionsPath := permissionsFile(filePath)
+		if _, err := os.Stat(permissionsPath); err == nil {
+			items, err := loadPermissions(permissionsPath)
+			if err != nil {
+				log.Printf("Error loading permissions %s: %v", permissionsPath, err)
+				summary.add("permissions", outcomeFailed, name)
+				return
+			}
+			if err := pushDashboardPermissions(ctx, uid, items); err != nil {
+				log.Printf("Error pushing permissions for dashboard %s: %s", name, describeError(err))
+				summary.add("permissions", outcomeFailed, name)
+				return
+			}
+			fmt.Printf("Applied permissions: %s\n", permissionsPath)
+		}
+	})
+
+	if pruning("dashboards") {
+		pruneDashboards(ctx)
 	}
 }
 
-func pushDatasources() {
+func pushDatasources(ctx context.Context) {
 	fmt.Println("Pushing datasources...")
-	datasourceFile := filepath.Join(directory, "datasources", "datasources.json")
-	data, err := ioutil.ReadFile(datasourceFile)
-	if err != nil {
+	if !roleAllows(ctx, "datasources", "Admin") {
+		return
+	}
+	if backupBeforePush {
+		if err := backupList(ctx, "datasources", "datasources.json", "/api/datasources"); err != nil {
+			log.Fatalf("Error backing up datasources: %s", describeError(err))
+		}
+	}
+
+	var datasources []datasource
+	if err := readResources(directory, "datasources", &datasources); err != nil {
 		fmt.Println("Error reading datasources file:", err)
 		return
 	}
 
-	var datasources []map[string]interface{}
-	err = json.Unmarshal(data, &datasources)
+	overrides, err := environmentOverrides()
 	if err != nil {
-		fmt.Println("Error unmarshalling datasources:", err)
-		return
+		log.Fatalf("Error: %v", err)
+	}
+	warnUnusedOverrides(overrides, datasources)
+	defaultName, err := localDefaultDatasource(datasources)
+	if err != nil {
+		log.Fatalf("Error: %v", err)
 	}
 
-	for _, ds := range datasources {
-		dsJSON, _ := json.Marshal(ds)
-		url := fmt.Sprintf("%s/api/datasources", baseURL)
-		sendRequest("POST", url, dsJSON)
-		fmt.Printf("Uploaded datasource: %s\n", ds["name"])
+	remote, err := fetchRemoteState(ctx, "datasources")
+	if err != nil {
+		log.Fatalf("Error fetching datasources: %s", describeError(err))
+	}
+	forEach(ctx, "datasources", len(datasources), func(i int) {
+		ds := datasources[i]
+		if !included("datasources", ds.Name) {
+			return
+		}
+		if o, ok := overrides[ds.Name]; ok {
+			var err error
+			if ds, err = overrideDatasource(ds, o); err != nil {
+				fmt.Printf("Error overriding datasource %s: %v\n", ds.Name, err)
+				return
+			}
+			fmt.Printf("Applied %s overrides to datasource %s\n", environment, ds.Name)
+		}
+		var pushed datasource
+		dsJSON, err := pushPayload("datasources", ds, &pushed)
+		if err != nil {
+			fmt.Printf("Error preparing datasource %s: %v\n", ds.Name, err)
+			return
+		}
+		if changedOnly && remote.unchanged(pushed) {
+			fmt.Printf("Unchanged datasource: %s\n", pushed.Name)
+			summary.add("datasources", outcomeUnchanged, pushed.Name)
+			return
+		}
+		// Grafana refuses to create a datasource whose name or UID is taken,
+		// so an existing datasource is updated by its remote UID
+		method, path := "POST", "/api/datasources"
+		current, exists := remote.datasource(pushed)
+		if exists {
+			method, path = "PUT", "/api/datasources/uid/"+current.UID
+			if pushed.UID == "" {
+				pushed.UID = current.UID
+				dsJSON, _ = json.Marshal(pushed)
+			}
+		}
+		if _, err := apiRequest(ctx, method, path, dsJSON); err != nil {
+			log.Printf("Error pushing datasource %s: %s", pushed.Name, describeError(err))
+			summary.add("datasources", outcomeFailed, pushed.Name)
+			return
+		}
+		if exists {
+			printChange("Updated datasource: %s\n", pushed.Name)
+		} else {
+			printChange("Uploaded datasource: %s\n", pushed.Name)
+		}
+		summary.add("datasources", outcomePushed, pushed.Name)
+	})
+	if defaultName != "" && !stopped(ctx) {
+		if err := applyDefaultDatasource(ctx, defaultName); err != nil {
+			log.Printf("Error setting the default datasource %s: %s", defaultName, describeError(err))
+			summary.add("datasources", outcomeFailed, defaultName)
+		}
+	}
+	if enterprise {
+		pushDatasourcePermissions(ctx, datasources)
+	}
+	if pruning("datasources") {
+		pruneDatasources(ctx, datasources)
 	}
 }
 
-func pushFolders() {
+func pushFolders(ctx context.Context) {
 	fmt.Println("Pushing folders...")
-	folderFile := filepath.Join(directory, "folders", "folders.json")
-	data, err := ioutil.ReadFile(folderFile)
-	if err != nil {
+	if backupBeforePush {
+		if err := backupList(ctx, "folders", "folders.json", "/api/folders"); err != nil {
+			log.Fatalf("Error backing up folders: %s", describeError(err))
+		}
+	}
+
+	var folders []folderInfo
+	if err := readResources(directory, "folders", &folders); err != nil {
 		fmt.Println("Error reading folders file:", err)
 		return
 	}
 
-	var folders []map[string]interface{}
-	err = json.Unmarshal(data, &folders)
+	remote, err := loadRemoteState(ctx, "folders")
 	if err != nil {
-		fmt.Println("Error unmarshalling folders:", err)
-		return
+		log.Fatalf("Error fetching folders: %s", describeError(err))
 	}
-
-	for _, folder := range folders {
-		folderJSON, _ := json.Marshal(folder)
-		url := fmt.Sprintf("%s/api/folders", baseURL)
-		sendRequest("POST", url, folderJSON)
-		fmt.Printf("Uploaded folder: %s\n", folder["title"])
+	// Nested folders are created after their parent, one level at a time
+	for _, level := range folderLevels(folders) {
+		pushFolderLevel(ctx, folders, level, remote)
+	}
+	pushFolderPermissions(ctx, folders)
+	if pruning("folders") {
+		pruneFolders(ctx, folders)
 	}
 }
 
-func pushNotificationChannels() {
+// pushFolderLevel pushes the folders at the given indexes concurrently.
+func pushFolderLevel(ctx context.Context, folders []folderInfo, level []int, remote remoteState) {
+	forEach(ctx, "folders", len(level), func(i int) {
+		f := folders[level[i]]
+		if !included("folders", f.Title) {
+			return
+		}
+		f.UID, f.ParentUID = environmentUID(f.UID), environmentUID(f.ParentUID)
+		var pushed folderInfo
+		folderJSON, err := pushPayload("folders", f, &pushed)
+		if err != nil {
+			fmt.Printf("Error preparing folder %s: %v\n", f.Title, err)
+			return
+		}
+		if remote.unchanged(pushed) {
+			fmt.Printf("Unchanged folder: %s\n", pushed.Title)
+			summary.add("folders", outcomeUnchanged, pushed.Title)
+			return
+		}
+		if err := saveFolder(ctx, pushed, folderJSON); err != nil {
+			log.Printf("Error pushing folder %s: %s", pushed.Title, describeError(err))
+			summary.add("folders", outcomeFailed, pushed.Title)
+			return
+		}
+		printChange("Uploaded folder: %s\n", pushed.Title)
+		summary.add("folders", outcomePushed, pushed.Title)
+	})
+}
+
+func pushNotificationChannels(ctx context.Context) {
 	fmt.Println("Pushing notification channels...")
-	notificationFile := filepath.Join(directory, "notifications", "notifications.json")
-	data, err := ioutil.ReadFile(notificationFile)
-	if err != nil {
+	if backupBeforePush {
+		if err := backupList(ctx, "notifications", "notifications.json", "/api/alert-notifications"); err != nil {
+			log.Fatalf("Error backing up notification channels: %s", describeError(err))
+		}
+	}
+
+	var notifications []notificationChannel
+	if err := readResources(directory, "notifications", &notifications); err != nil {
 		fmt.Println("Error reading notifications file:", err)
 		return
 	}
+	resolveChannelSecrets(notifications)
 
-	var notifications []map[string]interface{}
-	err = json.Unmarshal(data, &notifications)
+	remote, err := loadRemoteState(ctx, "notifications")
 	if err != nil {
-		fmt.Println("Error unmarshalling notifications:", err)
-		return
+		log.Fatalf("Error fetching notification channels: %s", describeError(err))
 	}
+	forEach(ctx, "notifications", len(notifications), func(i int) {
+		nc := notifications[i]
+		if !included("notifications", nc.Name) {
+			return
+		}
+		var channel notificationChannel
+		ncJSON, err := pushPayload("notifications", nc, &channel)
+		if err != nil {
+			fmt.Printf("Error preparing notification channel %s: %v\n", nc.Name, err)
+			return
+		}
+		if remote.unchanged(channel) {
+			fmt.Printf("Unchanged notification channel: %s\n", channel.Name)
+			summary.add("notifications", outcomeUnchanged, channel.Name)
+			return
+		}
 
-	for _, nc := range notifications {
-		ncJSON, _ := json.Marshal(nc)
-		url := fmt.Sprintf("%s/api/alert-notifications", baseURL)
-		sendRequest("POST", url, ncJSON)
-		fmt.Printf("Uploaded notification channel: %s\n", nc["name"])
+		exists := false
+		if channel.UID != "" {
+			if exists, err = notificationChannelExists(ctx, channel.UID); err != nil {
+				log.Printf("Error looking up notification channel %s: %s", channel.Name, describeError(err))
+				summary.add("notifications", outcomeFailed, channel.Name)
+				return
+			}
+		}
+		if exists {
+			_, err = apiRequest(ctx, "PUT", "/api/alert-notifications/uid/"+channel.UID, ncJSON)
+		} else {
+			_, err = apiRequest(ctx, "POST", "/api/alert-notifications", ncJSON)
+		}
+		if err != nil {
+			log.Printf("Error pushing notification channel %s: %s", channel.Name, describeError(err))
+			summary.add("notifications", outcomeFailed, channel.Name)
+			return
+		}
+		if exists {
+			printChange("Updated notification channel: %s\n", channel.Name)
+		} else {
+			printChange("Uploaded notification channel: %s\n", channel.Name)
+		}
+		summary.add("notifications", outcomePushed, channel.Name)
+	})
+}
+
+// notificationChannelExists reports whether a legacy notification channel
+// with the given UID exists on the instance.
+func notificationChannelExists(ctx context.Context, uid string) (bool, error) {
+	_, err := apiRequest(ctx, "GET", "/api/alert-notifications/uid/"+uid, nil)
+	if apiErr, ok := asAPIError(err); ok && apiErr.StatusCode == http.StatusNotFound {
+		return false, nil
 	}
+	return err == nil, err
 }
 
 // Helper Functions
 
-func downloadDashboard(uid string) []byte {
-	url := fmt.Sprintf("%s/api/dashboards/uid/%s", baseURL, uid)
-	return sendRequest("GET", url, nil)
-}
+// isProvisioned reports whether Grafana manages the dashboard with the given
+// UID from a provisioning file. Dashboards that do not exist yet are not.
+func isProvisioned(ctx context.Context, uid string) (bool, error) {
+	if uid == "" {
+		return false, nil
+	}
 
-func sendRequest(method, url string, body []byte) []byte {
-	req, err := http.NewRequest(method, url, bytes.NewBuffer(body))
+	url := fmt.Sprintf("%s/api/dashboards/uid/%s", baseURL, uid)
+	data, status, err := doRequest(ctx, "GET", url, nil)
 	if err != nil {
-		fmt.Println("Error creating request:", err)
-		os.Exit(1)
+		return false, err
+	}
+	if status == http.StatusNotFound {
+		return false, nil
+	}
+	if status >= 400 {
+		return false, newAPIError(status, data)
+	}
+
+	var result struct {
+		Meta struct {
+			Provisioned bool `json:"provisioned"`
+		} `json:"meta"`
 	}
-	req.Header.Set("Authorization", "Bearer "+apiKey)
-	if method == "POST" {
-		req.Header.Set("Content-Type", "application/json")
+	if err := json.Unmarshal(data, &result); err != nil {
+		return false, err
 	}
+	return result.Meta.Provisioned, nil
+}
+
+func downloadDashboard(ctx context.Context, uid string) []byte {
+	url := fmt.Sprintf("%s/api/dashboards/uid/%s", baseURL, uid)
+	return sendRequest(ctx, "GET", url, nil)
+}
 
-	client := &http.Client{}
-	resp, err := client.Do(req)
+func sendRequest(ctx context.Context, method, url string, body []byte) []byte {
+	data, status, err := doRequest(ctx, method, url, body)
+	if err != nil && stopped(ctx) {
+		fmt.Printf("Stopped: %s\n", describeStop(ctx.Err()))
+		os.Exit(1)
+	}
 	if err != nil {
 		fmt.Println("Error making request:", err)
 		os.Exit(1)
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode >= 400 {
-		fmt.Printf("Error: %s returned %d\n", url, resp.StatusCode)
+	if status >= 400 {
+		fmt.Printf("Error: %s %s: %s\n", method, url, describeError(newAPIError(status, data)))
 		os.Exit(1)
 	}
 
-	data, _ := ioutil.ReadAll(resp.Body)
 	return data
 }
 
+// doRequest performs an authenticated API call and returns the response body
+// and status code, leaving error statuses to the caller.
+func doRequest(ctx context.Context, method, url string, body []byte) ([]byte, int, error) {
+	return client.Do(ctx, method, url, body)
+}
+
+// apiRequest performs an authenticated API call to a path of the instance
+// and returns the response body, with error statuses as errors, for calls
+// made from concurrent workers where one failure must not end the run.
+func apiRequest(ctx context.Context, method, path string, body []byte) ([]byte, error) {
+	data, status, err := doRequest(ctx, method, baseURL+path, body)
+	if err == nil && status >= 400 {
+		err = newAPIError(status, data)
+	}
+	return data, err
+}
+
 func saveToFile(filePath string, data []byte) error {
 	return ioutil.WriteFile(filePath, data, 0644)
 }
-
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+)
+
+// manifestFile records, relative to -directory, what the last pull wrote.
+const manifestFile = "manifest.json"
+
+// manifestEntry describes a pulled dashboard. Hash is the SHA-256 of its
+// normalized JSON, so it can be compared with local and remote content
+// without keeping a copy of either. Dashboards of the General folder have
+// an empty FolderUID and the General FolderTitle. Team is the owning team of
+// pulls made with -group-by-team.
+type manifestEntry struct {
+	Path        string `json:"path"`
+	UID         string `json:"uid"`
+	Title       string `json:"title"`
+	FolderUID   string `json:"folderUid"`
+	FolderTitle string `json:"folderTitle"`
+	Team        string `json:"team,omitempty"`
+	Hash        string `json:"hash"`
+}
+
+type manifest struct {
+	Dashboards []manifestEntry `json:"dashboards"`
+}
+
+// dashboardHash returns the hash of the normalized dashboard JSON.
+func dashboardHash(data []byte) (string, error) {
+	normalized, err := normalizeDashboard(data)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(normalized)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// readManifest reads the manifest of a pulled directory.
+func readManifest(dir string) (manifest, error) {
+	var m manifest
+	data, err := os.ReadFile(filepath.Join(dir, manifestFile))
+	if err != nil {
+		return m, err
+	}
+	err = json.Unmarshal(data, &m)
+	return m, err
+}
+
+// writeManifest writes the manifest of a pulled directory.
+func writeManifest(dir string, m manifest) error {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, manifestFile), data, 0644)
+}
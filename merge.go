@@ -0,0 +1,284 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// maxUIDLength is the longest UID Grafana accepts.
+const maxUIDLength = 40
+
+// mergeSource is an instance consolidated into the target of push-merged.
+// Its dashboard and folder titles are prefixed with Prefix, and its
+// dashboards are pushed to Folder when set.
+type mergeSource struct {
+	Profile string `yaml:"profile"`
+	Prefix  string `yaml:"prefix"`
+	Folder  string `yaml:"folder"`
+}
+
+// sourceDirectory returns where the data of a merge source is pulled to.
+func sourceDirectory(baseDir string, s mergeSource) string {
+	return filepath.Join(baseDir, "sources", s.Profile)
+}
+
+// mergedDirectory returns where the rewritten data of a merge source is
+// staged before it is pushed.
+func mergedDirectory(baseDir string, s mergeSource) string {
+	return filepath.Join(baseDir, "merged", s.Profile)
+}
+
+// pullSources pulls every merge source into its own subdirectory.
+func pullSources(ctx context.Context) {
+	if len(cfg.Merge) == 0 {
+		log.Fatalf("Error: no merge sources defined in %s", configFile)
+	}
+
+	baseDir, baseWatermark := directory, activeWatermark
+	for _, s := range cfg.Merge {
+		if stopped(ctx) {
+			break
+		}
+		p, err := resolveProfile(s.Profile)
+		if err != nil {
+			log.Fatalf("Error in merge source %s: %v", s.Profile, err)
+		}
+
+		fmt.Printf("Source %s (%s)\n", s.Profile, p.URL)
+		directory = sourceDirectory(baseDir, s)
+		if err := useWatermark(p); err != nil {
+			log.Fatalf("Error in profile %s: %v", s.Profile, err)
+		}
+		connect(p.URL, p.APIKey)
+		pullData(ctx)
+	}
+	directory, activeWatermark = baseDir, baseWatermark
+}
+
+// pushMerged consolidates the pulled merge sources into the instance of
+// -url. Every source is first staged under merged/<profile> with prefixed
+// titles, and UIDs used by more than one source are prefixed as well so
+// the dashboards don't overwrite each other: a UID taken by two sources
+// becomes <profile>-<uid> in both. Dashboards go back to their rewritten
+// folders unless the source sets a folder. The staged directories are
+// kept for review.
+func pushMerged(ctx context.Context) {
+	if len(cfg.Merge) == 0 {
+		log.Fatalf("Error: no merge sources defined in %s", configFile)
+	}
+
+	baseDir := directory
+	conflicts, err := mergeConflicts(baseDir)
+	if err != nil {
+		log.Fatalf("Error reading merge sources: %v", err)
+	}
+
+	for _, s := range cfg.Merge {
+		if err := stageSource(baseDir, s, conflicts); err != nil {
+			log.Fatalf("Error staging merge source %s: %v", s.Profile, err)
+		}
+	}
+
+	targetFolder := folder
+	for _, s := range cfg.Merge {
+		if stopped(ctx) {
+			break
+		}
+		fmt.Printf("Merging %s\n", s.Profile)
+		directory = mergedDirectory(baseDir, s)
+		folder = s.Folder
+		if folder == "" {
+			folder = targetFolder
+		}
+		// Folders first, so that a source folder can be the target of
+		// its dashboards
+		for _, kind := range []struct {
+			dir  string
+			push func(context.Context)
+		}{
+			{"folders", pushFolders},
+			{"dashboards", pushDashboards},
+		} {
+			if _, err := os.Stat(filepath.Join(directory, kind.dir)); err == nil {
+				kind.push(ctx)
+			}
+		}
+	}
+	directory, folder = baseDir, targetFolder
+}
+
+// mergeConflicts returns the dashboard and folder UIDs found in more than
+// one merge source.
+func mergeConflicts(baseDir string) (map[string]bool, error) {
+	seen := make(map[string]string)
+	conflicts := make(map[string]bool)
+	for _, s := range cfg.Merge {
+		uids, err := sourceUIDs(sourceDirectory(baseDir, s))
+		if err != nil {
+			return nil, err
+		}
+		for _, uid := range uids {
+			if other, ok := seen[uid]; ok && other != s.Profile {
+				conflicts[uid] = true
+			}
+			seen[uid] = s.Profile
+		}
+	}
+	return conflicts, nil
+}
+
+// sourceUIDs returns the dashboard and folder UIDs of a pulled directory.
+func sourceUIDs(dir string) ([]string, error) {
+	var uids []string
+	dashboards, err := dashboardPaths(dir)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	for _, path := range dashboards {
+		dashboard, err := readDashboard(path)
+		if err != nil {
+			return nil, err
+		}
+		if uid, _ := dashboard["uid"].(string); uid != "" {
+			uids = append(uids, uid)
+		}
+	}
+
+	folders, err := readFolders(dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range folders {
+		if f.UID != "" {
+			uids = append(uids, f.UID)
+		}
+	}
+	return uids, nil
+}
+
+func readFolders(dir string) ([]folderInfo, error) {
+	var folders []folderInfo
+	err := readResources(dir, "folders", &folders)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	return folders, err
+}
+
+// stageSource writes the rewritten dashboards, folders and manifest of a
+// merge source to its staging directory. Folder UIDs are rewritten wherever
+// they appear, in the parents of nested folders and in the folders the
+// manifest places dashboards in.
+func stageSource(baseDir string, s mergeSource, conflicts map[string]bool) error {
+	src, dst := sourceDirectory(baseDir, s), mergedDirectory(baseDir, s)
+	if err := os.RemoveAll(dst); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dst, os.ModePerm); err != nil {
+		return err
+	}
+
+	rewrite := func(title, uid *string) {
+		if *title != "" && s.Prefix != "" {
+			*title = s.Prefix + " " + *title
+		}
+		if conflicts[*uid] {
+			*uid = prefixUID(s.Profile, *uid)
+		}
+	}
+	// Hashes of the rewritten dashboards, by path relative to the source
+	hashes := make(map[string]string)
+
+	dashboards, err := dashboardPaths(src)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	for _, path := range dashboards {
+		rel, err := filepath.Rel(filepath.Join(src, "dashboards"), path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, "dashboards", rel)
+		if err := os.MkdirAll(filepath.Dir(target), os.ModePerm); err != nil {
+			return err
+		}
+		dashboard, err := readDashboard(path)
+		if err != nil {
+			return err
+		}
+		title, _ := dashboard["title"].(string)
+		uid, _ := dashboard["uid"].(string)
+		rewrite(&title, &uid)
+		if title != "" {
+			dashboard["title"] = title
+		}
+		if uid != "" {
+			dashboard["uid"] = uid
+		}
+		if err := writeDashboard(target, dashboard); err != nil {
+			return err
+		}
+		data, err := json.Marshal(dashboard)
+		if err != nil {
+			return err
+		}
+		key, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		if hashes[key], err = dashboardHash(data); err != nil {
+			return err
+		}
+	}
+
+	folders, err := readFolders(src)
+	if err != nil {
+		return err
+	}
+	if len(folders) > 0 {
+		for i := range folders {
+			rewrite(&folders[i].Title, &folders[i].UID)
+			if conflicts[folders[i].ParentUID] {
+				folders[i].ParentUID = prefixUID(s.Profile, folders[i].ParentUID)
+			}
+		}
+		if err := writeResources(dst, "folders", folders); err != nil {
+			return err
+		}
+	}
+
+	// Without a manifest, push-dashboards sends every dashboard to the
+	// General folder
+	m, err := readManifest(src)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	for i := range m.Dashboards {
+		e := &m.Dashboards[i]
+		rewrite(&e.Title, &e.UID)
+		if e.FolderUID != "" {
+			rewrite(&e.FolderTitle, &e.FolderUID)
+		}
+		if hash, ok := hashes[filepath.Clean(e.Path)]; ok {
+			e.Hash = hash
+		}
+	}
+	return writeManifest(dst, m)
+}
+
+// prefixUID makes a UID unique to its source, within Grafana's UID length.
+func prefixUID(profile, uid string) string {
+	prefixed := strings.ToLower(profile) + "-" + uid
+	if len(prefixed) > maxUIDLength {
+		prefixed = prefixed[:maxUIDLength]
+	}
+	return prefixed
+}
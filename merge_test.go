@@ -0,0 +1,139 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestPrefixUID(t *testing.T) {
+	tests := []struct {
+		profile, uid, want string
+	}{
+		{"prod", "cpu", "prod-cpu"},
+		{"EU-West", "cpu", "eu-west-cpu"},
+		{"prod", strings.Repeat("u", 40), "prod-" + strings.Repeat("u", 35)},
+		{"prod", strings.Repeat("u", 35), "prod-" + strings.Repeat("u", 35)},
+	}
+	for _, tt := range tests {
+		if got := prefixUID(tt.profile, tt.uid); got != tt.want {
+			t.Errorf("prefixUID(%q, %q) = %q, want %q", tt.profile, tt.uid, got, tt.want)
+		}
+	}
+}
+
+// writeSource lays out a pulled merge source: the dashboard cpu in the
+// nested folder db under ops, and the dashboard home in General.
+func writeSource(t *testing.T, dir string) {
+	t.Helper()
+	write := func(path string, v interface{}) {
+		data, err := json.Marshal(v)
+		if err == nil {
+			err = os.MkdirAll(filepath.Dir(path), os.ModePerm)
+		}
+		if err == nil {
+			err = os.WriteFile(path, data, 0644)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	write(filepath.Join(dir, "dashboards", "Ops", "DB", "cpu.json"), map[string]interface{}{"uid": "cpu", "title": "CPU"})
+	write(filepath.Join(dir, "dashboards", "General", "home.json"), map[string]interface{}{"uid": "home", "title": "Home"})
+	write(filepath.Join(dir, "folders", "folders.json"), []folderInfo{{UID: "ops", Title: "Ops"}, {UID: "db", Title: "DB", ParentUID: "ops"}})
+	write(filepath.Join(dir, manifestFile), manifest{Dashboards: []manifestEntry{
+		{Path: filepath.Join("dashboards", "Ops", "DB", "cpu.json"), UID: "cpu", Title: "CPU", FolderUID: "db", FolderTitle: "DB", Hash: "old"},
+		{Path: filepath.Join("dashboards", "General", "home.json"), UID: "home", Title: "Home", FolderTitle: generalFolder, Hash: "old"},
+	}})
+}
+
+func TestStageSource(t *testing.T) {
+	base := t.TempDir()
+	s := mergeSource{Profile: "eu", Prefix: "EU"}
+	writeSource(t, sourceDirectory(base, s))
+	// cpu, db and ops are also used by another source, home is not
+	conflicts := map[string]bool{"cpu": true, "db": true, "ops": true}
+	if err := stageSource(base, s, conflicts); err != nil {
+		t.Fatal(err)
+	}
+	dst := mergedDirectory(base, s)
+
+	dashboards := []struct {
+		path, uid, title string
+	}{
+		{filepath.Join("Ops", "DB", "cpu.json"), "eu-cpu", "EU CPU"},
+		{filepath.Join("General", "home.json"), "home", "EU Home"},
+	}
+	for _, tt := range dashboards {
+		dashboard, err := readDashboard(filepath.Join(dst, "dashboards", tt.path))
+		if err != nil {
+			t.Errorf("staged dashboard %s: %v", tt.path, err)
+			continue
+		}
+		if dashboard["uid"] != tt.uid || dashboard["title"] != tt.title {
+			t.Errorf("staged %s as %v (%v), want %s (%s)", tt.path, dashboard["title"], dashboard["uid"], tt.title, tt.uid)
+		}
+	}
+
+	folders, err := readFolders(dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantFolders := []folderInfo{{UID: "eu-ops", Title: "EU Ops"}, {UID: "eu-db", Title: "EU DB", ParentUID: "eu-ops"}}
+	if len(folders) != len(wantFolders) {
+		t.Fatalf("staged folders %+v, want %+v", folders, wantFolders)
+	}
+	for i, want := range wantFolders {
+		if folders[i] != want {
+			t.Errorf("staged folder %+v, want %+v", folders[i], want)
+		}
+	}
+
+	m, err := readManifest(dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries := []struct {
+		uid, title, folderUID, folderTitle string
+	}{
+		{"eu-cpu", "EU CPU", "eu-db", "EU DB"},
+		{"home", "EU Home", "", generalFolder},
+	}
+	if len(m.Dashboards) != len(entries) {
+		t.Fatalf("staged manifest %+v, want %d dashboards", m.Dashboards, len(entries))
+	}
+	for i, want := range entries {
+		e := m.Dashboards[i]
+		if e.UID != want.uid || e.Title != want.title || e.FolderUID != want.folderUID || e.FolderTitle != want.folderTitle {
+			t.Errorf("staged manifest entry %+v, want %+v", e, want)
+		}
+		if e.Hash == "old" {
+			t.Errorf("staged manifest entry %s kept the hash of the source", e.UID)
+		}
+	}
+}
+
+func TestStageSourceWithoutConflicts(t *testing.T) {
+	base := t.TempDir()
+	s := mergeSource{Profile: "eu"}
+	writeSource(t, sourceDirectory(base, s))
+	if err := stageSource(base, s, nil); err != nil {
+		t.Fatal(err)
+	}
+	folders, err := readFolders(mergedDirectory(base, s))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(folders) != 2 || folders[1].UID != "db" || folders[1].ParentUID != "ops" || folders[1].Title != "DB" {
+		t.Errorf("staged folders %+v, want them unchanged", folders)
+	}
+	m, err := readManifest(mergedDirectory(base, s))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(m.Dashboards) != 2 || m.Dashboards[0].FolderUID != "db" || m.Dashboards[0].Title != "CPU" {
+		t.Errorf("staged manifest %+v, want it unchanged", m.Dashboards)
+	}
+}
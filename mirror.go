@@ -0,0 +1,25 @@
+package main
+
+import "encoding/json"
+
+// readOnly publishes dashboards to a read-only mirror: they are pushed
+// locked and can only be viewed.
+var readOnly bool
+
+// readOnlyPermissions replace the permissions of dashboards pushed with
+// -read-only. Admins keep access through their role.
+var readOnlyPermissions = []permissionItem{
+	{Role: "Viewer", Permission: 1},
+	{Role: "Editor", Permission: 1},
+}
+
+// lockDashboard marks a dashboard as not editable, so the UI doesn't offer
+// to change it.
+func lockDashboard(data []byte) ([]byte, error) {
+	var dashboard map[string]interface{}
+	if err := json.Unmarshal(data, &dashboard); err != nil {
+		return nil, err
+	}
+	dashboard["editable"] = false
+	return json.Marshal(dashboard)
+}
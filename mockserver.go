@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	"grafana-sync/internal/fakegrafana"
+)
+
+// runMockServer serves an in-memory Grafana API on -listen, seeded from the
+// local directory, until the run is cancelled. Any API key is accepted and
+// changes are lost on exit.
+func runMockServer(ctx context.Context) {
+	fake := fakegrafana.NewHandler()
+	if err := seedMockServer(fake); err != nil {
+		log.Fatalf("Error seeding mock server: %v", err)
+	}
+
+	server := &http.Server{Addr: listenAddr, Handler: fake}
+	go func() {
+		<-ctx.Done()
+		server.Close()
+	}()
+	fmt.Printf("Serving mock Grafana API on %s\n", listenAddr)
+	if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		log.Fatalf("Error serving mock Grafana API: %v", err)
+	}
+}
+
+// seedMockServer loads the folders, datasources, notification channels and
+// dashboards of the local directory into the mock. Dashboards go to the
+// folder recorded in the pull manifest, if any.
+func seedMockServer(fake *fakegrafana.Server) error {
+	folders := make(map[string]bool)
+	var list []folderInfo
+	if err := readResources(directory, "folders", &list); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	for _, f := range list {
+		fake.AddFolder(f.UID, f.Title, f.ParentUID)
+		folders[f.UID] = true
+	}
+
+	var datasources []datasource
+	if err := readResources(directory, "datasources", &datasources); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	for _, ds := range datasources {
+		object, err := toObject(ds)
+		if err != nil {
+			return err
+		}
+		fake.AddDatasource(object)
+	}
+
+	var channels []notificationChannel
+	if err := readResources(directory, "notifications", &channels); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	for _, nc := range channels {
+		object, err := toObject(nc)
+		if err != nil {
+			return err
+		}
+		fake.AddChannel(object)
+	}
+
+	pulled := make(map[string]manifestEntry)
+	if m, err := readManifest(directory); err == nil {
+		for _, e := range m.Dashboards {
+			pulled[e.Path] = e
+		}
+	}
+	files, err := dashboardFiles()
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	for _, path := range files {
+		dashboard, err := readDashboard(path)
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		if uid, _ := dashboard["uid"].(string); uid == "" {
+			log.Printf("Skipping dashboard %s: it has no uid", path)
+			continue
+		}
+		rel, _ := filepath.Rel(directory, path)
+		e := pulled[rel]
+		if e.FolderUID != "" && !folders[e.FolderUID] {
+			fake.AddFolder(e.FolderUID, e.FolderTitle, "")
+			folders[e.FolderUID] = true
+		}
+		fake.AddDashboard(e.FolderUID, dashboard)
+	}
+	fmt.Printf("Loaded %d folder(s), %d datasource(s), %d notification channel(s) and %d dashboard file(s) from %s\n", len(folders), len(datasources), len(channels), len(files), directory)
+	return nil
+}
+
+// toObject converts a typed resource to generic JSON.
+func toObject(v interface{}) (fakegrafana.Object, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var object fakegrafana.Object
+	err = json.Unmarshal(data, &object)
+	return object, err
+}
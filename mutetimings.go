@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"path/filepath"
+)
+
+// muteTimingsDir holds the mute timings of a directory, one file per timing.
+var muteTimingsDir = filepath.Join("alerting", "mute-timings")
+
+// muteTiming is a unified alerting mute timing, as returned by
+// /api/v1/provisioning/mute-timings. Its version and provenance are left
+// out of the files.
+type muteTiming struct {
+	Name          string                   `json:"name"`
+	TimeIntervals []map[string]interface{} `json:"time_intervals"`
+}
+
+func (m muteTiming) validate() error {
+	if m.Name == "" {
+		return errors.New("has no name")
+	}
+	return nil
+}
+
+// muteTimingPath returns the file of a mute timing in a directory.
+func muteTimingPath(dir, name string) string {
+	return filepath.Join(dir, muteTimingsDir, url.PathEscape(name)+".json")
+}
+
+// pullMuteTimings saves the mute timings of the instance. The mute timings
+// directory is replaced, so that deleted timings don't come back on push.
+func pullMuteTimings(ctx context.Context) {
+	fmt.Println("Pulling mute timings...")
+	var timings []muteTiming
+	if err := getJSON(ctx, "/api/v1/provisioning/mute-timings", &timings); err != nil {
+		pullFailed(ctx, "mute-timings", "fetching mute timings", err)
+		return
+	}
+
+	dir := filepath.Join(directory, muteTimingsDir)
+	err := os.RemoveAll(dir)
+	if err == nil {
+		err = os.MkdirAll(dir, os.ModePerm)
+	}
+	if err != nil {
+		log.Printf("Error replacing mute timings directory: %v", err)
+		summary.add("mute timings", outcomeFailed, dir)
+		return
+	}
+	for _, mt := range timings {
+		data, err := json.MarshalIndent(mt, "", "  ")
+		if err == nil {
+			err = os.WriteFile(muteTimingPath(directory, mt.Name), data, 0644)
+		}
+		if err != nil {
+			log.Printf("Error saving mute timing %s: %v", mt.Name, err)
+			continue
+		}
+		fmt.Printf("Saved mute timing: %s\n", mt.Name)
+	}
+}
+
+// pushMuteTimings creates or replaces the local mute timings, matched by
+// name.
+func pushMuteTimings(ctx context.Context) {
+	fmt.Println("Pushing mute timings...")
+	files, err := filepath.Glob(filepath.Join(directory, muteTimingsDir, "*.json"))
+	if err != nil || len(files) == 0 {
+		fmt.Println("Error reading mute timings directory: no mute timing files")
+		return
+	}
+
+	var existing []muteTiming
+	if err := getJSON(ctx, "/api/v1/provisioning/mute-timings", &existing); err != nil {
+		log.Printf("Error fetching mute timings: %s", describeError(err))
+		for _, path := range files {
+			summary.add("mute timings", outcomeFailed, filepath.Base(path))
+		}
+		return
+	}
+	exists := make(map[string]bool, len(existing))
+	for _, mt := range existing {
+		exists[mt.Name] = true
+	}
+
+	for _, path := range files {
+		if stopped(ctx) {
+			break
+		}
+		var mt muteTiming
+		data, err := os.ReadFile(path)
+		if err == nil {
+			err = json.Unmarshal(data, &mt)
+		}
+		if err == nil {
+			err = mt.validate()
+		}
+		if err != nil {
+			log.Printf("Error reading mute timing %s: %v", path, err)
+			summary.add("mute timings", outcomeFailed, filepath.Base(path))
+			continue
+		}
+		body, err := json.Marshal(mt)
+		if err != nil {
+			log.Printf("Error marshalling mute timing %s: %v", mt.Name, err)
+			continue
+		}
+		method, endpoint := "POST", "/api/v1/provisioning/mute-timings"
+		if exists[mt.Name] {
+			method, endpoint = "PUT", endpoint+"/"+url.PathEscape(mt.Name)
+		}
+		if _, err := apiRequest(ctx, method, endpoint, body); err != nil {
+			log.Printf("Error pushing mute timing %s: %s", mt.Name, describeError(err))
+			summary.add("mute timings", outcomeFailed, mt.Name)
+			continue
+		}
+		printChange("Uploaded mute timing: %s\n", mt.Name)
+		summary.add("mute timings", outcomePushed, mt.Name)
+	}
+}
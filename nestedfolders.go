@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"strings"
+)
+
+// folderLevels groups the indexes of folders by depth in the folder tree,
+// top level folders first, so that every level can be created once the
+// folders of the previous one exist. Folders whose parent isn't listed
+// count as top level.
+func folderLevels(folders []folderInfo) [][]int {
+	byUID := make(map[string]int, len(folders))
+	for i, f := range folders {
+		byUID[f.UID] = i
+	}
+	depths := make(map[int]int, len(folders))
+	var depth func(i int, seen map[int]bool) int
+	depth = func(i int, seen map[int]bool) int {
+		if d, ok := depths[i]; ok {
+			return d
+		}
+		d := 0
+		// A cycle, which Grafana doesn't allow, is cut where it's found
+		if parent, ok := byUID[folders[i].ParentUID]; ok && folders[i].ParentUID != "" && !seen[parent] {
+			seen[i] = true
+			d = depth(parent, seen) + 1
+		}
+		depths[i] = d
+		return d
+	}
+
+	var levels [][]int
+	for i := range folders {
+		d := depth(i, map[int]bool{})
+		for len(levels) <= d {
+			levels = append(levels, nil)
+		}
+		levels[d] = append(levels[d], i)
+	}
+	return levels
+}
+
+// folderPaths returns the path of every folder in the folder tree, by UID:
+// the titles of its ancestors and its own joined with /. Slashes in titles
+// are replaced so that every folder is a single directory.
+func folderPaths(folders []folderInfo) map[string]string {
+	byUID := make(map[string]folderInfo, len(folders))
+	for _, f := range folders {
+		byUID[f.UID] = f
+	}
+	paths := make(map[string]string, len(folders))
+	for _, f := range folders {
+		var titles []string
+		seen := make(map[string]bool)
+		for cur, ok := f, true; ok && !seen[cur.UID]; cur, ok = byUID[cur.ParentUID] {
+			seen[cur.UID] = true
+			titles = append([]string{strings.ReplaceAll(cur.Title, "/", "-")}, titles...)
+		}
+		paths[f.UID] = filepath.Join(titles...)
+	}
+	return paths
+}
+
+// saveFolder creates a folder from its JSON, or when a folder with its UID
+// exists, such as one created for the dashboards pushed before, renames it
+// and moves it under its parent as needed.
+func saveFolder(ctx context.Context, f folderInfo, body []byte) error {
+	if f.UID == "" {
+		return folderRequest(ctx, "POST", "/api/folders", body)
+	}
+	var current folderInfo
+	err := getJSON(ctx, "/api/folders/"+url.PathEscape(f.UID), &current)
+	if apiErr, ok := asAPIError(err); ok && apiErr.StatusCode == http.StatusNotFound {
+		return folderRequest(ctx, "POST", "/api/folders", body)
+	}
+	if err != nil {
+		return err
+	}
+
+	path := "/api/folders/" + url.PathEscape(f.UID)
+	if current.Title != f.Title {
+		update, _ := json.Marshal(map[string]interface{}{"title": f.Title, "overwrite": true})
+		if err := folderRequest(ctx, "PUT", path, update); err != nil {
+			return err
+		}
+	}
+	if current.ParentUID != f.ParentUID {
+		move, _ := json.Marshal(map[string]string{"parentUid": f.ParentUID})
+		return folderRequest(ctx, "POST", path+"/move", move)
+	}
+	return nil
+}
+
+func folderRequest(ctx context.Context, method, path string, body []byte) error {
+	data, status, err := doRequest(ctx, method, baseURL+path, body)
+	if err == nil && status >= 400 {
+		err = newAPIError(status, data)
+	}
+	return err
+}
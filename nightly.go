@@ -0,0 +1,303 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Settings of the nightly action.
+var (
+	archiveDir    string
+	keepArchives  int
+	digestWebhook string
+	smtpServer    string
+	mailFrom      string
+	mailTo        stringList
+)
+
+// archiveDateFormat names the daily archive directories.
+const archiveDateFormat = "2006-01-02"
+
+// changeSet lists the resources of a kind that changed between two exports.
+type changeSet struct {
+	Kind    string   `json:"kind"`
+	Added   []string `json:"added,omitempty"`
+	Changed []string `json:"changed,omitempty"`
+	Removed []string `json:"removed,omitempty"`
+}
+
+func (c changeSet) empty() bool {
+	return len(c.Added)+len(c.Changed)+len(c.Removed) == 0
+}
+
+// runNightly is meant to be scheduled once a day: it pulls everything into
+// a dated directory under -archive-dir, removes the archives beyond -keep,
+// and sends a summary of what changed since the previous archive to
+// -digest-webhook and by mail.
+func runNightly(ctx context.Context) {
+	previous, err := latestArchive()
+	if err != nil {
+		log.Fatalf("Error reading archives: %v", err)
+	}
+
+	date := time.Now().Format(archiveDateFormat)
+	current := filepath.Join(archiveDir, date)
+	if err := os.RemoveAll(current); err != nil {
+		log.Fatalf("Error clearing %s: %v", current, err)
+	}
+	baseDir := directory
+	directory = current
+	pullData(ctx)
+	directory = baseDir
+
+	var changes []changeSet
+	if previous != "" && previous != current {
+		if changes, err = diffArchives(previous, current); err != nil {
+			log.Fatalf("Error comparing with %s: %v", previous, err)
+		}
+	} else {
+		previous = ""
+	}
+
+	if err := rotateArchives(); err != nil {
+		log.Printf("Error removing old archives: %v", err)
+	}
+
+	digest := formatDigest(date, previous, changes)
+	fmt.Print(digest)
+	if digestWebhook != "" {
+		if err := sendDigestWebhook(date, digest, changes); err != nil {
+			log.Printf("Error sending digest webhook: %v", err)
+		}
+	}
+	if smtpServer != "" && len(mailTo) > 0 {
+		if err := sendDigestMail(date, digest); err != nil {
+			log.Printf("Error sending digest mail: %v", err)
+		}
+	}
+}
+
+// archives returns the archive directories, oldest first.
+func archives() ([]string, error) {
+	entries, err := os.ReadDir(archiveDir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, e := range entries {
+		if _, err := time.Parse(archiveDateFormat, e.Name()); err == nil && e.IsDir() {
+			names = append(names, e.Name())
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// latestArchive returns the most recent archive made before today.
+func latestArchive() (string, error) {
+	names, err := archives()
+	if err != nil {
+		return "", err
+	}
+	today := time.Now().Format(archiveDateFormat)
+	for i := len(names) - 1; i >= 0; i-- {
+		if names[i] < today {
+			return filepath.Join(archiveDir, names[i]), nil
+		}
+	}
+	return "", nil
+}
+
+// rotateArchives removes all but the -keep most recent archives.
+func rotateArchives() error {
+	if keepArchives <= 0 {
+		return nil
+	}
+	names, err := archives()
+	if err != nil {
+		return err
+	}
+	for len(names) > keepArchives {
+		if err := os.RemoveAll(filepath.Join(archiveDir, names[0])); err != nil {
+			return err
+		}
+		fmt.Printf("Removed archive %s\n", names[0])
+		names = names[1:]
+	}
+	return nil
+}
+
+// diffArchives compares two pulled directories: dashboards by their
+// manifest hashes, the other kinds item by item.
+func diffArchives(oldDir, newDir string) ([]changeSet, error) {
+	oldManifest, err := readManifest(oldDir)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	newManifest, err := readManifest(newDir)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	dashboards := changeSet{Kind: "dashboards"}
+	old := make(map[string]manifestEntry)
+	for _, e := range oldManifest.Dashboards {
+		old[e.UID] = e
+	}
+	for _, e := range newManifest.Dashboards {
+		name := fmt.Sprintf("%s (%s)", e.Title, e.UID)
+		if o, ok := old[e.UID]; !ok {
+			dashboards.Added = append(dashboards.Added, name)
+		} else if o.Hash != e.Hash {
+			dashboards.Changed = append(dashboards.Changed, name)
+		}
+		delete(old, e.UID)
+	}
+	for _, e := range old {
+		dashboards.Removed = append(dashboards.Removed, fmt.Sprintf("%s (%s)", e.Title, e.UID))
+	}
+	sort.Strings(dashboards.Removed)
+
+	changes := []changeSet{dashboards}
+	for _, kind := range []string{"folders", "datasources", "notifications"} {
+		c, err := diffList(kind, oldDir, newDir)
+		if err != nil {
+			return nil, err
+		}
+		changes = append(changes, c)
+	}
+	return changes, nil
+}
+
+// diffList compares the items of a pulled list, identified by UID.
+func diffList(kind, oldDir, newDir string) (changeSet, error) {
+	c := changeSet{Kind: kind}
+	read := func(dir string) (map[string]string, map[string]string, error) {
+		contents, names := map[string]string{}, map[string]string{}
+		data, err := os.ReadFile(filepath.Join(dir, kind, kind+".json"))
+		if os.IsNotExist(err) {
+			return contents, names, nil
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		var items []map[string]interface{}
+		if err := json.Unmarshal(data, &items); err != nil {
+			return nil, nil, err
+		}
+		for _, item := range items {
+			key := str(item["uid"])
+			if key == "" {
+				key = str(item["name"])
+			}
+			canonical, _ := json.Marshal(item)
+			contents[key] = string(canonical)
+			name := str(item["title"])
+			if name == "" {
+				name = str(item["name"])
+			}
+			names[key] = fmt.Sprintf("%s (%s)", name, key)
+		}
+		return contents, names, nil
+	}
+
+	oldItems, oldNames, err := read(oldDir)
+	if err != nil {
+		return c, err
+	}
+	newItems, newNames, err := read(newDir)
+	if err != nil {
+		return c, err
+	}
+	for key, content := range newItems {
+		if oldContent, ok := oldItems[key]; !ok {
+			c.Added = append(c.Added, newNames[key])
+		} else if oldContent != content {
+			c.Changed = append(c.Changed, newNames[key])
+		}
+	}
+	for key := range oldItems {
+		if _, ok := newItems[key]; !ok {
+			c.Removed = append(c.Removed, oldNames[key])
+		}
+	}
+	sort.Strings(c.Added)
+	sort.Strings(c.Changed)
+	sort.Strings(c.Removed)
+	return c, nil
+}
+
+// formatDigest renders the changes as a plain text summary.
+func formatDigest(date, previous string, changes []changeSet) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Grafana changes on %s, %s\n", baseURL, date)
+	if previous == "" {
+		b.WriteString("First export, nothing to compare with.\n")
+		return b.String()
+	}
+	fmt.Fprintf(&b, "Compared with %s.\n", filepath.Base(previous))
+
+	changed := false
+	for _, c := range changes {
+		if c.empty() {
+			continue
+		}
+		changed = true
+		fmt.Fprintf(&b, "\n%s: %d added, %d changed, %d removed\n", c.Kind, len(c.Added), len(c.Changed), len(c.Removed))
+		for _, marker := range []struct {
+			sign  string
+			names []string
+		}{{"+", c.Added}, {"~", c.Changed}, {"-", c.Removed}} {
+			for _, name := range marker.names {
+				fmt.Fprintf(&b, "  %s %s\n", marker.sign, name)
+			}
+		}
+	}
+	if !changed {
+		b.WriteString("No changes.\n")
+	}
+	return b.String()
+}
+
+func sendDigestWebhook(date, digest string, changes []changeSet) error {
+	body, _ := json.Marshal(map[string]interface{}{
+		"text":    digest,
+		"date":    date,
+		"changes": changes,
+	})
+	resp, err := http.Post(digestWebhook, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 400 {
+		return fmt.Errorf("webhook returned %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// sendDigestMail mails the digest through -smtp-server, authenticating
+// with $SMTP_USERNAME and $SMTP_PASSWORD when they are set.
+func sendDigestMail(date, digest string) error {
+	var auth smtp.Auth
+	if user := os.Getenv("SMTP_USERNAME"); user != "" {
+		host := strings.Split(smtpServer, ":")[0]
+		auth = smtp.PlainAuth("", user, os.Getenv("SMTP_PASSWORD"), host)
+	}
+	msg := fmt.Sprintf("From: %s\r\nTo: %s\r\nSubject: Grafana changes %s\r\nContent-Type: text/plain; charset=utf-8\r\n\r\n%s",
+		mailFrom, strings.Join(mailTo, ", "), date, strings.ReplaceAll(digest, "\n", "\r\n"))
+	return smtp.SendMail(smtpServer, auth, mailFrom, mailTo, []byte(msg))
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDiffList(t *testing.T) {
+	tests := []struct {
+		old, new                string
+		added, changed, removed string
+	}{
+		{"", "", "", "", ""},
+		{"", `[{"uid":"a","title":"A"}]`, "A (a)", "", ""},
+		{`[{"uid":"a","title":"A"}]`, "", "", "", "A (a)"},
+		{`[{"uid":"a","title":"A"}]`, `[{"uid":"a","title":"A"}]`, "", "", ""},
+		{`[{"uid":"a","title":"A"}]`, `[{"uid":"a","title":"A2"}]`, "", "A2 (a)", ""},
+		// Items without a UID are identified by name
+		{`[{"name":"Loki","url":"http://loki"}]`, `[{"name":"Loki","url":"http://loki:3100"}]`, "", "Loki (Loki)", ""},
+		{
+			`[{"uid":"a","title":"A"},{"uid":"b","title":"B"},{"uid":"c","title":"C"}]`,
+			`[{"uid":"d","title":"D"},{"uid":"c","title":"C","parentUid":"a"},{"uid":"a","title":"A"}]`,
+			"D (d)", "C (c)", "B (b)",
+		},
+	}
+	for _, tt := range tests {
+		oldDir, newDir := t.TempDir(), t.TempDir()
+		for dir, content := range map[string]string{oldDir: tt.old, newDir: tt.new} {
+			if content == "" {
+				continue
+			}
+			if err := os.MkdirAll(filepath.Join(dir, "folders"), os.ModePerm); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(filepath.Join(dir, "folders", "folders.json"), []byte(content), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+		c, err := diffList("folders", oldDir, newDir)
+		if err != nil {
+			t.Errorf("diffList(%s, %s): %v", tt.old, tt.new, err)
+			continue
+		}
+		got := []string{strings.Join(c.Added, ","), strings.Join(c.Changed, ","), strings.Join(c.Removed, ",")}
+		want := []string{tt.added, tt.changed, tt.removed}
+		if strings.Join(got, "|") != strings.Join(want, "|") {
+			t.Errorf("diffList(%s, %s) = %q, want %q", tt.old, tt.new, got, want)
+		}
+	}
+}
+
+func TestRotateArchives(t *testing.T) {
+	defer func(dir string, keep int) { archiveDir, keepArchives = dir, keep }(archiveDir, keepArchives)
+
+	days := []string{"2024-04-28", "2024-04-29", "2024-04-30", "2024-05-01"}
+	tests := []struct {
+		keep int
+		want string
+	}{
+		{0, "2024-04-28 2024-04-29 2024-04-30 2024-05-01 notes"},
+		{2, "2024-04-30 2024-05-01 notes"},
+		{4, "2024-04-28 2024-04-29 2024-04-30 2024-05-01 notes"},
+		{10, "2024-04-28 2024-04-29 2024-04-30 2024-05-01 notes"},
+		{1, "2024-05-01 notes"},
+	}
+	for _, tt := range tests {
+		archiveDir, keepArchives = t.TempDir(), tt.keep
+		// Directories not named after a date are not archives
+		for _, name := range append(days, "notes") {
+			if err := os.MkdirAll(filepath.Join(archiveDir, name), os.ModePerm); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := rotateArchives(); err != nil {
+			t.Errorf("rotateArchives with -keep=%d: %v", tt.keep, err)
+			continue
+		}
+		entries, err := os.ReadDir(archiveDir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, e := range entries {
+			got = append(got, e.Name())
+		}
+		if strings.Join(got, " ") != tt.want {
+			t.Errorf("rotateArchives with -keep=%d left %v, want %s", tt.keep, got, tt.want)
+		}
+	}
+}
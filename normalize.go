@@ -0,0 +1,75 @@
+package main
+
+import "encoding/json"
+
+// volatileDashboardFields change on every save and are ignored by default
+// when comparing local and remote dashboards.
+var volatileDashboardFields = []string{"id", "version", "iteration"}
+
+// Grafana's default time range, restored by resetTime.
+const (
+	defaultTimeFrom = "now-6h"
+	defaultTimeTo   = "now"
+)
+
+// normalizeConfig selects what is canonicalized before local and remote
+// dashboards are compared. It is read from the normalize section of the
+// configuration file.
+type normalizeConfig struct {
+	// Strip lists top level fields removed from both sides. Defaults to
+	// volatileDashboardFields.
+	Strip []string `yaml:"strip"`
+	// ResetTime replaces the saved time range with Grafana's default.
+	ResetTime bool `yaml:"resetTime"`
+	// ResetTemplating drops the current value and the cached options of
+	// template variables.
+	ResetTemplating bool `yaml:"resetTemplating"`
+	// ResetRefresh clears the auto refresh interval.
+	ResetRefresh bool `yaml:"resetRefresh"`
+}
+
+// normalizeDashboard returns the canonical JSON of a dashboard used to
+// compare local files with remote state.
+func normalizeDashboard(data []byte) ([]byte, error) {
+	var dashboard map[string]interface{}
+	if err := json.Unmarshal(data, &dashboard); err != nil {
+		return nil, err
+	}
+
+	rules := cfg.Normalize
+	strip := rules.Strip
+	if strip == nil {
+		strip = volatileDashboardFields
+	}
+	for _, field := range strip {
+		delete(dashboard, field)
+	}
+	if rules.ResetTime {
+		dashboard["time"] = map[string]interface{}{"from": defaultTimeFrom, "to": defaultTimeTo}
+	}
+	if rules.ResetRefresh {
+		dashboard["refresh"] = ""
+	}
+	if rules.ResetTemplating {
+		resetTemplating(dashboard)
+	}
+	return json.MarshalIndent(dashboard, "", "  ")
+}
+
+// resetTemplating removes the state Grafana saves along with template
+// variables: the selected value and, for query variables, the options
+// fetched from the datasource.
+func resetTemplating(dashboard map[string]interface{}) {
+	templating, _ := dashboard["templating"].(map[string]interface{})
+	list, _ := templating["list"].([]interface{})
+	for _, v := range list {
+		variable, ok := v.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		delete(variable, "current")
+		if variable["type"] == "query" {
+			delete(variable, "options")
+		}
+	}
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"path/filepath"
+)
+
+// orgID selects the organization the API calls act on, sent in the
+// X-Grafana-Org-Id header. 0 uses the default organization of the
+// credentials.
+var orgID int
+
+// orgDirectory returns where pull-all-orgs writes the resources of an
+// organization.
+func orgDirectory(baseDir string, id int) string {
+	return filepath.Join(baseDir, fmt.Sprintf("org-%d", id))
+}
+
+// pullAllOrgs pulls every organization of the instance into its own
+// org-<id> subdirectory. Listing the organizations and switching between
+// them needs a Grafana server admin.
+func pullAllOrgs(ctx context.Context) {
+	var orgs []struct {
+		ID   int    `json:"id"`
+		Name string `json:"name"`
+	}
+	if err := getJSON(ctx, "/api/orgs", &orgs); err != nil {
+		log.Fatalf("Error listing organizations: %s", describeError(err))
+	}
+
+	baseDir, baseOrg := directory, orgID
+	for _, o := range orgs {
+		if stopped(ctx) {
+			break
+		}
+		fmt.Printf("Organization %d (%s)\n", o.ID, o.Name)
+		directory, orgID = orgDirectory(baseDir, o.ID), o.ID
+		// Folders, datasources and the role of the credentials differ
+		// between organizations
+		connect(baseURL, apiKey)
+		folderOwners = make(map[string]string)
+		pullData(ctx)
+	}
+	directory, orgID = baseDir, baseOrg
+	connect(baseURL, apiKey)
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+)
+
+// orgUser is a user of the organization with its role, as stored in
+// users/users.json. Users are matched by login, or by email when the login
+// differs, since user IDs differ between instances.
+type orgUser struct {
+	Login string `json:"login"`
+	Email string `json:"email,omitempty"`
+	Role  string `json:"role"`
+}
+
+func (u orgUser) validate() error {
+	switch {
+	case u.Login == "" && u.Email == "":
+		return errors.New("has no login or email")
+	case roleRanks[u.Role] == 0:
+		return fmt.Errorf("has an invalid role %q", u.Role)
+	}
+	return nil
+}
+
+// listOrgUsers returns the users of the organization with their user IDs.
+func listOrgUsers(ctx context.Context) ([]orgUser, []int, error) {
+	var users []struct {
+		orgUser
+		UserID int `json:"userId"`
+	}
+	if err := getJSON(ctx, "/api/org/users", &users); err != nil {
+		return nil, nil, err
+	}
+	list := make([]orgUser, 0, len(users))
+	ids := make([]int, 0, len(users))
+	for _, u := range users {
+		list = append(list, u.orgUser)
+		ids = append(ids, u.UserID)
+	}
+	return list, ids, nil
+}
+
+func pullOrgUsers(ctx context.Context) {
+	fmt.Println("Pulling organization users...")
+	if !roleAllows(ctx, "users", "Admin") {
+		return
+	}
+	users, _, err := listOrgUsers(ctx)
+	if err != nil {
+		log.Fatalf("Error listing organization users: %s", describeError(err))
+	}
+	pulled := []orgUser{}
+	for _, u := range users {
+		if included("users", u.Login) {
+			pulled = append(pulled, u)
+		}
+	}
+	if err := writePulledResources(directory, "users", pulled); err != nil {
+		fmt.Println("Error saving organization users:", err)
+		return
+	}
+	fmt.Println("Saved organization users")
+}
+
+// pushOrgUsers re-applies the roles of the local users. Users of the
+// instance missing from the organization are added to it; users that don't
+// exist on the instance are reported, as they have to sign in or be
+// invited first. Users of the organization that aren't in the file are
+// left alone.
+func pushOrgUsers(ctx context.Context) {
+	fmt.Println("Pushing organization users...")
+	if !roleAllows(ctx, "users", "Admin") {
+		return
+	}
+	var list []orgUser
+	if err := readResources(directory, "users", &list); err != nil {
+		fmt.Println("Error reading organization users file:", err)
+		return
+	}
+	existing, ids, err := listOrgUsers(ctx)
+	if err != nil {
+		log.Fatalf("Error listing organization users: %s", describeError(err))
+	}
+	byLogin := make(map[string]int, len(existing))
+	byEmail := make(map[string]int, len(existing))
+	for i, u := range existing {
+		byLogin[u.Login] = i
+		if u.Email != "" {
+			byEmail[u.Email] = i
+		}
+	}
+
+	for _, u := range list {
+		if stopped(ctx) {
+			break
+		}
+		if !included("users", u.Login) {
+			continue
+		}
+		name := u.Login
+		if name == "" {
+			name = u.Email
+		}
+		var pushed orgUser
+		if _, err := pushPayload("users", u, &pushed); err != nil {
+			fmt.Printf("Error preparing organization user %s: %v\n", name, err)
+			summary.add("users", outcomeFailed, name)
+			continue
+		}
+
+		i, found := byLogin[pushed.Login]
+		if !found && pushed.Email != "" {
+			i, found = byEmail[pushed.Email]
+		}
+		var data []byte
+		var status int
+		switch {
+		case !found:
+			loginOrEmail := pushed.Login
+			if loginOrEmail == "" {
+				loginOrEmail = pushed.Email
+			}
+			body, _ := json.Marshal(map[string]string{"loginOrEmail": loginOrEmail, "role": pushed.Role})
+			data, status, err = doRequest(ctx, "POST", baseURL+"/api/org/users", body)
+		case existing[i].Role != pushed.Role:
+			body, _ := json.Marshal(map[string]string{"role": pushed.Role})
+			data, status, err = doRequest(ctx, "PATCH", fmt.Sprintf("%s/api/org/users/%d", baseURL, ids[i]), body)
+		default:
+			summary.add("users", outcomeUnchanged, name)
+			continue
+		}
+		if err == nil && status >= 400 {
+			err = newAPIError(status, data)
+		}
+		if err != nil {
+			log.Printf("Error pushing organization user %s: %s", name, describeError(err))
+			summary.add("users", outcomeFailed, name)
+			continue
+		}
+		if found {
+			fmt.Printf("Changed the role of %s from %s to %s\n", name, existing[i].Role, pushed.Role)
+		} else {
+			fmt.Printf("Added %s to the organization as %s\n", name, pushed.Role)
+		}
+		summary.add("users", outcomePushed, name)
+	}
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+)
+
+// selectedPanels holds the panel IDs or titles given with -panel. When set,
+// push-dashboards merges only those panels into the remote dashboards.
+var selectedPanels stringList
+
+// panelSelected reports whether a panel matches one of the -panel values,
+// either by ID or by title.
+func panelSelected(panel map[string]interface{}) bool {
+	title, _ := panel["title"].(string)
+	id, _ := panel["id"].(float64)
+	for _, s := range selectedPanels {
+		if n, err := strconv.Atoi(s); err == nil && float64(n) == id {
+			return true
+		}
+		if s == title {
+			return true
+		}
+	}
+	return false
+}
+
+// mergeSelectedPanels returns the remote version of a local dashboard with
+// the selected local panels merged into it. A selected panel replaces the
+// remote panel with the same ID. When there is none, it is added to the
+// remote row it belongs to locally, or appended when the remote dashboard
+// has no such row, while everything else on the remote dashboard is left
+// untouched.
+func mergeSelectedPanels(ctx context.Context, data []byte) ([]byte, error) {
+	var local map[string]interface{}
+	if err := json.Unmarshal(data, &local); err != nil {
+		return nil, err
+	}
+	uid, _ := local["uid"].(string)
+	if uid == "" {
+		return nil, fmt.Errorf("selective push needs a dashboard uid")
+	}
+
+	raw, _, err := client.GetRawDashboardByUID(ctx, uid)
+	if err != nil {
+		return nil, fmt.Errorf("fetching remote dashboard %s: %w", uid, err)
+	}
+	var remote map[string]interface{}
+	if err := json.Unmarshal(raw, &remote); err != nil {
+		return nil, err
+	}
+
+	remoteByID := map[float64]map[string]interface{}{}
+	for _, panel := range dashboardPanels(remote) {
+		if id, ok := panel["id"].(float64); ok {
+			remoteByID[id] = panel
+		}
+	}
+
+	rows := panelRows(local)
+	merged := 0
+	for _, panel := range dashboardPanels(local) {
+		if !panelSelected(panel) {
+			continue
+		}
+		id, _ := panel["id"].(float64)
+		if target, ok := remoteByID[id]; ok {
+			for k := range target {
+				delete(target, k)
+			}
+			for k, v := range panel {
+				target[k] = v
+			}
+		} else if row, ok := rows[id]; !ok || !addToRow(remote, row, panel) {
+			panels, _ := remote["panels"].([]interface{})
+			remote["panels"] = append(panels, panel)
+		}
+		merged++
+	}
+	if merged == 0 {
+		return nil, fmt.Errorf("none of the selected panels found in dashboard %s", uid)
+	}
+
+	fmt.Printf("Merging %d panel(s) into remote dashboard %s\n", merged, uid)
+	return json.Marshal(remote)
+}
+
+// panelRows returns the ID of the row every panel of a dashboard belongs to,
+// by panel ID: the collapsed row holding it, or the expanded row above it.
+// Panels above the first row are left out.
+func panelRows(dashboard map[string]interface{}) map[float64]float64 {
+	rows := make(map[float64]float64)
+	top, _ := dashboard["panels"].([]interface{})
+	var row interface{}
+	for _, p := range top {
+		panel, ok := p.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if panel["type"] == "row" {
+			row = panel["id"]
+			nested, _ := panel["panels"].([]interface{})
+			for _, n := range nested {
+				if child, ok := n.(map[string]interface{}); ok {
+					if id, ok := child["id"].(float64); ok {
+						rows[id], _ = panel["id"].(float64)
+					}
+				}
+			}
+			continue
+		}
+		if id, ok := panel["id"].(float64); ok && row != nil {
+			rows[id], _ = row.(float64)
+		}
+	}
+	return rows
+}
+
+// addToRow adds a panel to the row of a dashboard with the given ID: into
+// its panels when it is collapsed, or after the last panel below it when it
+// is expanded. It reports whether the dashboard has the row.
+func addToRow(dashboard map[string]interface{}, rowID float64, panel map[string]interface{}) bool {
+	top, _ := dashboard["panels"].([]interface{})
+	for i, p := range top {
+		row, ok := p.(map[string]interface{})
+		if !ok || row["type"] != "row" || row["id"] != rowID {
+			continue
+		}
+		if collapsed, _ := row["collapsed"].(bool); collapsed {
+			nested, _ := row["panels"].([]interface{})
+			row["panels"] = append(nested, panel)
+			return true
+		}
+		end := i + 1
+		for end < len(top) {
+			if next, ok := top[end].(map[string]interface{}); ok && next["type"] == "row" {
+				break
+			}
+			end++
+		}
+		panels := append(append(append([]interface{}{}, top[:end]...), panel), top[end:]...)
+		dashboard["panels"] = panels
+		return true
+	}
+	return false
+}
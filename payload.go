@@ -0,0 +1,172 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// maxBodySize is the largest request body the instance accepts, in bytes,
+// typically the limit of a reverse proxy in front of Grafana. Zero when
+// unknown, in which case dashboards are only minified after a 413.
+var maxBodySize int
+
+// Outcome recorded for dashboards larger than the instance accepts.
+const outcomeTooLarge = "too large"
+
+// minifySteps are the minifications the minify setting of the configuration
+// file can apply to dashboards too large to be pushed, in the order they are
+// applied.
+var minifySteps = []struct {
+	name  string
+	apply func(dashboard map[string]interface{})
+}{
+	{"descriptions", stripPanelDescriptions},
+	{"repeated-rows", collapseRepeatedRows},
+}
+
+// checkMinify rejects unknown steps in the minify setting.
+func checkMinify() error {
+	var names []string
+	for _, step := range minifySteps {
+		names = append(names, step.name)
+	}
+	for _, name := range cfg.Minify {
+		if !stringList(names).contains(name) {
+			return fmt.Errorf("unknown step %q, must be one of %s", name, strings.Join(names, ", "))
+		}
+	}
+	return nil
+}
+
+// tooLargeError reports a dashboard larger than the instance accepts, with
+// its size after minification, if any.
+type tooLargeError struct {
+	size     int
+	limit    int
+	minified bool
+}
+
+func (e *tooLargeError) Error() string {
+	msg := fmt.Sprintf("payload of %d bytes", e.size)
+	if e.minified {
+		msg += " after minification"
+	}
+	if e.limit > 0 {
+		msg += fmt.Sprintf(" exceeds the limit of %d bytes", e.limit)
+	} else {
+		msg += " was rejected by the instance as too large (HTTP 413)"
+	}
+	if len(cfg.Minify) == 0 {
+		msg += "; set minify in the configuration file to shrink it"
+	}
+	return msg
+}
+
+// saveDashboard saves a dashboard like SetRawDashboardWithParam, minifying it
+// first when its payload exceeds -max-body-size, or after the instance
+// rejected it as too large. A dashboard that still doesn't fit is reported
+// with a tooLargeError instead of being sent.
+func saveDashboard(ctx context.Context, name string, request rawBoardRequest) (statusMessage, error) {
+	minified := false
+	size := payloadSize(request)
+	minify := func() {
+		request.Dashboard, minified = minifyDashboard(request.Dashboard), true
+		before := size
+		size = payloadSize(request)
+		fmt.Printf("Minified dashboard %s from %d to %d bytes\n", name, before, size)
+	}
+	if maxBodySize > 0 && size > maxBodySize {
+		if len(cfg.Minify) == 0 {
+			return statusMessage{}, &tooLargeError{size: size, limit: maxBodySize}
+		}
+		if minify(); size > maxBodySize {
+			return statusMessage{}, &tooLargeError{size: size, limit: maxBodySize, minified: true}
+		}
+	}
+
+	status, err := client.SetRawDashboardWithParam(ctx, request)
+	apiErr, ok := asAPIError(err)
+	if !ok || apiErr.StatusCode != http.StatusRequestEntityTooLarge {
+		return status, err
+	}
+	if minified || len(cfg.Minify) == 0 {
+		return status, &tooLargeError{size: size, minified: minified}
+	}
+	minify()
+	status, err = client.SetRawDashboardWithParam(ctx, request)
+	if apiErr, ok := asAPIError(err); ok && apiErr.StatusCode == http.StatusRequestEntityTooLarge {
+		return status, &tooLargeError{size: size, minified: true}
+	}
+	return status, err
+}
+
+// payloadSize returns the size of the request body saving a dashboard.
+func payloadSize(request rawBoardRequest) int {
+	body, _ := json.Marshal(dashboardSaveBody(request))
+	return len(body)
+}
+
+// minifyDashboard applies the minify steps of the configuration file to a
+// dashboard given as JSON, returning it unchanged when it can't be decoded.
+func minifyDashboard(data []byte) []byte {
+	var dashboard map[string]interface{}
+	if err := json.Unmarshal(data, &dashboard); err != nil {
+		return data
+	}
+	for _, step := range minifySteps {
+		if stringList(cfg.Minify).contains(step.name) {
+			step.apply(dashboard)
+		}
+	}
+	minified, err := json.Marshal(dashboard)
+	if err != nil {
+		return data
+	}
+	return minified
+}
+
+// stripPanelDescriptions removes the descriptions of every panel, shown in
+// the tooltip of their title.
+func stripPanelDescriptions(dashboard map[string]interface{}) {
+	for _, panel := range dashboardPanels(dashboard) {
+		delete(panel, "description")
+	}
+}
+
+// collapseRepeatedRows removes the copies Grafana saves of repeated rows and
+// panels, leaving the row or panel they repeat, which Grafana repeats again
+// when the dashboard is loaded.
+func collapseRepeatedRows(dashboard map[string]interface{}) {
+	dropRepeats(dashboard, "panels", "repeatPanelId")
+	for _, panel := range dashboardPanels(dashboard) {
+		dropRepeats(panel, "panels", "repeatPanelId")
+	}
+	// Dashboards of schema versions before 16 keep panels in rows
+	dropRepeats(dashboard, "rows", "repeatRowId")
+	rows, _ := dashboard["rows"].([]interface{})
+	for _, r := range rows {
+		if row, ok := r.(map[string]interface{}); ok {
+			dropRepeats(row, "panels", "repeatPanelId")
+		}
+	}
+}
+
+// dropRepeats removes from the list of panels or rows under key the copies
+// marked by the given field.
+func dropRepeats(parent map[string]interface{}, key, marker string) {
+	list, ok := parent[key].([]interface{})
+	if !ok {
+		return
+	}
+	kept := make([]interface{}, 0, len(list))
+	for _, item := range list {
+		if m, ok := item.(map[string]interface{}); ok && m[marker] != nil {
+			continue
+		}
+		kept = append(kept, item)
+	}
+	parent[key] = kept
+}
@@ -0,0 +1,228 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// permissionsSuffix names the sidecar file holding the permissions of a
+// dashboard, e.g. "my-dashboard.permissions.json" next to "my-dashboard.json".
+const permissionsSuffix = ".permissions.json"
+
+// permissionItem is one entry of a permissions sidecar file. Exactly one of
+// Role, Team or User names who the permission is granted to. Team and user
+// names may contain ${VAR} placeholders resolved from the environment.
+type permissionItem struct {
+	Role       string `json:"role,omitempty" yaml:"role"`
+	Team       string `json:"team,omitempty" yaml:"team"`
+	User       string `json:"user,omitempty" yaml:"user"`
+	Permission int    `json:"permission" yaml:"permission"`
+}
+
+// permissionsFile returns the sidecar path for a dashboard file.
+func permissionsFile(dashboardFile string) string {
+	name := strings.TrimSuffix(dashboardFile, composeSuffix)
+	return strings.TrimSuffix(name, ".json") + permissionsSuffix
+}
+
+// loadPermissions reads a sidecar file and resolves its placeholders.
+func loadPermissions(path string) ([]permissionItem, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var items []permissionItem
+	if err := json.Unmarshal(data, &items); err != nil {
+		return nil, err
+	}
+	if err := expandPermissions(items); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+// loadPermissionsByKey reads a permissions file holding the entries of
+// several resources, by folder UID or datasource name, and resolves its
+// placeholders.
+func loadPermissionsByKey(path string) (map[string][]permissionItem, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var permissions map[string][]permissionItem
+	if err := json.Unmarshal(data, &permissions); err != nil {
+		return nil, err
+	}
+	for _, items := range permissions {
+		if err := expandPermissions(items); err != nil {
+			return nil, err
+		}
+	}
+	return permissions, nil
+}
+
+// expandPermissions resolves the placeholders of permission entries.
+func expandPermissions(items []permissionItem) error {
+	for i := range items {
+		for _, field := range []*string{&items[i].Role, &items[i].Team, &items[i].User} {
+			var err error
+			if *field, err = expandPlaceholders(*field); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// expandPlaceholders replaces ${VAR} references with environment values and
+// fails on variables that are not set, so a missing team mapping is never
+// silently turned into an empty name.
+func expandPlaceholders(s string) (string, error) {
+	var missing []string
+	expanded := os.Expand(s, func(name string) string {
+		value, ok := os.LookupEnv(name)
+		if !ok {
+			missing = append(missing, name)
+		}
+		return value
+	})
+	if len(missing) > 0 {
+		return "", fmt.Errorf("unresolved placeholders in %q: %s", s, strings.Join(missing, ", "))
+	}
+	return expanded, nil
+}
+
+// pushDashboardPermissions replaces the permissions of a dashboard with the
+// given items, translating team and user names to IDs of the target instance.
+func pushDashboardPermissions(ctx context.Context, uid string, items []permissionItem) error {
+	return pushPermissions(ctx, fmt.Sprintf("/api/dashboards/uid/%s/permissions", url.PathEscape(uid)), items)
+}
+
+// pushPermissions replaces the permissions at the permissions endpoint of a
+// dashboard or a folder.
+func pushPermissions(ctx context.Context, path string, items []permissionItem) error {
+	var resolved []map[string]interface{}
+	for _, item := range items {
+		entry, err := resolvePermission(ctx, item, "role")
+		if err != nil {
+			return err
+		}
+		resolved = append(resolved, entry)
+	}
+
+	body, _ := json.Marshal(map[string]interface{}{"items": resolved})
+	_, err := apiRequest(ctx, "POST", path, body)
+	return err
+}
+
+// resolvePermission returns the API form of a permission entry, with the
+// role under roleKey and the team or user by ID on the target instance.
+func resolvePermission(ctx context.Context, item permissionItem, roleKey string) (map[string]interface{}, error) {
+	entry := map[string]interface{}{"permission": item.Permission}
+	switch {
+	case item.Role != "":
+		entry[roleKey] = item.Role
+	case item.Team != "":
+		id, err := lookupTeamID(ctx, item.Team)
+		if err != nil {
+			return nil, err
+		}
+		entry["teamId"] = id
+	case item.User != "":
+		id, err := lookupUserID(ctx, item.User)
+		if err != nil {
+			return nil, err
+		}
+		entry["userId"] = id
+	default:
+		return nil, fmt.Errorf("permission entry without role, team or user")
+	}
+	return entry, nil
+}
+
+// dashboardPermissions returns the permissions set on a dashboard itself,
+// as sidecar entries. Permissions inherited from the folder are left out, as
+// they are restored with the folder, and so is the Admin role, which always
+// has full access.
+func dashboardPermissions(ctx context.Context, uid string) ([]permissionItem, error) {
+	return ownPermissions(ctx, fmt.Sprintf("/api/dashboards/uid/%s/permissions", url.PathEscape(uid)))
+}
+
+// ownPermissions returns the entries of a permissions endpoint that aren't
+// inherited, leaving out the Admin role.
+func ownPermissions(ctx context.Context, path string) ([]permissionItem, error) {
+	var entries []effectivePermission
+	if err := getJSON(ctx, path, &entries); err != nil {
+		return nil, err
+	}
+	var items []permissionItem
+	for _, e := range entries {
+		if e.Inherited || e.Role == "Admin" {
+			continue
+		}
+		items = append(items, permissionItem{Role: e.Role, Team: e.Team, User: e.UserLogin, Permission: e.Permission})
+	}
+	return items, nil
+}
+
+// pullDashboardPermissions saves the permissions of a dashboard in the
+// sidecar of its file, and removes a stale sidecar when the dashboard only
+// has inherited permissions.
+func pullDashboardPermissions(ctx context.Context, uid, dashboardFile string) error {
+	items, err := dashboardPermissions(ctx, uid)
+	if err != nil {
+		return err
+	}
+	path := permissionsFile(dashboardFile)
+	if len(items) == 0 {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+	data, err := json.MarshalIndent(items, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+func lookupTeamID(ctx context.Context, name string) (int, error) {
+	var result struct {
+		Teams []struct {
+			ID   int    `json:"id"`
+			Name string `json:"name"`
+		} `json:"teams"`
+	}
+	if err := getJSON(ctx, "/api/teams/search?name="+url.QueryEscape(name), &result); err != nil {
+		return 0, err
+	}
+	for _, t := range result.Teams {
+		if t.Name == name {
+			return t.ID, nil
+		}
+	}
+	return 0, fmt.Errorf("team not found: %s", name)
+}
+
+func lookupUserID(ctx context.Context, login string) (int, error) {
+	var users []struct {
+		UserID int    `json:"userId"`
+		Login  string `json:"login"`
+		Email  string `json:"email"`
+	}
+	if err := getJSON(ctx, "/api/org/users/lookup?query="+url.QueryEscape(login), &users); err != nil {
+		return 0, err
+	}
+	for _, u := range users {
+		if u.Login == login || u.Email == login {
+			return u.UserID, nil
+		}
+	}
+	return 0, fmt.Errorf("user not found: %s", login)
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/url"
+	"sort"
+)
+
+// permissionLevels are the names of Grafana permission values, as used by
+// the permission policy.
+var permissionLevels = map[string]int{
+	"None":  0,
+	"View":  1,
+	"Edit":  2,
+	"Admin": 4,
+}
+
+// permissionPolicy is the highest permission a dashboard may grant, per
+// organization role, team or user login. Default applies to teams and users
+// not listed; roles not listed are not restricted.
+type permissionPolicy struct {
+	Roles   map[string]string `yaml:"roles"`
+	Teams   map[string]string `yaml:"teams"`
+	Users   map[string]string `yaml:"users"`
+	Default string            `yaml:"default"`
+}
+
+// effectivePermission is an entry of the permissions of a dashboard,
+// including the ones inherited from its folder.
+type effectivePermission struct {
+	Role           string `json:"role"`
+	Team           string `json:"team"`
+	UserLogin      string `json:"userLogin"`
+	Permission     int    `json:"permission"`
+	PermissionName string `json:"permissionName"`
+	Inherited      bool   `json:"inherited"`
+}
+
+// allowed returns who an entry grants the permission to and the level the
+// policy allows them, -1 when unrestricted.
+func (p permissionPolicy) allowed(e effectivePermission) (string, int) {
+	limit := func(levels map[string]string, name, fallback string) int {
+		level, ok := levels[name]
+		if !ok {
+			level = fallback
+		}
+		if level == "" {
+			return -1
+		}
+		return permissionLevels[level]
+	}
+	switch {
+	case e.Role != "":
+		return "role:" + e.Role, limit(p.Roles, e.Role, "")
+	case e.Team != "":
+		return "team:" + e.Team, limit(p.Teams, e.Team, p.Default)
+	default:
+		return "user:" + e.UserLogin, limit(p.Users, e.UserLogin, p.Default)
+	}
+}
+
+// validatePermissionPolicy checks the levels used in the policy.
+func validatePermissionPolicy(p permissionPolicy) error {
+	for _, levels := range []map[string]string{p.Roles, p.Teams, p.Users, {"default": p.Default}} {
+		for name, level := range levels {
+			if _, ok := permissionLevels[level]; !ok && level != "" {
+				return fmt.Errorf("invalid permission %q for %s, must be None, View, Edit or Admin", level, name)
+			}
+		}
+	}
+	return nil
+}
+
+// reportPermissions lists the effective permissions of every dashboard of
+// the instance, folder permissions included, and flags the entries granting
+// more than the permissionPolicy of the configuration file, for access
+// reviews.
+func reportPermissions(ctx context.Context) {
+	policy := cfg.PermissionPolicy
+	if err := validatePermissionPolicy(policy); err != nil {
+		log.Fatalf("Error in permissionPolicy: %v", err)
+	}
+
+	dashboards, err := client.Search(ctx, searchType(searchTypeDashboard))
+	if err != nil {
+		log.Fatalf("Error searching dashboards: %s", describeError(err))
+	}
+	sort.Slice(dashboards, func(i, j int) bool { return dashboards[i].Title < dashboards[j].Title })
+
+	header := []string{"dashboard_uid", "dashboard", "folder", "grantee", "permission", "inherited", "violation"}
+	var rows [][]string
+	for _, db := range dashboards {
+		if stopped(ctx) {
+			break
+		}
+		endpoint := fmt.Sprintf("%s/api/dashboards/uid/%s/permissions", baseURL, url.PathEscape(db.UID))
+		data, status, err := doRequest(ctx, "GET", endpoint, nil)
+		if err == nil && status >= 400 {
+			err = newAPIError(status, data)
+		}
+		var entries []effectivePermission
+		if err == nil {
+			err = json.Unmarshal(data, &entries)
+		}
+		if err != nil {
+			log.Printf("Error reading permissions of dashboard %s: %s", db.UID, describeError(err))
+			continue
+		}
+
+		folderTitle := db.FolderTitle
+		if db.FolderUID == "" {
+			folderTitle = generalFolder
+		}
+		for _, e := range entries {
+			grantee, limit := policy.allowed(e)
+			var violation string
+			if limit >= 0 && e.Permission > limit {
+				violation = "exceeds policy"
+			}
+			rows = append(rows, []string{db.UID, db.Title, folderTitle, grantee, e.PermissionName, fmt.Sprint(e.Inherited), violation})
+		}
+	}
+	writeReport(header, rows)
+}
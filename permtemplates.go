@@ -0,0 +1,97 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"text/template"
+)
+
+// folderPermissionRule applies a permission template of the configuration
+// file to the folders whose title matches a regular expression. The named
+// groups of the expression, such as (?P<team>.+), can be used in the
+// template as {{.team}}, along with {{.Title}} and {{.UID}} of the folder.
+type folderPermissionRule struct {
+	Match    string `yaml:"match"`
+	Template string `yaml:"template"`
+}
+
+// folderPermissionPatterns are the compiled expressions of the
+// folderPermissions rules, in the same order.
+var folderPermissionPatterns []*regexp.Regexp
+
+// checkPermissionTemplates compiles the folderPermissions rules and rejects
+// unknown templates and invalid template entries.
+func checkPermissionTemplates() error {
+	for name, items := range cfg.PermissionTemplates {
+		for i, item := range items {
+			if _, err := renderPermission(item, nil); err != nil {
+				return fmt.Errorf("template %s, entry %d: %v", name, i+1, err)
+			}
+		}
+	}
+	folderPermissionPatterns = nil
+	for i, rule := range cfg.FolderPermissions {
+		pattern, err := regexp.Compile(rule.Match)
+		if err != nil {
+			return fmt.Errorf("rule %d: %v", i+1, err)
+		}
+		if _, ok := cfg.PermissionTemplates[rule.Template]; !ok {
+			return fmt.Errorf("rule %d: unknown template %q", i+1, rule.Template)
+		}
+		folderPermissionPatterns = append(folderPermissionPatterns, pattern)
+	}
+	return nil
+}
+
+// templatePermissions returns the permissions of the template of the first
+// folderPermissions rule matching the title of a folder, and the name of
+// the template. The name is empty when no rule matches.
+func templatePermissions(f folderInfo) ([]permissionItem, string, error) {
+	for i, pattern := range folderPermissionPatterns {
+		match := pattern.FindStringSubmatch(f.Title)
+		if match == nil {
+			continue
+		}
+		fields := map[string]string{"Title": f.Title, "UID": f.UID}
+		for j, group := range pattern.SubexpNames() {
+			if group != "" {
+				fields[group] = match[j]
+			}
+		}
+		name := cfg.FolderPermissions[i].Template
+		var items []permissionItem
+		for _, item := range cfg.PermissionTemplates[name] {
+			rendered, err := renderPermission(item, fields)
+			if err != nil {
+				return nil, name, err
+			}
+			items = append(items, rendered)
+		}
+		if err := expandPermissions(items); err != nil {
+			return nil, name, err
+		}
+		return items, name, nil
+	}
+	return nil, "", nil
+}
+
+// renderPermission executes the role, team and user of a template entry with
+// the fields of a folder.
+func renderPermission(item permissionItem, fields map[string]string) (permissionItem, error) {
+	for _, field := range []*string{&item.Role, &item.Team, &item.User} {
+		t, err := template.New("permission").Option("missingkey=error").Parse(*field)
+		if err != nil {
+			return item, err
+		}
+		if fields == nil {
+			continue
+		}
+		var b strings.Builder
+		if err := t.Execute(&b, fields); err != nil {
+			return item, err
+		}
+		*field = b.String()
+	}
+	return item, nil
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+)
+
+// playlist is a playlist as stored in playlists/playlists.json. Playlists
+// are matched by UID.
+type playlist struct {
+	UID      string         `json:"uid,omitempty"`
+	Name     string         `json:"name"`
+	Interval string         `json:"interval"`
+	Items    []playlistItem `json:"items"`
+}
+
+// playlistItem is a dashboard of a playlist, by UID or by tag. Dashboards
+// given by ID are converted to UIDs on pull, since IDs differ between
+// instances. The title of the dashboard is kept with its UID, to find the
+// dashboard on instances where it has another UID.
+type playlistItem struct {
+	Type  string `json:"type"`
+	Value string `json:"value"`
+	Title string `json:"title,omitempty"`
+}
+
+const (
+	playlistItemByUID = "dashboard_by_uid"
+	playlistItemByID  = "dashboard_by_id"
+)
+
+func (p playlist) validate() error {
+	switch {
+	case p.Name == "":
+		return errors.New("has no name")
+	case p.Interval == "":
+		return errors.New("has no interval")
+	}
+	for _, item := range p.Items {
+		if item.Type == "" || item.Value == "" {
+			return errors.New("has an item without type or value")
+		}
+	}
+	return nil
+}
+
+// pullPlaylists saves the playlists of the instance. The playlists file is
+// left as it is when a playlist can't be fetched, so that it isn't lost.
+func pullPlaylists(ctx context.Context) {
+	fmt.Println("Pulling playlists...")
+	var list []playlist
+	if err := getJSON(ctx, "/api/playlists", &list); err != nil {
+		pullFailed(ctx, "playlists", "fetching playlists", err)
+		return
+	}
+	boards, err := client.Search(ctx, searchType(searchTypeDashboard))
+	if err != nil {
+		pullFailed(ctx, "playlists", "searching the dashboards of playlists", err)
+		return
+	}
+	byUID := make(map[string]foundBoard, len(boards))
+	byID := make(map[string]foundBoard, len(boards))
+	for _, b := range boards {
+		byUID[b.UID] = b
+		byID[fmt.Sprint(b.ID)] = b
+	}
+
+	pulled := []playlist{}
+	complete := true
+	for _, p := range list {
+		if stopped(ctx) {
+			return
+		}
+		if !included("playlists", p.Name) {
+			continue
+		}
+		if err := getJSON(ctx, "/api/playlists/"+url.PathEscape(p.UID), &p); err != nil {
+			log.Printf("Error fetching playlist %s: %s", p.Name, describeError(err))
+			summary.add("playlists", outcomeFailed, p.Name)
+			complete = false
+			continue
+		}
+		for i, item := range p.Items {
+			var board foundBoard
+			var ok bool
+			switch item.Type {
+			case playlistItemByID:
+				board, ok = byID[item.Value]
+			case playlistItemByUID:
+				board, ok = byUID[item.Value]
+			default:
+				continue
+			}
+			if !ok {
+				log.Printf("Warning: playlist %s has a missing dashboard %s", p.Name, item.Value)
+				continue
+			}
+			p.Items[i] = playlistItem{Type: playlistItemByUID, Value: board.UID, Title: board.Title}
+		}
+		pulled = append(pulled, p)
+	}
+	if !complete {
+		fmt.Println("Playlists file left unchanged, since some playlists could not be fetched")
+		return
+	}
+	if err := writePulledResources(directory, "playlists", pulled); err != nil {
+		fmt.Println("Error saving playlists:", err)
+		return
+	}
+	fmt.Println("Saved playlists")
+}
+
+// pushPlaylists creates or updates the local playlists. Dashboards of
+// playlist items that don't exist on the instance are looked up by title,
+// so that playlists keep working where dashboards have other UIDs.
+func pushPlaylists(ctx context.Context) {
+	fmt.Println("Pushing playlists...")
+	var list []playlist
+	if err := readResources(directory, "playlists", &list); err != nil {
+		fmt.Println("Error reading playlists file:", err)
+		return
+	}
+
+	failAll := func(what string, err error) {
+		log.Printf("Error %s: %s", what, describeError(err))
+		for _, p := range list {
+			if included("playlists", p.Name) {
+				summary.add("playlists", outcomeFailed, p.Name)
+			}
+		}
+	}
+	boards, err := client.Search(ctx, searchType(searchTypeDashboard))
+	if err != nil {
+		failAll("searching dashboards", err)
+		return
+	}
+	uids := make(map[string]bool, len(boards))
+	byTitle := make(map[string][]string)
+	for _, b := range boards {
+		uids[b.UID] = true
+		byTitle[b.Title] = append(byTitle[b.Title], b.UID)
+	}
+	var existing []playlist
+	if err := getJSON(ctx, "/api/playlists", &existing); err != nil {
+		failAll("fetching playlists", err)
+		return
+	}
+	exists := make(map[string]bool, len(existing))
+	for _, p := range existing {
+		exists[p.UID] = true
+	}
+
+	for _, p := range list {
+		if stopped(ctx) {
+			break
+		}
+		if !included("playlists", p.Name) {
+			continue
+		}
+		for i, item := range p.Items {
+			if item.Type != playlistItemByUID || uids[item.Value] {
+				continue
+			}
+			if matches := byTitle[item.Title]; len(matches) == 1 {
+				fmt.Printf("Playlist %s: dashboard %s is %s on the instance\n", p.Name, item.Title, matches[0])
+				p.Items[i].Value = matches[0]
+				continue
+			}
+			log.Printf("Warning: playlist %s: dashboard %s (%s) not found on the instance", p.Name, item.Title, item.Value)
+		}
+		for i := range p.Items {
+			p.Items[i].Title = ""
+		}
+
+		var pushed playlist
+		body, err := pushPayload("playlists", p, &pushed)
+		if err != nil {
+			fmt.Printf("Error preparing playlist %s: %v\n", p.Name, err)
+			summary.add("playlists", outcomeFailed, p.Name)
+			continue
+		}
+		method, endpoint := "POST", "/api/playlists"
+		if pushed.UID != "" && exists[pushed.UID] {
+			method, endpoint = "PUT", endpoint+"/"+url.PathEscape(pushed.UID)
+		}
+		if _, err := apiRequest(ctx, method, endpoint, body); err != nil {
+			log.Printf("Error pushing playlist %s: %s", pushed.Name, describeError(err))
+			summary.add("playlists", outcomeFailed, pushed.Name)
+			continue
+		}
+		printChange("Uploaded playlist: %s\n", pushed.Name)
+		summary.add("playlists", outcomePushed, pushed.Name)
+	}
+}
@@ -0,0 +1,269 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// alertLabels are the sample label sets of the routing report, as
+// key=value pairs separated by commas.
+var alertLabels stringList
+
+// policiesFile is the notification policy tree of a directory, as returned
+// by /api/v1/provisioning/policies.
+var policiesFile = filepath.Join("alerting", "policies.json")
+
+// policyRoute is a node of a notification policy tree. Routes without a
+// receiver inherit the one of their parent.
+type policyRoute struct {
+	Receiver       string         `json:"receiver,omitempty"`
+	ObjectMatchers [][]string     `json:"object_matchers,omitempty"`
+	Matchers       []string       `json:"matchers,omitempty"`
+	Continue       bool           `json:"continue,omitempty"`
+	Routes         []*policyRoute `json:"routes,omitempty"`
+}
+
+// labelMatcher is a matcher of a route: a label name, an operator among =,
+// !=, =~ and !~, and a value or regular expression.
+type labelMatcher struct {
+	name, op, value string
+	re              *regexp.Regexp
+}
+
+var matcherString = regexp.MustCompile(`^\s*([^=!~\s]+)\s*(=~|!~|!=|=)\s*(.*?)\s*$`)
+
+// matchers returns the matchers of a route, from object_matchers or from
+// the matchers strings, such as severity=~"critical|warning".
+func (r *policyRoute) matchers() ([]labelMatcher, error) {
+	var parts [][]string
+	parts = append(parts, r.ObjectMatchers...)
+	for _, s := range r.Matchers {
+		m := matcherString.FindStringSubmatch(s)
+		if m == nil {
+			return nil, fmt.Errorf("invalid matcher %q", s)
+		}
+		parts = append(parts, []string{m[1], m[2], strings.Trim(m[3], `"`)})
+	}
+
+	matchers := make([]labelMatcher, 0, len(parts))
+	for _, p := range parts {
+		if len(p) != 3 {
+			return nil, fmt.Errorf("invalid matcher %q", p)
+		}
+		m := labelMatcher{name: p[0], op: p[1], value: p[2]}
+		switch m.op {
+		case "=", "!=":
+		case "=~", "!~":
+			re, err := regexp.Compile("^(?:" + m.value + ")$")
+			if err != nil {
+				return nil, fmt.Errorf("invalid matcher %q: %v", p, err)
+			}
+			m.re = re
+		default:
+			return nil, fmt.Errorf("invalid matcher operator %q", m.op)
+		}
+		matchers = append(matchers, m)
+	}
+	return matchers, nil
+}
+
+// matches reports whether labels match, missing labels being empty.
+func (m labelMatcher) matches(labels map[string]string) bool {
+	value := labels[m.name]
+	switch m.op {
+	case "=":
+		return value == m.value
+	case "!=":
+		return value != m.value
+	case "=~":
+		return m.re.MatchString(value)
+	default:
+		return !m.re.MatchString(value)
+	}
+}
+
+func (m labelMatcher) String() string {
+	return m.name + m.op + m.value
+}
+
+// routeMatch is a route selected for an alert: its receiver and the matchers
+// of the routes leading to it.
+type routeMatch struct {
+	receiver string
+	path     []string
+}
+
+// routeAlert returns the routes an alert with the given labels is sent to,
+// like Alertmanager: the first matching child route is followed, and the
+// ones after it too while the matching routes have continue set. An alert
+// matching no child route stays on the parent.
+func routeAlert(r *policyRoute, receiver string, path []string, labels map[string]string) ([]routeMatch, error) {
+	if r.Receiver != "" {
+		receiver = r.Receiver
+	}
+	var matches []routeMatch
+	for _, child := range r.Routes {
+		matchers, err := child.matchers()
+		if err != nil {
+			return nil, err
+		}
+		matched := true
+		for _, m := range matchers {
+			if !m.matches(labels) {
+				matched = false
+				break
+			}
+		}
+		if !matched {
+			continue
+		}
+
+		var step []string
+		for _, m := range matchers {
+			step = append(step, m.String())
+		}
+		childPath := append(append([]string{}, path...), strings.Join(step, ","))
+		found, err := routeAlert(child, receiver, childPath, labels)
+		if err != nil {
+			return nil, err
+		}
+		matches = append(matches, found...)
+		if !child.Continue {
+			break
+		}
+	}
+	if len(matches) == 0 {
+		matches = []routeMatch{{receiver: receiver, path: path}}
+	}
+	return matches, nil
+}
+
+// sampleLabels derives a label set from the equality matchers leading to
+// every route of a tree, so that each route gets exercised without listing
+// samples by hand.
+func sampleLabels(r *policyRoute, labels map[string]string, samples map[string]map[string]string) error {
+	for _, child := range r.Routes {
+		matchers, err := child.matchers()
+		if err != nil {
+			return err
+		}
+		sample := make(map[string]string, len(labels))
+		for k, v := range labels {
+			sample[k] = v
+		}
+		for _, m := range matchers {
+			if m.op == "=" {
+				sample[m.name] = m.value
+			}
+		}
+		samples[formatLabels(sample)] = sample
+		if err := sampleLabels(child, sample, samples); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func parseLabels(s string) (map[string]string, error) {
+	labels := make(map[string]string)
+	for _, pair := range strings.Split(s, ",") {
+		key, value, ok := strings.Cut(pair, "=")
+		if !ok || strings.TrimSpace(key) == "" {
+			return nil, fmt.Errorf("invalid label %q, expected key=value", pair)
+		}
+		labels[strings.TrimSpace(key)] = strings.TrimSpace(value)
+	}
+	return labels, nil
+}
+
+func formatLabels(labels map[string]string) string {
+	pairs := make([]string, 0, len(labels))
+	for k, v := range labels {
+		pairs = append(pairs, k+"="+v)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+func formatRoutes(matches []routeMatch) (string, string) {
+	var receivers, paths []string
+	for _, m := range matches {
+		receivers = append(receivers, m.receiver)
+		path := "root"
+		if len(m.path) > 0 {
+			path += " / " + strings.Join(m.path, " / ")
+		}
+		paths = append(paths, path)
+	}
+	return strings.Join(receivers, ";"), strings.Join(paths, ";")
+}
+
+// reportRouting simulates the routing of sample alerts through the
+// notification policy tree of the instance and through the local one, and
+// lists for each sample the contact points selected before and after
+// pushing the local tree. Samples come from -alert-labels, or else from the
+// matchers of both trees.
+func reportRouting(ctx context.Context) {
+	var local policyRoute
+	data, err := os.ReadFile(filepath.Join(directory, policiesFile))
+	if err == nil {
+		err = json.Unmarshal(data, &local)
+	}
+	if err != nil {
+		log.Fatalf("Error reading notification policies: %v", err)
+	}
+	var remote policyRoute
+	data = sendRequest(ctx, "GET", baseURL+"/api/v1/provisioning/policies", nil)
+	if err := json.Unmarshal(data, &remote); err != nil {
+		log.Fatalf("Error unmarshalling notification policies: %v", err)
+	}
+
+	samples := make(map[string]map[string]string)
+	for _, s := range alertLabels {
+		labels, err := parseLabels(s)
+		if err != nil {
+			log.Fatalf("Error: %v", err)
+		}
+		samples[formatLabels(labels)] = labels
+	}
+	if len(samples) == 0 {
+		for _, tree := range []*policyRoute{&remote, &local} {
+			if err := sampleLabels(tree, map[string]string{}, samples); err != nil {
+				log.Fatalf("Error in notification policies: %v", err)
+			}
+		}
+	}
+	keys := make([]string, 0, len(samples))
+	for key := range samples {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	header := []string{"labels", "before", "before_route", "after", "after_route", "changed"}
+	var rows [][]string
+	for _, key := range keys {
+		before, err := routeAlert(&remote, "", nil, samples[key])
+		if err != nil {
+			log.Fatalf("Error in remote notification policies: %v", err)
+		}
+		after, err := routeAlert(&local, "", nil, samples[key])
+		if err != nil {
+			log.Fatalf("Error in local notification policies: %v", err)
+		}
+		beforeReceivers, beforeRoutes := formatRoutes(before)
+		afterReceivers, afterRoutes := formatRoutes(after)
+		changed := ""
+		if beforeReceivers != afterReceivers {
+			changed = "yes"
+		}
+		rows = append(rows, []string{key, beforeReceivers, beforeRoutes, afterReceivers, afterRoutes, changed})
+	}
+	writeReport(header, rows)
+}
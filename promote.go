@@ -0,0 +1,95 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+)
+
+var (
+	// assumeYes promotes without asking for confirmation.
+	assumeYes bool
+	// pushMessage is saved as the version message of the pushed dashboards.
+	pushMessage string
+)
+
+// promote copies the dashboards of -folder from the instance of the -from
+// profile to the instance of the -to profile. The dashboards are pulled into
+// a temporary directory and pushed like local files, so that the transforms,
+// URL rewrites, UID aliases and watermark of the target apply, after the
+// changes have been shown and confirmed. The pushed versions are saved with a
+// message naming the source profile.
+func promote(ctx context.Context) {
+	fromProfile, toProfile := annotationsFrom, annotationsTo
+	if fromProfile == "" || toProfile == "" || folder == "" {
+		log.Fatalf("Error: promote requires -from, -to and -folder")
+	}
+	source, err := resolveProfile(fromProfile)
+	if err != nil {
+		log.Fatalf("Error in -from: %v", err)
+	}
+	target, err := resolveProfile(toProfile)
+	if err != nil {
+		log.Fatalf("Error in -to: %v", err)
+	}
+
+	tmp, err := os.MkdirTemp("", "grafana-sync-promote-")
+	if err != nil {
+		log.Fatalf("Error creating temporary directory: %v", err)
+	}
+	defer os.RemoveAll(tmp)
+	baseDir := directory
+	directory = tmp
+	defer func() { directory = baseDir }()
+
+	fmt.Printf("Pulling folder %s from %s (%s)\n", folder, fromProfile, source.URL)
+	connect(source.URL, source.APIKey)
+	sourceFolder, err := findFolder(ctx, folder)
+	if err != nil {
+		log.Fatalf("Error: %s", describeError(err))
+	}
+	pullDashboards(ctx)
+	if stopped(ctx) {
+		return
+	}
+
+	if err := useWatermark(target); err != nil {
+		log.Fatalf("Error in profile %s: %v", toProfile, err)
+	}
+	connect(target.URL, target.APIKey)
+	drifts, err := checkDrift(ctx)
+	if err != nil {
+		log.Fatalf("Error comparing dashboards with %s: %s", toProfile, describeError(err))
+	}
+	if len(drifts) == 0 {
+		fmt.Printf("Nothing to promote: folder %s is the same on %s\n", folder, toProfile)
+		return
+	}
+	text, _ := diffSummary(drifts)
+	fmt.Print(text)
+	if !assumeYes && !confirm(fmt.Sprintf("Promote %d change(s) from %s to %s?", len(drifts), fromProfile, toProfile)) {
+		fmt.Println("Promotion cancelled")
+		return
+	}
+
+	if err := ensureFolder(ctx, sourceFolder); err != nil {
+		log.Fatalf("Error creating folder %s on %s: %s", folder, toProfile, describeError(err))
+	}
+	lookups.reset()
+	pushMessage = fmt.Sprintf("Promoted from %s by grafana-sync", fromProfile)
+	pushDashboards(ctx)
+}
+
+// confirm asks a yes or no question on the terminal, defaulting to no.
+func confirm(question string) bool {
+	fmt.Printf("%s [y/N] ", question)
+	answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	switch strings.ToLower(strings.TrimSpace(answer)) {
+	case "y", "yes":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,400 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+var (
+	// prune deletes the remote resources missing locally after a push.
+	prune      bool
+	pruneScope string
+	// pruneKinds lists, comma-separated, the resource kinds -prune deletes.
+	pruneKinds string
+)
+
+// Outcome recorded for remote resources deleted by -prune.
+const outcomePruned = "pruned"
+
+// pruneActions push resources and can prune the remote ones afterwards.
+var pruneActions = map[string]bool{
+	"push":             true,
+	"push-dashboards":  true,
+	"push-datasources": true,
+	"push-folders":     true,
+}
+
+// prunableKinds are the resource kinds -prune-kinds accepts.
+var prunableKinds = []string{"dashboards", "datasources", "folders"}
+
+// pruning reports whether -prune deletes the remote resources of a kind.
+func pruning(kind string) bool {
+	if !prune {
+		return false
+	}
+	for _, k := range strings.Split(pruneKinds, ",") {
+		if strings.TrimSpace(k) == kind {
+			return true
+		}
+	}
+	return false
+}
+
+// pruneTerm is a condition of -prune-scope, as key=value. The manifest term
+// has no value.
+type pruneTerm struct {
+	key, value string
+}
+
+var pruneTerms []pruneTerm
+
+var pruneAnd = regexp.MustCompile(`\s+AND\s+`)
+
+// parsePruneScope parses -prune-scope, terms joined with AND, and adds the
+// folder of -folder and the tags of -tag, so that a push to a folder or of
+// tagged dashboards only prunes those.
+func parsePruneScope() error {
+	if !pruneActions[action] {
+		return fmt.Errorf("prune is not supported by the %s action", action)
+	}
+	for _, kind := range strings.Split(pruneKinds, ",") {
+		if kind = strings.TrimSpace(kind); kind != "" && !stringList(prunableKinds).contains(kind) {
+			return fmt.Errorf("unknown kind %q in -prune-kinds, must be one of %s", kind, strings.Join(prunableKinds, ", "))
+		}
+	}
+	pruneTerms = nil
+	if scope := strings.TrimSpace(pruneScope); scope != "" {
+		for _, term := range pruneAnd.Split(scope, -1) {
+			if term == "manifest" {
+				pruneTerms = append(pruneTerms, pruneTerm{key: term})
+				continue
+			}
+			key, value, ok := strings.Cut(term, "=")
+			if !ok || key == "" || value == "" {
+				return fmt.Errorf("invalid prune scope term %q, expected key=value or manifest", term)
+			}
+			pruneTerms = append(pruneTerms, pruneTerm{key: key, value: value})
+		}
+	}
+	if folder != "" {
+		pruneTerms = append(pruneTerms, pruneTerm{key: "folder", value: folder})
+	}
+	for _, tag := range dashboardTags {
+		pruneTerms = append(pruneTerms, pruneTerm{key: "tag", value: tag})
+	}
+	return nil
+}
+
+// inPruneScope reports whether a remote dashboard matches every term of the
+// prune scope. folder matches the folder title, tag a tag of the dashboard
+// and manifest the dashboards recorded in the pull manifest. Any other key
+// matches a key=value or key:value tag, the usual way to label dashboards,
+// such as managed-by=grafana-sync.
+func inPruneScope(board foundBoard, managed map[string]bool) bool {
+	for _, term := range pruneTerms {
+		switch term.key {
+		case "folder":
+			title := board.FolderTitle
+			if title == "" {
+				title = generalFolder
+			}
+			if title != term.value {
+				return false
+			}
+		case "tag":
+			if !stringList(board.Tags).contains(term.value) {
+				return false
+			}
+		case "manifest":
+			if !managed[board.UID] {
+				return false
+			}
+		default:
+			tags := stringList(board.Tags)
+			if !tags.contains(term.key+"="+term.value) && !tags.contains(term.key+":"+term.value) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// pruneDashboards deletes the remote dashboards in the prune scope whose UID
+// matches no local dashboard. Nothing is deleted when a local dashboard can't
+// be read, since its remote copy would be deleted with it. With
+// -uses-datasource-type, only the dashboards the push is limited to are
+// pruned.
+func pruneDashboards(ctx context.Context) {
+	if stopped(ctx) {
+		return
+	}
+	fmt.Println("Pruning dashboards...")
+
+	files, err := dashboardSources()
+	if err != nil {
+		log.Printf("Not pruning dashboards: error reading dashboard directory: %v", err)
+		return
+	}
+	local := make(map[string]bool)
+	for _, path := range files {
+		var dashboard struct {
+			UID string `json:"uid"`
+		}
+		data, err := loadDashboard(path)
+		if err == nil {
+			err = json.Unmarshal(data, &dashboard)
+		}
+		if err != nil {
+			log.Printf("Not pruning dashboards: error loading %s: %v", path, err)
+			return
+		}
+		if dashboard.UID != "" {
+			local[dashboard.UID] = true
+		}
+	}
+	if len(local) == 0 {
+		log.Printf("Not pruning dashboards: no local dashboard has a uid")
+		return
+	}
+
+	var managed map[string]bool
+	for _, term := range pruneTerms {
+		if term.key != "manifest" {
+			continue
+		}
+		m, err := readManifest(directory)
+		if err != nil {
+			log.Printf("Not pruning dashboards: error reading manifest: %v", err)
+			return
+		}
+		managed = make(map[string]bool)
+		// The manifest holds the logical UIDs of -uid-aliases
+		for _, e := range m.Dashboards {
+			managed[environmentUID(e.UID)] = true
+		}
+	}
+
+	boards, err := client.Search(ctx, searchType(searchTypeDashboard))
+	if err != nil {
+		log.Printf("Error searching dashboards to prune: %s", describeError(err))
+		return
+	}
+	pluginOwners, err := pluginDashboards(ctx)
+	if err != nil {
+		log.Printf("Not pruning dashboards: error listing app plugin dashboards: %s", describeError(err))
+		return
+	}
+	for _, board := range boards {
+		if stopped(ctx) {
+			break
+		}
+		if local[board.UID] || !included("dashboards", board.Title) || !uidSelected(board.UID) || !inPruneScope(board, managed) {
+			continue
+		}
+		name := fmt.Sprintf("%s (%s)", board.Title, board.UID)
+		if plugin, ok := pluginOwners[board.UID]; ok {
+			fmt.Printf("Not pruning dashboard %s of app plugin %s\n", name, plugin)
+			continue
+		}
+		if len(usesDatasourceTypes) > 0 {
+			data, _, err := client.GetRawDashboardByUID(ctx, board.UID)
+			var uses bool
+			if err == nil {
+				uses, err = usesDatasourceType(ctx, data)
+			}
+			if err != nil {
+				log.Printf("Error resolving the datasources of dashboard %s: %s", name, describeError(err))
+				summary.add("dashboards", outcomeFailed, name)
+				continue
+			}
+			if !uses {
+				continue
+			}
+		}
+
+		provisioned, err := isProvisioned(ctx, board.UID)
+		if err != nil {
+			log.Printf("Error checking dashboard %s: %s", name, describeError(err))
+			summary.add("dashboards", outcomeFailed, name)
+			continue
+		}
+		if provisioned {
+			fmt.Printf("Not pruning provisioned dashboard %s\n", name)
+			continue
+		}
+
+		if backupBeforePush {
+			if err := backupDashboard(ctx, board.UID); err != nil {
+				log.Printf("Error backing up dashboard %s: %s", name, describeError(err))
+				summary.add("dashboards", outcomeFailed, name)
+				continue
+			}
+		}
+
+		if err := deleteDashboard(ctx, board.UID); err != nil {
+			log.Printf("Error pruning dashboard %s: %s", name, describeError(err))
+			summary.add("dashboards", outcomeFailed, name)
+			continue
+		}
+		printChange("Pruned dashboard: %s\n", name)
+		summary.add("dashboards", outcomePruned, name)
+	}
+}
+
+// deleteDashboard deletes a dashboard by UID.
+func deleteDashboard(ctx context.Context, uid string) error {
+	data, status, err := doRequest(ctx, "DELETE", fmt.Sprintf("%s/api/dashboards/uid/%s", baseURL, url.PathEscape(uid)), nil)
+	if err != nil {
+		return err
+	}
+	if status >= 400 && status != http.StatusNotFound {
+		return newAPIError(status, data)
+	}
+	return nil
+}
+
+// pruneDatasources deletes the remote datasources whose name matches no
+// local datasource. Datasources provisioned from files are read-only and
+// kept. With -folder, the push is limited to a folder and nothing is pruned.
+func pruneDatasources(ctx context.Context, datasources []datasource) {
+	if stopped(ctx) {
+		return
+	}
+	fmt.Println("Pruning datasources...")
+	if folder != "" {
+		fmt.Println("Not pruning datasources: -folder limits the push to a folder")
+		return
+	}
+	local := make(map[string]bool)
+	for _, ds := range datasources {
+		local[ds.Name] = true
+	}
+
+	var remote []struct {
+		UID      string `json:"uid"`
+		Name     string `json:"name"`
+		ReadOnly bool   `json:"readOnly"`
+	}
+	if err := getJSON(ctx, "/api/datasources", &remote); err != nil {
+		log.Printf("Error fetching datasources to prune: %s", describeError(err))
+		return
+	}
+	for _, ds := range remote {
+		if stopped(ctx) {
+			break
+		}
+		if local[ds.Name] || !included("datasources", ds.Name) {
+			continue
+		}
+		if ds.ReadOnly {
+			fmt.Printf("Not pruning provisioned datasource %s\n", ds.Name)
+			continue
+		}
+		data, status, err := doRequest(ctx, "DELETE", fmt.Sprintf("%s/api/datasources/name/%s", baseURL, url.PathEscape(ds.Name)), nil)
+		if err == nil && status >= 400 && status != http.StatusNotFound {
+			err = newAPIError(status, data)
+		}
+		if err != nil {
+			log.Printf("Error pruning datasource %s: %s", ds.Name, describeError(err))
+			summary.add("datasources", outcomeFailed, ds.Name)
+			continue
+		}
+		printChange("Pruned datasource: %s\n", ds.Name)
+		summary.add("datasources", outcomePruned, ds.Name)
+	}
+}
+
+// pruneFolders deletes the remote folders whose UID matches no local folder.
+// Since deleting a folder deletes what it holds, folders that still hold
+// dashboards or subfolders are kept, and so are the folders holding alert
+// rules, which Grafana refuses to delete. With -folder, the push is limited
+// to a folder and nothing is pruned.
+func pruneFolders(ctx context.Context, folders []folderInfo) {
+	if stopped(ctx) {
+		return
+	}
+	fmt.Println("Pruning folders...")
+	if folder != "" {
+		fmt.Println("Not pruning folders: -folder limits the push to a folder")
+		return
+	}
+	local := make(map[string]bool)
+	for _, f := range folders {
+		if f.UID == "" {
+			log.Printf("Not pruning folders: local folder %s has no uid", f.Title)
+			return
+		}
+		local[environmentUID(f.UID)] = true
+	}
+
+	remote, err := client.GetAllFolders(ctx)
+	if err != nil {
+		log.Printf("Error fetching folders to prune: %s", describeError(err))
+		return
+	}
+	ruleFolders, err := alertRuleFolders(ctx)
+	if err != nil {
+		log.Printf("Not pruning folders: error listing alert rules: %s", describeError(err))
+		return
+	}
+	for _, f := range remote {
+		if stopped(ctx) {
+			break
+		}
+		if local[f.UID] || !included("folders", f.Title) {
+			continue
+		}
+		name := fmt.Sprintf("%s (%s)", f.Title, f.UID)
+		if rules := ruleFolders[f.UID]; rules > 0 {
+			fmt.Printf("Not pruning folder %s: it holds %d alert rule(s)\n", name, rules)
+			continue
+		}
+		content, err := client.Search(ctx, searchFolderUID(f.UID))
+		if err != nil {
+			log.Printf("Error checking folder %s: %s", name, describeError(err))
+			summary.add("folders", outcomeFailed, name)
+			continue
+		}
+		if len(content) > 0 {
+			fmt.Printf("Not pruning folder %s: it holds %d dashboard(s) or folder(s)\n", name, len(content))
+			continue
+		}
+		data, status, err := doRequest(ctx, "DELETE", fmt.Sprintf("%s/api/folders/%s", baseURL, url.PathEscape(f.UID)), nil)
+		if err == nil && status >= 400 && status != http.StatusNotFound {
+			err = newAPIError(status, data)
+		}
+		if err != nil {
+			log.Printf("Error pruning folder %s: %s", name, describeError(err))
+			summary.add("folders", outcomeFailed, name)
+			continue
+		}
+		printChange("Pruned folder: %s\n", name)
+		summary.add("folders", outcomePruned, name)
+	}
+}
+
+// alertRuleFolders counts the alert rules of each folder UID. Instances
+// without unified alerting have none.
+func alertRuleFolders(ctx context.Context) (map[string]int, error) {
+	var rules []struct {
+		FolderUID string `json:"folderUID"`
+	}
+	err := getJSON(ctx, "/api/v1/provisioning/alert-rules", &rules)
+	if apiErr, ok := asAPIError(err); ok && apiErr.StatusCode == http.StatusNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	folders := make(map[string]int)
+	for _, r := range rules {
+		folders[r.FolderUID]++
+	}
+	return folders, nil
+}
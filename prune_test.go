@@ -0,0 +1,111 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestParsePruneScope(t *testing.T) {
+	defer func(a, s, k, f string, tags stringList) {
+		action, pruneScope, pruneKinds, folder, dashboardTags = a, s, k, f, tags
+	}(action, pruneScope, pruneKinds, folder, dashboardTags)
+
+	tests := []struct {
+		action, scope, kinds, folder string
+		tags                         stringList
+		want                         string
+		wantErr                      bool
+	}{
+		{"push-dashboards", "", "dashboards", "", nil, "[]", false},
+		{"push", "managed-by=grafana-sync", "dashboards", "", nil, "[{managed-by grafana-sync}]", false},
+		{"push", "team=ops AND manifest", "dashboards,folders", "", nil, "[{team ops} {manifest }]", false},
+		{"push-dashboards", "  folder=Infra  ", "dashboards", "", nil, "[{folder Infra}]", false},
+		// -folder and -tag narrow the scope to what the push touches
+		{"push-dashboards", "team=ops", "dashboards", "Infra", stringList{"a", "b"}, "[{team ops} {folder Infra} {tag a} {tag b}]", false},
+		{"push-dashboards", "team", "dashboards", "", nil, "", true},
+		{"push-dashboards", "team=", "dashboards", "", nil, "", true},
+		{"push-dashboards", "=ops", "dashboards", "", nil, "", true},
+		{"push-dashboards", "team=ops and folder=Infra", "dashboards", "", nil, "[{team ops and folder=Infra}]", false},
+		{"push-dashboards", "", "dashboards,alerts", "", nil, "", true},
+		{"pull", "", "dashboards", "", nil, "", true},
+		{"push-merged", "", "dashboards", "", nil, "", true},
+	}
+	for _, tt := range tests {
+		action, pruneScope, pruneKinds, folder, dashboardTags = tt.action, tt.scope, tt.kinds, tt.folder, tt.tags
+		err := parsePruneScope()
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("parsePruneScope(%s, %q, %q) = %v, want an error", tt.action, tt.scope, tt.kinds, pruneTerms)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parsePruneScope(%s, %q, %q): %v", tt.action, tt.scope, tt.kinds, err)
+			continue
+		}
+		if got := fmt.Sprint(pruneTerms); got != tt.want {
+			t.Errorf("parsePruneScope(%s, %q, %q) = %s, want %s", tt.action, tt.scope, tt.kinds, got, tt.want)
+		}
+	}
+}
+
+func TestInPruneScope(t *testing.T) {
+	defer func(terms []pruneTerm) { pruneTerms = terms }(pruneTerms)
+
+	board := foundBoard{UID: "cpu", Title: "CPU", FolderTitle: "Infra", Tags: []string{"prod", "managed-by=grafana-sync", "team:ops"}}
+	general := foundBoard{UID: "home", Title: "Home", Tags: []string{"prod"}}
+	managed := map[string]bool{"cpu": true}
+
+	tests := []struct {
+		terms []pruneTerm
+		board foundBoard
+		want  bool
+	}{
+		{nil, board, true},
+		{[]pruneTerm{{"folder", "Infra"}}, board, true},
+		{[]pruneTerm{{"folder", "infra"}}, board, false},
+		{[]pruneTerm{{"folder", "General"}}, general, true},
+		{[]pruneTerm{{"folder", "General"}}, board, false},
+		{[]pruneTerm{{"tag", "prod"}}, board, true},
+		{[]pruneTerm{{"tag", "dev"}}, board, false},
+		{[]pruneTerm{{"manifest", ""}}, board, true},
+		{[]pruneTerm{{"manifest", ""}}, general, false},
+		// Other keys match key=value and key:value tags
+		{[]pruneTerm{{"managed-by", "grafana-sync"}}, board, true},
+		{[]pruneTerm{{"team", "ops"}}, board, true},
+		{[]pruneTerm{{"team", "web"}}, board, false},
+		{[]pruneTerm{{"managed-by", "grafana-sync"}}, general, false},
+		// Every term must match
+		{[]pruneTerm{{"folder", "Infra"}, {"tag", "prod"}, {"team", "ops"}}, board, true},
+		{[]pruneTerm{{"folder", "Infra"}, {"tag", "dev"}}, board, false},
+	}
+	for _, tt := range tests {
+		pruneTerms = tt.terms
+		if got := inPruneScope(tt.board, managed); got != tt.want {
+			t.Errorf("inPruneScope(%s, %v) = %v, want %v", tt.board.UID, tt.terms, got, tt.want)
+		}
+	}
+}
+
+func TestPruning(t *testing.T) {
+	defer func(p bool, k string) { prune, pruneKinds = p, k }(prune, pruneKinds)
+
+	tests := []struct {
+		prune bool
+		kinds string
+		kind  string
+		want  bool
+	}{
+		{false, "dashboards", "dashboards", false},
+		{true, "dashboards", "dashboards", true},
+		{true, "dashboards", "folders", false},
+		{true, "dashboards, folders", "folders", true},
+		{true, "", "dashboards", false},
+	}
+	for _, tt := range tests {
+		prune, pruneKinds = tt.prune, tt.kinds
+		if got := pruning(tt.kind); got != tt.want {
+			t.Errorf("pruning(%s) with -prune=%v -prune-kinds=%q = %v, want %v", tt.kind, tt.prune, tt.kinds, got, tt.want)
+		}
+	}
+}
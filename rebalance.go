@@ -0,0 +1,169 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// ruleGroupRule moves the local alert rules it matches to another group or
+// folder, and sets the evaluation interval of the group they end up in.
+// Unset targets keep the current folder, group or interval.
+type ruleGroupRule struct {
+	Match    ruleGroupMatch `yaml:"match"`
+	Folder   string         `yaml:"folder"`
+	Group    string         `yaml:"group"`
+	Interval string         `yaml:"interval"`
+}
+
+// ruleGroupMatch selects alert rules by the UID of their folder, their group
+// title and their labels. A rule matches when it is in one of the folders,
+// in one of the groups and has all the labels; empty conditions match any
+// rule.
+type ruleGroupMatch struct {
+	Folders []string          `yaml:"folders"`
+	Groups  []string          `yaml:"groups"`
+	Labels  map[string]string `yaml:"labels"`
+}
+
+func (m ruleGroupMatch) matches(g ruleGroup, rule map[string]interface{}) bool {
+	if len(m.Folders) > 0 && !stringList(m.Folders).contains(g.FolderUID) {
+		return false
+	}
+	if len(m.Groups) > 0 && !stringList(m.Groups).contains(g.Title) {
+		return false
+	}
+	labels, _ := rule["labels"].(map[string]interface{})
+	for key, value := range m.Labels {
+		if labels[key] != value {
+			return false
+		}
+	}
+	return true
+}
+
+// groupKey identifies a rule group, group titles being unique per folder.
+type groupKey struct {
+	folderUID, title string
+}
+
+func (k groupKey) String() string {
+	return k.folderUID + "/" + k.title
+}
+
+// rebalanceRuleGroups applies the ruleGroups rules of the configuration
+// file to the local alert rule groups: every rule goes to the group of the
+// first rule matching it, and groups left empty are removed. The group
+// files are then rewritten, ready to be reviewed and pushed.
+func rebalanceRuleGroups() {
+	if len(cfg.RuleGroups) == 0 {
+		log.Fatalf("Error: no ruleGroups rules in %s", configFile)
+	}
+	intervals := make([]int64, len(cfg.RuleGroups))
+	for i, r := range cfg.RuleGroups {
+		if r.Interval == "" {
+			continue
+		}
+		d, err := time.ParseDuration(r.Interval)
+		if err != nil || d <= 0 || d%(10*time.Second) != 0 {
+			log.Fatalf("Error in ruleGroups rule %d: interval %q is not a positive multiple of 10s", i+1, r.Interval)
+		}
+		intervals[i] = int64(d / time.Second)
+	}
+
+	files, err := ruleGroupFiles(directory)
+	if err != nil {
+		log.Fatalf("Error reading alert rule groups: %v", err)
+	}
+	groups := make(map[groupKey]*ruleGroup)
+	var order []groupKey
+	for _, path := range files {
+		g, err := readRuleGroup(path)
+		if err != nil {
+			log.Fatalf("Error reading %s: %v", path, err)
+		}
+		key := groupKey{g.FolderUID, g.Title}
+		if groups[key] != nil {
+			log.Fatalf("Error: rule group %s is defined twice", key)
+		}
+		groups[key] = &g
+		order = append(order, key)
+	}
+
+	// Groups keep their interval unless a rule sets it, rules moved into
+	// a new group bring the interval of the group they come from
+	rebalanced := make(map[groupKey]*ruleGroup, len(groups))
+	setBy := make(map[groupKey]int)
+	for _, key := range order {
+		g := groups[key]
+		rebalanced[key] = &ruleGroup{Title: g.Title, FolderUID: g.FolderUID, Interval: g.Interval}
+	}
+	moved := 0
+	for _, key := range order {
+		g := groups[key]
+		for _, rule := range g.Rules {
+			to := key
+			interval := int64(0)
+			for i, r := range cfg.RuleGroups {
+				if !r.Match.matches(*g, rule) {
+					continue
+				}
+				if r.Folder != "" {
+					to.folderUID = r.Folder
+				}
+				if r.Group != "" {
+					to.title = r.Group
+				}
+				if intervals[i] > 0 {
+					interval = intervals[i]
+					if j, ok := setBy[to]; ok && intervals[j] != interval {
+						log.Fatalf("Error: ruleGroups rules %d and %d set different intervals for group %s", j+1, i+1, to)
+					}
+					setBy[to] = i
+				}
+				break
+			}
+
+			dest := rebalanced[to]
+			if dest == nil {
+				dest = &ruleGroup{Title: to.title, FolderUID: to.folderUID, Interval: g.Interval}
+				rebalanced[to] = dest
+				order = append(order, to)
+			}
+			if interval > 0 && dest.Interval != interval {
+				fmt.Printf("Set interval of group %s: %ds -> %ds\n", to, dest.Interval, interval)
+				dest.Interval = interval
+			}
+			if to != key {
+				fmt.Printf("Moved rule %v: %s -> %s\n", rule["title"], key, to)
+				moved++
+			}
+			rule["folderUID"] = to.folderUID
+			rule["ruleGroup"] = to.title
+			dest.Rules = append(dest.Rules, rule)
+		}
+	}
+
+	for _, path := range files {
+		if err := os.Remove(path); err != nil {
+			log.Fatalf("Error removing %s: %v", path, err)
+		}
+		// Folders left without groups are removed too
+		os.Remove(filepath.Dir(path))
+	}
+	written := 0
+	for _, key := range order {
+		g := rebalanced[key]
+		if len(g.Rules) == 0 {
+			fmt.Printf("Removed empty group %s\n", key)
+			continue
+		}
+		if err := writeRuleGroup(directory, *g); err != nil {
+			log.Fatalf("Error saving rule group %s: %v", key, err)
+		}
+		written++
+	}
+	fmt.Printf("Rebalanced alert rules: %d moved, %d group(s) from %d\n", moved, written, len(groups))
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"log"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"text/template"
+	"time"
+)
+
+// watchConfig makes the daemon reload the configuration file when it
+// changes, in addition to on SIGHUP.
+var watchConfig bool
+
+// configPollInterval is how often -watch-config looks for changes to the
+// configuration file.
+const configPollInterval = 5 * time.Second
+
+// configMu guards the jobs of the configuration file, which the job
+// scheduler reads while a reload may replace them.
+var configMu sync.Mutex
+
+// scheduledJobs returns the jobs of the current configuration.
+func scheduledJobs() []job {
+	configMu.Lock()
+	defer configMu.Unlock()
+	return cfg.Jobs
+}
+
+// watchConfigFile reloads the configuration file on SIGHUP and, with
+// -watch-config, when its modification time changes, until the run is
+// cancelled.
+func watchConfigFile(ctx context.Context) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	var poll <-chan time.Time
+	modified := configModTime()
+	if watchConfig {
+		ticker := time.NewTicker(configPollInterval)
+		defer ticker.Stop()
+		poll = ticker.C
+	}
+	for {
+		select {
+		case <-hup:
+			log.Printf("Received SIGHUP, reloading %s", configFile)
+		case <-poll:
+			m := configModTime()
+			if m.Equal(modified) {
+				continue
+			}
+			modified = m
+			log.Printf("%s changed, reloading", configFile)
+		case <-ctx.Done():
+			return
+		}
+		if err := reloadConfig(); err != nil {
+			log.Printf("Error reloading configuration, keeping the current one: %v", err)
+			continue
+		}
+		log.Printf("Reloaded %s: %d job(s)", configFile, len(scheduledJobs()))
+	}
+}
+
+// configModTime returns the modification time of the configuration file,
+// zero when it doesn't exist.
+func configModTime() time.Time {
+	info, err := os.Stat(configFile)
+	if err != nil {
+		return time.Time{}
+	}
+	return info.ModTime()
+}
+
+// reloadConfig reads the configuration file again and applies its profiles,
+// jobs, filters and settings. It waits for the sync in flight, if any, so
+// that a run never mixes two configurations, and keeps the current
+// configuration when the file is invalid. Settings given as flags still
+// take precedence, and settings removed from the file keep their value.
+func reloadConfig() error {
+	syncMu.Lock()
+	defer syncMu.Unlock()
+	configMu.Lock()
+	defer configMu.Unlock()
+
+	previous := struct {
+		cfg         config
+		url, key    string
+		directory   string
+		folder      string
+		maxBodySize int
+		watermark   *watermark
+		layout      *template.Template
+	}{cfg, baseURL, apiKey, directory, folder, maxBodySize, activeWatermark, layoutTemplate}
+
+	err := readConfig()
+	if err == nil {
+		err = applyConfigSettings()
+	}
+	if err != nil {
+		cfg, baseURL, apiKey, directory, folder = previous.cfg, previous.url, previous.key, previous.directory, previous.folder
+		maxBodySize, activeWatermark, layoutTemplate = previous.maxBodySize, previous.watermark, previous.layout
+		return err
+	}
+	if baseURL != previous.url || apiKey != previous.key {
+		connect(baseURL, apiKey)
+	}
+	return nil
+}
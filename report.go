@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+)
+
+var (
+	reportName   string
+	reportFormat string
+)
+
+// onlineReports need a connection to an instance, the other reports work
+// on local files.
+var onlineReports = map[string]bool{
+	"permissions": true,
+	"routing":     true,
+	"stale":       true,
+}
+
+// runReport writes the report selected with -report to stdout.
+func runReport(ctx context.Context) {
+	switch reportName {
+	case "legacy-alerts":
+		reportLegacyAlerts()
+	case "uid-stability":
+		reportUIDStability()
+	case "permissions":
+		reportPermissions(ctx)
+	case "duplicates":
+		reportDuplicates()
+	case "routing":
+		reportRouting(ctx)
+	case "stale":
+		reportStale(ctx)
+	case "links":
+		reportLinks()
+	default:
+		fmt.Println("Error: report must be one of 'legacy-alerts', 'uid-stability', 'permissions', 'duplicates', 'routing', 'stale', 'links'")
+		os.Exit(1)
+	}
+}
+
+// writeReport prints rows as CSV or, with -format json, as an array of
+// objects keyed by the header.
+func writeReport(header []string, rows [][]string) {
+	switch reportFormat {
+	case "csv":
+		w := csv.NewWriter(os.Stdout)
+		if err := w.WriteAll(append([][]string{header}, rows...)); err != nil {
+			log.Fatalf("Error writing report: %v", err)
+		}
+	case "json":
+		items := make([]map[string]string, 0, len(rows))
+		for _, row := range rows {
+			item := map[string]string{}
+			for i, column := range header {
+				item[column] = row[i]
+			}
+			items = append(items, item)
+		}
+		out, _ := json.MarshalIndent(items, "", "  ")
+		fmt.Println(string(out))
+	default:
+		fmt.Println("Error: format must be 'csv' or 'json'")
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+)
+
+// requiredKinds lists, comma-separated, the resource kinds whose pull must
+// succeed. Other kinds are skipped with a warning when their API fails, so
+// that backups keep running on instances where, say, alerting is disabled.
+var requiredKinds string
+
+// pullKinds are the resource kinds pulled by pull, as named in -required.
+var pullKinds = []string{"dashboards", "library-panels", "datasources", "folders", "notifications"}
+
+// Outcome recorded for the resource kinds skipped because their API failed.
+const outcomeUnavailable = "unavailable"
+
+// checkRequiredKinds rejects unknown kinds in -required.
+func checkRequiredKinds() error {
+	for _, kind := range strings.Split(requiredKinds, ",") {
+		kind = strings.TrimSpace(kind)
+		if kind != "" && !stringList(pullKinds).contains(kind) {
+			return fmt.Errorf("unknown kind %q in -required, must be one of %s", kind, strings.Join(pullKinds, ", "))
+		}
+	}
+	return nil
+}
+
+func kindRequired(kind string) bool {
+	for _, k := range strings.Split(requiredKinds, ",") {
+		if strings.TrimSpace(k) == kind {
+			return true
+		}
+	}
+	return false
+}
+
+// pullFailed handles the failure of the API listing a resource kind. It ends
+// the run when the kind is required, and otherwise warns and records the
+// kind as unavailable in the summary, leaving its local files as they are.
+func pullFailed(ctx context.Context, kind, what string, err error) {
+	if stopped(ctx) {
+		return
+	}
+	if kindRequired(kind) {
+		log.Fatalf("Error %s: %s", what, describeError(err))
+	}
+	log.Printf("Warning: error %s: %s. Skipping %s, which is not -required", what, describeError(err), kind)
+	summary.add(strings.ReplaceAll(kind, "-", " "), outcomeUnavailable, describeError(err))
+}
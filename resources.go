@@ -0,0 +1,201 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// datasource is a datasource as stored in datasources/datasources.json. Only
+// the fields accepted when creating a datasource are kept, IDs and read-only
+// fields computed by Grafana are dropped on pull.
+type datasource struct {
+	UID             string                 `json:"uid,omitempty"`
+	Name            string                 `json:"name"`
+	Type            string                 `json:"type"`
+	Access          string                 `json:"access,omitempty"`
+	URL             string                 `json:"url,omitempty"`
+	User            string                 `json:"user,omitempty"`
+	Database        string                 `json:"database,omitempty"`
+	BasicAuth       bool                   `json:"basicAuth,omitempty"`
+	BasicAuthUser   string                 `json:"basicAuthUser,omitempty"`
+	WithCredentials bool                   `json:"withCredentials,omitempty"`
+	IsDefault       bool                   `json:"isDefault,omitempty"`
+	JSONData        map[string]interface{} `json:"jsonData,omitempty"`
+	SecureJSONData  map[string]string      `json:"secureJsonData,omitempty"`
+}
+
+func (d datasource) validate() error {
+	switch {
+	case d.Name == "":
+		return errors.New("has no name")
+	case d.Type == "":
+		return errors.New("has no type")
+	}
+	return nil
+}
+
+// notificationChannel is a legacy alert notification channel as stored in
+// notifications/notifications.json. IDs differ between instances, channels
+// are matched by UID because legacy dashboard alerts reference them by UID.
+type notificationChannel struct {
+	UID                   string                 `json:"uid,omitempty"`
+	Name                  string                 `json:"name"`
+	Type                  string                 `json:"type"`
+	IsDefault             bool                   `json:"isDefault"`
+	SendReminder          bool                   `json:"sendReminder"`
+	DisableResolveMessage bool                   `json:"disableResolveMessage"`
+	Frequency             string                 `json:"frequency,omitempty"`
+	Settings              map[string]interface{} `json:"settings"`
+	SecureSettings        map[string]string      `json:"secureSettings,omitempty"`
+}
+
+func (n notificationChannel) validate() error {
+	switch {
+	case n.Name == "":
+		return errors.New("has no name")
+	case n.Type == "":
+		return errors.New("has no type")
+	}
+	return nil
+}
+
+// Folders are stored in folders/folders.json as folderInfo, without their ID.
+func (f folderInfo) validate() error {
+	if f.Title == "" {
+		return errors.New("has no title")
+	}
+	return nil
+}
+
+// resource is an item of a resource list file.
+type resource interface {
+	validate() error
+}
+
+// resourceFile returns the path of the list file of a resource kind.
+func resourceFile(dir, kind string) string {
+	return filepath.Join(dir, kind, kind+".json")
+}
+
+// readResources decodes the list file of a resource kind into list, a
+// pointer to a slice of the kind's type.
+func readResources(dir, kind string, list interface{}) error {
+	data, err := os.ReadFile(resourceFile(dir, kind))
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, list); err != nil {
+		return fmt.Errorf("invalid JSON: %w", err)
+	}
+	return nil
+}
+
+// writeResources writes the list file of a resource kind.
+func writeResources(dir, kind string, list interface{}) error {
+	data, err := json.MarshalIndent(list, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Join(dir, kind), os.ModePerm); err != nil {
+		return err
+	}
+	return os.WriteFile(resourceFile(dir, kind), data, 0644)
+}
+
+// readResourceList reads the list file of any resource kind but dashboards.
+func readResourceList(dir, kind string) ([]resource, error) {
+	var items []resource
+	switch kind {
+	case "datasources":
+		var list []datasource
+		if err := readResources(dir, kind, &list); err != nil {
+			return nil, err
+		}
+		for _, item := range list {
+			items = append(items, item)
+		}
+	case "folders":
+		var list []folderInfo
+		if err := readResources(dir, kind, &list); err != nil {
+			return nil, err
+		}
+		for _, item := range list {
+			items = append(items, item)
+		}
+	case "notifications":
+		var list []notificationChannel
+		if err := readResources(dir, kind, &list); err != nil {
+			return nil, err
+		}
+		for _, item := range list {
+			items = append(items, item)
+		}
+	case "playlists":
+		var list []playlist
+		if err := readResources(dir, kind, &list); err != nil {
+			return nil, err
+		}
+		for _, item := range list {
+			items = append(items, item)
+		}
+	case "teams":
+		var list []team
+		if err := readResources(dir, kind, &list); err != nil {
+			return nil, err
+		}
+		for _, item := range list {
+			items = append(items, item)
+		}
+	case "users":
+		var list []orgUser
+		if err := readResources(dir, kind, &list); err != nil {
+			return nil, err
+		}
+		for _, item := range list {
+			items = append(items, item)
+		}
+	case "annotations":
+		var list []annotation
+		if err := readResources(dir, kind, &list); err != nil {
+			return nil, err
+		}
+		for _, item := range list {
+			items = append(items, item)
+		}
+	case serviceAccountsKind:
+		var list []exportedServiceAccount
+		if err := readResources(dir, kind, &list); err != nil {
+			return nil, err
+		}
+		for _, item := range list {
+			items = append(items, item)
+		}
+	default:
+		return nil, fmt.Errorf("%s is not a resource list", kind)
+	}
+	return items, nil
+}
+
+// pushPayload passes a resource through the -transform commands of its kind
+// and decodes the result into out, a pointer to a value of the kind's type,
+// so that the pushed payload is always one the tool understands and has its
+// required fields set. It returns the payload to push.
+func pushPayload(kind string, in resource, out resource) ([]byte, error) {
+	data, err := json.Marshal(in)
+	if err != nil {
+		return nil, err
+	}
+	if data, err = applyTransforms(kind, data); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, out); err != nil {
+		return nil, fmt.Errorf("invalid transform output: %w", err)
+	}
+	if err := out.validate(); err != nil {
+		return nil, err
+	}
+	return json.Marshal(out)
+}
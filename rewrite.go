@@ -0,0 +1,81 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// urlRewrite replaces a URL prefix, typically the address of a
+// decommissioned instance, with another.
+type urlRewrite struct {
+	From string `yaml:"from"`
+	To   string `yaml:"to"`
+}
+
+// rewriteURLs applies the urlRewrites of the configuration file to the
+// dashboard links, the panel and data links and the content of text panels
+// of a dashboard.
+func rewriteURLs(data []byte) ([]byte, error) {
+	if len(cfg.URLRewrites) == 0 {
+		return data, nil
+	}
+
+	var dashboard map[string]interface{}
+	if err := json.Unmarshal(data, &dashboard); err != nil {
+		return nil, err
+	}
+	rewriteDashboardLinks(dashboard, rewriteURL)
+	return json.Marshal(dashboard)
+}
+
+// rewriteDashboardLinks applies rewrite to the dashboard links, the panel
+// and data links and the content of text panels of a dashboard.
+func rewriteDashboardLinks(dashboard map[string]interface{}, rewrite func(string) string) {
+	rewriteLinks(dashboard["links"], rewrite)
+	for _, panel := range dashboardPanels(dashboard) {
+		rewriteLinks(panel["links"], rewrite)
+		if content, ok := panel["content"].(string); ok {
+			panel["content"] = rewrite(content)
+		}
+
+		options, _ := panel["options"].(map[string]interface{})
+		if content, ok := options["content"].(string); ok {
+			options["content"] = rewrite(content)
+		}
+		// Data links of the old graph panel
+		rewriteLinks(options["dataLinks"], rewrite)
+
+		fieldConfig, _ := panel["fieldConfig"].(map[string]interface{})
+		defaults, _ := fieldConfig["defaults"].(map[string]interface{})
+		rewriteLinks(defaults["links"], rewrite)
+		overrides, _ := fieldConfig["overrides"].([]interface{})
+		for _, o := range overrides {
+			override, _ := o.(map[string]interface{})
+			properties, _ := override["properties"].([]interface{})
+			for _, p := range properties {
+				if property, ok := p.(map[string]interface{}); ok && property["id"] == "links" {
+					rewriteLinks(property["value"], rewrite)
+				}
+			}
+		}
+	}
+}
+
+// rewriteLinks rewrites the url of every link of a list.
+func rewriteLinks(links interface{}, rewrite func(string) string) {
+	list, _ := links.([]interface{})
+	for _, l := range list {
+		if link, ok := l.(map[string]interface{}); ok {
+			if url, ok := link["url"].(string); ok {
+				link["url"] = rewrite(url)
+			}
+		}
+	}
+}
+
+func rewriteURL(s string) string {
+	for _, r := range cfg.URLRewrites {
+		s = strings.ReplaceAll(s, r.From, r.To)
+	}
+	return s
+}
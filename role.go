@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"sync"
+)
+
+var requireRole string
+
+// roleRanks orders the Grafana organization roles.
+var roleRanks = map[string]int{
+	"Viewer": 1,
+	"Editor": 2,
+	"Admin":  3,
+}
+
+// Outcome recorded for resource kinds skipped because the token's role is
+// too low for their endpoints.
+const outcomeInsufficientRole = "skipped (role)"
+
+// The role of the credentials is detected once per connection. roleMu
+// guards it, since concurrent workers ask for it.
+var (
+	roleMu       sync.Mutex
+	detectedRole string
+	roleDetected bool
+)
+
+// tokenRole returns the organization role of the credentials in use, or an
+// empty string when it cannot be determined. It is safe for concurrent use.
+func tokenRole(ctx context.Context) string {
+	roleMu.Lock()
+	defer roleMu.Unlock()
+	if !roleDetected {
+		detectedRole, roleDetected = detectRole(ctx), true
+	}
+	return detectedRole
+}
+
+// resetRole forgets the detected role, when connecting to another instance
+// or with other credentials.
+func resetRole() {
+	roleMu.Lock()
+	defer roleMu.Unlock()
+	detectedRole, roleDetected = "", false
+}
+
+// detectRole asks the instance for the role of the credentials. Users and
+// service accounts report their role directly. Legacy API keys cannot, so
+// they are probed with an Admin-only endpoint and reported as Admin when it
+// succeeds.
+func detectRole(ctx context.Context) string {
+	data, status, err := doRequest(ctx, "GET", baseURL+"/api/user", nil)
+	if err == nil && status == http.StatusOK {
+		var user struct {
+			OrgID int `json:"orgId"`
+		}
+		var orgs []struct {
+			OrgID int    `json:"orgId"`
+			Role  string `json:"role"`
+		}
+		if json.Unmarshal(data, &user) == nil {
+			data, status, err = doRequest(ctx, "GET", baseURL+"/api/user/orgs", nil)
+			if err == nil && status == http.StatusOK && json.Unmarshal(data, &orgs) == nil {
+				for _, o := range orgs {
+					if o.OrgID == user.OrgID {
+						return o.Role
+					}
+				}
+			}
+		}
+		return ""
+	}
+
+	if _, status, err := doRequest(ctx, "GET", baseURL+"/api/org/users", nil); err == nil && status == http.StatusOK {
+		return "Admin"
+	}
+	return ""
+}
+
+// checkRequiredRole exits when -require-role is set and the credentials do
+// not have at least that role.
+func checkRequiredRole(ctx context.Context) {
+	if requireRole == "" {
+		return
+	}
+	if _, ok := roleRanks[requireRole]; !ok {
+		fmt.Println("Error: require-role must be one of 'Viewer', 'Editor', 'Admin'")
+		os.Exit(1)
+	}
+
+	role := tokenRole(ctx)
+	if role == "" {
+		log.Fatalf("Error: could not determine the role of the API key, %s is required", requireRole)
+	}
+	if roleRanks[role] < roleRanks[requireRole] {
+		log.Fatalf("Error: the API key has the %s role, %s is required", role, requireRole)
+	}
+	fmt.Printf("API key role: %s\n", role)
+}
+
+// roleAllows reports whether the credentials can use endpoints that need the
+// given role. When the role is unknown the call is attempted anyway. Skipped
+// kinds are explained and recorded in the summary.
+func roleAllows(ctx context.Context, kind, needed string) bool {
+	role := tokenRole(ctx)
+	if role == "" || roleRanks[role] >= roleRanks[needed] {
+		return true
+	}
+	fmt.Printf("Skipping %s: requires the %s role, the API key has %s\n", kind, needed, role)
+	summary.add(kind, outcomeInsufficientRole, kind)
+	return false
+}
@@ -0,0 +1,233 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"grafana-sync/internal/fakegrafana"
+)
+
+// useInstance points the tool at a fake instance, pulling to and pushing
+// from dir, with a fresh run summary. The layout is compiled up front, as
+// loading the configuration does, since pulls render it concurrently.
+func useInstance(t *testing.T, fake *fakegrafana.Server, dir string) {
+	t.Helper()
+	previous := directory
+	t.Cleanup(func() { directory = previous })
+	directory = dir
+	summary = newRunSummary()
+	if err := parseLayout(); err != nil {
+		t.Fatal(err)
+	}
+	connect(fake.URL, "test-key")
+}
+
+// newInstance starts a fake instance, closed when the test ends.
+func newInstance(t *testing.T) *fakegrafana.Server {
+	t.Helper()
+	fake := fakegrafana.New()
+	t.Cleanup(fake.Close)
+	return fake
+}
+
+// mutations returns the calls of fake that may have changed it.
+func mutations(fake *fakegrafana.Server) []string {
+	var calls []string
+	for _, call := range fake.Requests() {
+		if !strings.HasPrefix(call, "GET ") {
+			calls = append(calls, call)
+		}
+	}
+	return calls
+}
+
+// readJSON decodes a file written by a pull.
+func readJSON(t *testing.T, path string, out interface{}) {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(data, out); err != nil {
+		t.Fatalf("%s: %v", path, err)
+	}
+}
+
+func TestDashboardsRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	source := newInstance(t)
+	source.AddFolder("ops", "Ops", "")
+	source.AddDashboard("ops", fakegrafana.Object{"uid": "cpu", "title": "CPU usage", "tags": []interface{}{"infra"}, "panels": []interface{}{}})
+	source.AddDashboard("", fakegrafana.Object{"uid": "home", "title": "Home", "panels": []interface{}{}})
+	useInstance(t, source, dir)
+	pullDashboards(ctx)
+
+	files, err := dashboardPaths(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pulled := make(map[string]string)
+	for _, path := range files {
+		var dashboard struct {
+			UID string `json:"uid"`
+		}
+		readJSON(t, path, &dashboard)
+		rel, _ := filepath.Rel(dir, path)
+		pulled[dashboard.UID] = filepath.ToSlash(rel)
+	}
+	if len(pulled) != 2 {
+		t.Fatalf("pulled %v, want the dashboards cpu and home", pulled)
+	}
+	if !strings.Contains(pulled["cpu"], "Ops/") {
+		t.Errorf("cpu pulled to %s, want it under its folder Ops", pulled["cpu"])
+	}
+	if m := mutations(source); len(m) > 0 {
+		t.Errorf("pull changed the source instance: %v", m)
+	}
+
+	target := newInstance(t)
+	useInstance(t, target, dir)
+	pushDashboards(ctx)
+
+	for _, uid := range []string{"cpu", "home"} {
+		dashboard, ok := target.Dashboard(uid)
+		if !ok {
+			t.Errorf("dashboard %s was not pushed", uid)
+			continue
+		}
+		want, _ := source.Dashboard(uid)
+		if dashboard["title"] != want["title"] {
+			t.Errorf("dashboard %s pushed with title %v, want %v", uid, dashboard["title"], want["title"])
+		}
+	}
+	var saved struct {
+		Meta struct {
+			FolderTitle string `json:"folderTitle"`
+		} `json:"meta"`
+	}
+	if err := getJSON(ctx, "/api/dashboards/uid/cpu", &saved); err != nil || saved.Meta.FolderTitle != "Ops" {
+		t.Errorf("cpu pushed to folder %q (%v), want Ops", saved.Meta.FolderTitle, err)
+	}
+	saves := 0
+	for _, call := range mutations(target) {
+		if call == "POST /api/dashboards/db" {
+			saves++
+		}
+	}
+	if saves != 2 {
+		t.Errorf("push saved %d dashboards, want 2: %v", saves, mutations(target))
+	}
+	if summary.failed() {
+		t.Errorf("push failed: %v", summary.items)
+	}
+}
+
+func TestDatasourcesRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	source := newInstance(t)
+	source.AddDatasource(fakegrafana.Object{"uid": "prom", "name": "Prometheus", "type": "prometheus", "url": "http://prometheus:9090", "access": "proxy", "isDefault": true})
+	source.AddDatasource(fakegrafana.Object{"uid": "logs", "name": "Loki", "type": "loki", "url": "http://loki:3100", "access": "proxy"})
+	useInstance(t, source, dir)
+	pullDatasources(ctx)
+
+	var pulled []datasource
+	readJSON(t, resourceFile(dir, "datasources"), &pulled)
+	if len(pulled) != 2 || pulled[0].Name != "Prometheus" || pulled[1].Name != "Loki" {
+		t.Fatalf("pulled %+v, want Prometheus and Loki in order", pulled)
+	}
+
+	// Pushing back to the instance pulled from updates the datasources in
+	// place instead of creating them again
+	useInstance(t, source, dir)
+	pushDatasources(ctx)
+	for _, call := range mutations(source) {
+		if call == "POST /api/datasources" {
+			t.Errorf("push created an existing datasource: %v", mutations(source))
+		}
+	}
+	if summary.failed() {
+		t.Errorf("push to the source failed: %v", summary.items)
+	}
+
+	target := newInstance(t)
+	useInstance(t, target, dir)
+	pushDatasources(ctx)
+	var created int
+	for _, call := range mutations(target) {
+		if call == "POST /api/datasources" {
+			created++
+		}
+	}
+	if created != 2 {
+		t.Errorf("push created %d datasources, want 2: %v", created, mutations(target))
+	}
+	var pushed []datasource
+	if err := getJSON(ctx, "/api/datasources", &pushed); err != nil {
+		t.Fatal(err)
+	}
+	for _, ds := range pushed {
+		if ds.Name == "Prometheus" && !ds.IsDefault {
+			t.Errorf("Prometheus is not the default datasource of the target")
+		}
+	}
+}
+
+func TestFoldersAndChannelsRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	source := newInstance(t)
+	source.AddFolder("team-a", "Team A", "")
+	source.AddChannel(fakegrafana.Object{"uid": "pager", "name": "Pager", "type": "pagerduty", "settings": map[string]interface{}{"severity": "critical"}})
+	useInstance(t, source, dir)
+	pullFolders(ctx)
+	pullNotificationChannels(ctx)
+
+	var folders []folderInfo
+	readJSON(t, resourceFile(dir, "folders"), &folders)
+	if len(folders) != 1 || folders[0].UID != "team-a" || folders[0].Title != "Team A" {
+		t.Fatalf("pulled folders %+v, want Team A", folders)
+	}
+	var channels []notificationChannel
+	readJSON(t, resourceFile(dir, "notifications"), &channels)
+	if len(channels) != 1 || channels[0].UID != "pager" {
+		t.Fatalf("pulled channels %+v, want Pager", channels)
+	}
+
+	target := newInstance(t)
+	useInstance(t, target, dir)
+	pushFolders(ctx)
+	pushNotificationChannels(ctx)
+	if summary.failed() {
+		t.Errorf("push failed: %v", summary.items)
+	}
+	var folder folderInfo
+	if err := getJSON(ctx, "/api/folders/team-a", &folder); err != nil || folder.Title != "Team A" {
+		t.Errorf("folder team-a pushed as %+v (%v), want Team A", folder, err)
+	}
+
+	// A second push updates the channel by UID
+	pushNotificationChannels(ctx)
+	var channel notificationChannel
+	if err := getJSON(ctx, "/api/alert-notifications/uid/pager", &channel); err != nil || channel.Name != "Pager" {
+		t.Errorf("channel pager pushed as %+v (%v), want Pager", channel, err)
+	}
+	want := []string{"POST /api/alert-notifications", "PUT /api/alert-notifications/uid/pager"}
+	var got []string
+	for _, call := range mutations(target) {
+		if strings.Contains(call, "/api/alert-notifications") {
+			got = append(got, call)
+		}
+	}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("channel calls %v, want %v", got, want)
+	}
+}
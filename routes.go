@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+)
+
+// pushRoutes pushes every routed directory to the instance of its profile in
+// one run, printing a separate summary for each route.
+func pushRoutes(ctx context.Context) {
+	if len(cfg.Routes) == 0 {
+		log.Fatalf("Error: no routes defined in %s", configFile)
+	}
+
+	baseDir, baseEnvironment, baseWatermark := directory, environment, activeWatermark
+	for _, r := range cfg.Routes {
+		if stopped(ctx) {
+			break
+		}
+		p, err := resolveProfile(r.Profile)
+		if err != nil {
+			log.Fatalf("Error in route %s: %v", r.Directory, err)
+		}
+
+		fmt.Printf("Route %s -> %s (%s)\n", r.Directory, r.Profile, p.URL)
+		directory = filepath.Join(baseDir, r.Directory)
+		folder = r.Folder
+		environment = baseEnvironment
+		if r.Environment != "" {
+			environment = r.Environment
+		}
+		if err := useWatermark(p); err != nil {
+			log.Fatalf("Error in profile %s: %v", r.Profile, err)
+		}
+		connect(p.URL, p.APIKey)
+
+		summary = newRunSummary()
+		pushDirectory(ctx)
+		summary.print()
+	}
+
+	directory, environment, activeWatermark = baseDir, baseEnvironment, baseWatermark
+	summary = newRunSummary()
+}
+
+// pushDirectory pushes the resource kinds present in the local directory.
+func pushDirectory(ctx context.Context) {
+	requireSecrets()
+	kinds := []struct {
+		dir  string
+		push func(context.Context)
+	}{
+		{libraryPanelsDir, pushLibraryPanels},
+		{"dashboards", pushDashboards},
+		{"datasources", pushDatasources},
+		{"folders", pushFolders},
+		{"notifications", pushNotificationChannels},
+	}
+	for _, kind := range kinds {
+		if stopped(ctx) {
+			break
+		}
+		if _, err := os.Stat(filepath.Join(directory, kind.dir)); err == nil {
+			kind.push(ctx)
+		}
+	}
+}
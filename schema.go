@@ -0,0 +1,267 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// oldestMigratedSchema is the oldest schemaVersion push can upgrade. Older
+// dashboards need the earlier migrations of the Grafana frontend and are
+// pushed unchanged.
+const oldestMigratedSchema = 27
+
+// schemaMigrations reproduce, in order, the migrations the Grafana frontend
+// applies when it loads a dashboard, so that dashboards are stored upgraded
+// instead of being migrated again on every load. Each migration upgrades a
+// dashboard to its version.
+var schemaMigrations = []struct {
+	version int
+	migrate func(dashboard map[string]interface{})
+}{
+	{28, migrateSchema28},
+	{29, migrateSchema29},
+	{30, migrateSchema30},
+}
+
+// migrateDashboardSchema upgrades a dashboard with a schemaVersion between
+// oldestMigratedSchema and the last migration. It returns the version the
+// dashboard had, 0 when it has none.
+func migrateDashboardSchema(data []byte) ([]byte, int, error) {
+	var dashboard map[string]interface{}
+	if err := json.Unmarshal(data, &dashboard); err != nil {
+		return nil, 0, err
+	}
+	version, _ := dashboard["schemaVersion"].(float64)
+	from := int(version)
+	if from < oldestMigratedSchema || from >= latestMigratedSchema() {
+		return data, from, nil
+	}
+
+	for _, m := range schemaMigrations {
+		if from < m.version {
+			m.migrate(dashboard)
+			dashboard["schemaVersion"] = m.version
+		}
+	}
+	data, err := json.Marshal(dashboard)
+	return data, from, err
+}
+
+func latestMigratedSchema() int {
+	return schemaMigrations[len(schemaMigrations)-1].version
+}
+
+func templateVariables(dashboard map[string]interface{}) []map[string]interface{} {
+	var variables []map[string]interface{}
+	templating, _ := dashboard["templating"].(map[string]interface{})
+	list, _ := templating["list"].([]interface{})
+	for _, v := range list {
+		if variable, ok := v.(map[string]interface{}); ok {
+			variables = append(variables, variable)
+		}
+	}
+	return variables
+}
+
+// migrateSchema28 replaces singlestat panels with stat panels and removes
+// the tag options of template variables.
+func migrateSchema28(dashboard map[string]interface{}) {
+	for _, panel := range dashboardPanels(dashboard) {
+		if panel["type"] == "singlestat" {
+			migrateSinglestat(panel)
+		}
+	}
+	for _, variable := range templateVariables(dashboard) {
+		for _, field := range []string{"tags", "tagsQuery", "tagValuesQuery", "useTags"} {
+			delete(variable, field)
+		}
+	}
+}
+
+// singlestatCalcs maps the singlestat valueName to stat reducers.
+var singlestatCalcs = map[string]string{
+	"avg":     "mean",
+	"current": "lastNotNull",
+	"total":   "sum",
+	"first":   "firstNotNull",
+	"delta":   "delta",
+	"diff":    "diff",
+	"range":   "range",
+	"min":     "min",
+	"max":     "max",
+	"name":    "last",
+}
+
+// migrateSinglestat converts a singlestat panel into a stat panel, or into a
+// gauge when the singlestat showed one.
+func migrateSinglestat(panel map[string]interface{}) {
+	defaults := map[string]interface{}{}
+	if format, ok := panel["format"].(string); ok && format != "none" {
+		defaults["unit"] = format
+	}
+	if decimals, ok := panel["decimals"].(float64); ok {
+		defaults["decimals"] = decimals
+	}
+
+	steps := []interface{}{}
+	colors, _ := panel["colors"].([]interface{})
+	color := func(i int) interface{} {
+		if i < len(colors) {
+			return colors[i]
+		}
+		return "green"
+	}
+	steps = append(steps, map[string]interface{}{"color": color(0), "value": nil})
+	if thresholds, ok := panel["thresholds"].(string); ok && thresholds != "" {
+		for i, t := range strings.Split(thresholds, ",") {
+			if value, err := strconv.ParseFloat(strings.TrimSpace(t), 64); err == nil {
+				steps = append(steps, map[string]interface{}{"color": color(i + 1), "value": value})
+			}
+		}
+	}
+	defaults["thresholds"] = map[string]interface{}{"mode": "absolute", "steps": steps}
+
+	var mappings []interface{}
+	valueMaps, _ := panel["valueMaps"].([]interface{})
+	for _, vm := range valueMaps {
+		if m, ok := vm.(map[string]interface{}); ok {
+			mappings = append(mappings, map[string]interface{}{"type": 1, "value": m["value"], "text": m["text"]})
+		}
+	}
+	if len(mappings) > 0 {
+		defaults["mappings"] = mappings
+	}
+
+	calc := "mean"
+	if valueName, ok := panel["valueName"].(string); ok {
+		if c, ok := singlestatCalcs[valueName]; ok {
+			calc = c
+		}
+	}
+	options := map[string]interface{}{
+		"reduceOptions": map[string]interface{}{"calcs": []interface{}{calc}, "fields": "", "values": false},
+		"orientation":   "horizontal",
+		"textMode":      "auto",
+		"colorMode":     "value",
+		"graphMode":     "none",
+		"justifyMode":   "auto",
+	}
+	if background, _ := panel["colorBackground"].(bool); background {
+		options["colorMode"] = "background"
+	}
+	if sparkline, ok := panel["sparkline"].(map[string]interface{}); ok && sparkline["show"] == true {
+		options["graphMode"] = "area"
+	}
+
+	panel["type"] = "stat"
+	if gauge, ok := panel["gauge"].(map[string]interface{}); ok && gauge["show"] == true {
+		panel["type"] = "gauge"
+		options = map[string]interface{}{
+			"reduceOptions":        options["reduceOptions"],
+			"showThresholdLabels":  gauge["thresholdLabels"] == true,
+			"showThresholdMarkers": gauge["thresholdMarkers"] != false,
+		}
+		if min, ok := gauge["minValue"].(float64); ok {
+			defaults["min"] = min
+		}
+		if max, ok := gauge["maxValue"].(float64); ok {
+			defaults["max"] = max
+		}
+	}
+	panel["options"] = options
+	panel["fieldConfig"] = map[string]interface{}{"defaults": defaults, "overrides": []interface{}{}}
+	for _, field := range []string{"format", "decimals", "thresholds", "colors", "valueMaps", "mappingType", "rangeMaps", "valueName", "colorBackground", "colorValue", "sparkline", "gauge", "postfix", "prefix", "nullPointMode", "tableColumn"} {
+		delete(panel, field)
+	}
+}
+
+// migrateSchema29 makes query variables refresh on load and drops their
+// saved options, which are fetched again.
+func migrateSchema29(dashboard map[string]interface{}) {
+	for _, variable := range templateVariables(dashboard) {
+		if variable["type"] != "query" {
+			continue
+		}
+		if refresh, _ := variable["refresh"].(float64); refresh != 1 && refresh != 2 {
+			variable["refresh"] = 1
+		}
+		if options, _ := variable["options"].([]interface{}); len(options) > 0 {
+			variable["options"] = []interface{}{}
+		}
+	}
+}
+
+// migrateSchema30 upgrades value mappings to the grouped format and moves
+// the tooltip options of time series panels.
+func migrateSchema30(dashboard map[string]interface{}) {
+	for _, panel := range dashboardPanels(dashboard) {
+		fieldConfig, _ := panel["fieldConfig"].(map[string]interface{})
+		if defaults, ok := fieldConfig["defaults"].(map[string]interface{}); ok {
+			if mappings, ok := defaults["mappings"].([]interface{}); ok {
+				defaults["mappings"] = upgradeValueMappings(mappings)
+			}
+		}
+		overrides, _ := fieldConfig["overrides"].([]interface{})
+		for _, o := range overrides {
+			override, _ := o.(map[string]interface{})
+			properties, _ := override["properties"].([]interface{})
+			for _, p := range properties {
+				if property, ok := p.(map[string]interface{}); ok && property["id"] == "mappings" {
+					if mappings, ok := property["value"].([]interface{}); ok {
+						property["value"] = upgradeValueMappings(mappings)
+					}
+				}
+			}
+		}
+
+		if panel["type"] == "timeseries" || panel["type"] == "xychart" {
+			options, _ := panel["options"].(map[string]interface{})
+			if tooltip, ok := options["tooltipOptions"]; ok {
+				options["tooltip"] = tooltip
+				delete(options, "tooltipOptions")
+			}
+		}
+	}
+}
+
+// upgradeValueMappings converts value mappings from the flat format, where
+// type 1 maps a value and type 2 a range, to the grouped format. Mappings
+// already in the grouped format are kept.
+func upgradeValueMappings(mappings []interface{}) []interface{} {
+	var upgraded []interface{}
+	values := map[string]interface{}{}
+	for i, m := range mappings {
+		mapping, ok := m.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		result := map[string]interface{}{"text": mapping["text"], "index": i}
+		if color, ok := mapping["color"]; ok {
+			result["color"] = color
+		}
+		switch fmt.Sprint(mapping["type"]) {
+		case "1":
+			if mapping["value"] == "null" {
+				upgraded = append(upgraded, map[string]interface{}{"type": "special", "options": map[string]interface{}{"match": "null", "result": result}})
+			} else {
+				values[fmt.Sprint(mapping["value"])] = result
+			}
+		case "2":
+			r := map[string]interface{}{"result": result}
+			for _, bound := range []string{"from", "to"} {
+				if v, err := strconv.ParseFloat(fmt.Sprint(mapping[bound]), 64); err == nil {
+					r[bound] = v
+				}
+			}
+			upgraded = append(upgraded, map[string]interface{}{"type": "range", "options": r})
+		default:
+			upgraded = append(upgraded, mapping)
+		}
+	}
+	if len(values) > 0 {
+		upgraded = append([]interface{}{map[string]interface{}{"type": "value", "options": values}}, upgraded...)
+	}
+	return upgraded
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// requiredSecretsFile lists, in the directory of a resource kind, the
+// secrets its pulled resources need on push.
+const requiredSecretsFile = "required-secrets.txt"
+
+// secretPlaceholder matches a secure field value that is a placeholder to
+// resolve from the environment on push.
+var secretPlaceholder = regexp.MustCompile(`^\$\{([A-Za-z_][A-Za-z0-9_]*)\}$`)
+
+var secretVarInvalid = regexp.MustCompile(`[^A-Z0-9]+`)
+
+// requiredSecret is a secure field of a resource that Grafana doesn't return
+// on pull, replaced with a placeholder for the variable Var.
+type requiredSecret struct {
+	Var, Resource, Field string
+}
+
+// secretVar returns the environment variable holding a secure field of a
+// resource, such as NOTIFICATIONS_SLACK_ALERTS_URL.
+func secretVar(kind, name, field string) string {
+	v := secretVarInvalid.ReplaceAllString(strings.ToUpper(kind+"_"+name+"_"+field), "_")
+	return strings.Trim(v, "_")
+}
+
+// secretPlaceholders returns placeholders for the secure fields of a pulled
+// resource, and records them in secrets.
+func secretPlaceholders(kind, name string, secureFields map[string]bool, secrets *[]requiredSecret) map[string]string {
+	var placeholders map[string]string
+	for field, set := range secureFields {
+		if !set {
+			continue
+		}
+		if placeholders == nil {
+			placeholders = make(map[string]string)
+		}
+		v := secretVar(kind, name, field)
+		placeholders[field] = "${" + v + "}"
+		*secrets = append(*secrets, requiredSecret{Var: v, Resource: name, Field: field})
+	}
+	return placeholders
+}
+
+// writeRequiredSecrets saves the checklist of the secrets of a resource
+// kind, removing a previous one when there are none left.
+func writeRequiredSecrets(dir, kind string, secrets []requiredSecret) error {
+	path := filepath.Join(dir, kind, requiredSecretsFile)
+	if len(secrets) == 0 {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+	sort.Slice(secrets, func(i, j int) bool { return secrets[i].Var < secrets[j].Var })
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "# Secrets Grafana doesn't return on pull, to set in the environment before pushing %s\n", kind)
+	for _, s := range secrets {
+		fmt.Fprintf(&b, "%s\t%s: %s\n", s.Var, s.Resource, s.Field)
+	}
+	return os.WriteFile(path, []byte(b.String()), 0644)
+}
+
+// resolveSecrets replaces the placeholders of secure fields with the value
+// of their environment variable. Every missing variable is reported at once,
+// so that all of them can be supplied before anything is pushed.
+func resolveSecrets(name string, secure map[string]string, missing *[]string) map[string]string {
+	if len(secure) == 0 {
+		return secure
+	}
+	resolved := make(map[string]string, len(secure))
+	for field, value := range secure {
+		resolved[field] = resolveSecret(name, field, value, missing)
+	}
+	return resolved
+}
+
+// resolveSecret returns the value of the environment variable of a
+// placeholder, recording it in missing when it isn't set. Other values are
+// returned unchanged.
+func resolveSecret(name, field, value string, missing *[]string) string {
+	m := secretPlaceholder.FindStringSubmatch(value)
+	if m == nil {
+		return value
+	}
+	if v, ok := os.LookupEnv(m[1]); ok {
+		return v
+	}
+	*missing = append(*missing, fmt.Sprintf("%s (%s: %s)", m[1], name, field))
+	return value
+}
+
+// resolveChannelSecrets resolves the secure settings placeholders of the
+// notification channels synced, exiting with the list of missing secrets
+// when any is missing.
+func resolveChannelSecrets(channels []notificationChannel) {
+	var missing []string
+	for i, nc := range channels {
+		if included("notifications", nc.Name) {
+			channels[i].SecureSettings = resolveSecrets(nc.Name, nc.SecureSettings, &missing)
+		}
+	}
+	if len(missing) > 0 {
+		sort.Strings(missing)
+		log.Fatalf("Error: missing secrets of notification channels, set these environment variables before pushing:\n  %s", strings.Join(missing, "\n  "))
+	}
+}
+
+// requireSecrets fails before anything is pushed when a secret of the local
+// notification channels is missing.
+func requireSecrets() {
+	var channels []notificationChannel
+	if err := readResources(directory, "notifications", &channels); err == nil {
+		resolveChannelSecrets(channels)
+	}
+}
@@ -0,0 +1,404 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+var (
+	serviceAccountName string
+	serviceAccountRole string
+	// serviceAccountTeam is a team the service account joins, so that it
+	// gets the folder and dashboard permissions of the team.
+	serviceAccountTeam string
+	tokenTTL           time.Duration
+	// tokenFile receives the token instead of the standard output.
+	tokenFile string
+)
+
+// serviceAccount is a service account as returned by /api/serviceaccounts.
+type serviceAccount struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+	Role string `json:"role"`
+}
+
+// bootstrapServiceAccount creates, with the admin credentials of -apikey, a
+// service account with the -service-account-role role for sync runs, and a
+// token for it. An existing service account with the same name is reused,
+// its role brought in line, so onboarding can be run again to get a new
+// token. When a step fails, the changes already made are listed, so that a
+// half-configured service account doesn't go unnoticed.
+func bootstrapServiceAccount(ctx context.Context) {
+	if _, ok := roleRanks[serviceAccountRole]; !ok {
+		fmt.Println("Error: service-account-role must be one of 'Viewer', 'Editor', 'Admin'")
+		os.Exit(1)
+	}
+	if serviceAccountName == "" {
+		fmt.Println("Error: service-account-name is required")
+		os.Exit(1)
+	}
+
+	var done []string
+	if err := setupServiceAccount(ctx, &done); err != nil {
+		if len(done) > 0 {
+			fmt.Printf("Changes made before the error:\n  %s\n", strings.Join(done, "\n  "))
+		}
+		log.Fatalf("Error: %s", describeError(err))
+	}
+}
+
+// setupServiceAccount runs the steps of bootstrapServiceAccount, adding a
+// line to done for every change made to the instance.
+func setupServiceAccount(ctx context.Context, done *[]string) error {
+	sa, err := findServiceAccount(ctx, serviceAccountName)
+	if err != nil {
+		return fmt.Errorf("searching service accounts: %w", err)
+	}
+	switch {
+	case sa == nil:
+		body, _ := json.Marshal(map[string]interface{}{"name": serviceAccountName, "role": serviceAccountRole})
+		data, err := apiRequest(ctx, "POST", "/api/serviceaccounts", body)
+		if err != nil {
+			return fmt.Errorf("creating service account %s: %w", serviceAccountName, err)
+		}
+		sa = &serviceAccount{}
+		if err := json.Unmarshal(data, sa); err != nil {
+			return fmt.Errorf("reading service account %s: %w", serviceAccountName, err)
+		}
+		*done = append(*done, fmt.Sprintf("created service account %s (ID %d) with the %s role", sa.Name, sa.ID, serviceAccountRole))
+		printChange("Created service account %s with the %s role\n", sa.Name, serviceAccountRole)
+	case sa.Role != serviceAccountRole:
+		body, _ := json.Marshal(map[string]interface{}{"role": serviceAccountRole})
+		if _, err := apiRequest(ctx, "PATCH", fmt.Sprintf("/api/serviceaccounts/%d", sa.ID), body); err != nil {
+			return fmt.Errorf("changing the role of service account %s: %w", sa.Name, err)
+		}
+		*done = append(*done, fmt.Sprintf("changed the role of service account %s from %s to %s", sa.Name, sa.Role, serviceAccountRole))
+		fmt.Printf("Changed the role of service account %s from %s to %s\n", sa.Name, sa.Role, serviceAccountRole)
+	default:
+		fmt.Printf("Using service account %s\n", sa.Name)
+	}
+
+	if serviceAccountTeam != "" {
+		joined, err := joinTeam(ctx, sa.ID, serviceAccountTeam)
+		if err != nil {
+			return fmt.Errorf("adding service account %s to team %s: %w", sa.Name, serviceAccountTeam, err)
+		}
+		if joined {
+			*done = append(*done, fmt.Sprintf("added service account %s to team %s", sa.Name, serviceAccountTeam))
+		}
+	}
+
+	tokenName := fmt.Sprintf("grafana-sync-%s", time.Now().UTC().Format("20060102150405"))
+	body, _ := json.Marshal(map[string]interface{}{"name": tokenName, "secondsToLive": int64(tokenTTL.Seconds())})
+	data, err := apiRequest(ctx, "POST", fmt.Sprintf("/api/serviceaccounts/%d/tokens", sa.ID), body)
+	if err != nil {
+		return fmt.Errorf("creating a token for service account %s: %w", sa.Name, err)
+	}
+	var token struct {
+		Key string `json:"key"`
+	}
+	if err := json.Unmarshal(data, &token); err != nil || token.Key == "" {
+		*done = append(*done, fmt.Sprintf("created token %s of service account %s, which could not be read: delete it", tokenName, sa.Name))
+		return fmt.Errorf("reading the token of service account %s: %v", sa.Name, err)
+	}
+
+	if tokenFile == "" {
+		printChange("Created token %s:\n%s\n", tokenName, token.Key)
+		return nil
+	}
+	if err := os.WriteFile(tokenFile, []byte(token.Key+"\n"), 0600); err != nil {
+		*done = append(*done, fmt.Sprintf("created token %s of service account %s, which could not be saved: delete it", tokenName, sa.Name))
+		return fmt.Errorf("saving token: %w", err)
+	}
+	fmt.Printf("Saved token %s to %s\n", tokenName, tokenFile)
+	return nil
+}
+
+// findServiceAccount returns the service account with the given name, or
+// nil when there is none.
+func findServiceAccount(ctx context.Context, name string) (*serviceAccount, error) {
+	var result struct {
+		ServiceAccounts []serviceAccount `json:"serviceAccounts"`
+	}
+	if err := getJSON(ctx, "/api/serviceaccounts/search?query="+url.QueryEscape(name), &result); err != nil {
+		return nil, err
+	}
+	for _, sa := range result.ServiceAccounts {
+		if sa.Name == name {
+			return &sa, nil
+		}
+	}
+	return nil, nil
+}
+
+// joinTeam adds a service account to a team unless it is a member already,
+// and reports whether it was added.
+func joinTeam(ctx context.Context, userID int, team string) (bool, error) {
+	teamID, err := lookupTeamID(ctx, team)
+	if err != nil {
+		return false, err
+	}
+	var members []struct {
+		UserID int `json:"userId"`
+	}
+	if err := getJSON(ctx, fmt.Sprintf("/api/teams/%d/members", teamID), &members); err != nil {
+		return false, err
+	}
+	for _, m := range members {
+		if m.UserID == userID {
+			return false, nil
+		}
+	}
+	body, _ := json.Marshal(map[string]int{"userId": userID})
+	if _, err := apiRequest(ctx, "POST", fmt.Sprintf("/api/teams/%d/members", teamID), body); err != nil {
+		return false, err
+	}
+	fmt.Printf("Added service account to team %s\n", team)
+	return true, nil
+}
+
+// serviceAccountsKind is the resource kind of the service accounts, stored
+// in service-accounts/service-accounts.json.
+const serviceAccountsKind = "service-accounts"
+
+// serviceAccountPageSize is the number of service accounts listed per
+// request.
+const serviceAccountPageSize = 1000
+
+// exportedServiceAccount is a service account as stored in
+// service-accounts/service-accounts.json, matched by name. Tokens are kept
+// without their secret, which Grafana only returns on creation.
+type exportedServiceAccount struct {
+	Name       string                `json:"name"`
+	Role       string                `json:"role"`
+	IsDisabled bool                  `json:"isDisabled,omitempty"`
+	Tokens     []serviceAccountToken `json:"tokens,omitempty"`
+}
+
+// serviceAccountToken is the metadata of a service account token.
+type serviceAccountToken struct {
+	Name       string     `json:"name"`
+	Created    *time.Time `json:"created,omitempty"`
+	Expiration *time.Time `json:"expiration,omitempty"`
+	LastUsedAt *time.Time `json:"lastUsedAt,omitempty"`
+}
+
+func (sa exportedServiceAccount) validate() error {
+	switch {
+	case sa.Name == "":
+		return errors.New("has no name")
+	case roleRanks[sa.Role] == 0 && sa.Role != "None":
+		return fmt.Errorf("has an invalid role %q", sa.Role)
+	}
+	for _, t := range sa.Tokens {
+		if t.Name == "" {
+			return errors.New("has a token without name")
+		}
+	}
+	return nil
+}
+
+// listServiceAccounts returns the service accounts of the instance, with
+// their IDs.
+func listServiceAccounts(ctx context.Context) ([]serviceAccount, map[string]bool, error) {
+	var accounts []serviceAccount
+	disabled := make(map[string]bool)
+	for page := 1; ; page++ {
+		var result struct {
+			ServiceAccounts []struct {
+				serviceAccount
+				IsDisabled bool `json:"isDisabled"`
+			} `json:"serviceAccounts"`
+		}
+		if err := getJSON(ctx, fmt.Sprintf("/api/serviceaccounts/search?perpage=%d&page=%d", serviceAccountPageSize, page), &result); err != nil {
+			return nil, nil, err
+		}
+		for _, sa := range result.ServiceAccounts {
+			accounts = append(accounts, sa.serviceAccount)
+			disabled[sa.Name] = sa.IsDisabled
+		}
+		if len(result.ServiceAccounts) < serviceAccountPageSize {
+			return accounts, disabled, nil
+		}
+	}
+}
+
+// serviceAccountTokens returns the tokens of a service account.
+func serviceAccountTokens(ctx context.Context, id int) ([]serviceAccountToken, error) {
+	var tokens []serviceAccountToken
+	err := getJSON(ctx, fmt.Sprintf("/api/serviceaccounts/%d/tokens", id), &tokens)
+	return tokens, err
+}
+
+// pullServiceAccounts saves the service accounts of the instance with their
+// role and the metadata of their tokens.
+func pullServiceAccounts(ctx context.Context) {
+	fmt.Println("Pulling service accounts...")
+	if !roleAllows(ctx, serviceAccountsKind, "Admin") {
+		return
+	}
+	accounts, disabled, err := listServiceAccounts(ctx)
+	if err != nil {
+		log.Fatalf("Error listing service accounts: %s", describeError(err))
+	}
+
+	pulled := []exportedServiceAccount{}
+	for _, sa := range accounts {
+		if stopped(ctx) {
+			return
+		}
+		if !included(serviceAccountsKind, sa.Name) {
+			continue
+		}
+		tokens, err := serviceAccountTokens(ctx, sa.ID)
+		if err != nil {
+			log.Printf("Error fetching the tokens of service account %s: %s", sa.Name, describeError(err))
+			continue
+		}
+		pulled = append(pulled, exportedServiceAccount{Name: sa.Name, Role: sa.Role, IsDisabled: disabled[sa.Name], Tokens: tokens})
+	}
+	if err := writePulledResources(directory, serviceAccountsKind, pulled); err != nil {
+		fmt.Println("Error saving service accounts:", err)
+		return
+	}
+	fmt.Println("Saved service accounts")
+}
+
+// pushServiceAccounts creates the missing service accounts and updates the
+// role and state of the others. Tokens missing by name are created again
+// with the time they had left, their secret printed or appended to
+// -token-file; expired tokens aren't recreated.
+func pushServiceAccounts(ctx context.Context) {
+	fmt.Println("Pushing service accounts...")
+	if !roleAllows(ctx, serviceAccountsKind, "Admin") {
+		return
+	}
+	var list []exportedServiceAccount
+	if err := readResources(directory, serviceAccountsKind, &list); err != nil {
+		fmt.Println("Error reading service accounts file:", err)
+		return
+	}
+	accounts, disabled, err := listServiceAccounts(ctx)
+	if err != nil {
+		log.Fatalf("Error listing service accounts: %s", describeError(err))
+	}
+	existing := make(map[string]serviceAccount, len(accounts))
+	for _, sa := range accounts {
+		existing[sa.Name] = sa
+	}
+
+	for _, local := range list {
+		if stopped(ctx) {
+			break
+		}
+		if !included(serviceAccountsKind, local.Name) {
+			continue
+		}
+		var sa exportedServiceAccount
+		if _, err := pushPayload(serviceAccountsKind, local, &sa); err != nil {
+			fmt.Printf("Error preparing service account %s: %v\n", local.Name, err)
+			summary.add(serviceAccountsKind, outcomeFailed, local.Name)
+			continue
+		}
+		if err := pushServiceAccount(ctx, sa, existing, disabled); err != nil {
+			log.Printf("Error pushing service account %s: %s", sa.Name, describeError(err))
+			summary.add(serviceAccountsKind, outcomeFailed, sa.Name)
+			continue
+		}
+		printChange("Uploaded service account: %s\n", sa.Name)
+		summary.add(serviceAccountsKind, outcomePushed, sa.Name)
+	}
+}
+
+func pushServiceAccount(ctx context.Context, sa exportedServiceAccount, existing map[string]serviceAccount, disabled map[string]bool) error {
+	remote, found := existing[sa.Name]
+	var data []byte
+	var status int
+	var err error
+	body, _ := json.Marshal(map[string]interface{}{"name": sa.Name, "role": sa.Role, "isDisabled": sa.IsDisabled})
+	switch {
+	case !found:
+		data, status, err = doRequest(ctx, "POST", baseURL+"/api/serviceaccounts", body)
+	case remote.Role != sa.Role || disabled[sa.Name] != sa.IsDisabled:
+		data, status, err = doRequest(ctx, "PATCH", fmt.Sprintf("%s/api/serviceaccounts/%d", baseURL, remote.ID), body)
+	}
+	if err == nil && status >= 400 {
+		err = newAPIError(status, data)
+	}
+	if err != nil {
+		return err
+	}
+	if !found {
+		if err := json.Unmarshal(data, &remote); err != nil {
+			return err
+		}
+		printChange("Created service account %s with the %s role\n", sa.Name, sa.Role)
+	}
+
+	tokens, err := serviceAccountTokens(ctx, remote.ID)
+	if err != nil {
+		return err
+	}
+	exists := make(map[string]bool, len(tokens))
+	for _, t := range tokens {
+		exists[t.Name] = true
+	}
+	for _, t := range sa.Tokens {
+		if exists[t.Name] {
+			continue
+		}
+		var secondsToLive int64
+		if t.Expiration != nil {
+			if secondsToLive = int64(time.Until(*t.Expiration).Seconds()); secondsToLive <= 0 {
+				fmt.Printf("Skipping expired token %s of service account %s\n", t.Name, sa.Name)
+				continue
+			}
+		}
+		body, _ := json.Marshal(map[string]interface{}{"name": t.Name, "secondsToLive": secondsToLive})
+		data, status, err := doRequest(ctx, "POST", fmt.Sprintf("%s/api/serviceaccounts/%d/tokens", baseURL, remote.ID), body)
+		if err == nil && status >= 400 {
+			err = newAPIError(status, data)
+		}
+		if err != nil {
+			return fmt.Errorf("creating token %s: %w", t.Name, err)
+		}
+		var token struct {
+			Key string `json:"key"`
+		}
+		if err := json.Unmarshal(data, &token); err != nil {
+			return err
+		}
+		if err := saveServiceAccountToken(sa.Name, t.Name, token.Key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// saveServiceAccountToken prints the secret of a recreated token, or
+// appends it to -token-file, readable by its owner only, as
+// <service account>/<token>=<secret>.
+func saveServiceAccountToken(account, name, key string) error {
+	if tokenFile == "" {
+		printChange("Created token %s of service account %s:\n%s\n", name, account, key)
+		return nil
+	}
+	f, err := os.OpenFile(tokenFile, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if _, err := fmt.Fprintf(f, "%s/%s=%s\n", account, name, key); err != nil {
+		return err
+	}
+	fmt.Printf("Saved token %s of service account %s to %s\n", name, account, tokenFile)
+	return nil
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// snapshotsDir holds the dashboard snapshots of a directory, one file per
+// snapshot named after its key.
+const snapshotsDir = "snapshots"
+
+// snapshot is a dashboard snapshot as stored in snapshots/<key>.json. The
+// key is part of the URL the snapshot was shared with, so it is kept on
+// push.
+type snapshot struct {
+	Name      string                 `json:"name"`
+	Key       string                 `json:"key"`
+	Expires   time.Time              `json:"expires"`
+	Dashboard map[string]interface{} `json:"dashboard"`
+}
+
+// pullSnapshots saves the snapshots of the instance with their dashboard.
+// External snapshots are left out, their content being stored on the
+// external server. The snapshots directory is replaced.
+func pullSnapshots(ctx context.Context) {
+	fmt.Println("Pulling snapshots...")
+	var list []struct {
+		snapshot
+		External bool `json:"external"`
+	}
+	if err := getJSON(ctx, "/api/dashboard/snapshots", &list); err != nil {
+		fmt.Printf("Error listing snapshots: %s\n", describeError(err))
+		return
+	}
+
+	dir := filepath.Join(directory, snapshotsDir)
+	if err := os.RemoveAll(dir); err != nil {
+		log.Fatalf("Error cleaning snapshots directory: %v", err)
+	}
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		log.Fatalf("Error creating directory: %v", err)
+	}
+	for _, s := range list {
+		if stopped(ctx) {
+			return
+		}
+		if s.External {
+			fmt.Printf("Skipping external snapshot %s\n", s.Name)
+			continue
+		}
+		var body struct {
+			Dashboard map[string]interface{} `json:"dashboard"`
+		}
+		if err := getJSON(ctx, "/api/snapshots/"+url.PathEscape(s.Key), &body); err != nil {
+			log.Printf("Error fetching snapshot %s: %s", s.Name, describeError(err))
+			continue
+		}
+		s.Dashboard = body.Dashboard
+		data, err := json.MarshalIndent(s.snapshot, "", "  ")
+		if err == nil {
+			err = os.WriteFile(filepath.Join(dir, url.PathEscape(s.Key)+".json"), data, 0644)
+		}
+		if err != nil {
+			log.Printf("Error saving snapshot %s: %v", s.Name, err)
+			continue
+		}
+		fmt.Printf("Saved snapshot: %s\n", s.Name)
+	}
+}
+
+// pushSnapshots recreates the local snapshots missing on the instance with
+// their key, so that shared snapshot links work again, and the time they
+// had left. Expired snapshots are skipped. The delete keys of the recreated
+// snapshots are new.
+func pushSnapshots(ctx context.Context) {
+	fmt.Println("Pushing snapshots...")
+	files, err := filepath.Glob(filepath.Join(directory, snapshotsDir, "*.json"))
+	if err != nil || len(files) == 0 {
+		fmt.Println("Error reading snapshots directory: no snapshot files")
+		return
+	}
+
+	for _, path := range files {
+		if stopped(ctx) {
+			break
+		}
+		var s snapshot
+		data, err := os.ReadFile(path)
+		if err == nil {
+			err = json.Unmarshal(data, &s)
+		}
+		if err == nil && (s.Key == "" || s.Dashboard == nil) {
+			err = fmt.Errorf("snapshot has no key or dashboard")
+		}
+		if err != nil {
+			log.Printf("Error reading snapshot %s: %v", path, err)
+			summary.add("snapshots", outcomeFailed, filepath.Base(path))
+			continue
+		}
+		ttl := time.Until(s.Expires)
+		if !s.Expires.IsZero() && ttl <= 0 {
+			fmt.Printf("Skipping expired snapshot %s\n", s.Name)
+			continue
+		}
+
+		err = getJSON(ctx, "/api/snapshots/"+url.PathEscape(s.Key), &struct{}{})
+		if err == nil {
+			summary.add("snapshots", outcomeUnchanged, s.Name)
+			continue
+		}
+		if apiErr, ok := asAPIError(err); !ok || apiErr.StatusCode != http.StatusNotFound {
+			log.Printf("Error checking snapshot %s: %s", s.Name, describeError(err))
+			summary.add("snapshots", outcomeFailed, s.Name)
+			continue
+		}
+
+		payload := map[string]interface{}{"name": s.Name, "key": s.Key, "dashboard": s.Dashboard}
+		if !s.Expires.IsZero() {
+			payload["expires"] = int64(ttl.Seconds())
+		}
+		body, _ := json.Marshal(payload)
+		data, status, err := doRequest(ctx, "POST", baseURL+"/api/snapshots", body)
+		if err == nil && status >= 400 {
+			err = newAPIError(status, data)
+		}
+		if err != nil {
+			log.Printf("Error pushing snapshot %s: %s", s.Name, describeError(err))
+			summary.add("snapshots", outcomeFailed, s.Name)
+			continue
+		}
+		printChange("Uploaded snapshot: %s\n", s.Name)
+		summary.add("snapshots", outcomePushed, s.Name)
+	}
+}
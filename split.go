@@ -0,0 +1,168 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+)
+
+// splitDir is where split writes the directory of every target.
+var splitDir string
+
+// splitRule assigns dashboards to a target. A dashboard matches when it has
+// one of the tags, is in one of the folders or is owned by one of the teams.
+type splitRule struct {
+	Target  string   `yaml:"target"`
+	Tags    []string `yaml:"tags"`
+	Folders []string `yaml:"folders"`
+	Teams   []string `yaml:"teams"`
+}
+
+func (r splitRule) matches(e manifestEntry, tags []string) bool {
+	folderTitle := e.FolderTitle
+	if folderTitle == "" {
+		folderTitle = generalFolder
+	}
+	if stringList(r.Folders).contains(folderTitle) || (e.Team != "" && stringList(r.Teams).contains(e.Team)) {
+		return true
+	}
+	for _, tag := range tags {
+		if stringList(r.Tags).contains(tag) {
+			return true
+		}
+	}
+	return false
+}
+
+// splitData distributes the dashboards of a pull between the targets of the
+// split rules of the configuration file. Every target gets a directory laid
+// out like a pulled directory under -split-dir, with its dashboards, the
+// folders they are in and a copy of the datasources and notification
+// channels. Dashboards go to the first matching rule; the ones matching
+// none are listed so the rules can be completed before the directories are
+// pushed to their new instances.
+func splitData() {
+	if len(cfg.Split) == 0 {
+		log.Fatalf("Error: no split rules in %s", configFile)
+	}
+	m, err := readManifest(directory)
+	if err != nil {
+		log.Fatalf("Error reading manifest, pull the dashboards first: %v", err)
+	}
+
+	fmt.Println("Splitting dashboards...")
+	assigned := make(map[string][]manifestEntry)
+	var unassigned []manifestEntry
+	for _, e := range m.Dashboards {
+		var dashboard struct {
+			Tags []string `json:"tags"`
+		}
+		data, err := os.ReadFile(filepath.Join(directory, e.Path))
+		if err == nil {
+			err = json.Unmarshal(data, &dashboard)
+		}
+		if err != nil {
+			log.Fatalf("Error reading %s: %v", e.Path, err)
+		}
+
+		matched := false
+		for _, rule := range cfg.Split {
+			if rule.matches(e, dashboard.Tags) {
+				assigned[rule.Target] = append(assigned[rule.Target], e)
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			unassigned = append(unassigned, e)
+		}
+	}
+
+	for _, rule := range cfg.Split {
+		entries, ok := assigned[rule.Target]
+		if !ok {
+			continue
+		}
+		delete(assigned, rule.Target)
+		if err := writeSplitTarget(rule.Target, entries); err != nil {
+			log.Fatalf("Error writing target %s: %v", rule.Target, err)
+		}
+		fmt.Printf("  %s: %d dashboard(s) in %s\n", rule.Target, len(entries), filepath.Join(splitDir, rule.Target))
+	}
+
+	if len(unassigned) > 0 {
+		fmt.Printf("%d dashboard(s) match no rule:\n", len(unassigned))
+		for _, e := range unassigned {
+			fmt.Printf("  %s - %s (%s)\n", e.Title, e.UID, e.Path)
+		}
+	}
+}
+
+// writeSplitTarget writes the directory of a split target.
+func writeSplitTarget(target string, entries []manifestEntry) error {
+	targetDir := filepath.Join(splitDir, target)
+	if err := os.MkdirAll(filepath.Join(targetDir, "dashboards"), os.ModePerm); err != nil {
+		return err
+	}
+
+	folderUIDs := make(map[string]bool)
+	for _, e := range entries {
+		data, err := os.ReadFile(filepath.Join(directory, e.Path))
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(targetDir, "dashboards", layoutRelPath(e.Path))
+		if err := os.MkdirAll(filepath.Dir(target), os.ModePerm); err != nil {
+			return err
+		}
+		if err := os.WriteFile(target, data, 0644); err != nil {
+			return err
+		}
+		folderUIDs[e.FolderUID] = true
+	}
+
+	if err := splitFolders(targetDir, folderUIDs); err != nil {
+		return err
+	}
+	for _, kind := range []string{"datasources", "notifications"} {
+		data, err := os.ReadFile(filepath.Join(directory, kind, kind+".json"))
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if err := os.MkdirAll(filepath.Join(targetDir, kind), os.ModePerm); err != nil {
+			return err
+		}
+		if err := os.WriteFile(filepath.Join(targetDir, kind, kind+".json"), data, 0644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// splitFolders writes the pulled folders holding the dashboards of a target.
+func splitFolders(targetDir string, uids map[string]bool) error {
+	var folders []folderInfo
+	err := readResources(directory, "folders", &folders)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var kept []folderInfo
+	for _, f := range folders {
+		if uids[f.UID] {
+			kept = append(kept, f)
+		}
+	}
+	if len(kept) == 0 {
+		return nil
+	}
+	return writeResources(targetDir, "folders", kept)
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"time"
+)
+
+var (
+	// staleDays is how long a dashboard must go unviewed to be stale.
+	staleDays int
+	tagStale  bool
+)
+
+// staleTag is added to stale dashboards with -tag-stale.
+const staleTag = "stale"
+
+// lastViewedSort is the search sort option of Grafana Enterprise usage
+// insights ordering dashboards by last view, its sort meta being the time of
+// that view.
+const lastViewedSort = "viewed-recently"
+
+// staleDashboard is a dashboard with the time it was last viewed, or last
+// updated without usage insights.
+type staleDashboard struct {
+	board foundBoard
+	last  time.Time
+}
+
+// reportStale lists the dashboards not viewed for -stale-days, oldest
+// first, to feed cleanup campaigns. View times come from the usage insights
+// of Grafana Enterprise; other editions don't record them, so the time of
+// the last update is used instead. With -tag-stale, the stale dashboards
+// are also tagged stale.
+func reportStale(ctx context.Context) {
+	source := "viewed"
+	boards, err := client.Search(ctx, searchType(searchTypeDashboard), searchSort(lastViewedSort))
+	if err != nil || !hasSortMeta(boards) {
+		log.Printf("Warning: usage insights are not available (Grafana Enterprise), using the time of the last update instead")
+		source = "updated"
+		if boards, err = client.Search(ctx, searchType(searchTypeDashboard)); err != nil {
+			log.Fatalf("Error searching dashboards: %s", describeError(err))
+		}
+	}
+
+	cutoff := time.Now().AddDate(0, 0, -staleDays)
+	var stale []staleDashboard
+	for _, board := range boards {
+		if stopped(ctx) {
+			break
+		}
+		var last time.Time
+		if source == "viewed" {
+			last = sortMetaTime(board.SortMeta)
+		} else {
+			_, meta, err := client.GetRawDashboardByUID(ctx, board.UID)
+			if err != nil {
+				log.Printf("Error fetching dashboard UID %s: %s", board.UID, describeError(err))
+				continue
+			}
+			last = meta.Updated
+		}
+		if last.Before(cutoff) {
+			stale = append(stale, staleDashboard{board: board, last: last})
+		}
+	}
+	sort.SliceStable(stale, func(i, j int) bool { return stale[i].last.Before(stale[j].last) })
+
+	header := []string{"folder", "dashboard", "uid", "url", "last_" + source, "days"}
+	var rows [][]string
+	for _, s := range stale {
+		folderTitle := s.board.FolderTitle
+		if folderTitle == "" {
+			folderTitle = generalFolder
+		}
+		last, days := "never", ""
+		if !s.last.IsZero() {
+			last = s.last.UTC().Format(time.RFC3339)
+			days = strconv.Itoa(int(time.Since(s.last).Hours() / 24))
+		}
+		rows = append(rows, []string{folderTitle, s.board.Title, s.board.UID, s.board.link(), last, days})
+	}
+	writeReport(header, rows)
+
+	if !tagStale {
+		return
+	}
+	for _, s := range stale {
+		if stopped(ctx) {
+			return
+		}
+		if err := tagDashboard(ctx, s.board.UID, staleTag); err != nil {
+			log.Printf("Error tagging dashboard %s: %s", s.board.Title, describeError(err))
+			continue
+		}
+		log.Printf("Tagged dashboard %s as %s", s.board.Title, staleTag)
+	}
+}
+
+// hasSortMeta reports whether the search results carry the sort meta of
+// usage insights, which editions without them leave out.
+func hasSortMeta(boards []foundBoard) bool {
+	for _, board := range boards {
+		if board.SortMeta != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// sortMetaTime decodes a last view time, given as Unix milliseconds or as
+// a timestamp. Dashboards never viewed have no time.
+func sortMetaTime(meta json.RawMessage) time.Time {
+	var ms int64
+	if err := json.Unmarshal(meta, &ms); err == nil {
+		if ms <= 0 {
+			return time.Time{}
+		}
+		return time.UnixMilli(ms)
+	}
+	var t time.Time
+	json.Unmarshal(meta, &t)
+	return t
+}
+
+// tagDashboard adds a tag to a dashboard, keeping it in its folder.
+// Provisioned dashboards can't be saved and are left alone.
+func tagDashboard(ctx context.Context, uid, tag string) error {
+	raw, meta, err := client.GetRawDashboardByUID(ctx, uid)
+	if err != nil {
+		return err
+	}
+	if meta.Provisioned {
+		return fmt.Errorf("dashboard is provisioned")
+	}
+	var board map[string]interface{}
+	if err := json.Unmarshal(raw, &board); err != nil {
+		return err
+	}
+	tags, _ := board["tags"].([]interface{})
+	for _, t := range tags {
+		if t == tag {
+			return nil
+		}
+	}
+	board["tags"] = append(tags, tag)
+
+	data, err := json.Marshal(board)
+	if err != nil {
+		return err
+	}
+	_, err = client.SetRawDashboardWithParam(ctx, rawBoardRequest{
+		Dashboard:  data,
+		Parameters: setDashboardParams{FolderUID: meta.FolderUID, Overwrite: true, Message: "Tagged " + tag + " by grafana-sync"},
+	})
+	return err
+}
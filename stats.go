@@ -0,0 +1,189 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+var (
+	// pushgatewayURL, when set, receives the statistics of the stats action
+	// instead of stdout.
+	pushgatewayURL string
+	// pushgatewayJob is the job the statistics are grouped under on the
+	// Pushgateway.
+	pushgatewayJob string
+)
+
+// dashboardStats describes a dashboard of the directory.
+type dashboardStats struct {
+	UID    string `json:"uid"`
+	Title  string `json:"title"`
+	Folder string `json:"folder"`
+	Panels int    `json:"panels"`
+}
+
+// estateStats are the statistics of the pulled directory printed by stats.
+type estateStats struct {
+	Dashboards          int              `json:"dashboards"`
+	DashboardsPerFolder map[string]int   `json:"dashboardsPerFolder"`
+	Panels              int              `json:"panels"`
+	PanelsPerDashboard  []dashboardStats `json:"panelsPerDashboard"`
+	AlertRules          int              `json:"alertRules"`
+	AlertRulesPerFolder map[string]int   `json:"alertRulesPerFolder"`
+	Datasources         int              `json:"datasources"`
+	DatasourceTypes     map[string]int   `json:"datasourceTypes"`
+}
+
+// printStats counts the dashboards, panels, alert rules and datasources of
+// the directory, so that the size of the synced estate can be followed over
+// time. Dashboards are in the folder the pull manifest records for them,
+// otherwise in the folder push would put them in. The statistics are
+// printed as JSON, or pushed to -pushgateway as Prometheus metrics.
+func printStats() {
+	stats := estateStats{
+		DashboardsPerFolder: map[string]int{},
+		PanelsPerDashboard:  []dashboardStats{},
+		AlertRulesPerFolder: map[string]int{},
+		DatasourceTypes:     map[string]int{},
+	}
+
+	m, err := readManifest(directory)
+	if err != nil && !os.IsNotExist(err) {
+		log.Fatalf("Error reading manifest: %v", err)
+	}
+	pulledFolders := map[string]string{}
+	for _, e := range m.Dashboards {
+		pulledFolders[e.Path] = e.FolderTitle
+	}
+	files, err := dashboardSources()
+	if err != nil && !os.IsNotExist(err) {
+		log.Fatalf("Error reading dashboards directory: %v", err)
+	}
+	for _, path := range files {
+		data, err := loadDashboard(path)
+		if err != nil {
+			log.Fatalf("Error reading %s: %v", path, err)
+		}
+		var dashboard map[string]interface{}
+		if err := json.Unmarshal(data, &dashboard); err != nil {
+			log.Fatalf("Error parsing %s: %v", path, err)
+		}
+		d := dashboardStats{Panels: len(dashboardPanels(dashboard))}
+		d.UID, _ = dashboard["uid"].(string)
+		d.Title, _ = dashboard["title"].(string)
+		rel, _ := filepath.Rel(directory, path)
+		if title, ok := pulledFolders[rel]; ok {
+			d.Folder = title
+		} else if folder != "" {
+			d.Folder = folder
+		} else {
+			d.Folder = "General"
+		}
+		stats.Dashboards++
+		stats.DashboardsPerFolder[d.Folder]++
+		stats.Panels += d.Panels
+		stats.PanelsPerDashboard = append(stats.PanelsPerDashboard, d)
+	}
+
+	folderTitles := map[string]string{}
+	var folders []folderInfo
+	if err := readResources(directory, "folders", &folders); err != nil && !os.IsNotExist(err) {
+		log.Fatalf("Error reading folders file: %v", err)
+	}
+	for _, f := range folders {
+		folderTitles[f.UID] = f.Title
+	}
+	groups, err := ruleGroupFiles(directory)
+	if err != nil && !os.IsNotExist(err) {
+		log.Fatalf("Error reading alert-rules directory: %v", err)
+	}
+	for _, path := range groups {
+		g, err := readRuleGroup(path)
+		if err != nil {
+			log.Fatalf("Error reading %s: %v", path, err)
+		}
+		title, ok := folderTitles[g.FolderUID]
+		if !ok {
+			title = g.FolderUID
+		}
+		stats.AlertRules += len(g.Rules)
+		stats.AlertRulesPerFolder[title] += len(g.Rules)
+	}
+
+	var datasources []datasource
+	if err := readResources(directory, "datasources", &datasources); err != nil && !os.IsNotExist(err) {
+		log.Fatalf("Error reading datasources file: %v", err)
+	}
+	for _, ds := range datasources {
+		stats.Datasources++
+		stats.DatasourceTypes[ds.Type]++
+	}
+
+	if pushgatewayURL == "" {
+		out, _ := json.MarshalIndent(stats, "", "  ")
+		fmt.Println(string(out))
+		return
+	}
+	if err := pushStats(stats); err != nil {
+		log.Fatalf("Error pushing statistics to %s: %v", pushgatewayURL, err)
+	}
+	fmt.Printf("Pushed statistics to %s\n", pushgatewayURL)
+}
+
+// pushStats replaces the metrics of -pushgateway-job on the Pushgateway with
+// the statistics.
+func pushStats(stats estateStats) error {
+	var b bytes.Buffer
+	gauge := func(name, help string) {
+		fmt.Fprintf(&b, "# HELP %s %s\n# TYPE %s gauge\n", name, help, name)
+	}
+	gauge("grafana_sync_estate_dashboards", "Number of dashboards per folder.")
+	for _, f := range sortedKeys(stats.DashboardsPerFolder) {
+		fmt.Fprintf(&b, "grafana_sync_estate_dashboards{folder=%q} %d\n", f, stats.DashboardsPerFolder[f])
+	}
+	gauge("grafana_sync_estate_dashboard_panels", "Number of panels of a dashboard.")
+	for _, d := range stats.PanelsPerDashboard {
+		fmt.Fprintf(&b, "grafana_sync_estate_dashboard_panels{uid=%q,title=%q,folder=%q} %d\n", d.UID, d.Title, d.Folder, d.Panels)
+	}
+	gauge("grafana_sync_estate_alert_rules", "Number of alert rules per folder.")
+	for _, f := range sortedKeys(stats.AlertRulesPerFolder) {
+		fmt.Fprintf(&b, "grafana_sync_estate_alert_rules{folder=%q} %d\n", f, stats.AlertRulesPerFolder[f])
+	}
+	gauge("grafana_sync_estate_datasources", "Number of datasources per type.")
+	for _, t := range sortedKeys(stats.DatasourceTypes) {
+		fmt.Fprintf(&b, "grafana_sync_estate_datasources{type=%q} %d\n", t, stats.DatasourceTypes[t])
+	}
+
+	endpoint := strings.TrimSuffix(pushgatewayURL, "/") + "/metrics/job/" + url.PathEscape(pushgatewayJob)
+	req, err := http.NewRequest(http.MethodPut, endpoint, &b)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "text/plain; version=0.0.4")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 400 {
+		return fmt.Errorf("pushgateway returned %d", resp.StatusCode)
+	}
+	return nil
+}
+
+func sortedKeys(m map[string]int) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Outcomes recorded in the run summary.
+const (
+	outcomePushed      = "pushed"
+	outcomeFailed      = "failed"
+	outcomeProvisioned = "provisioned"
+)
+
+// runSummary collects what happened to each resource during a run so that a
+// short report can be printed once all actions are done. It is safe for
+// concurrent use.
+type runSummary struct {
+	mu    sync.Mutex
+	kinds []string
+	items map[string]map[string][]string
+	// observe, when set, is called with every recorded outcome.
+	observe func(kind, outcome, name string)
+}
+
+var summary = newRunSummary()
+
+func newRunSummary() *runSummary {
+	return &runSummary{items: map[string]map[string][]string{}}
+}
+
+// add records the outcome for a named resource of the given kind.
+func (s *runSummary) add(kind, outcome, name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.items[kind]; !ok {
+		s.kinds = append(s.kinds, kind)
+		s.items[kind] = map[string][]string{}
+	}
+	s.items[kind][outcome] = append(s.items[kind][outcome], name)
+	if s.observe != nil {
+		s.observe(kind, outcome, name)
+	}
+}
+
+// failed reports whether any resource failed.
+func (s *runSummary) failed() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, outcomes := range s.items {
+		if len(outcomes[outcomeFailed]) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// counts returns the number of resources by kind and outcome, keyed as
+// "<kind> <outcome>".
+func (s *runSummary) counts() map[string]int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	counts := make(map[string]int)
+	for kind, outcomes := range s.items {
+		for outcome, names := range outcomes {
+			counts[kind+" "+outcome] = len(names)
+		}
+	}
+	return counts
+}
+
+// print writes the counts per kind and outcome, listing the resources of
+// every outcome other than a plain push or an unchanged resource.
+func (s *runSummary) print() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.kinds) == 0 {
+		return
+	}
+
+	fmt.Println("Summary:")
+	for _, kind := range s.kinds {
+		outcomes := make([]string, 0, len(s.items[kind]))
+		for outcome := range s.items[kind] {
+			outcomes = append(outcomes, outcome)
+		}
+		sort.Strings(outcomes)
+
+		counts := make([]string, 0, len(outcomes))
+		for _, outcome := range outcomes {
+			label := outcome
+			if dryRun && outcome == outcomePushed {
+				label = outcomeDryRun
+			}
+			counts = append(counts, fmt.Sprintf("%d %s", len(s.items[kind][outcome]), label))
+		}
+		fmt.Printf("  %s: %s\n", kind, strings.Join(counts, ", "))
+
+		for _, outcome := range outcomes {
+			if outcome == outcomePushed || outcome == outcomeUnchanged {
+				continue
+			}
+			for _, name := range s.items[kind][outcome] {
+				fmt.Printf("    %s: %s\n", outcome, name)
+			}
+		}
+	}
+	if dryRun {
+		fmt.Println("Dry run: nothing was changed on the instance")
+	}
+}
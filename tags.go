@@ -0,0 +1,27 @@
+package main
+
+import "encoding/json"
+
+// dashboardTags limits pull and push to the dashboards carrying every one of
+// these tags, as the tag parameter of the search API does.
+var dashboardTags stringList
+
+// hasDashboardTags reports whether a dashboard given as JSON carries every
+// tag of -tag.
+func hasDashboardTags(data []byte) (bool, error) {
+	if len(dashboardTags) == 0 {
+		return true, nil
+	}
+	var dashboard struct {
+		Tags stringList `json:"tags"`
+	}
+	if err := json.Unmarshal(data, &dashboard); err != nil {
+		return false, err
+	}
+	for _, tag := range dashboardTags {
+		if !dashboard.Tags.contains(tag) {
+			return false, nil
+		}
+	}
+	return true, nil
+}
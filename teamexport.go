@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// groupByTeam makes pull-dashboards lay dashboards out per owning team.
+var groupByTeam bool
+
+// unownedTeam collects dashboards whose folder grants no team permission,
+// including the dashboards of the General folder.
+const unownedTeam = "unowned"
+
+// folderOwners caches the owning team of every folder seen during a pull.
+var (
+	folderOwners   = make(map[string]string)
+	folderOwnersMu sync.Mutex
+)
+
+// folderOwner returns the team owning a folder: the team with the highest
+// permission on it, the first by name on ties.
+func folderOwner(ctx context.Context, folderUID string) (string, error) {
+	if folderUID == "" {
+		return unownedTeam, nil
+	}
+	folderOwnersMu.Lock()
+	defer folderOwnersMu.Unlock()
+	if owner, ok := folderOwners[folderUID]; ok {
+		return owner, nil
+	}
+
+	endpoint := fmt.Sprintf("%s/api/folders/%s/permissions", baseURL, url.PathEscape(folderUID))
+	data, status, err := doRequest(ctx, "GET", endpoint, nil)
+	if err != nil {
+		return "", err
+	}
+	if status >= 400 {
+		return "", newAPIError(status, data)
+	}
+
+	var items []struct {
+		Team       string `json:"team"`
+		Permission int    `json:"permission"`
+	}
+	if err := json.Unmarshal(data, &items); err != nil {
+		return "", err
+	}
+	sort.Slice(items, func(i, j int) bool {
+		if items[i].Permission != items[j].Permission {
+			return items[i].Permission > items[j].Permission
+		}
+		return items[i].Team < items[j].Team
+	})
+
+	owner := unownedTeam
+	for _, item := range items {
+		if item.Team != "" {
+			owner = item.Team
+			break
+		}
+	}
+	folderOwners[folderUID] = owner
+	return owner, nil
+}
+
+// teamDirectory returns the directory, relative to -directory, holding the
+// resources of a team. It is laid out like a pulled directory so it can be
+// used as a route or as the -directory of another run.
+func teamDirectory(team string) string {
+	return "teams/" + strings.NewReplacer("/", "-", "\\", "-").Replace(team)
+}
@@ -0,0 +1,258 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+)
+
+// team is a team as stored in teams/teams.json, with its members and
+// preferences. Teams are matched by name, members by login, since IDs
+// differ between instances.
+type team struct {
+	Name        string           `json:"name"`
+	Email       string           `json:"email,omitempty"`
+	Members     []teamMember     `json:"members"`
+	Preferences *teamPreferences `json:"preferences,omitempty"`
+}
+
+// teamMember is a member of a team. Permission 4 makes the member an admin
+// of the team.
+type teamMember struct {
+	Login      string `json:"login"`
+	Email      string `json:"email,omitempty"`
+	Permission int    `json:"permission,omitempty"`
+}
+
+// teamPreferences are the preferences of a team. The home dashboard is kept
+// by UID only.
+type teamPreferences struct {
+	Theme            string `json:"theme,omitempty"`
+	HomeDashboardUID string `json:"homeDashboardUID,omitempty"`
+	Timezone         string `json:"timezone,omitempty"`
+	WeekStart        string `json:"weekStart,omitempty"`
+}
+
+// teamPageSize is the number of teams listed per request.
+const teamPageSize = 1000
+
+func (t team) validate() error {
+	if t.Name == "" {
+		return errors.New("has no name")
+	}
+	for _, m := range t.Members {
+		if m.Login == "" {
+			return errors.New("has a member without login")
+		}
+	}
+	return nil
+}
+
+// listTeams returns the teams of the instance, and their IDs by name.
+func listTeams(ctx context.Context) (map[string]int, []team, error) {
+	ids := make(map[string]int)
+	var teams []team
+	for page := 1; ; page++ {
+		var result struct {
+			Teams []struct {
+				ID    int    `json:"id"`
+				Name  string `json:"name"`
+				Email string `json:"email"`
+			} `json:"teams"`
+		}
+		data, status, err := doRequest(ctx, "GET", fmt.Sprintf("%s/api/teams/search?perpage=%d&page=%d", baseURL, teamPageSize, page), nil)
+		if err != nil {
+			return nil, nil, err
+		}
+		if status >= 400 {
+			return nil, nil, newAPIError(status, data)
+		}
+		if err := json.Unmarshal(data, &result); err != nil {
+			return nil, nil, err
+		}
+		for _, t := range result.Teams {
+			ids[t.Name] = t.ID
+			teams = append(teams, team{Name: t.Name, Email: t.Email})
+		}
+		if len(result.Teams) < teamPageSize {
+			return ids, teams, nil
+		}
+	}
+}
+
+// teamMembers returns the members of a team with their user IDs.
+func teamMembers(ctx context.Context, teamID int) ([]teamMember, map[string]int, error) {
+	var members []struct {
+		teamMember
+		UserID int `json:"userId"`
+	}
+	data, status, err := doRequest(ctx, "GET", fmt.Sprintf("%s/api/teams/%d/members", baseURL, teamID), nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	if status >= 400 {
+		return nil, nil, newAPIError(status, data)
+	}
+	if err := json.Unmarshal(data, &members); err != nil {
+		return nil, nil, err
+	}
+	list := []teamMember{}
+	ids := make(map[string]int, len(members))
+	for _, m := range members {
+		list = append(list, m.teamMember)
+		ids[m.Login] = m.UserID
+	}
+	return list, ids, nil
+}
+
+func pullTeams(ctx context.Context) {
+	fmt.Println("Pulling teams...")
+	ids, teams, err := listTeams(ctx)
+	if err != nil {
+		log.Fatalf("Error listing teams: %s", describeError(err))
+	}
+
+	pulled := []team{}
+	for _, t := range teams {
+		if stopped(ctx) {
+			return
+		}
+		if !included("teams", t.Name) {
+			continue
+		}
+		if t.Members, _, err = teamMembers(ctx, ids[t.Name]); err != nil {
+			log.Printf("Error fetching members of team %s: %s", t.Name, describeError(err))
+			continue
+		}
+		var prefs teamPreferences
+		data := sendRequest(ctx, "GET", fmt.Sprintf("%s/api/teams/%d/preferences", baseURL, ids[t.Name]), nil)
+		if err := json.Unmarshal(data, &prefs); err != nil {
+			log.Printf("Error unmarshalling preferences of team %s: %v", t.Name, err)
+			continue
+		}
+		if prefs != (teamPreferences{}) {
+			t.Preferences = &prefs
+		}
+		pulled = append(pulled, t)
+	}
+	if err := writePulledResources(directory, "teams", pulled); err != nil {
+		fmt.Println("Error saving teams:", err)
+		return
+	}
+	fmt.Println("Saved teams")
+}
+
+// pushTeams creates or updates the local teams, adds their missing members
+// and sets their preferences. Members of a team that aren't in the file are
+// kept, so that users and service accounts added on the instance aren't
+// dropped.
+func pushTeams(ctx context.Context) {
+	fmt.Println("Pushing teams...")
+	var list []team
+	if err := readResources(directory, "teams", &list); err != nil {
+		fmt.Println("Error reading teams file:", err)
+		return
+	}
+	ids, _, err := listTeams(ctx)
+	if err != nil {
+		log.Fatalf("Error listing teams: %s", describeError(err))
+	}
+
+	for _, t := range list {
+		if stopped(ctx) {
+			break
+		}
+		if !included("teams", t.Name) {
+			continue
+		}
+		var pushed team
+		if _, err := pushPayload("teams", t, &pushed); err != nil {
+			fmt.Printf("Error preparing team %s: %v\n", t.Name, err)
+			summary.add("teams", outcomeFailed, t.Name)
+			continue
+		}
+		if err := pushTeam(ctx, pushed, ids); err != nil {
+			log.Printf("Error pushing team %s: %s", pushed.Name, describeError(err))
+			summary.add("teams", outcomeFailed, pushed.Name)
+			continue
+		}
+		printChange("Uploaded team: %s\n", pushed.Name)
+		summary.add("teams", outcomePushed, pushed.Name)
+	}
+}
+
+// pushTeam creates or updates a team, given the IDs of the existing teams
+// by name, then syncs its members and preferences.
+func pushTeam(ctx context.Context, t team, ids map[string]int) error {
+	body, _ := json.Marshal(map[string]string{"name": t.Name, "email": t.Email})
+	teamID, exists := ids[t.Name]
+	method, endpoint := "POST", baseURL+"/api/teams"
+	if exists {
+		method, endpoint = "PUT", fmt.Sprintf("%s/api/teams/%d", baseURL, teamID)
+	}
+	data, status, err := doRequest(ctx, method, endpoint, body)
+	if err == nil && status >= 400 {
+		err = newAPIError(status, data)
+	}
+	if err != nil {
+		return err
+	}
+	if !exists {
+		var created struct {
+			TeamID int `json:"teamId"`
+		}
+		if err := json.Unmarshal(data, &created); err != nil {
+			return err
+		}
+		teamID = created.TeamID
+		printChange("Created team: %s\n", t.Name)
+	}
+
+	current, userIDs, err := teamMembers(ctx, teamID)
+	if err != nil {
+		return err
+	}
+	permissions := make(map[string]int, len(current))
+	for _, m := range current {
+		permissions[m.Login] = m.Permission
+	}
+	for _, m := range t.Members {
+		userID, member := userIDs[m.Login]
+		if !member {
+			if userID, err = lookupUserID(ctx, m.Login); err != nil {
+				return err
+			}
+			body, _ := json.Marshal(map[string]int{"userId": userID})
+			if err := teamRequest(ctx, "POST", fmt.Sprintf("/api/teams/%d/members", teamID), body); err != nil {
+				return fmt.Errorf("adding member %s: %w", m.Login, err)
+			}
+			fmt.Printf("Added %s to team %s\n", m.Login, t.Name)
+		}
+		if permissions[m.Login] != m.Permission {
+			body, _ := json.Marshal(map[string]int{"permission": m.Permission})
+			if err := teamRequest(ctx, "PUT", fmt.Sprintf("/api/teams/%d/members/%d", teamID, userID), body); err != nil {
+				return fmt.Errorf("setting the permission of member %s: %w", m.Login, err)
+			}
+		}
+	}
+
+	if t.Preferences != nil {
+		body, _ := json.Marshal(t.Preferences)
+		if err := teamRequest(ctx, "PUT", fmt.Sprintf("/api/teams/%d/preferences", teamID), body); err != nil {
+			return fmt.Errorf("setting preferences: %w", err)
+		}
+	}
+	return nil
+}
+
+// teamRequest sends a request to a team endpoint, returning error statuses
+// as errors.
+func teamRequest(ctx context.Context, method, path string, body []byte) error {
+	data, status, err := doRequest(ctx, method, baseURL+path, body)
+	if err == nil && status >= 400 {
+		err = newAPIError(status, data)
+	}
+	return err
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+)
+
+var (
+	// matchPatterns limits pull and push to the dashboards and datasources
+	// whose title or name matches one of these patterns.
+	matchPatterns stringList
+	// excludePatterns skips the dashboards and datasources whose title or
+	// name matches one of these patterns.
+	excludePatterns stringList
+)
+
+// titleFilterKinds are the resource kinds -match and -exclude apply to.
+var titleFilterKinds = []string{"dashboards", "datasources"}
+
+// titlePattern is a pattern of -match or -exclude: a regular expression when
+// written between slashes, as in /^test-/, and a glob otherwise.
+type titlePattern struct {
+	glob string
+	re   *regexp.Regexp
+}
+
+func (p titlePattern) matches(name string) bool {
+	if p.re != nil {
+		return p.re.MatchString(name)
+	}
+	ok, _ := path.Match(p.glob, name)
+	return ok
+}
+
+var titleMatches, titleExcludes []titlePattern
+
+// parseTitleFilters compiles -match and -exclude, so that invalid patterns
+// are reported before anything is synced.
+func parseTitleFilters() error {
+	var err error
+	if titleMatches, err = parseTitlePatterns("match", matchPatterns); err != nil {
+		return err
+	}
+	titleExcludes, err = parseTitlePatterns("exclude", excludePatterns)
+	return err
+}
+
+func parseTitlePatterns(name string, patterns []string) ([]titlePattern, error) {
+	var parsed []titlePattern
+	for _, pattern := range patterns {
+		if len(pattern) > 1 && strings.HasPrefix(pattern, "/") && strings.HasSuffix(pattern, "/") {
+			re, err := regexp.Compile(pattern[1 : len(pattern)-1])
+			if err != nil {
+				return nil, fmt.Errorf("-%s: invalid regular expression %q: %v", name, pattern, err)
+			}
+			parsed = append(parsed, titlePattern{re: re})
+			continue
+		}
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("-%s: invalid pattern %q", name, pattern)
+		}
+		parsed = append(parsed, titlePattern{glob: pattern})
+	}
+	return parsed, nil
+}
+
+// titleSelected reports whether a dashboard title or datasource name passes
+// -match and -exclude. Other kinds always pass.
+func titleSelected(kind, name string) bool {
+	if !stringList(titleFilterKinds).contains(kind) {
+		return true
+	}
+	if len(titleMatches) > 0 && !matchesTitle(titleMatches, name) {
+		return false
+	}
+	return !matchesTitle(titleExcludes, name)
+}
+
+func matchesTitle(patterns []titlePattern, name string) bool {
+	for _, p := range patterns {
+		if p.matches(name) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+)
+
+// resourceKinds lists the resource types that can be synced.
+var resourceKinds = []string{"dashboards", "datasources", "folders", "notifications", "playlists", "teams", "users", "service-accounts", "annotations"}
+
+// transformFlag collects kind=command pairs given with -transform.
+type transformFlag map[string][]string
+
+var transforms = transformFlag{}
+
+func (t transformFlag) String() string {
+	var pairs []string
+	for kind, commands := range t {
+		for _, command := range commands {
+			pairs = append(pairs, kind+"="+command)
+		}
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+func (t transformFlag) Set(value string) error {
+	kind, command, ok := strings.Cut(value, "=")
+	if !ok || strings.TrimSpace(command) == "" {
+		return fmt.Errorf("expected kind=command, got %q", value)
+	}
+	if !isResourceKind(kind) {
+		return fmt.Errorf("unknown resource kind %q, must be one of %s", kind, strings.Join(resourceKinds, ", "))
+	}
+	t[kind] = append(t[kind], command)
+	return nil
+}
+
+func isResourceKind(kind string) bool {
+	for _, k := range resourceKinds {
+		if k == kind {
+			return true
+		}
+	}
+	return false
+}
+
+// applyTransforms pipes a resource through every transform configured for its
+// kind, in the order given on the command line. Each transform is run with
+// sh -c, so that arguments can be quoted as in a shell, receives the resource
+// JSON on stdin and must print the resulting JSON on stdout.
+func applyTransforms(kind string, data []byte) ([]byte, error) {
+	for _, command := range transforms[kind] {
+		cmd := shellCommand(context.Background(), command)
+		cmd.Stdin = bytes.NewReader(data)
+		cmd.Stderr = os.Stderr
+		cmd.Env = append(os.Environ(), "GRAFANA_SYNC_KIND="+kind)
+
+		out, err := cmd.Output()
+		if err != nil {
+			return nil, fmt.Errorf("transform %q failed: %w", command, err)
+		}
+		if !json.Valid(out) {
+			return nil, fmt.Errorf("transform %q returned invalid JSON", command)
+		}
+		data = out
+	}
+	return data, nil
+}
+
+// shellCommand returns a command running a user-supplied command line with
+// sh -c, so that its arguments can be quoted as in a shell, for example
+// around a jq filter.
+func shellCommand(ctx context.Context, command string) *exec.Cmd {
+	return exec.CommandContext(ctx, "sh", "-c", command)
+}
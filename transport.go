@@ -0,0 +1,205 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// httpClient is used for every API call so that every request goes through
+// the same transport.
+var httpClient = &http.Client{Transport: &transport{next: http.DefaultTransport}}
+
+// transport wraps the default RoundTripper with the tool's request handling.
+type transport struct {
+	next http.RoundTripper
+}
+
+// rateLimit caps the number of API calls per second, 0 means no limit.
+var rateLimit float64
+
+// limiter spaces API calls according to rateLimit.
+var limiter struct {
+	mu   sync.Mutex
+	next time.Time
+}
+
+// waitForRateLimit blocks until the next API call is allowed or the context
+// of the call is done.
+func waitForRateLimit(ctx context.Context) error {
+	if rateLimit <= 0 {
+		return nil
+	}
+	limiter.mu.Lock()
+	now := time.Now()
+	if limiter.next.Before(now) {
+		limiter.next = now
+	}
+	wait := limiter.next.Sub(now)
+	limiter.next = limiter.next.Add(time.Duration(float64(time.Second) / rateLimit))
+	limiter.mu.Unlock()
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (t *transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if err := waitForRateLimit(req.Context()); err != nil {
+		return nil, err
+	}
+	requestID := newRequestID()
+	req = req.Clone(req.Context())
+	req.Header.Set("User-Agent", userAgent)
+	req.Header.Set("X-Request-Id", requestID)
+	if actingUser != "" {
+		req.Header.Set(actingUserHeader, actingUser)
+	}
+	if orgID > 0 {
+		req.Header.Set("X-Grafana-Org-Id", strconv.Itoa(orgID))
+	}
+	if logRequests {
+		log.Printf("%s %s request-id=%s", req.Method, req.URL.Redacted(), requestID)
+	}
+	if dryRun && mutating(req) {
+		return t.dryRunResponse(req)
+	}
+
+	var reqBody []byte
+	if debugHTTPDir != "" && req.Body != nil {
+		reqBody, _ = io.ReadAll(req.Body)
+		req.Body.Close()
+		req.Body = io.NopCloser(bytes.NewReader(reqBody))
+	}
+
+	resp, err := t.next.RoundTrip(req)
+	if err == nil && resp.StatusCode >= 400 && (logRequests || resp.StatusCode != http.StatusNotFound) {
+		log.Printf("%s %s returned %d request-id=%s", req.Method, req.URL.Redacted(), resp.StatusCode, requestID)
+	}
+
+	if debugHTTPDir != "" && (err != nil || resp.StatusCode >= 400) {
+		var respBody []byte
+		if resp != nil {
+			respBody, _ = io.ReadAll(resp.Body)
+			resp.Body.Close()
+			resp.Body = io.NopCloser(bytes.NewReader(respBody))
+		}
+		if err := captureExchange(req, reqBody, resp, respBody, err); err != nil {
+			fmt.Println("Error recording HTTP exchange:", err)
+		}
+	}
+	return resp, err
+}
+
+// newRequestID returns a random identifier sent as X-Request-Id so that
+// Grafana server logs can be correlated with a sync run.
+func newRequestID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return fmt.Sprintf("%d", time.Now().UnixNano())
+	}
+	return hex.EncodeToString(b)
+}
+
+// Headers and JSON fields that never end up in debug captures.
+var (
+	sensitiveHeaders = []string{"Authorization", "Cookie", "Set-Cookie", "X-Api-Key"}
+	sensitiveFields  = map[string]bool{
+		"secureJsonData":    true,
+		"secureSettings":    true,
+		"password":          true,
+		"basicAuthPassword": true,
+		"key":               true,
+	}
+)
+
+var captureSeq int64
+
+// captureExchange writes a sanitized request/response pair to debugHTTPDir.
+func captureExchange(req *http.Request, reqBody []byte, resp *http.Response, respBody []byte, rtErr error) error {
+	if err := os.MkdirAll(debugHTTPDir, os.ModePerm); err != nil {
+		return err
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s %s\n", req.Method, req.URL.Redacted())
+	writeHeaders(&b, req.Header)
+	fmt.Fprintf(&b, "\n%s\n\n", sanitizeBody(reqBody))
+	if rtErr != nil {
+		fmt.Fprintf(&b, "Error: %v\n", rtErr)
+	} else {
+		fmt.Fprintf(&b, "%s %s\n", resp.Proto, resp.Status)
+		writeHeaders(&b, resp.Header)
+		fmt.Fprintf(&b, "\n%s\n", sanitizeBody(respBody))
+	}
+
+	name := fmt.Sprintf("%s-%03d-%s%s.txt",
+		time.Now().Format("20060102T150405"),
+		atomic.AddInt64(&captureSeq, 1),
+		req.Method,
+		nonFileChars.ReplaceAllString(req.URL.Path, "_"))
+	return os.WriteFile(filepath.Join(debugHTTPDir, name), []byte(b.String()), 0600)
+}
+
+var nonFileChars = regexp.MustCompile(`[^A-Za-z0-9.-]+`)
+
+func writeHeaders(b *strings.Builder, header http.Header) {
+	h := header.Clone()
+	for _, name := range sensitiveHeaders {
+		if h.Get(name) != "" {
+			h.Set(name, "[REDACTED]")
+		}
+	}
+	h.Write(b)
+}
+
+// sanitizeBody redacts secret fields from JSON bodies. Other bodies are
+// returned unchanged.
+func sanitizeBody(body []byte) []byte {
+	var v interface{}
+	if err := json.Unmarshal(body, &v); err != nil {
+		return body
+	}
+	out, err := json.MarshalIndent(redact(v), "", "  ")
+	if err != nil {
+		return body
+	}
+	return out
+}
+
+func redact(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for k, val := range v {
+			if sensitiveFields[k] {
+				v[k] = "[REDACTED]"
+			} else {
+				v[k] = redact(val)
+			}
+		}
+	case []interface{}:
+		for i, val := range v {
+			v[i] = redact(val)
+		}
+	}
+	return v
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"strings"
+)
+
+var (
+	// dashboardUIDs limits pull and push to these dashboards, by the UID of
+	// their file.
+	dashboardUIDs stringList
+	// uidFile lists more UIDs for -uid, one per line.
+	uidFile string
+)
+
+// loadUIDFile adds the UIDs of -uid-file to -uid, skipping blank lines and
+// # comments.
+func loadUIDFile() error {
+	f, err := os.Open(uidFile)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line != "" && !strings.HasPrefix(line, "#") {
+			dashboardUIDs = append(dashboardUIDs, line)
+		}
+	}
+	return scanner.Err()
+}
+
+// uidSelected reports whether a dashboard UID of the instance passes -uid.
+// The UIDs of -uid are those of the files, translated with -uid-aliases.
+func uidSelected(uid string) bool {
+	if len(dashboardUIDs) == 0 {
+		return true
+	}
+	for _, u := range dashboardUIDs {
+		if environmentUID(u) == uid {
+			return true
+		}
+	}
+	return false
+}
+
+// dashboardUID returns the UID of a dashboard given as JSON, empty when it
+// can't be decoded.
+func dashboardUID(data []byte) string {
+	var dashboard struct {
+		UID string `json:"uid"`
+	}
+	json.Unmarshal(data, &dashboard)
+	return dashboard.UID
+}
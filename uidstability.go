@@ -0,0 +1,103 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// compareDir is the second pull compared by the uid-stability report.
+var compareDir string
+
+// reportUIDStability compares the dashboards of -directory and
+// -compare-directory, typically pulls of two environments, and lists the
+// dashboards that have the same title in the same folder but a different
+// UID, which breaks alert links and bookmarks between them.
+func reportUIDStability() {
+	if compareDir == "" {
+		log.Fatalf("Error: the uid-stability report needs -compare-directory")
+	}
+	left, err := pulledDashboards(directory)
+	if err != nil {
+		log.Fatalf("Error reading %s: %v", directory, err)
+	}
+	right, err := pulledDashboards(compareDir)
+	if err != nil {
+		log.Fatalf("Error reading %s: %v", compareDir, err)
+	}
+
+	byTitle := func(entries []manifestEntry) map[string][]string {
+		uids := make(map[string][]string)
+		for _, e := range entries {
+			key := e.FolderTitle + "/" + e.Title
+			uids[key] = append(uids[key], e.UID)
+		}
+		return uids
+	}
+	leftUIDs, rightUIDs := byTitle(left), byTitle(right)
+
+	var keys []string
+	for key := range leftUIDs {
+		if _, ok := rightUIDs[key]; ok {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	header := []string{"folder", "dashboard", "uid", "compare_uid"}
+	var rows [][]string
+	for _, key := range keys {
+		l, r := leftUIDs[key], rightUIDs[key]
+		sort.Strings(l)
+		sort.Strings(r)
+		if strings.Join(l, ",") == strings.Join(r, ",") {
+			continue
+		}
+		folderTitle, title, _ := strings.Cut(key, "/")
+		if folderTitle == "" {
+			folderTitle = generalFolder
+		}
+		rows = append(rows, []string{folderTitle, title, strings.Join(l, ";"), strings.Join(r, ";")})
+	}
+	writeReport(header, rows)
+}
+
+// pulledDashboards returns the dashboards of a pulled directory, from its
+// manifest when there is one and otherwise from the dashboard files, in
+// which case folders are unknown.
+func pulledDashboards(dir string) ([]manifestEntry, error) {
+	m, err := readManifest(dir)
+	if err == nil {
+		return m.Dashboards, nil
+	}
+	if !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	files, err := dashboardPaths(dir)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	var entries []manifestEntry
+	for _, path := range files {
+		if isComposeManifest(path) {
+			continue
+		}
+		dashboard, err := readDashboard(path)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return nil, err
+		}
+		e := manifestEntry{Path: rel}
+		e.UID, _ = dashboard["uid"].(string)
+		e.Title, _ = dashboard["title"].(string)
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
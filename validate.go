@@ -0,0 +1,114 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// validateData checks that the local resource files can be pushed, without
+// talking to Grafana, and exits with a non-zero status when problems are found.
+func validateData() {
+	fmt.Println("Validating local data...")
+
+	var problems []string
+	problems = append(problems, validateDashboards()...)
+	problems = append(problems, validateFolderPermissions()...)
+	problems = append(problems, validateDatasourcePermissions()...)
+	for _, kind := range []string{"datasources", "folders", "notifications", "playlists", "teams", "users", "service-accounts", "annotations"} {
+		problems = append(problems, validateList(kind)...)
+	}
+
+	for _, p := range problems {
+		fmt.Println("  " + p)
+	}
+	if len(problems) > 0 {
+		fmt.Printf("Found %d problem(s)\n", len(problems))
+		os.Exit(1)
+	}
+	fmt.Println("Local data is valid")
+}
+
+func validateDashboards() []string {
+	files, err := dashboardDirFiles(directory)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return []string{fmt.Sprintf("%s: %v", filepath.Join(directory, "dashboards"), err)}
+	}
+
+	var problems []string
+	for _, filePath := range files {
+		if isComposeManifest(filePath) {
+			composed, err := composeDashboard(filePath)
+			if err != nil {
+				problems = append(problems, fmt.Sprintf("%s: %v", filePath, err))
+				continue
+			}
+			data, _ := json.Marshal(composed)
+			problems = append(problems, guardrailProblems(filePath, data)...)
+			continue
+		}
+
+		if strings.HasSuffix(filePath, permissionsSuffix) {
+			if _, err := loadPermissions(filePath); err != nil {
+				problems = append(problems, fmt.Sprintf("%s: %v", filePath, err))
+			}
+			continue
+		}
+
+		data, err := os.ReadFile(filePath)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("%s: %v", filePath, err))
+			continue
+		}
+		var dashboard map[string]interface{}
+		if err := json.Unmarshal(data, &dashboard); err != nil {
+			problems = append(problems, fmt.Sprintf("%s: invalid JSON: %v", filePath, err))
+			continue
+		}
+		if title, _ := dashboard["title"].(string); title == "" {
+			problems = append(problems, fmt.Sprintf("%s: dashboard has no title", filePath))
+		}
+		problems = append(problems, guardrailProblems(filePath, data)...)
+	}
+	return problems
+}
+
+// validateList checks the list file of a resource kind, each item of which
+// must have its required fields set. A missing file is not a problem.
+func validateList(kind string) []string {
+	filePath := resourceFile(directory, kind)
+	items, err := readResourceList(directory, kind)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return []string{fmt.Sprintf("%s: %v", filePath, err)}
+	}
+
+	var problems []string
+	for i, item := range items {
+		if err := item.validate(); err != nil {
+			problems = append(problems, fmt.Sprintf("%s: item %d %v", filePath, i, err))
+		}
+	}
+	return problems
+}
+
+// guardrailProblems reports guardrail violations as problems in block mode
+// and only prints them as warnings otherwise.
+func guardrailProblems(filePath string, data []byte) []string {
+	var problems []string
+	for _, v := range checkGuardrails(data) {
+		if guardrailsBlock() {
+			problems = append(problems, fmt.Sprintf("%s: %s", filePath, v))
+		} else {
+			fmt.Printf("  warning: %s: %s\n", filePath, v)
+		}
+	}
+	return problems
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+)
+
+// Reasons a dashboard failed verification.
+const (
+	verifyMissingLocally  = "missing locally"
+	verifyModifiedLocally = "modified locally"
+	verifyMissingRemotely = "missing remotely"
+	verifyChangedRemotely = "changed remotely"
+	verifyUntracked       = "untracked"
+)
+
+// verifyDashboards compares the hashes of local files and remote
+// dashboards with the manifest of the last pull. It only reports which
+// side changed, which makes it much cheaper than a diff, and exits with a
+// non-zero status when anything doesn't match.
+func verifyDashboards(ctx context.Context) {
+	fmt.Println("Verifying dashboards...")
+	m, err := readManifest(directory)
+	if err != nil {
+		log.Fatalf("Error reading manifest, pull the dashboards first: %v", err)
+	}
+
+	failures := 0
+	report := func(reason string, e manifestEntry) {
+		fmt.Printf("  %s: %s - %s (%s)\n", reason, e.Title, e.UID, e.Path)
+		failures++
+	}
+
+	tracked := make(map[string]bool)
+	for _, e := range m.Dashboards {
+		if stopped(ctx) {
+			return
+		}
+		tracked[e.Path] = true
+
+		data, err := os.ReadFile(filepath.Join(directory, e.Path))
+		if os.IsNotExist(err) {
+			report(verifyMissingLocally, e)
+		} else if err != nil {
+			log.Fatalf("Error reading %s: %v", e.Path, err)
+		} else if hash, err := dashboardHash(data); err != nil || hash != e.Hash {
+			report(verifyModifiedLocally, e)
+		}
+
+		raw, _, err := client.GetRawDashboardByUID(ctx, e.UID)
+		if err != nil {
+			if apiErr, ok := asAPIError(err); ok && apiErr.StatusCode == http.StatusNotFound {
+				report(verifyMissingRemotely, e)
+				continue
+			}
+			log.Fatalf("Error fetching dashboard UID %s: %s", e.UID, describeError(err))
+		}
+		if hash, err := dashboardHash(raw); err != nil || hash != e.Hash {
+			report(verifyChangedRemotely, e)
+		}
+	}
+
+	files, err := dashboardFiles()
+	if err != nil && !os.IsNotExist(err) {
+		log.Fatalf("Error reading dashboards directory: %v", err)
+	}
+	for _, filePath := range files {
+		rel, _ := filepath.Rel(directory, filePath)
+		if !tracked[rel] {
+			fmt.Printf("  %s: %s\n", verifyUntracked, rel)
+			failures++
+		}
+	}
+
+	if failures > 0 {
+		fmt.Printf("Found %d mismatch(es)\n", failures)
+		os.Exit(1)
+	}
+	fmt.Printf("Verified %d dashboard(s)\n", len(m.Dashboards))
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// watermark marks the dashboards pushed to a non-production profile, so that
+// screenshots of them can't be mistaken for production.
+type watermark struct {
+	// Text is the watermark, such as STAGING.
+	Text string `yaml:"text"`
+	// Mode is where the watermark goes: title, panel or both. Defaults to
+	// title.
+	Mode string `yaml:"mode"`
+}
+
+// activeWatermark is the watermark of the profile in use, nil when it has
+// none.
+var activeWatermark *watermark
+
+var slugInvalid = regexp.MustCompile(`[^a-z0-9]+`)
+
+// watermarkPanelHeight is the height of the text panel added on top of
+// watermarked dashboards, in grid units.
+const watermarkPanelHeight = 2
+
+func (w watermark) validate() error {
+	if w.Text == "" {
+		return fmt.Errorf("watermark has no text")
+	}
+	switch w.Mode {
+	case "", "title", "panel", "both":
+		return nil
+	}
+	return fmt.Errorf("watermark mode must be 'title', 'panel' or 'both', not %q", w.Mode)
+}
+
+func (w watermark) titleSuffix() string {
+	return " [" + w.Text + "]"
+}
+
+func (w watermark) panelContent() string {
+	return fmt.Sprintf(`<div style="text-align:center;font-size:20px;font-weight:bold;color:#f2495c">%s</div>`, w.Text)
+}
+
+// useWatermark makes the watermark of a profile the active one.
+func useWatermark(p profile) error {
+	activeWatermark = nil
+	if p.Watermark == nil {
+		return nil
+	}
+	if err := p.Watermark.validate(); err != nil {
+		return err
+	}
+	activeWatermark = p.Watermark
+	return nil
+}
+
+// watermarkDashboard adds the active watermark to a dashboard about to be
+// pushed: a suffix to its title, a text panel across its top, or both. A
+// dashboard already watermarked is left unchanged.
+func watermarkDashboard(data []byte) ([]byte, error) {
+	w := activeWatermark
+	if w == nil {
+		return data, nil
+	}
+	var dashboard map[string]interface{}
+	if err := json.Unmarshal(data, &dashboard); err != nil {
+		return nil, err
+	}
+
+	if w.Mode != "panel" {
+		if title, _ := dashboard["title"].(string); !strings.HasSuffix(title, w.titleSuffix()) {
+			dashboard["title"] = title + w.titleSuffix()
+		}
+	}
+	if w.Mode == "panel" || w.Mode == "both" {
+		if watermarkPanelIndex(dashboard) < 0 {
+			addWatermarkPanel(dashboard, w)
+		}
+	}
+	return json.Marshal(dashboard)
+}
+
+// removeWatermark strips the active watermark from a pulled dashboard, so
+// that it doesn't travel to production with the files.
+func removeWatermark(dashboard map[string]interface{}) {
+	w := activeWatermark
+	if w == nil {
+		return
+	}
+	if title, _ := dashboard["title"].(string); strings.HasSuffix(title, w.titleSuffix()) {
+		dashboard["title"] = strings.TrimSuffix(title, w.titleSuffix())
+	}
+	i := watermarkPanelIndex(dashboard)
+	if i < 0 {
+		return
+	}
+	panels, _ := dashboard["panels"].([]interface{})
+	dashboard["panels"] = append(panels[:i], panels[i+1:]...)
+	shiftPanels(dashboard, -watermarkPanelHeight)
+}
+
+// unwatermarkedSlug returns the slug of a pulled dashboard without the part
+// Grafana derived from the title suffix of the active watermark.
+func unwatermarkedSlug(slug string) string {
+	if activeWatermark == nil || activeWatermark.Mode == "panel" {
+		return slug
+	}
+	suffix := strings.Trim(slugInvalid.ReplaceAllString(strings.ToLower(activeWatermark.Text), "-"), "-")
+	return strings.TrimSuffix(slug, "-"+suffix)
+}
+
+// watermarkPanelIndex returns the index of the watermark panel among the
+// top-level panels of a dashboard, or -1.
+func watermarkPanelIndex(dashboard map[string]interface{}) int {
+	panels, _ := dashboard["panels"].([]interface{})
+	for i, p := range panels {
+		panel, _ := p.(map[string]interface{})
+		options, _ := panel["options"].(map[string]interface{})
+		if panel["type"] == "text" && options["content"] == activeWatermark.panelContent() {
+			return i
+		}
+	}
+	return -1
+}
+
+// addWatermarkPanel inserts a full-width text panel at the top of a
+// dashboard, moving every other panel down.
+func addWatermarkPanel(dashboard map[string]interface{}, w *watermark) {
+	maxID := 0.0
+	for _, panel := range dashboardPanels(dashboard) {
+		if id, ok := panel["id"].(float64); ok && id > maxID {
+			maxID = id
+		}
+	}
+	shiftPanels(dashboard, watermarkPanelHeight)
+
+	panel := map[string]interface{}{
+		"id":          maxID + 1,
+		"type":        "text",
+		"title":       "",
+		"transparent": true,
+		"gridPos":     map[string]interface{}{"x": 0, "y": 0, "w": 24, "h": watermarkPanelHeight},
+		"options":     map[string]interface{}{"mode": "html", "content": w.panelContent()},
+	}
+	panels, _ := dashboard["panels"].([]interface{})
+	dashboard["panels"] = append([]interface{}{panel}, panels...)
+}
+
+// shiftPanels moves every panel of a dashboard down by dy grid units.
+func shiftPanels(dashboard map[string]interface{}, dy float64) {
+	for _, panel := range dashboardPanels(dashboard) {
+		if pos, ok := panel["gridPos"].(map[string]interface{}); ok {
+			y, _ := pos["y"].(float64)
+			pos["y"] = y + dy
+		}
+	}
+}
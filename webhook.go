@@ -0,0 +1,166 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+var (
+	webhookLog       string
+	webhookToken     string
+	reconcileCommand string
+)
+
+// changeEvent records a dashboard change reported to the webhook.
+type changeEvent struct {
+	Time      time.Time `json:"time"`
+	UID       string    `json:"uid"`
+	Title     string    `json:"title,omitempty"`
+	Version   int       `json:"version,omitempty"`
+	UpdatedBy string    `json:"updatedBy,omitempty"`
+	Error     string    `json:"error,omitempty"`
+}
+
+var webhookMu sync.Mutex
+
+// serveWebhook receives "dashboard saved" notifications, either from a
+// Grafana webhook contact point (alerts carrying a dashboardUID label or
+// annotation) or from any JSON payload with a dashboardUid field. Each
+// reported dashboard is looked up to record who changed it, appended to
+// -webhook-log and handed to -reconcile-command when configured.
+func serveWebhook(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !webhookAuthorized(r) {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	uids, err := webhookDashboardUIDs(body)
+	if err != nil {
+		http.Error(w, "invalid payload: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	for _, uid := range uids {
+		event := describeChange(r.Context(), uid)
+		if err := recordChange(event); err != nil {
+			log.Printf("Error recording change of dashboard %s: %v", uid, err)
+		}
+		if reconcileCommand != "" {
+			go runReconcile(event)
+		}
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// webhookAuthorized checks the token of a webhook call, given as bearer token
+// or token query parameter. Calls are refused when no token is set.
+func webhookAuthorized(r *http.Request) bool {
+	if webhookToken == "" {
+		return false
+	}
+	bearer := subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), []byte("Bearer "+webhookToken)) == 1
+	query := subtle.ConstantTimeCompare([]byte(r.URL.Query().Get("token")), []byte(webhookToken)) == 1
+	return bearer || query
+}
+
+// webhookDashboardUIDs extracts the dashboard UIDs referenced by a payload.
+func webhookDashboardUIDs(body []byte) ([]string, error) {
+	var payload struct {
+		DashboardUID string `json:"dashboardUid"`
+		Alerts       []struct {
+			Labels      map[string]string `json:"labels"`
+			Annotations map[string]string `json:"annotations"`
+		} `json:"alerts"`
+	}
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return nil, err
+	}
+
+	seen := map[string]bool{}
+	var uids []string
+	add := func(uid string) {
+		if uid != "" && !seen[uid] {
+			seen[uid] = true
+			uids = append(uids, uid)
+		}
+	}
+	add(payload.DashboardUID)
+	for _, a := range payload.Alerts {
+		add(a.Labels["dashboardUID"])
+		add(a.Annotations["dashboardUID"])
+	}
+	return uids, nil
+}
+
+// describeChange looks up the current version of a dashboard and who saved it.
+func describeChange(ctx context.Context, uid string) changeEvent {
+	event := changeEvent{Time: time.Now().UTC(), UID: uid}
+	raw, meta, err := client.GetRawDashboardByUID(ctx, uid)
+	if err != nil {
+		event.Error = describeError(err)
+		return event
+	}
+
+	var dashboard struct {
+		Title string `json:"title"`
+	}
+	if err := json.Unmarshal(raw, &dashboard); err != nil {
+		event.Error = err.Error()
+	}
+	event.Title = dashboard.Title
+	event.Version = meta.Version
+	event.UpdatedBy = meta.UpdatedBy
+	return event
+}
+
+func recordChange(event changeEvent) error {
+	log.Printf("Dashboard changed: %s (%s) version %d by %s", event.Title, event.UID, event.Version, event.UpdatedBy)
+	if webhookLog == "" {
+		return nil
+	}
+
+	webhookMu.Lock()
+	defer webhookMu.Unlock()
+	f, err := os.OpenFile(webhookLog, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return json.NewEncoder(f).Encode(event)
+}
+
+// runReconcile hands a change to the reconcile command, for example a script
+// that pulls the dashboard and opens a pull request. The change is passed in
+// GRAFANA_SYNC_* environment variables.
+func runReconcile(event changeEvent) {
+	cmd := shellCommand(context.Background(), reconcileCommand)
+	cmd.Env = append(os.Environ(),
+		"GRAFANA_SYNC_DASHBOARD_UID="+event.UID,
+		"GRAFANA_SYNC_DASHBOARD_TITLE="+event.Title,
+		fmt.Sprintf("GRAFANA_SYNC_DASHBOARD_VERSION=%d", event.Version),
+		"GRAFANA_SYNC_UPDATED_BY="+event.UpdatedBy,
+	)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		log.Printf("Reconcile command failed for dashboard %s: %v\n%s", event.UID, err, out)
+		return
+	}
+	log.Printf("Reconcile command finished for dashboard %s", event.UID)
+}